@@ -8,14 +8,30 @@ import (
 	"github.com/script-development/RT-CV/controller/ctx"
 	"github.com/script-development/RT-CV/db"
 	"github.com/script-development/RT-CV/helpers/auth"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/matchesProcessor"
+	"github.com/script-development/RT-CV/helpers/profilesCache"
+	"github.com/script-development/RT-CV/helpers/webhooks"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // InsertData adds the profiles to every route
-func InsertData(dbConn db.Connection) fiber.Handler {
+func InsertData(
+	dbConn db.Connection,
+	processor *matchesProcessor.Processor,
+	webhookSender *webhooks.Sender,
+	emailService *emailservice.Service,
+	cache *profilesCache.Cache,
+) fiber.Handler {
 	requestContext := ctx.SetDbConn(context.Background(), dbConn)
 
-	requestContext = ctx.ResetMatcherProfilesCache(requestContext)
+	requestContext = ctx.SetMatchesProcessor(requestContext, processor)
+
+	requestContext = ctx.SetWebhookSender(requestContext, webhookSender)
+
+	requestContext = ctx.SetEmailService(requestContext, emailService)
+
+	requestContext = ctx.SetProfilesCache(requestContext, cache)
 
 	requestContext = ctx.SetAuth(requestContext, auth.NewHelper(dbConn))
 
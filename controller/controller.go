@@ -84,9 +84,32 @@ func Routes(app *fiber.App, appVersion string, testing bool) {
 				b.Get(``, routeGetProfile, requiresAuth(models.APIKeyRoleInformationObtainer))
 				b.Put(``, routeModifyProfile, requiresAuth(models.APIKeyRoleController))
 				b.Delete(``, routeDeleteProfile, requiresAuth(models.APIKeyRoleController))
+				b.Post(`/explainMatch`, routeExplainProfileMatch, requiresAuth(models.APIKeyRoleDashboard))
 			}, middlewareBindProfile())
 		}, requiresAuth(0))
 
+		b.Group(`/synonymSets`, func(b *routeBuilder.Router) {
+			b.Get(``, routeGetSynonymSets, requiresAuth(models.APIKeyRoleInformationObtainer|models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			b.Post(``, routeCreateSynonymSet, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			b.Group(`/:synonymSet`, func(b *routeBuilder.Router) {
+				b.Get(``, routeGetSynonymSet, requiresAuth(models.APIKeyRoleInformationObtainer|models.APIKeyRoleController|models.APIKeyRoleDashboard))
+				b.Put(``, routeUpdateSynonymSet, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+				b.Delete(``, routeDeleteSynonymSet, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			})
+		}, requiresAuth(0))
+
+		b.Group(`/emailTemplates`, func(b *routeBuilder.Router) {
+			b.Get(``, routeGetEmailTemplates, requiresAuth(models.APIKeyRoleInformationObtainer|models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			b.Post(``, routeCreateEmailTemplate, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			b.Post(`/preview`, routePreviewEmailTemplate, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			b.Group(`/:emailTemplate`, func(b *routeBuilder.Router) {
+				b.Get(``, routeGetEmailTemplate, requiresAuth(models.APIKeyRoleInformationObtainer|models.APIKeyRoleController|models.APIKeyRoleDashboard))
+				b.Get(`/preview`, routePreviewStoredEmailTemplate, requiresAuth(models.APIKeyRoleInformationObtainer|models.APIKeyRoleController|models.APIKeyRoleDashboard))
+				b.Put(``, routeUpdateEmailTemplate, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+				b.Delete(``, routeDeleteEmailTemplate, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			})
+		}, requiresAuth(0))
+
 		b.Group(`/keys`, func(b *routeBuilder.Router) {
 			b.Get(``, routeGetKeys)
 			b.Get(`/scrapers`, routeGetScraperKeys)
@@ -98,6 +121,22 @@ func Routes(app *fiber.App, appVersion string, testing bool) {
 			}, middlewareBindKey())
 		}, requiresAuth(models.APIKeyRoleDashboard))
 
+		b.Group(`/matchJobs`, func(b *routeBuilder.Router) {
+			b.Get(``, routeGetMatchJobsStats)
+			b.Get(`/failed`, routeGetFailedMatchJobs)
+		}, requiresAuth(models.APIKeyRoleDashboard))
+
+		b.Group(`/webhookDeliveries`, func(b *routeBuilder.Router) {
+			b.Get(`/profile/:profile`, routeGetWebhookDeliveries, middlewareBindProfile())
+			b.Get(``, routeGetWebhookDeliveries)
+		}, requiresAuth(models.APIKeyRoleInformationObtainer|models.APIKeyRoleDashboard))
+
+		b.Group(`/emailDeliveries`, func(b *routeBuilder.Router) {
+			b.Get(``, routeGetEmailDeliveries, requiresAuth(models.APIKeyRoleInformationObtainer|models.APIKeyRoleDashboard))
+			b.Post(`/retryFailed`, routeRetryFailedEmailDeliveries, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+			b.Post(`/:emailDelivery/retry`, routeRetryEmailDelivery, requiresAuth(models.APIKeyRoleController|models.APIKeyRoleDashboard))
+		}, requiresAuth(0))
+
 		b.Post(
 			`/exampleAttachmentPdf`,
 			routeGetExampleAttachmentPDF,
@@ -6,20 +6,28 @@ import (
 	"io/ioutil"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/script-development/RT-CV/db/testingdb"
 	"github.com/script-development/RT-CV/helpers/auth"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/matchesProcessor"
+	"github.com/script-development/RT-CV/helpers/profilesCache"
 	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/helpers/webhooks"
 	"github.com/script-development/RT-CV/mock"
 	. "github.com/stretchr/testify/assert"
 )
 
 type testingRouter struct {
-	t          *testing.T
-	fiber      *fiber.App
-	db         *testingdb.TestConnection
-	authHeader string
+	t         *testing.T
+	fiber     *fiber.App
+	db        *testingdb.TestConnection
+	processor *matchesProcessor.Processor
+	// emailTransport contains the emails sent by the routes
+	emailTransport *emailservice.MemoryTransport
+	authHeader     string
 }
 
 func newTestingRouter(t *testing.T) *testingRouter {
@@ -28,14 +36,21 @@ func newTestingRouter(t *testing.T) *testingRouter {
 	app := fiber.New(fiber.Config{
 		ErrorHandler: FiberErrorHandler,
 	})
-	app.Use(InsertData(db))
+	webhookSender := webhooks.NewSender(db, webhooks.Options{SecretsKey: "testing-webhook-secrets-key"})
+	emailTransport := emailservice.NewMemoryTransport()
+	emailService := emailservice.NewService(db, emailTransport, emailservice.Options{RetryDelay: time.Millisecond})
+	processor := matchesProcessor.NewProcessor(db, matchesProcessor.Options{}, webhookSender, emailService)
+	processor.Start()
+	app.Use(InsertData(db, processor, webhookSender, emailService, profilesCache.NewCache(db, profilesCache.DefaultTTL)))
 	Routes(app, "TESTING", true)
 
 	return &testingRouter{
-		t:          t,
-		fiber:      app,
-		db:         db,
-		authHeader: auth.GenAuthHeaderKey(mock.Key1.ID.Hex(), mock.Key1.Key),
+		t:              t,
+		fiber:          app,
+		db:             db,
+		processor:      processor,
+		emailTransport: emailTransport,
+		authHeader:     auth.GenAuthHeaderKey(mock.Key1.ID.Hex(), mock.Key1.Key),
 	}
 }
 
@@ -94,6 +109,16 @@ func TestCannotAccessCriticalRoutesWithoutCredentials(t *testing.T) {
 			routeBuilder.Get,
 			"/api/v1/keys",
 		},
+		{
+			"match jobs",
+			routeBuilder.Get,
+			"/api/v1/matchJobs",
+		},
+		{
+			"webhook deliveries",
+			routeBuilder.Get,
+			"/api/v1/webhookDeliveries",
+		},
 	}
 
 	app := newTestingRouter(t)
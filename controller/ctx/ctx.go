@@ -2,12 +2,15 @@ package ctx
 
 import (
 	"context"
-	"time"
 
 	"github.com/apex/log"
 	"github.com/gofiber/fiber/v2"
 	"github.com/script-development/RT-CV/db"
 	"github.com/script-development/RT-CV/helpers/auth"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/matchesProcessor"
+	"github.com/script-development/RT-CV/helpers/profilesCache"
+	"github.com/script-development/RT-CV/helpers/webhooks"
 	"github.com/script-development/RT-CV/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -25,16 +28,22 @@ type loggerCtx uint8
 type dbConnCtx uint8
 type requestIDCtx uint8
 type profilesCacheCtx uint8
+type matchesProcessorCtx uint8
+type webhookSenderCtx uint8
+type emailServiceCtx uint8
 
 const (
-	profileCtxKey       = profileCtx(0)
-	authCtxKey          = authCtx(0)
-	keyCtxKey           = keyCtx(0)
-	keyFromParamCtxKey  = keyFromParamCtx(0)
-	loggerCtxKey        = loggerCtx(0)
-	dbConnCtxKey        = dbConnCtx(0)
-	requestIDCtxKey     = requestIDCtx(0)
-	profilesCacheCtxKey = profilesCacheCtx(0)
+	profileCtxKey          = profileCtx(0)
+	authCtxKey             = authCtx(0)
+	keyCtxKey              = keyCtx(0)
+	keyFromParamCtxKey     = keyFromParamCtx(0)
+	loggerCtxKey           = loggerCtx(0)
+	dbConnCtxKey           = dbConnCtx(0)
+	requestIDCtxKey        = requestIDCtx(0)
+	profilesCacheCtxKey    = profilesCacheCtx(0)
+	matchesProcessorCtxKey = matchesProcessorCtx(0)
+	webhookSenderCtxKey    = webhookSenderCtx(0)
+	emailServiceCtxKey     = emailServiceCtx(0)
 )
 
 // getCtxValue returns a value from the context
@@ -115,18 +124,42 @@ func SetDbConn(ctx context.Context, value db.Connection) context.Context {
 	return context.WithValue(ctx, dbConnCtxKey, value)
 }
 
-// MatcherProfilesCache contains the matcher profiles cache
-type MatcherProfilesCache struct {
-	InsertionTime time.Time
-	Profiles      []*models.Profile
+// GetProfilesCache returns the cache with the profiles used by the matcher
+func GetProfilesCache(c *fiber.Ctx) *profilesCache.Cache {
+	return getCtxValue(c, profilesCacheCtxKey).(*profilesCache.Cache)
 }
 
-// GetMatcherProfilesCache returns the cached profiles used by the matcher
-func GetMatcherProfilesCache(c *fiber.Ctx) *MatcherProfilesCache {
-	return getCtxValue(c, profilesCacheCtxKey).(*MatcherProfilesCache)
+// SetProfilesCache sets the profiles cache
+func SetProfilesCache(ctx context.Context, value *profilesCache.Cache) context.Context {
+	return context.WithValue(ctx, profilesCacheCtxKey, value)
 }
 
-// ResetMatcherProfilesCache sets the profiles cache to an empty object
-func ResetMatcherProfilesCache(ctx context.Context) context.Context {
-	return context.WithValue(ctx, profilesCacheCtxKey, &MatcherProfilesCache{})
+// GetMatchesProcessor returns the processor that handles the matches in the background
+func GetMatchesProcessor(c *fiber.Ctx) *matchesProcessor.Processor {
+	return getCtxValue(c, matchesProcessorCtxKey).(*matchesProcessor.Processor)
+}
+
+// SetMatchesProcessor sets the matches processor
+func SetMatchesProcessor(ctx context.Context, value *matchesProcessor.Processor) context.Context {
+	return context.WithValue(ctx, matchesProcessorCtxKey, value)
+}
+
+// GetWebhookSender returns the sender that delivers the matches to the httpCall addresses of profiles
+func GetWebhookSender(c *fiber.Ctx) *webhooks.Sender {
+	return getCtxValue(c, webhookSenderCtxKey).(*webhooks.Sender)
+}
+
+// SetWebhookSender sets the webhook sender
+func SetWebhookSender(ctx context.Context, value *webhooks.Sender) context.Context {
+	return context.WithValue(ctx, webhookSenderCtxKey, value)
+}
+
+// GetEmailService returns the service that sends the emails of the matches
+func GetEmailService(c *fiber.Ctx) *emailservice.Service {
+	return getCtxValue(c, emailServiceCtxKey).(*emailservice.Service)
+}
+
+// SetEmailService sets the email service
+func SetEmailService(ctx context.Context, value *emailservice.Service) context.Context {
+	return context.WithValue(ctx, emailServiceCtxKey, value)
 }
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/script-development/RT-CV/controller/ctx"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var routeGetEmailDeliveries = routeBuilder.R{
+	Description: `get the log of emails sent to the email addresses of profiles, the newest first.
+the optional status query param can be used to only get the deliveries with a specific status (queued, sent or failed).
+the optional limit (default 100, max 1000) and skip query params can be used to get the next pages of deliveries`,
+	Res: []models.EmailDelivery{},
+	Fn: func(c *fiber.Ctx) error {
+		var status *models.EmailDeliveryStatus
+		if statusQuery := c.Query(`status`); statusQuery != "" {
+			parsedStatus := models.EmailDeliveryStatus(statusQuery)
+			if !parsedStatus.Valid() {
+				return ErrorRes(c, fiber.StatusBadRequest, errors.New("unknown status, expected queued, sent or failed"))
+			}
+			status = &parsedStatus
+		}
+
+		page, err := parsePageQuery(c)
+		if err != nil {
+			return ErrorRes(c, fiber.StatusBadRequest, err)
+		}
+
+		deliveries, err := models.GetEmailDeliveries(ctx.GetDbConn(c), status, page)
+		if err != nil {
+			return err
+		}
+		return c.JSON(deliveries)
+	},
+}
+
+var routeRetryEmailDelivery = routeBuilder.R{
+	Description: "send a failed email again, the returned delivery is queued and is updated in the background",
+	Res:         models.EmailDelivery{},
+	Fn: func(c *fiber.Ctx) error {
+		deliveryID, err := primitive.ObjectIDFromHex(c.Params(`emailDelivery`))
+		if err != nil {
+			return err
+		}
+		delivery, err := models.GetEmailDelivery(ctx.GetDbConn(c), deliveryID)
+		if err != nil {
+			return err
+		}
+
+		err = ctx.GetEmailService(c).Retry(delivery)
+		if errors.Is(err, emailservice.ErrNotRetryable) {
+			return ErrorRes(c, fiber.StatusBadRequest, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		delivery.Status = models.EmailDeliveryStatusQueued
+		delivery.LastError = ""
+		return c.JSON(delivery)
+	},
+}
+
+// RetryFailedEmailDeliveriesRes is the response of routeRetryFailedEmailDeliveries
+type RetryFailedEmailDeliveriesRes struct {
+	Retried int `json:"retried" description:"the amount of failed deliveries that are queued again"`
+}
+
+var routeRetryFailedEmailDeliveries = routeBuilder.R{
+	Description: "send all failed emails again of which the message is still known",
+	Res:         RetryFailedEmailDeliveriesRes{},
+	Fn: func(c *fiber.Ctx) error {
+		status := models.EmailDeliveryStatusFailed
+		deliveries, err := models.GetEmailDeliveries(ctx.GetDbConn(c), &status, models.Page{})
+		if err != nil {
+			return err
+		}
+
+		emailService := ctx.GetEmailService(c)
+		res := RetryFailedEmailDeliveriesRes{}
+		for _, delivery := range deliveries {
+			err = emailService.Retry(delivery)
+			if errors.Is(err, emailservice.ErrNotRetryable) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			res.Retried++
+		}
+		return c.JSON(res)
+	},
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestRouteEmailDeliveries(t *testing.T) {
+	app := newTestingRouter(t)
+
+	now := time.Now()
+	newDelivery := func(status models.EmailDeliveryStatus, withMessage bool, createdAt time.Time) *models.EmailDelivery {
+		delivery := &models.EmailDelivery{
+			M:         db.NewM(),
+			To:        []string{"a@example.com"},
+			Subject:   "subject",
+			Status:    status,
+			Attempts:  1,
+			CreatedAt: jsonHelpers.RFC3339Nano(createdAt),
+			UpdatedAt: jsonHelpers.RFC3339Nano(createdAt),
+		}
+		if withMessage {
+			delivery.Message = &models.EmailMessage{To: delivery.To, Subject: delivery.Subject, HTML: "<p>body</p>"}
+		}
+		NoError(t, app.db.Insert(delivery))
+		return delivery
+	}
+	sent := newDelivery(models.EmailDeliveryStatusSent, false, now.Add(-time.Hour))
+	failed := newDelivery(models.EmailDeliveryStatusFailed, true, now)
+	otherFailed := newDelivery(models.EmailDeliveryStatusFailed, true, now.Add(-time.Minute))
+
+	getDeliveries := func(route string) []string {
+		res, body := app.MakeRequest(routeBuilder.Get, route, TestReqOpts{})
+		Equal(t, 200, res.StatusCode, string(body))
+		deliveries := []models.EmailDelivery{}
+		NoError(t, json.Unmarshal(body, &deliveries))
+		ids := []string{}
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID.Hex())
+		}
+		return ids
+	}
+
+	// All deliveries should be returned the newest first
+	Equal(
+		t,
+		[]string{failed.ID.Hex(), otherFailed.ID.Hex(), sent.ID.Hex()},
+		getDeliveries(`/api/v1/emailDeliveries`),
+	)
+	Equal(
+		t,
+		[]string{failed.ID.Hex(), otherFailed.ID.Hex()},
+		getDeliveries(`/api/v1/emailDeliveries?status=failed`),
+	)
+
+	// The deliveries can be requested in pages
+	Equal(
+		t,
+		[]string{otherFailed.ID.Hex()},
+		getDeliveries(`/api/v1/emailDeliveries?limit=1&skip=1`),
+	)
+
+	res, body := app.MakeRequest(routeBuilder.Get, `/api/v1/emailDeliveries?status=unknown`, TestReqOpts{})
+	Equal(t, 400, res.StatusCode, string(body))
+	res, body = app.MakeRequest(routeBuilder.Get, `/api/v1/emailDeliveries?limit=0`, TestReqOpts{})
+	Equal(t, 400, res.StatusCode, string(body))
+
+	// Sent deliveries can't be retried
+	res, body = app.MakeRequest(routeBuilder.Post, `/api/v1/emailDeliveries/`+sent.ID.Hex()+`/retry`, TestReqOpts{})
+	Equal(t, 400, res.StatusCode, string(body))
+
+	res, body = app.MakeRequest(routeBuilder.Post, `/api/v1/emailDeliveries/`+failed.ID.Hex()+`/retry`, TestReqOpts{})
+	Equal(t, 200, res.StatusCode, string(body))
+	delivery := models.EmailDelivery{}
+	NoError(t, json.Unmarshal(body, &delivery))
+	Equal(t, models.EmailDeliveryStatusQueued, delivery.Status)
+
+	res, body = app.MakeRequest(routeBuilder.Post, `/api/v1/emailDeliveries/retryFailed`, TestReqOpts{})
+	Equal(t, 200, res.StatusCode, string(body))
+	retryRes := RetryFailedEmailDeliveriesRes{}
+	NoError(t, json.Unmarshal(body, &retryRes))
+	// The first failed delivery is already retried so only the other one is queued
+	Equal(t, 1, retryRes.Retried)
+
+	// Wait for the retried emails to be sent
+	for i := 0; i < 100 && len(app.emailTransport.Sent()) < 2; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	Len(t, app.emailTransport.Sent(), 2)
+	Empty(t, getDeliveries(`/api/v1/emailDeliveries?status=failed`))
+}
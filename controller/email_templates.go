@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/script-development/RT-CV/controller/ctx"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/locale"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var routeGetEmailTemplates = routeBuilder.R{
+	Description: "get all custom email templates",
+	Res:         []models.EmailTemplate{},
+	Fn: func(c *fiber.Ctx) error {
+		templates, err := models.GetEmailTemplates(ctx.GetDbConn(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(templates)
+	},
+}
+
+var routeGetEmailTemplate = routeBuilder.R{
+	Description: "get a custom email template based on it's ID",
+	Res:         models.EmailTemplate{},
+	Fn: func(c *fiber.Ctx) error {
+		emailTemplate, err := getEmailTemplateFromParam(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(emailTemplate)
+	},
+}
+
+// EmailTemplateModifyCreateData are the fields that can be set when creating or modifying an email template
+// When modifying all the fields are optional and if null are not updated
+type EmailTemplateModifyCreateData struct {
+	Name        *string                   `json:"name"`
+	Kind        *models.EmailTemplateKind `json:"kind" description:"match or digest"`
+	Subject     *string                   `json:"subject" description:"text/template of the subject, if empty the default subject of the locale is used"`
+	HTML        *string                   `json:"html" description:"html/template of the email body"`
+	UpdateKeyID *struct {
+		KeyID *primitive.ObjectID `json:"keyId"`
+	} `json:"updateKeyId" description:"set the key this template is the default of, if keyId is null the template is only used by the profiles referring to it"`
+}
+
+// apply applies the data to the email template
+func (data EmailTemplateModifyCreateData) apply(emailTemplate *models.EmailTemplate) {
+	if data.Name != nil {
+		emailTemplate.Name = *data.Name
+	}
+	if data.Kind != nil {
+		emailTemplate.Kind = *data.Kind
+	}
+	if data.Subject != nil {
+		emailTemplate.Subject = *data.Subject
+	}
+	if data.HTML != nil {
+		emailTemplate.HTML = *data.HTML
+	}
+	if data.UpdateKeyID != nil {
+		emailTemplate.KeyID = data.UpdateKeyID.KeyID
+	}
+}
+
+// saveEmailTemplate validates and stores an email template
+func saveEmailTemplate(c *fiber.Ctx, emailTemplate *models.EmailTemplate, isNew bool) error {
+	dbConn := ctx.GetDbConn(c)
+
+	otherTemplates, err := models.GetEmailTemplates(dbConn)
+	if err != nil {
+		return err
+	}
+	err = emailTemplate.Validate(otherTemplates)
+	if err != nil {
+		return ErrorRes(c, fiber.StatusBadRequest, err)
+	}
+	if emailTemplate.KeyID != nil {
+		err = models.CheckAPIKeysExists(dbConn, []primitive.ObjectID{*emailTemplate.KeyID})
+		if err != nil {
+			return ErrorRes(c, fiber.StatusBadRequest, err)
+		}
+	}
+
+	if isNew {
+		err = dbConn.Insert(emailTemplate)
+	} else {
+		err = dbConn.UpdateByID(emailTemplate)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(emailTemplate)
+}
+
+var routeCreateEmailTemplate = routeBuilder.R{
+	Description: "create a custom email template, the template is parse checked and rendered against an example CV before it's saved",
+	Body:        EmailTemplateModifyCreateData{},
+	Res:         models.EmailTemplate{},
+	Fn: func(c *fiber.Ctx) error {
+		body := EmailTemplateModifyCreateData{}
+		err := c.BodyParser(&body)
+		if err != nil {
+			return err
+		}
+
+		if body.Kind == nil {
+			return errors.New("kind should be set")
+		}
+
+		emailTemplate := &models.EmailTemplate{M: db.NewM()}
+		body.apply(emailTemplate)
+		return saveEmailTemplate(c, emailTemplate, true)
+	},
+}
+
+var routeUpdateEmailTemplate = routeBuilder.R{
+	Description: "update a custom email template, all the body fields are optional",
+	Body:        EmailTemplateModifyCreateData{},
+	Res:         models.EmailTemplate{},
+	Fn: func(c *fiber.Ctx) error {
+		emailTemplate, err := getEmailTemplateFromParam(c)
+		if err != nil {
+			return err
+		}
+
+		body := EmailTemplateModifyCreateData{}
+		err = c.BodyParser(&body)
+		if err != nil {
+			return err
+		}
+
+		body.apply(&emailTemplate)
+		return saveEmailTemplate(c, &emailTemplate, false)
+	},
+}
+
+var routeDeleteEmailTemplate = routeBuilder.R{
+	Description: "delete a custom email template, the profiles using this template fall back to the template of the key or the built in template",
+	Res:         models.EmailTemplate{},
+	Fn: func(c *fiber.Ctx) error {
+		emailTemplate, err := getEmailTemplateFromParam(c)
+		if err != nil {
+			return err
+		}
+
+		dbConn := ctx.GetDbConn(c)
+		field := "matchEmailTemplateId"
+		if emailTemplate.Kind == models.EmailTemplateKindDigest {
+			field = "digestEmailTemplateId"
+		}
+		profiles := []models.Profile{}
+		err = dbConn.Find(&models.Profile{}, &profiles, bson.M{field: emailTemplate.ID})
+		if err != nil {
+			return err
+		}
+		for idx := range profiles {
+			if emailTemplate.Kind == models.EmailTemplateKindDigest {
+				profiles[idx].DigestEmailTemplateID = nil
+			} else {
+				profiles[idx].MatchEmailTemplateID = nil
+			}
+			err = dbConn.UpdateByID(&profiles[idx])
+			if err != nil {
+				return err
+			}
+		}
+
+		err = dbConn.DeleteByID(&emailTemplate)
+		if err != nil {
+			return err
+		}
+
+		ctx.GetProfilesCache(c).Invalidate()
+
+		return c.JSON(emailTemplate)
+	},
+}
+
+// EmailTemplatePreviewBody is the request body of routePreviewEmailTemplate
+type EmailTemplatePreviewBody struct {
+	Kind    models.EmailTemplateKind `json:"kind" description:"match or digest"`
+	Locale  locale.Locale            `json:"locale" description:"the locale to render the template in, nl or en. If empty nl is used"`
+	Subject string                   `json:"subject" description:"text/template of the subject, if empty the default subject of the locale is used"`
+	HTML    string                   `json:"html" description:"html/template of the email body, if empty the built in template of the kind is rendered"`
+}
+
+var routePreviewEmailTemplate = routeBuilder.R{
+	Description: "Render an email template against an example CV without saving it.\n\n" +
+		"Match templates have the fields .Profile, .ProfileIDHex, .Cv, .MatchText, .LogoURL and .Domain, " +
+		"digest templates have .LogoURL and .Matches with per match .ProfileName, .Cv, .MatchText and .Domain. " +
+		`Messages of the locale catalog can be used with {{ t "messageKey" }} and the locale with {{ locale }}`,
+	Body: EmailTemplatePreviewBody{},
+	Res:  models.EmailContent{},
+	Fn: func(c *fiber.Ctx) error {
+		body := EmailTemplatePreviewBody{}
+		err := c.BodyParser(&body)
+		if err != nil {
+			return err
+		}
+		if !body.Kind.Valid() {
+			return ErrorRes(c, fiber.StatusBadRequest, errors.New(`kind: must be "match" or "digest"`))
+		}
+		if !body.Locale.Valid() {
+			return ErrorRes(c, fiber.StatusBadRequest, errors.New("locale: unknown locale"))
+		}
+
+		emailTemplate := models.EmailTemplate{Kind: body.Kind, Subject: body.Subject, HTML: body.HTML}
+		content, err := emailTemplate.Preview(body.Locale)
+		if err != nil {
+			return ErrorRes(c, fiber.StatusBadRequest, err)
+		}
+		return c.JSON(content)
+	},
+}
+
+var routePreviewStoredEmailTemplate = routeBuilder.R{
+	Description: "Render a stored email template against an example CV, the locale can be set using the locale query parameter",
+	Res:         models.EmailContent{},
+	Fn: func(c *fiber.Ctx) error {
+		emailTemplate, err := getEmailTemplateFromParam(c)
+		if err != nil {
+			return err
+		}
+
+		l := locale.Locale(c.Query(`locale`))
+		if !l.Valid() {
+			return ErrorRes(c, fiber.StatusBadRequest, errors.New("locale: unknown locale"))
+		}
+
+		content, err := emailTemplate.Preview(l)
+		if err != nil {
+			return ErrorRes(c, fiber.StatusBadRequest, err)
+		}
+		return c.JSON(content)
+	},
+}
+
+func getEmailTemplateFromParam(c *fiber.Ctx) (models.EmailTemplate, error) {
+	templateID, err := primitive.ObjectIDFromHex(c.Params(`emailTemplate`))
+	if err != nil {
+		return models.EmailTemplate{}, err
+	}
+	return models.GetEmailTemplate(ctx.GetDbConn(c), templateID)
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/mock"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestEmailTemplateRoutes(t *testing.T) {
+	app := newTestingRouter(t)
+
+	// The mock data contains no email templates
+	_, res := app.MakeRequest(routeBuilder.Get, `/api/v1/emailTemplates`, TestReqOpts{})
+	Equal(t, "[]", string(res))
+
+	// Create a template
+	httpRes, res := app.MakeRequest(routeBuilder.Post, `/api/v1/emailTemplates`, TestReqOpts{
+		Body: []byte(`{"name": "custom", "kind": "match", "subject": "Match for {{ .Profile.Name }}", "html": "<p>{{ t \"emailCandidateName\" }}: {{ .Cv.PersonalDetails.FirstName }}</p>"}`),
+	})
+	Equal(t, 200, httpRes.StatusCode, string(res))
+	emailTemplate := models.EmailTemplate{}
+	NoError(t, json.Unmarshal(res, &emailTemplate))
+	Equal(t, models.EmailTemplateKindMatch, emailTemplate.Kind)
+
+	// Invalid templates should be rejected
+	invalidBodies := []string{
+		`{"name": "custom", "html": "<p></p>"}`,
+		`{"name": "custom", "kind": "weekly", "html": "<p></p>"}`,
+		`{"kind": "match", "html": "<p></p>"}`,
+		`{"name": "custom", "kind": "match", "html": "{{ if .Profile.Name }}"}`,
+		`{"name": "custom", "kind": "match", "html": "{{ .DoesNotExist }}"}`,
+		`{"name": "custom", "kind": "match", "subject": "{{ .Profile.Name", "html": "<p></p>"}`,
+		`{"name": "custom", "kind": "match", "html": "<p></p>", "updateKeyId": {"keyId": "000000000000000000000000"}}`,
+	}
+	for _, body := range invalidBodies {
+		httpRes, _ := app.MakeRequest(routeBuilder.Post, `/api/v1/emailTemplates`, TestReqOpts{Body: []byte(body)})
+		NotEqual(t, 200, httpRes.StatusCode, body)
+	}
+
+	// Preview the stored template in english
+	_, res = app.MakeRequest(routeBuilder.Get, `/api/v1/emailTemplates/`+emailTemplate.ID.Hex()+`/preview?locale=en`, TestReqOpts{})
+	content := models.EmailContent{}
+	NoError(t, json.Unmarshal(res, &content))
+	Equal(t, "Match for Example profile", content.Subject)
+	Equal(t, "<p>Candidate name: "+models.ExampleCV().PersonalDetails.FirstName+"</p>", content.HTML)
+
+	// Preview an unsaved template
+	_, res = app.MakeRequest(routeBuilder.Post, `/api/v1/emailTemplates/preview`, TestReqOpts{
+		Body: []byte(`{"kind": "digest", "locale": "en"}`),
+	})
+	content = models.EmailContent{}
+	NoError(t, json.Unmarshal(res, &content))
+	Equal(t, "2 new matches", content.Subject)
+	Contains(t, content.HTML, "Yes, 2 new matches!")
+
+	httpRes, _ = app.MakeRequest(routeBuilder.Post, `/api/v1/emailTemplates/preview`, TestReqOpts{
+		Body: []byte(`{"kind": "match", "html": "{{ .DoesNotExist }}"}`),
+	})
+	Equal(t, 400, httpRes.StatusCode)
+
+	// Use the template in a profile
+	profileRoute := `/api/v1/profiles/` + mock.Profile1.ID.Hex()
+	httpRes, res = app.MakeRequest(routeBuilder.Put, profileRoute, TestReqOpts{
+		Body: []byte(`{"locale": "en", "updateEmailTemplates": {"matchEmailTemplateId": "` + emailTemplate.ID.Hex() + `"}}`),
+	})
+	Equal(t, 200, httpRes.StatusCode, string(res))
+	profile := models.Profile{}
+	NoError(t, json.Unmarshal(res, &profile))
+	Equal(t, "en", string(profile.Locale))
+	if NotNil(t, profile.MatchEmailTemplateID) {
+		Equal(t, emailTemplate.ID, *profile.MatchEmailTemplateID)
+	}
+
+	invalidProfileBodies := []string{
+		`{"locale": "fr"}`,
+		`{"updateEmailTemplates": {"matchEmailTemplateId": "000000000000000000000000"}}`,
+		`{"updateEmailTemplates": {"digestEmailTemplateId": "` + emailTemplate.ID.Hex() + `"}}`,
+	}
+	for _, body := range invalidProfileBodies {
+		httpRes, _ := app.MakeRequest(routeBuilder.Put, profileRoute, TestReqOpts{Body: []byte(body)})
+		NotEqual(t, 200, httpRes.StatusCode, body)
+	}
+
+	// Update the template
+	_, res = app.MakeRequest(routeBuilder.Put, `/api/v1/emailTemplates/`+emailTemplate.ID.Hex(), TestReqOpts{
+		Body: []byte(`{"subject": ""}`),
+	})
+	updated := models.EmailTemplate{}
+	NoError(t, json.Unmarshal(res, &updated))
+	Equal(t, "", updated.Subject)
+	Equal(t, emailTemplate.HTML, updated.HTML)
+
+	// Deleting the template removes it from the profile
+	app.MakeRequest(routeBuilder.Delete, `/api/v1/emailTemplates/`+emailTemplate.ID.Hex(), TestReqOpts{})
+	_, res = app.MakeRequest(routeBuilder.Get, `/api/v1/emailTemplates`, TestReqOpts{})
+	Equal(t, "[]", string(res))
+
+	stored, err := models.GetProfile(app.db, mock.Profile1.ID)
+	NoError(t, err)
+	Nil(t, stored.MatchEmailTemplateID)
+	Equal(t, "en", string(stored.Locale))
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/script-development/RT-CV/controller/ctx"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+)
+
+// RouteGetMatchJobsStatsRes is the response of routeGetMatchJobsStats
+type RouteGetMatchJobsStatsRes struct {
+	Pending    uint64 `json:"pending" description:"jobs waiting to be processed, this includes failed jobs that will be retried"`
+	Processing uint64 `json:"processing" description:"jobs that are currently being processed"`
+	Failed     uint64 `json:"failed" description:"jobs that failed too many times and won't be retried"`
+}
+
+var routeGetMatchJobsStats = routeBuilder.R{
+	Description: "get the amount of match jobs in the queue of matches that still need to be processed (saved and sent to the profile emails and http calls)",
+	Res:         RouteGetMatchJobsStatsRes{},
+	Fn: func(c *fiber.Ctx) error {
+		dbConn := ctx.GetDbConn(c)
+
+		res := RouteGetMatchJobsStatsRes{}
+		var err error
+		res.Pending, err = models.CountMatchJobsWithStatus(dbConn, models.MatchJobStatusPending)
+		if err != nil {
+			return err
+		}
+		res.Processing, err = models.CountMatchJobsWithStatus(dbConn, models.MatchJobStatusProcessing)
+		if err != nil {
+			return err
+		}
+		res.Failed, err = models.CountMatchJobsWithStatus(dbConn, models.MatchJobStatusFailed)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(res)
+	},
+}
+
+var routeGetFailedMatchJobs = routeBuilder.R{
+	Description: "get the match jobs that failed too many times and won't be retried",
+	Res:         []models.MatchJob{},
+	Fn: func(c *fiber.Ctx) error {
+		jobs, err := models.GetMatchJobsWithStatus(ctx.GetDbConn(c), models.MatchJobStatusFailed)
+		if err != nil {
+			return err
+		}
+		return c.JSON(jobs)
+	},
+}
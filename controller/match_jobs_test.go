@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestRouteMatchJobs(t *testing.T) {
+	app := newTestingRouter(t)
+
+	failedJob := models.NewMatchJob(time.Now())
+	failedJob.Status = models.MatchJobStatusFailed
+	failedJob.Attempts = 5
+	failedJob.LastError = "some error"
+	NoError(t, app.db.Insert(failedJob))
+
+	res, body := app.MakeRequest(routeBuilder.Get, `/api/v1/matchJobs`, TestReqOpts{})
+	Equal(t, 200, res.StatusCode, string(body))
+	Equal(t, `{"pending":0,"processing":0,"failed":1}`, string(body))
+
+	res, body = app.MakeRequest(routeBuilder.Get, `/api/v1/matchJobs/failed`, TestReqOpts{})
+	Equal(t, 200, res.StatusCode, string(body))
+	jobs := []models.MatchJob{}
+	NoError(t, json.Unmarshal(body, &jobs))
+	Len(t, jobs, 1)
+	Equal(t, failedJob.ID, jobs[0].ID)
+	Equal(t, "some error", jobs[0].LastError)
+}
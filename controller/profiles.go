@@ -1,11 +1,15 @@
 package controller
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/script-development/RT-CV/controller/ctx"
 	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/locale"
+	"github.com/script-development/RT-CV/helpers/match"
 	"github.com/script-development/RT-CV/helpers/routeBuilder"
 	"github.com/script-development/RT-CV/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -91,6 +95,8 @@ var routeGetProfile = routeBuilder.R{
 	},
 }
 
+var errAgeMatchingDisabled = errors.New("minAge and maxAge cannot be set, age matching is disabled on this server")
+
 var routeCreateProfile = routeBuilder.R{
 	Description: "create a new profile that can match scraped CVs",
 	Res:         models.Profile{},
@@ -108,6 +114,14 @@ var routeCreateProfile = routeBuilder.R{
 		if err != nil {
 			return err
 		}
+		if profile.HasAgeCriteria() && match.GetConfig().DisableAgeMatching {
+			return errAgeMatchingDisabled
+		}
+
+		err = ctx.GetWebhookSender(c).EncryptSecrets(&profile.OnMatch, nil)
+		if err != nil {
+			return err
+		}
 
 		// Set the ID of the profile
 		profile.M = db.NewM()
@@ -120,7 +134,7 @@ var routeCreateProfile = routeBuilder.R{
 		}
 
 		// Invalidate profiles cache
-		*ctx.GetMatcherProfilesCache(c) = ctx.MatcherProfilesCache{}
+		ctx.GetProfilesCache(c).Invalidate()
 
 		return c.JSON(profile)
 	},
@@ -133,6 +147,14 @@ type UpdateProfileReq struct {
 	Active          *bool    `json:"active"`
 	AllowedScrapers []string `json:"allowedScrapers" description:"the scraper IDs that can be used to match this profile, if null/undefined this value won't be updated, if empty array all scrapers will be allowed"`
 
+	UpdateActivePeriod *struct {
+		ActiveFrom  *jsonHelpers.RFC3339Nano `json:"activeFrom"`
+		ActiveUntil *jsonHelpers.RFC3339Nano `json:"activeUntil"`
+	} `json:"updateActivePeriod"`
+	Schedule          []models.ProfileSchedule `json:"schedule"`
+	MaxMatchesPerDay  *int                     `json:"maxMatchesPerDay"`
+	MaxMatchesPerWeek *int                     `json:"maxMatchesPerWeek"`
+
 	MustDesiredProfession *bool                      `json:"mustDesiredProfession"`
 	DesiredProfessions    []models.ProfileProfession `json:"desiredProfessions"`
 
@@ -142,6 +164,9 @@ type UpdateProfileReq struct {
 
 	MustExpProfession     *bool                      `json:"mustExpProfession"`
 	ProfessionExperienced []models.ProfileProfession `json:"professionExperienced"`
+	MinYearsExperience    *float64                   `json:"minYearsExperience"`
+	MinWeeklyHours        *int                       `json:"minWeeklyHours"`
+	MaxWeeklyHours        *int                       `json:"maxWeeklyHours"`
 
 	MustDriversLicense *bool                          `json:"mustDriversLicense"`
 	DriversLicenses    []models.ProfileDriversLicense `json:"driversLicenses"`
@@ -151,9 +176,38 @@ type UpdateProfileReq struct {
 	YearsSinceEducation   *int                      `json:"yearsSinceEducation"`
 	Educations            []models.ProfileEducation `json:"educations"`
 
-	Zipcodes []models.ProfileDutchZipcode `json:"zipCodes"`
+	MustLanguage *bool                    `json:"mustLanguage"`
+	Languages    []models.ProfileLanguage `json:"languages"`
+
+	MustSkill *bool                 `json:"mustSkill"`
+	Skills    []models.ProfileSkill `json:"skills"`
+
+	MinAge                    *int `json:"minAge"`
+	MaxAge                    *int `json:"maxAge"`
+	UpdateAvailableWithinDays *struct {
+		AvailableWithinDays *int `json:"availableWithinDays"`
+	} `json:"updateAvailableWithinDays"`
+
+	Zipcodes    []models.ProfileZipcode   `json:"zipCodes"`
+	ZipRadiuses []models.ProfileZipRadius `json:"zipRadiuses"`
+
+	UpdateCriteria *struct {
+		Criteria *models.ProfileCriteriaExpression `json:"criteria"`
+	} `json:"updateCriteria" description:"set the criteria expression of the profile, if criteria is null the must* fields are used again"`
+	Exclusions *models.ProfileExclusions `json:"exclusions"`
+
+	UpdateScoreWeights *struct {
+		ScoreWeights *models.ProfileScoreWeights `json:"scoreWeights"`
+	} `json:"updateScoreWeights" description:"set the score weights of the profile, if scoreWeights is null the default weights are used"`
+	MinimumScore *float64 `json:"minimumScore"`
 
 	OnMatch *models.ProfileOnMatch `json:"onMatch"`
+
+	Locale               *locale.Locale `json:"locale"`
+	UpdateEmailTemplates *struct {
+		MatchEmailTemplateID  *primitive.ObjectID `json:"matchEmailTemplateId"`
+		DigestEmailTemplateID *primitive.ObjectID `json:"digestEmailTemplateId"`
+	} `json:"updateEmailTemplates" description:"set the custom email templates of the profile, if a template id is null the profile uses the template of the key or the built in template"`
 }
 
 var routeModifyProfile = routeBuilder.R{
@@ -195,6 +249,25 @@ var routeModifyProfile = routeBuilder.R{
 			}
 			profile.AllowedScrapers = allowedScrapersIDs
 		}
+		if body.UpdateActivePeriod != nil || body.Schedule != nil || body.MaxMatchesPerDay != nil || body.MaxMatchesPerWeek != nil {
+			if body.UpdateActivePeriod != nil {
+				profile.ActiveFrom = body.UpdateActivePeriod.ActiveFrom
+				profile.ActiveUntil = body.UpdateActivePeriod.ActiveUntil
+			}
+			if body.Schedule != nil {
+				profile.Schedule = body.Schedule
+			}
+			if body.MaxMatchesPerDay != nil {
+				profile.MaxMatchesPerDay = *body.MaxMatchesPerDay
+			}
+			if body.MaxMatchesPerWeek != nil {
+				profile.MaxMatchesPerWeek = *body.MaxMatchesPerWeek
+			}
+			err = profile.ValidateScheduleAndQuota()
+			if err != nil {
+				return err
+			}
+		}
 		if body.MustDesiredProfession != nil {
 			profile.MustDesiredProfession = *body.MustDesiredProfession
 		}
@@ -214,6 +287,21 @@ var routeModifyProfile = routeBuilder.R{
 		if body.ProfessionExperienced != nil {
 			profile.ProfessionExperienced = body.ProfessionExperienced
 		}
+		if body.MinYearsExperience != nil || body.MinWeeklyHours != nil || body.MaxWeeklyHours != nil {
+			if body.MinYearsExperience != nil {
+				profile.MinYearsExperience = *body.MinYearsExperience
+			}
+			if body.MinWeeklyHours != nil {
+				profile.MinWeeklyHours = *body.MinWeeklyHours
+			}
+			if body.MaxWeeklyHours != nil {
+				profile.MaxWeeklyHours = *body.MaxWeeklyHours
+			}
+			err = profile.ValidateExperience()
+			if err != nil {
+				return err
+			}
+		}
 		if body.MustDriversLicense != nil {
 			profile.MustDriversLicense = *body.MustDriversLicense
 		}
@@ -232,12 +320,117 @@ var routeModifyProfile = routeBuilder.R{
 		if body.Educations != nil {
 			profile.Educations = body.Educations
 		}
+		if body.MustLanguage != nil {
+			profile.MustLanguage = *body.MustLanguage
+		}
+		if body.Languages != nil {
+			err = models.ValidateProfileLanguages(body.Languages)
+			if err != nil {
+				return err
+			}
+			profile.Languages = body.Languages
+		}
+		if body.MustSkill != nil {
+			profile.MustSkill = *body.MustSkill
+		}
+		if body.Skills != nil {
+			err = models.ValidateProfileSkills(body.Skills)
+			if err != nil {
+				return err
+			}
+			profile.Skills = body.Skills
+		}
+		if body.MinAge != nil || body.MaxAge != nil || body.UpdateAvailableWithinDays != nil {
+			if body.MinAge != nil {
+				profile.MinAge = *body.MinAge
+			}
+			if body.MaxAge != nil {
+				profile.MaxAge = *body.MaxAge
+			}
+			if body.UpdateAvailableWithinDays != nil {
+				profile.AvailableWithinDays = body.UpdateAvailableWithinDays.AvailableWithinDays
+			}
+			err = profile.ValidateAgeAndAvailability()
+			if err != nil {
+				return err
+			}
+			if (body.MinAge != nil || body.MaxAge != nil) && profile.HasAgeCriteria() && match.GetConfig().DisableAgeMatching {
+				return errAgeMatchingDisabled
+			}
+		}
 		if body.Zipcodes != nil {
+			err = models.ValidateProfileZipcodes(body.Zipcodes)
+			if err != nil {
+				return err
+			}
 			profile.Zipcodes = body.Zipcodes
 		}
+		if body.ZipRadiuses != nil {
+			err = models.ValidateProfileZipRadiuses(body.ZipRadiuses)
+			if err != nil {
+				return err
+			}
+			profile.ZipRadiuses = body.ZipRadiuses
+		}
+		if body.UpdateCriteria != nil {
+			if body.UpdateCriteria.Criteria != nil {
+				err = body.UpdateCriteria.Criteria.Validate()
+				if err != nil {
+					return err
+				}
+			}
+			profile.Criteria = body.UpdateCriteria.Criteria
+		}
+		if body.Exclusions != nil {
+			err = body.Exclusions.Validate()
+			if err != nil {
+				return err
+			}
+			profile.Exclusions = *body.Exclusions
+		}
+		if body.UpdateScoreWeights != nil {
+			if body.UpdateScoreWeights.ScoreWeights != nil {
+				err = body.UpdateScoreWeights.ScoreWeights.Validate()
+				if err != nil {
+					return err
+				}
+			}
+			profile.ScoreWeights = body.UpdateScoreWeights.ScoreWeights
+		}
+		if body.MinimumScore != nil {
+			if *body.MinimumScore < 0 {
+				return errors.New("minimumScore: cannot be negative")
+			}
+			profile.MinimumScore = *body.MinimumScore
+		}
 		if body.OnMatch != nil {
+			err = body.OnMatch.ValidateSendMail()
+			if err != nil {
+				return err
+			}
+			err = body.OnMatch.ValidateHTTPCalls()
+			if err != nil {
+				return err
+			}
+			err = ctx.GetWebhookSender(c).EncryptSecrets(body.OnMatch, profile.OnMatch.HTTPCall)
+			if err != nil {
+				return err
+			}
 			profile.OnMatch = *body.OnMatch
 		}
+		if body.Locale != nil || body.UpdateEmailTemplates != nil {
+			if body.Locale != nil {
+				profile.Locale = *body.Locale
+			}
+			if body.UpdateEmailTemplates != nil {
+				profile.MatchEmailTemplateID = body.UpdateEmailTemplates.MatchEmailTemplateID
+				profile.DigestEmailTemplateID = body.UpdateEmailTemplates.DigestEmailTemplateID
+			}
+			err = profile.ValidateEmailSettings(dbConn)
+			if err != nil {
+				return err
+			}
+		}
 
 		err = dbConn.UpdateByID(profile)
 		if err != nil {
@@ -245,12 +438,71 @@ var routeModifyProfile = routeBuilder.R{
 		}
 
 		// Invalidate profiles cache
-		*ctx.GetMatcherProfilesCache(c) = ctx.MatcherProfilesCache{}
+		ctx.GetProfilesCache(c).Invalidate()
 
 		return c.JSON(profile)
 	},
 }
 
+// RouteExplainProfileMatchBody is the request body of routeExplainProfileMatch
+type RouteExplainProfileMatchBody struct {
+	CV    models.CV `json:"cv"`
+	KeyID *string   `json:"keyId" description:"the id of the scraper key to match as, if null/undefined the key used to make this request is used"`
+}
+
+var routeExplainProfileMatch = routeBuilder.R{
+	Description: "Explains why a CV does or does not match a profile.\n\n" +
+		"Returns every criterion of the profile that was evaluated, if it passed and with what CV values.",
+	Res:  match.Explanation{},
+	Body: RouteExplainProfileMatchBody{},
+	Fn: func(c *fiber.Ctx) error {
+		profile := ctx.GetProfile(c)
+		key := ctx.GetKey(c)
+
+		var body RouteExplainProfileMatchBody
+		err := c.BodyParser(&body)
+		if err != nil {
+			return err
+		}
+
+		err = body.CV.Validate()
+		if err != nil {
+			return ErrorRes(c, fiber.StatusBadRequest, err)
+		}
+
+		if body.KeyID != nil {
+			keyID, err := primitive.ObjectIDFromHex(*body.KeyID)
+			if err != nil {
+				return err
+			}
+			scraperKey, err := models.GetAPIKey(ctx.GetDbConn(c), keyID)
+			if err != nil {
+				return err
+			}
+			key = &scraperKey
+		}
+
+		synonyms, err := models.GetSynonymIndex(ctx.GetDbConn(c))
+		if err != nil {
+			return err
+		}
+		// The profile might be shared with the database connection so we expand a copy of it
+		expandedProfile, err := profile.Clone()
+		if err != nil {
+			return err
+		}
+		synonyms.ExpandProfile(&expandedProfile)
+
+		profiles := []*models.Profile{&expandedProfile}
+		explanations := match.Explain(key, profiles, body.CV)
+		err = match.ExplainMatchQuota(explanations, profiles, matchQuotaReached(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(explanations[0])
+	},
+}
+
 var routeDeleteProfile = routeBuilder.R{
 	Description: "Delete a profile stored in the database",
 	Res:         models.Profile{},
@@ -263,7 +515,7 @@ var routeDeleteProfile = routeBuilder.R{
 		}
 
 		// Invalidate profiles cache
-		*ctx.GetMatcherProfilesCache(c) = ctx.MatcherProfilesCache{}
+		ctx.GetProfilesCache(c).Invalidate()
 
 		return c.JSON(profile)
 	},
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/script-development/RT-CV/helpers/match"
+	"github.com/script-development/RT-CV/helpers/postalcode"
 	"github.com/script-development/RT-CV/helpers/routeBuilder"
 	"github.com/script-development/RT-CV/mock"
 	"github.com/script-development/RT-CV/models"
@@ -130,7 +133,14 @@ func TestRouteUpdateProfile(t *testing.T) {
 				Equal(t, before.MustEducation, after.MustEducation)
 				Equal(t, before.YearsSinceEducation, after.YearsSinceEducation)
 				Equal(t, before.Educations, after.Educations)
+				Equal(t, before.MustLanguage, after.MustLanguage)
+				Equal(t, before.Languages, after.Languages)
 				Equal(t, before.Zipcodes, after.Zipcodes)
+				Equal(t, before.ZipRadiuses, after.ZipRadiuses)
+				Equal(t, before.Criteria, after.Criteria)
+				Equal(t, before.Exclusions, after.Exclusions)
+				Equal(t, before.ScoreWeights, after.ScoreWeights)
+				Equal(t, before.MinimumScore, after.MinimumScore)
 				Equal(t, before.OnMatch, after.OnMatch)
 			},
 		},
@@ -233,11 +243,150 @@ func TestRouteUpdateProfile(t *testing.T) {
 				Equal(t, []models.ProfileEducation{{Name: "updated education"}}, after.Educations)
 			},
 		},
+		{
+			"Set MustLanguage",
+			M{"mustLanguage": true},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, true, after.MustLanguage)
+			},
+		},
+		{
+			"Set Languages",
+			M{"languages": []models.ProfileLanguage{{Name: "Engels", LevelSpoken: models.LanguageLevelGood}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, []models.ProfileLanguage{{Name: "Engels", LevelSpoken: models.LanguageLevelGood}}, after.Languages)
+			},
+		},
+		{
+			"Set MinYearsExperience",
+			M{"minYearsExperience": 2.5},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, 2.5, after.MinYearsExperience)
+			},
+		},
+		{
+			"Set weekly hours",
+			M{"minWeeklyHours": 24, "maxWeeklyHours": 32},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, 24, after.MinWeeklyHours)
+				Equal(t, 32, after.MaxWeeklyHours)
+			},
+		},
+		{
+			"Set age range",
+			M{"minAge": 18, "maxAge": 30},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, 18, after.MinAge)
+				Equal(t, 30, after.MaxAge)
+			},
+		},
+		{
+			"Set AvailableWithinDays",
+			M{"updateAvailableWithinDays": M{"availableWithinDays": 14}},
+			func(t *testing.T, before, after models.Profile) {
+				NotNil(t, after.AvailableWithinDays)
+				Equal(t, 14, *after.AvailableWithinDays)
+			},
+		},
+		{
+			"Set MustSkill",
+			M{"mustSkill": true},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, true, after.MustSkill)
+			},
+		},
+		{
+			"Set Skills",
+			M{"skills": []models.ProfileSkill{{Name: "Heftruck rijden"}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, []models.ProfileSkill{{Name: "Heftruck rijden"}}, after.Skills)
+			},
+		},
+		{
+			"Set Schedule",
+			M{"schedule": []models.ProfileSchedule{{Weekday: time.Monday, FromHour: 9, ToHour: 17}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, []models.ProfileSchedule{{Weekday: time.Monday, FromHour: 9, ToHour: 17}}, after.Schedule)
+			},
+		},
+		{
+			"Set match quotas",
+			M{"maxMatchesPerDay": 5, "maxMatchesPerWeek": 20},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, 5, after.MaxMatchesPerDay)
+				Equal(t, 20, after.MaxMatchesPerWeek)
+			},
+		},
+		{
+			"Set active period",
+			M{"updateActivePeriod": M{"activeUntil": "2100-01-01T00:00:00Z"}},
+			func(t *testing.T, before, after models.Profile) {
+				Nil(t, after.ActiveFrom)
+				NotNil(t, after.ActiveUntil)
+				Equal(t, 2100, after.ActiveUntil.Time().Year())
+			},
+		},
 		{
 			"Set Zipcodes",
-			M{"zipcodes": []models.ProfileDutchZipcode{{From: 1500, To: 2500}}},
+			M{"zipcodes": []models.ProfileZipcode{{From: 1500, To: 2500}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, []models.ProfileZipcode{{From: 1500, To: 2500}}, after.Zipcodes)
+			},
+		},
+		{
+			"Set Zipcodes with a country",
+			M{"zipcodes": []models.ProfileZipcode{{Country: postalcode.CountryBE, From: 9000, To: 9999}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, []models.ProfileZipcode{{Country: postalcode.CountryBE, From: 9000, To: 9999}}, after.Zipcodes)
+			},
+		},
+		{
+			"Set ZipRadiuses",
+			M{"zipRadiuses": []models.ProfileZipRadius{{Zipcode: 3511, RadiusKm: 25}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, []models.ProfileZipRadius{{Zipcode: 3511, RadiusKm: 25}}, after.ZipRadiuses)
+			},
+		},
+		{
+			"Set Criteria",
+			M{"updateCriteria": M{"criteria": models.ProfileCriteriaExpression{Not: &models.ProfileCriteriaExpression{Criterion: models.ProfileCriterionLanguages}}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, &models.ProfileCriteriaExpression{Not: &models.ProfileCriteriaExpression{Criterion: models.ProfileCriterionLanguages}}, after.Criteria)
+			},
+		},
+		{
+			"Clear Criteria",
+			M{"updateCriteria": M{"criteria": nil}},
 			func(t *testing.T, before, after models.Profile) {
-				Equal(t, []models.ProfileDutchZipcode{{From: 1500, To: 2500}}, after.Zipcodes)
+				Nil(t, after.Criteria)
+			},
+		},
+		{
+			"Set Exclusions",
+			M{"exclusions": models.ProfileExclusions{PreferredJobs: []string{"stagiair"}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, []string{"stagiair"}, after.Exclusions.PreferredJobs)
+			},
+		},
+		{
+			"Set ScoreWeights",
+			M{"updateScoreWeights": M{"scoreWeights": models.ProfileScoreWeights{Education: 3, Recency: 0.5}}},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, &models.ProfileScoreWeights{Education: 3, Recency: 0.5}, after.ScoreWeights)
+			},
+		},
+		{
+			"Clear ScoreWeights",
+			M{"updateScoreWeights": M{"scoreWeights": nil}},
+			func(t *testing.T, before, after models.Profile) {
+				Nil(t, after.ScoreWeights)
+			},
+		},
+		{
+			"Set MinimumScore",
+			M{"minimumScore": 2.5},
+			func(t *testing.T, before, after models.Profile) {
+				Equal(t, 2.5, after.MinimumScore)
 			},
 		},
 		{
@@ -273,3 +422,136 @@ func TestRouteUpdateProfile(t *testing.T) {
 		}
 	}
 }
+
+func TestRouteExplainProfileMatch(t *testing.T) {
+	app := newTestingRouter(t)
+
+	body, err := json.Marshal(RouteExplainProfileMatchBody{
+		CV: models.CV{
+			ReferenceNumber: "explain",
+			PersonalDetails: models.PersonalDetails{Zip: "9779AB"},
+		},
+	})
+	NoError(t, err)
+
+	route := `/api/v1/profiles/` + mock.Profile1.ID.Hex() + `/explainMatch`
+	res, resBody := app.MakeRequest(routeBuilder.Post, route, TestReqOpts{Body: body})
+	Equal(t, 200, res.StatusCode, string(resBody))
+
+	explanation := match.Explanation{}
+	err = json.Unmarshal(resBody, &explanation)
+	NoError(t, err)
+	Equal(t, mock.Profile1.ID, explanation.ProfileID)
+	False(t, explanation.Matched)
+	NotEmpty(t, explanation.Steps)
+
+	// Profile 1 only allows key 2, we are using key 1 so that should fail
+	Equal(t, match.CriterionAllowedScrapers, explanation.Steps[1].Criterion)
+	False(t, explanation.Steps[1].Passed)
+
+	// Explain as key 2
+	key2ID := mock.Key2.ID.Hex()
+	body, err = json.Marshal(RouteExplainProfileMatchBody{
+		CV:    models.CV{ReferenceNumber: "explain"},
+		KeyID: &key2ID,
+	})
+	NoError(t, err)
+	_, resBody = app.MakeRequest(routeBuilder.Post, route, TestReqOpts{Body: body})
+	explanation = match.Explanation{}
+	err = json.Unmarshal(resBody, &explanation)
+	NoError(t, err)
+	for _, step := range explanation.Steps {
+		if step.Criterion == match.CriterionAllowedScrapers {
+			True(t, step.Passed)
+		}
+	}
+}
+
+func TestRouteUpdateProfileAgeMatchingDisabled(t *testing.T) {
+	match.SetConfig(match.Config{DisableAgeMatching: true})
+	defer match.SetConfig(match.Config{})
+
+	app := newTestingRouter(t)
+	route := `/api/v1/profiles/` + mock.Profile1.ID.Hex()
+
+	res, body := app.MakeRequest(routeBuilder.Put, route, TestReqOpts{Body: []byte(`{"minAge": 18}`)})
+	NotEqual(t, 200, res.StatusCode)
+	Contains(t, string(body), "age matching is disabled")
+
+	// Removing the age range should still be possible
+	res, body = app.MakeRequest(routeBuilder.Put, route, TestReqOpts{Body: []byte(`{"minAge": 0, "maxAge": 0}`)})
+	Equal(t, 200, res.StatusCode, string(body))
+}
+
+func TestRouteUpdateProfileSigningSecret(t *testing.T) {
+	app := newTestingRouter(t)
+	route := `/api/v1/profiles/` + mock.Profile1.ID.Hex()
+
+	getCall := func(body []byte) models.ProfileHTTPCallData {
+		profile := models.Profile{}
+		NoError(t, json.Unmarshal(body, &profile))
+		if Len(t, profile.OnMatch.HTTPCall, 1) {
+			return profile.OnMatch.HTTPCall[0]
+		}
+		return models.ProfileHTTPCallData{}
+	}
+
+	setOnMatch := func(call string) (int, []byte) {
+		res, body := app.MakeRequest(routeBuilder.Put, route, TestReqOpts{
+			Body: []byte(`{"onMatch": {"httpCall": [` + call + `]}}`),
+		})
+		return res.StatusCode, body
+	}
+
+	// The secret should never be returned
+	status, body := setOnMatch(`{"uri": "https://example.com", "method": "POST", "signingSecret": "a-very-secret-signing-key"}`)
+	Equal(t, 200, status, string(body))
+	NotContains(t, string(body), "a-very-secret-signing-key")
+	call := getCall(body)
+	True(t, call.Signed)
+	Nil(t, call.SigningSecret)
+
+	stored, err := models.GetProfile(app.db, mock.Profile1.ID)
+	NoError(t, err)
+	if Len(t, stored.OnMatch.HTTPCall, 1) {
+		NotEmpty(t, stored.OnMatch.HTTPCall[0].EncryptedSigningSecret)
+		NotContains(t, stored.OnMatch.HTTPCall[0].EncryptedSigningSecret, "a-very-secret-signing-key")
+	}
+
+	// Leaving out the secret keeps the current secret
+	status, body = setOnMatch(`{"uri": "https://example.com", "method": "POST"}`)
+	Equal(t, 200, status, string(body))
+	True(t, getCall(body).Signed)
+
+	// An empty secret disables signing
+	status, body = setOnMatch(`{"uri": "https://example.com", "method": "POST", "signingSecret": ""}`)
+	Equal(t, 200, status, string(body))
+	False(t, getCall(body).Signed)
+
+	status, body = setOnMatch(`{"uri": "https://example.com", "method": "POST", "signingSecret": "short"}`)
+	NotEqual(t, 200, status)
+	Contains(t, string(body), "signingSecret")
+}
+
+func TestRouteUpdateProfileHTTPCallTemplate(t *testing.T) {
+	app := newTestingRouter(t)
+	route := `/api/v1/profiles/` + mock.Profile1.ID.Hex()
+
+	setOnMatch := func(call string) (int, []byte) {
+		res, body := app.MakeRequest(routeBuilder.Put, route, TestReqOpts{
+			Body: []byte(`{"onMatch": {"httpCall": [` + call + `]}}`),
+		})
+		return res.StatusCode, body
+	}
+
+	status, body := setOnMatch(`{"uri": "https://example.com", "method": "POST", "bodyTemplate": "{\"ref\": {{json .CV.ReferenceNumber}}}"}`)
+	Equal(t, 200, status, string(body))
+
+	status, body = setOnMatch(`{"uri": "https://example.com", "method": "POST", "bodyTemplate": "{{.CV.DoesNotExist}}"}`)
+	NotEqual(t, 200, status)
+	Contains(t, string(body), "bodyTemplate")
+
+	status, body = setOnMatch(`{"uri": "https://example.com", "method": "POST", "payloadMode": "query"}`)
+	NotEqual(t, 200, status)
+	Contains(t, string(body), "payloadMode")
+}
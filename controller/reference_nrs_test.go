@@ -33,7 +33,7 @@ func TestScannedReferenceNrs(t *testing.T) {
 		NoError(t, err)
 	}
 
-	err = router.db.UnsafeInsert(
+	err = router.db.Insert(
 		newMatch("1", time.Now().Add(-(time.Minute*30))),
 		newMatch("2", time.Now().Add(-(time.Minute*90))),
 		newMatch("3", time.Now().AddDate(0, 0, -2)),
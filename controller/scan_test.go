@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/match"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/mock"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestScanCVWhileChangingProfiles(t *testing.T) {
+	app := newTestingRouter(t)
+	profileRoute := `/api/v1/profiles/` + mock.Profile1.ID.Hex()
+
+	// Allow all scrapers so the profile is matched against the scanned CVs
+	res, _ := app.MakeRequest(routeBuilder.Put, profileRoute, TestReqOpts{
+		Body: []byte(`{"allowedScrapers": []}`),
+	})
+	Equal(t, 200, res.StatusCode)
+
+	// A CV that matches mock profile 1
+	educationEndDate := jsonHelpers.RFC3339Nano(time.Now())
+	scanBody, err := json.Marshal(RouteScraperScanCVBody{
+		CV: models.CV{
+			ReferenceNumber: "concurrent",
+			PersonalDetails: models.PersonalDetails{Zip: "3000AB"},
+			WorkExperiences: []models.WorkExperience{{Profession: "Dancer"}},
+			Educations:      []models.Education{{Name: "Default", HasDiploma: true, EndDate: &educationEndDate}},
+			DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("A")},
+		},
+		Debug: true,
+	})
+	NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				res, body := app.MakeRequest(routeBuilder.Post, `/api/v1/scraper/scanCV`, TestReqOpts{Body: scanBody})
+				Equal(t, 200, res.StatusCode, string(body))
+
+				scanRes := RouteScraperScanCVRes{}
+				NoError(t, json.Unmarshal(body, &scanRes))
+				Len(t, scanRes.Matches, 1)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				body := []byte(fmt.Sprintf(`{"name": "profile %d %d"}`, i, j))
+				res, resBody := app.MakeRequest(routeBuilder.Put, profileRoute, TestReqOpts{Body: body})
+				Equal(t, 200, res.StatusCode, string(resBody))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestScanCVWhileShuttingDown(t *testing.T) {
+	app := newTestingRouter(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	NoError(t, app.processor.Shutdown(ctx))
+
+	scanBody, err := json.Marshal(RouteScraperScanCVBody{
+		CV: models.CV{ReferenceNumber: "shutdown"},
+	})
+	NoError(t, err)
+
+	// New CVs should be refused so the scraper can try again later
+	res, body := app.MakeRequest(routeBuilder.Post, `/api/v1/scraper/scanCV`, TestReqOpts{Body: scanBody})
+	Equal(t, 503, res.StatusCode, string(body))
+
+	count, err := app.db.Count(&models.MatchJob{}, nil)
+	NoError(t, err)
+	Equal(t, uint64(0), count)
+}
+
+func TestScanCVMatchQuota(t *testing.T) {
+	app := newTestingRouter(t)
+	profileRoute := `/api/v1/profiles/` + mock.Profile1.ID.Hex()
+
+	// Remove the mock matches of profile 1 so we know how many matches count towards the quota
+	earlierMatches := []models.Match{}
+	NoError(t, app.db.Find(&models.Match{}, &earlierMatches, bson.M{"profileId": mock.Profile1.ID}))
+	for idx := range earlierMatches {
+		NoError(t, app.db.DeleteByID(&earlierMatches[idx]))
+	}
+
+	res, body := app.MakeRequest(routeBuilder.Put, profileRoute, TestReqOpts{
+		Body: []byte(`{"allowedScrapers": [], "maxMatchesPerDay": 1}`),
+	})
+	Equal(t, 200, res.StatusCode, string(body))
+
+	// A CV that matches mock profile 1
+	educationEndDate := jsonHelpers.RFC3339Nano(time.Now())
+	scanBody, err := json.Marshal(RouteScraperScanCVBody{
+		CV: models.CV{
+			ReferenceNumber: "quota",
+			PersonalDetails: models.PersonalDetails{Zip: "3000AB"},
+			WorkExperiences: []models.WorkExperience{{Profession: "Dancer"}},
+			Educations:      []models.Education{{Name: "Default", HasDiploma: true, EndDate: &educationEndDate}},
+			DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("A")},
+		},
+		Debug: true,
+	})
+	NoError(t, err)
+
+	scan := func() RouteScraperScanCVRes {
+		res, body := app.MakeRequest(routeBuilder.Post, `/api/v1/scraper/scanCV`, TestReqOpts{Body: scanBody})
+		Equal(t, 200, res.StatusCode, string(body))
+		scanRes := RouteScraperScanCVRes{}
+		NoError(t, json.Unmarshal(body, &scanRes))
+		return scanRes
+	}
+
+	profileExplanation := func(scanRes RouteScraperScanCVRes) match.Explanation {
+		for _, explanation := range scanRes.Explanations {
+			if explanation.ProfileID == mock.Profile1.ID {
+				return explanation
+			}
+		}
+		t.Fatal("profile 1 is not explained")
+		return match.Explanation{}
+	}
+
+	scanRes := scan()
+	Len(t, scanRes.Matches, 1)
+	explanation := profileExplanation(scanRes)
+	True(t, explanation.Matched)
+	lastStep := explanation.Steps[len(explanation.Steps)-1]
+	Equal(t, match.CriterionMatchQuota, lastStep.Criterion)
+	True(t, lastStep.Passed)
+
+	// Once the profile reached its quota it should no longer be reported as matched
+	NoError(t, app.db.Insert(&models.Match{
+		M:         db.NewM(),
+		ProfileID: mock.Profile1.ID,
+		When:      jsonHelpers.RFC3339Nano(time.Now()),
+	}))
+
+	scanRes = scan()
+	Len(t, scanRes.Matches, 0)
+	explanation = profileExplanation(scanRes)
+	False(t, explanation.Matched)
+	lastStep = explanation.Steps[len(explanation.Steps)-1]
+	Equal(t, match.CriterionMatchQuota, lastStep.Criterion)
+	False(t, lastStep.Passed)
+	True(t, lastStep.Required)
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/script-development/RT-CV/controller/ctx"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var routeGetSynonymSets = routeBuilder.R{
+	Description: "get all synonym sets",
+	Res:         []models.SynonymSet{},
+	Fn: func(c *fiber.Ctx) error {
+		sets, err := models.GetSynonymSets(ctx.GetDbConn(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(sets)
+	},
+}
+
+var routeGetSynonymSet = routeBuilder.R{
+	Description: "get a synonym set based on it's ID",
+	Res:         models.SynonymSet{},
+	Fn: func(c *fiber.Ctx) error {
+		set, err := getSynonymSetFromParam(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(set)
+	},
+}
+
+// SynonymSetModifyCreateData are the fields that can be set when creating or modifying a synonym set
+// When modifying all the fields are optional and if null are not updated
+type SynonymSetModifyCreateData struct {
+	Kind           *models.SynonymKind `json:"kind" description:"profession or education"`
+	Terms          []string            `json:"terms"`
+	UpdateParentID *struct {
+		ParentID *string `json:"parentId"`
+	} `json:"updateParentId" description:"set the parent of the synonym set, if parentId is null the parent is removed"`
+}
+
+// apply applies the data to the synonym set
+func (data SynonymSetModifyCreateData) apply(set *models.SynonymSet) error {
+	if data.Kind != nil {
+		set.Kind = *data.Kind
+	}
+	if data.Terms != nil {
+		set.Terms = data.Terms
+	}
+	if data.UpdateParentID != nil {
+		if data.UpdateParentID.ParentID == nil {
+			set.ParentID = nil
+		} else {
+			parentID, err := primitive.ObjectIDFromHex(*data.UpdateParentID.ParentID)
+			if err != nil {
+				return err
+			}
+			set.ParentID = &parentID
+		}
+	}
+	return nil
+}
+
+// saveSynonymSet validates and stores a synonym set
+func saveSynonymSet(c *fiber.Ctx, set *models.SynonymSet, isNew bool) error {
+	dbConn := ctx.GetDbConn(c)
+
+	otherSets, err := models.GetSynonymSets(dbConn)
+	if err != nil {
+		return err
+	}
+	err = set.Validate(otherSets)
+	if err != nil {
+		return ErrorRes(c, fiber.StatusBadRequest, err)
+	}
+
+	if isNew {
+		err = dbConn.Insert(set)
+	} else {
+		err = dbConn.UpdateByID(set)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The profiles in the cache are expanded with the synonyms so we need to invalidate the cache
+	ctx.GetProfilesCache(c).Invalidate()
+
+	return c.JSON(set)
+}
+
+var routeCreateSynonymSet = routeBuilder.R{
+	Description: "create a new synonym set, the terms of the set are used as aliases of matching profile professions or educations",
+	Body:        SynonymSetModifyCreateData{},
+	Res:         models.SynonymSet{},
+	Fn: func(c *fiber.Ctx) error {
+		body := SynonymSetModifyCreateData{}
+		err := c.BodyParser(&body)
+		if err != nil {
+			return err
+		}
+
+		if body.Kind == nil {
+			return errors.New("kind should be set")
+		}
+
+		set := &models.SynonymSet{M: db.NewM()}
+		err = body.apply(set)
+		if err != nil {
+			return err
+		}
+
+		return saveSynonymSet(c, set, true)
+	},
+}
+
+var routeUpdateSynonymSet = routeBuilder.R{
+	Description: "update a synonym set, all the body fields are optional",
+	Body:        SynonymSetModifyCreateData{},
+	Res:         models.SynonymSet{},
+	Fn: func(c *fiber.Ctx) error {
+		set, err := getSynonymSetFromParam(c)
+		if err != nil {
+			return err
+		}
+
+		body := SynonymSetModifyCreateData{}
+		err = c.BodyParser(&body)
+		if err != nil {
+			return err
+		}
+
+		err = body.apply(&set)
+		if err != nil {
+			return err
+		}
+
+		return saveSynonymSet(c, &set, false)
+	},
+}
+
+var routeDeleteSynonymSet = routeBuilder.R{
+	Description: "delete a synonym set, the child sets of this set will lose their parent",
+	Res:         models.SynonymSet{},
+	Fn: func(c *fiber.Ctx) error {
+		set, err := getSynonymSetFromParam(c)
+		if err != nil {
+			return err
+		}
+
+		dbConn := ctx.GetDbConn(c)
+		children := []models.SynonymSet{}
+		err = dbConn.Find(&set, &children, bson.M{"parentId": set.ID})
+		if err != nil {
+			return err
+		}
+		for idx := range children {
+			children[idx].ParentID = nil
+			err = dbConn.UpdateByID(&children[idx])
+			if err != nil {
+				return err
+			}
+		}
+
+		err = dbConn.DeleteByID(&set)
+		if err != nil {
+			return err
+		}
+
+		ctx.GetProfilesCache(c).Invalidate()
+
+		return c.JSON(set)
+	},
+}
+
+func getSynonymSetFromParam(c *fiber.Ctx) (models.SynonymSet, error) {
+	setID, err := primitive.ObjectIDFromHex(c.Params(`synonymSet`))
+	if err != nil {
+		return models.SynonymSet{}, err
+	}
+	return models.GetSynonymSet(ctx.GetDbConn(c), setID)
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestSynonymSetRoutes(t *testing.T) {
+	app := newTestingRouter(t)
+
+	// The mock data contains no synonym sets
+	_, res := app.MakeRequest(routeBuilder.Get, `/api/v1/synonymSets`, TestReqOpts{})
+	Equal(t, "[]", string(res))
+
+	// Create a set
+	_, res = app.MakeRequest(routeBuilder.Post, `/api/v1/synonymSets`, TestReqOpts{
+		Body: []byte(`{"kind": "profession", "terms": ["chauffeur", "driver"]}`),
+	})
+	parent := models.SynonymSet{}
+	err := json.Unmarshal(res, &parent)
+	NoError(t, err)
+	Equal(t, models.SynonymKindProfession, parent.Kind)
+	Equal(t, []string{"chauffeur", "driver"}, parent.Terms)
+
+	// Create a child set
+	_, res = app.MakeRequest(routeBuilder.Post, `/api/v1/synonymSets`, TestReqOpts{
+		Body: []byte(`{"kind": "profession", "terms": ["vrachtwagenchauffeur", "truck driver"], "updateParentId": {"parentId": "` + parent.ID.Hex() + `"}}`),
+	})
+	child := models.SynonymSet{}
+	err = json.Unmarshal(res, &child)
+	NoError(t, err)
+	NotNil(t, child.ParentID)
+	Equal(t, parent.ID, *child.ParentID)
+
+	// Invalid sets should be rejected
+	invalidBodies := []string{
+		`{"terms": ["foo"]}`,
+		`{"kind": "foo", "terms": ["foo"]}`,
+		`{"kind": "profession", "terms": []}`,
+		`{"kind": "profession", "terms": [" "]}`,
+		`{"kind": "education", "terms": ["foo"], "updateParentId": {"parentId": "` + parent.ID.Hex() + `"}}`,
+		`{"kind": "profession", "terms": ["foo"], "updateParentId": {"parentId": "000000000000000000000000"}}`,
+	}
+	for _, body := range invalidBodies {
+		httpRes, _ := app.MakeRequest(routeBuilder.Post, `/api/v1/synonymSets`, TestReqOpts{Body: []byte(body)})
+		NotEqual(t, 200, httpRes.StatusCode, body)
+	}
+
+	// A set cannot become the child of its own child
+	httpRes, _ := app.MakeRequest(routeBuilder.Put, `/api/v1/synonymSets/`+parent.ID.Hex(), TestReqOpts{
+		Body: []byte(`{"updateParentId": {"parentId": "` + child.ID.Hex() + `"}}`),
+	})
+	NotEqual(t, 200, httpRes.StatusCode)
+
+	// Update a set
+	_, res = app.MakeRequest(routeBuilder.Put, `/api/v1/synonymSets/`+parent.ID.Hex(), TestReqOpts{
+		Body: []byte(`{"terms": ["chauffeur", "driver", "bestuurder"]}`),
+	})
+	updatedParent := models.SynonymSet{}
+	err = json.Unmarshal(res, &updatedParent)
+	NoError(t, err)
+	Equal(t, []string{"chauffeur", "driver", "bestuurder"}, updatedParent.Terms)
+
+	// Get a single set
+	_, res = app.MakeRequest(routeBuilder.Get, `/api/v1/synonymSets/`+child.ID.Hex(), TestReqOpts{})
+	fetchedChild := models.SynonymSet{}
+	err = json.Unmarshal(res, &fetchedChild)
+	NoError(t, err)
+	Equal(t, child.Terms, fetchedChild.Terms)
+
+	// Deleting the parent should remove the parent from the child
+	app.MakeRequest(routeBuilder.Delete, `/api/v1/synonymSets/`+parent.ID.Hex(), TestReqOpts{})
+	_, res = app.MakeRequest(routeBuilder.Get, `/api/v1/synonymSets`, TestReqOpts{})
+	sets := []models.SynonymSet{}
+	err = json.Unmarshal(res, &sets)
+	NoError(t, err)
+	Len(t, sets, 1)
+	Equal(t, child.ID, sets[0].ID)
+	Nil(t, sets[0].ParentID)
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/script-development/RT-CV/controller/ctx"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var routeGetWebhookDeliveries = routeBuilder.R{
+	Description: `get the log of webhooks sent to the httpCall addresses of profiles, the newest first.
+the optional status query param can be used to only get the deliveries with a specific status (pending, delivered or failed).
+the optional limit (default 100, max 1000) and skip query params can be used to get the next pages of deliveries`,
+	Res: []models.WebhookDelivery{},
+	Fn: func(c *fiber.Ctx) error {
+		var profileID *primitive.ObjectID
+		if c.Params(`profile`) != "" {
+			profileID = &ctx.GetProfile(c).ID
+		}
+
+		var status *models.WebhookDeliveryStatus
+		if statusQuery := c.Query(`status`); statusQuery != "" {
+			parsedStatus := models.WebhookDeliveryStatus(statusQuery)
+			if !parsedStatus.Valid() {
+				return ErrorRes(c, fiber.StatusBadRequest, errors.New("unknown status, expected pending, delivered or failed"))
+			}
+			status = &parsedStatus
+		}
+
+		page, err := parsePageQuery(c)
+		if err != nil {
+			return ErrorRes(c, fiber.StatusBadRequest, err)
+		}
+
+		deliveries, err := models.GetWebhookDeliveries(ctx.GetDbConn(c), profileID, status, page)
+		if err != nil {
+			return err
+		}
+		return c.JSON(deliveries)
+	},
+}
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// parsePageQuery parses the optional limit and skip query params of a route that returns a page of a list
+func parsePageQuery(c *fiber.Ctx) (models.Page, error) {
+	page := models.Page{Limit: defaultPageLimit}
+
+	if limitQuery := c.Query(`limit`); limitQuery != "" {
+		limit, err := strconv.ParseInt(limitQuery, 10, 64)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, errors.New("limit must be a number between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+		page.Limit = limit
+	}
+
+	if skipQuery := c.Query(`skip`); skipQuery != "" {
+		skip, err := strconv.ParseInt(skipQuery, 10, 64)
+		if err != nil || skip < 0 {
+			return page, errors.New("skip must be a positive number")
+		}
+		page.Skip = skip
+	}
+
+	return page, nil
+}
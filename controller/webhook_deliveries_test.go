@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/routeBuilder"
+	"github.com/script-development/RT-CV/mock"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestRouteGetWebhookDeliveries(t *testing.T) {
+	app := newTestingRouter(t)
+
+	now := time.Now()
+	newDelivery := func(profile *models.Profile, status models.WebhookDeliveryStatus, createdAt time.Time) *models.WebhookDelivery {
+		delivery := &models.WebhookDelivery{
+			M:         db.NewM(),
+			ProfileID: profile.ID,
+			URI:       "https://example.com/webhook",
+			Method:    "POST",
+			Status:    status,
+			Attempts:  1,
+			CreatedAt: jsonHelpers.RFC3339Nano(createdAt),
+			UpdatedAt: jsonHelpers.RFC3339Nano(createdAt),
+		}
+		NoError(t, app.db.Insert(delivery))
+		return delivery
+	}
+	delivered := newDelivery(mock.Profile1, models.WebhookDeliveryStatusDelivered, now.Add(-time.Hour))
+	failed := newDelivery(mock.Profile1, models.WebhookDeliveryStatusFailed, now)
+	otherProfile := newDelivery(mock.Profile2, models.WebhookDeliveryStatusDelivered, now.Add(-time.Minute))
+
+	getDeliveries := func(route string) []models.WebhookDelivery {
+		res, body := app.MakeRequest(routeBuilder.Get, route, TestReqOpts{})
+		Equal(t, 200, res.StatusCode, string(body))
+		deliveries := []models.WebhookDelivery{}
+		NoError(t, json.Unmarshal(body, &deliveries))
+		return deliveries
+	}
+	ids := func(deliveries []models.WebhookDelivery) []string {
+		res := []string{}
+		for _, delivery := range deliveries {
+			res = append(res, delivery.ID.Hex())
+		}
+		return res
+	}
+
+	// All deliveries should be returned the newest first
+	Equal(
+		t,
+		[]string{failed.ID.Hex(), otherProfile.ID.Hex(), delivered.ID.Hex()},
+		ids(getDeliveries(`/api/v1/webhookDeliveries`)),
+	)
+
+	Equal(
+		t,
+		[]string{failed.ID.Hex()},
+		ids(getDeliveries(`/api/v1/webhookDeliveries?status=failed`)),
+	)
+
+	Equal(
+		t,
+		[]string{failed.ID.Hex(), delivered.ID.Hex()},
+		ids(getDeliveries(`/api/v1/webhookDeliveries/profile/`+mock.Profile1.ID.Hex())),
+	)
+
+	Equal(
+		t,
+		[]string{delivered.ID.Hex()},
+		ids(getDeliveries(`/api/v1/webhookDeliveries/profile/`+mock.Profile1.ID.Hex()+`?status=delivered`)),
+	)
+
+	// The deliveries can be requested in pages
+	Equal(
+		t,
+		[]string{failed.ID.Hex(), otherProfile.ID.Hex()},
+		ids(getDeliveries(`/api/v1/webhookDeliveries?limit=2`)),
+	)
+	Equal(
+		t,
+		[]string{delivered.ID.Hex()},
+		ids(getDeliveries(`/api/v1/webhookDeliveries?limit=2&skip=2`)),
+	)
+
+	for _, query := range []string{`status=unknown`, `limit=0`, `limit=1001`, `limit=abc`, `skip=-1`} {
+		res, body := app.MakeRequest(routeBuilder.Get, `/api/v1/webhookDeliveries?`+query, TestReqOpts{})
+		Equal(t, 400, res.StatusCode, query+" "+string(body))
+	}
+}
@@ -39,10 +39,11 @@ export interface Match {
     desiredProfession?: string
     professionExperienced?: boolean
     driversLicense?: boolean
-    zipCode?: null | DutchZipCode
+    zipCode?: null | ZipCode
 }
 
-export interface DutchZipCode {
+export interface ZipCode {
+    country?: 'NL' | 'BE' | 'DE'
     from: number
     to: number
 }
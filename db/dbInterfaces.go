@@ -10,6 +10,12 @@ import (
 type FindOptions struct {
 	// NoDefaultFilters does not include the default filters for the entry provided
 	NoDefaultFilters bool
+	// Sort sorts the results of Find on the listed fields, 1 sorts a field ascending and -1 descending
+	Sort bson.D
+	// Skip skips the first n results of Find
+	Skip int64
+	// Limit limits the amount of results of Find, 0 means no limit
+	Limit int64
 }
 
 // Connection is a abstract interface for a database connection
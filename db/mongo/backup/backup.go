@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
@@ -12,6 +13,7 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/script-development/RT-CV/db"
 	"github.com/script-development/RT-CV/db/mongo"
+	"github.com/script-development/RT-CV/helpers/shutdown"
 	"github.com/script-development/RT-CV/models"
 )
 
@@ -91,13 +93,51 @@ func StartsSchedule(dbConn db.Connection, options StartScheduleOptions, forceBac
 	// Check every 24 hours if we need to create a backup
 	ticker := time.NewTicker(24 * time.Hour)
 	go func() {
-		checkNeedBackup(s3Client, options.S3Bucket, mongoDBConn, options.BackupEncryptionKey, forceBackup)
+		runBackupCheck(func() {
+			checkNeedBackup(s3Client, options.S3Bucket, mongoDBConn, options.BackupEncryptionKey, forceBackup)
+		})
 		for range ticker.C {
-			checkNeedBackup(s3Client, options.S3Bucket, mongoDBConn, options.BackupEncryptionKey, false)
+			runBackupCheck(func() {
+				checkNeedBackup(s3Client, options.S3Bucket, mongoDBConn, options.BackupEncryptionKey, false)
+			})
 		}
 	}()
 }
 
+var (
+	// inProgress contains the backup that's currently being created
+	inProgress   sync.WaitGroup
+	stateLock    sync.Mutex
+	shuttingDown bool
+)
+
+// runBackupCheck runs check unless the server is shutting down
+func runBackupCheck(check func()) {
+	stateLock.Lock()
+	if shuttingDown {
+		stateLock.Unlock()
+		return
+	}
+	inProgress.Add(1)
+	stateLock.Unlock()
+
+	defer inProgress.Done()
+	check()
+}
+
+// Shutdown prevents new backups from being created and waits for the backup in progress to be uploaded or ctx to expire
+func Shutdown(ctx context.Context) error {
+	stateLock.Lock()
+	shuttingDown = true
+	stateLock.Unlock()
+
+	err := shutdown.WaitGroup(ctx, &inProgress)
+	if err != nil {
+		return fmt.Errorf("backup in progress is not finished: %s", err.Error())
+	}
+	return nil
+}
+
 func checkNeedBackup(s3Client *minio.Client, bucketName string, dbConn *mongo.Connection, backupMasterKey string, force bool) {
 	if force {
 		log.Info("creating a new backup..")
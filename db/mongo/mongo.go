@@ -84,7 +84,18 @@ func (c *Connection) Find(e db.Entry, results interface{}, filter bson.M, option
 		dbHelpers.MergeFilters(e.DefaultFindFilters(), filter)
 	}
 
-	cur, err := c.collection(e).Find(dbHelpers.Ctx(), queryFilters)
+	findOpts := options.Find()
+	if len(opts.Sort) > 0 {
+		findOpts.SetSort(opts.Sort)
+	}
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+
+	cur, err := c.collection(e).Find(dbHelpers.Ctx(), queryFilters, findOpts)
 	if err != nil {
 		return err
 	}
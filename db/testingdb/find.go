@@ -75,11 +75,26 @@ func (c *TestConnection) Find(base db.Entry, results interface{}, filters bson.M
 	resultsSliceContentType := resultRefl.Type().Elem()
 	resultIsSliceOfPtrs := resultsSliceContentType.Kind() == reflect.Ptr
 
+	matchedItems := []interface{}{}
 	for _, item := range c.getCollectionFromEntry(base).data {
-		if !itemsFilter.matches(item) {
-			continue
+		if itemsFilter.matches(item) {
+			matchedItems = append(matchedItems, item)
+		}
+	}
+
+	sortItems(matchedItems, opts.Sort)
+	if opts.Skip > 0 {
+		if opts.Skip >= int64(len(matchedItems)) {
+			matchedItems = []interface{}{}
+		} else {
+			matchedItems = matchedItems[opts.Skip:]
 		}
+	}
+	if opts.Limit > 0 && opts.Limit < int64(len(matchedItems)) {
+		matchedItems = matchedItems[:opts.Limit]
+	}
 
+	for _, item := range matchedItems {
 		itemRefl := reflect.ValueOf(item)
 		if resultIsSliceOfPtrs {
 			resultRefl = reflect.Append(resultRefl, itemRefl)
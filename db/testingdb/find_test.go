@@ -3,6 +3,8 @@ package testingdb
 import (
 	"testing"
 
+	"github.com/script-development/RT-CV/db"
+
 	. "github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -43,3 +45,42 @@ func TestFindWithoutFilters(t *testing.T) {
 	Len(t, foundResultsPtrs, 1)
 	Equal(t, mockData.ID, foundResultsPtrs[0].ID)
 }
+
+func TestFindSortSkipAndLimit(t *testing.T) {
+	testDB := NewDB()
+
+	for _, username := range []string{"b", "d", "a", "c"} {
+		user := NewMockuser()
+		user.Username = username
+		err := testDB.Insert(user)
+		NoError(t, err)
+	}
+
+	usernames := func(users []MockUser) []string {
+		res := []string{}
+		for _, user := range users {
+			res = append(res, user.Username)
+		}
+		return res
+	}
+
+	foundResults := []MockUser{}
+	err := testDB.Find(&MockUser{}, &foundResults, bson.M{}, db.FindOptions{Sort: bson.D{{Key: "username", Value: 1}}})
+	NoError(t, err)
+	Equal(t, []string{"a", "b", "c", "d"}, usernames(foundResults))
+
+	foundResults = []MockUser{}
+	err = testDB.Find(&MockUser{}, &foundResults, bson.M{}, db.FindOptions{Sort: bson.D{{Key: "username", Value: -1}}})
+	NoError(t, err)
+	Equal(t, []string{"d", "c", "b", "a"}, usernames(foundResults))
+
+	foundResults = []MockUser{}
+	err = testDB.Find(&MockUser{}, &foundResults, bson.M{}, db.FindOptions{Sort: bson.D{{Key: "username", Value: 1}}, Skip: 1, Limit: 2})
+	NoError(t, err)
+	Equal(t, []string{"b", "c"}, usernames(foundResults))
+
+	foundResults = []MockUser{}
+	err = testDB.Find(&MockUser{}, &foundResults, bson.M{}, db.FindOptions{Skip: 10})
+	NoError(t, err)
+	Len(t, foundResults, 0)
+}
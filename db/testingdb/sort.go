@@ -0,0 +1,129 @@
+package testingdb
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sortItems sorts the items on the fields of the sort document in the same way as MongoDB would
+// A field with the value 1 is sorted ascending and a field with the value -1 is sorted descending
+func sortItems(items []interface{}, sortBy bson.D) {
+	if len(sortBy) == 0 {
+		return
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, sortField := range sortBy {
+			order := compareSortValues(
+				resolveDbField(items[i], sortField.Key),
+				resolveDbField(items[j], sortField.Key),
+			)
+			if order == 0 {
+				continue
+			}
+			if sortDirection(sortField.Value) < 0 {
+				return order > 0
+			}
+			return order < 0
+		}
+		return false
+	})
+}
+
+// resolveDbField returns the value of the field with the database name key within item
+// The returned value is invalid if the field does not exist
+func resolveDbField(item interface{}, key string) reflect.Value {
+	value := reflect.ValueOf(item)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+
+	fields, isStruct := mapStruct(value.Type())
+	if !isStruct {
+		return reflect.Value{}
+	}
+	field, ok := fields[key]
+	if !ok {
+		return reflect.Value{}
+	}
+
+	for _, goPathPart := range field.GoPathToField {
+		value = value.FieldByName(goPathPart)
+	}
+	value = value.FieldByName(field.GoFieldName)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// sortDirection returns the direction of a sort field value, 1 for ascending and -1 for descending
+func sortDirection(direction interface{}) int64 {
+	value := reflect.ValueOf(direction)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Float32, reflect.Float64:
+		return int64(value.Float())
+	default:
+		return 1
+	}
+}
+
+// compareSortValues returns -1 if a should be sorted before b, 1 if b should be sorted before a and 0 if they are equal
+// Like MongoDB a missing value is sorted before any other value
+func compareSortValues(a, b reflect.Value) int {
+	if !a.IsValid() || !b.IsValid() {
+		switch {
+		case a.IsValid():
+			return 1
+		case b.IsValid():
+			return -1
+		default:
+			return 0
+		}
+	}
+
+	if a.Type().ConvertibleTo(timeType) && b.Type().ConvertibleTo(timeType) {
+		aTime := a.Convert(timeType).Interface().(time.Time)
+		bTime := b.Convert(timeType).Interface().(time.Time)
+		switch {
+		case aTime.Before(bTime):
+			return -1
+		case aTime.After(bTime):
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	if aID, ok := a.Interface().(primitive.ObjectID); ok {
+		if bID, ok := b.Interface().(primitive.ObjectID); ok {
+			return strings.Compare(aID.Hex(), bID.Hex())
+		}
+	}
+
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return strings.Compare(a.String(), b.String())
+	}
+
+	switch {
+	case compareNumbers(numComparisonLess, a, b):
+		return -1
+	case compareNumbers(numComparisonGreater, a, b):
+		return 1
+	default:
+		return 0
+	}
+}
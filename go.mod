@@ -24,6 +24,7 @@ require (
 	github.com/valyala/fasthttp v1.34.0
 	go.mongodb.org/mongo-driver v1.8.4
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/text v0.3.7
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 	jaytaylor.com/html2text v0.0.0-20211105163654-bc68cce691ba
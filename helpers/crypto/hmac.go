@@ -0,0 +1,30 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// SignaturePrefix is the prefix of signatures in headers, it names the algorithm used to create the signature
+const SignaturePrefix = "sha256="
+
+// SignTimestampedPayload returns the hex encoded HMAC-SHA256 of the timestamp and payload joined by a dot
+// Including the timestamp in the signature allows the receiver to reject old (replayed) payloads
+func SignTimestampedPayload(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyTimestampedPayload returns true if signature is the signature of the timestamp and payload created with secret
+// The signature may start with the SignaturePrefix so the value of a signature header can be used as is
+// The comparison is done in constant time
+// Note that this does not check the timestamp, the caller should reject timestamps that are too old
+func VerifyTimestampedPayload(secret []byte, timestamp string, payload []byte, signature string) bool {
+	expected := SignTimestampedPayload(secret, timestamp, payload)
+	return hmac.Equal([]byte(expected), []byte(strings.TrimPrefix(signature, SignaturePrefix)))
+}
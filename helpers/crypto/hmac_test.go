@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestSignTimestampedPayload(t *testing.T) {
+	secret := []byte("a-very-secret-signing-key")
+	payload := []byte(`{"profileId":"123"}`)
+
+	signature := SignTimestampedPayload(secret, "1600000000", payload)
+	Len(t, signature, 64)
+	Equal(t, signature, SignTimestampedPayload(secret, "1600000000", payload))
+
+	True(t, VerifyTimestampedPayload(secret, "1600000000", payload, signature))
+	False(t, VerifyTimestampedPayload(secret, "1600000001", payload, signature))
+	False(t, VerifyTimestampedPayload(secret, "1600000000", []byte(`{"profileId":"124"}`), signature))
+	False(t, VerifyTimestampedPayload([]byte("another-signing-key"), "1600000000", payload, signature))
+	False(t, VerifyTimestampedPayload(secret, "1600000000", payload, ""))
+
+	// The value of the signature header contains the algorithm as prefix
+	True(t, VerifyTimestampedPayload(secret, "1600000000", payload, SignaturePrefix+signature))
+	False(t, VerifyTimestampedPayload(secret, "1600000000", payload, "sha1="+signature))
+	False(t, VerifyTimestampedPayload(secret, "1600000000", payload, SignaturePrefix))
+}
+
+// ExampleVerifyTimestampedPayload shows how a receiver of a signed webhook can verify the request
+func ExampleVerifyTimestampedPayload() {
+	secret := []byte("the-signing-secret-of-the-http-call")
+	body := []byte(`{"profileId":"123"}`)
+
+	// These values are normally read from the X-RTCV-Timestamp and X-RTCV-Signature request headers
+	// The signature header value starts with the algorithm, VerifyTimestampedPayload accepts it as is
+	timestamp := "1600000000"
+	signature := "sha256=" + SignTimestampedPayload(secret, timestamp, body)
+
+	verify := func(now time.Time) error {
+		// Reject requests with an old timestamp so a captured request cannot be replayed later on
+		unixTimestamp, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return err
+		}
+		age := now.Sub(time.Unix(unixTimestamp, 0))
+		if age > 5*time.Minute || age < -5*time.Minute {
+			return errors.New("timestamp outside of the allowed window")
+		}
+
+		if !VerifyTimestampedPayload(secret, timestamp, body, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	fmt.Println(verify(time.Unix(1600000060, 0)))
+	fmt.Println(verify(time.Unix(1600003600, 0)))
+	// Output:
+	// <nil>
+	// timestamp outside of the allowed window
+}
@@ -0,0 +1,344 @@
+package emailDigest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/shutdown"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Options contains the settings of a Scheduler
+type Options struct {
+	// DailyHour is the hour of the day (0-23, local time) the daily digests are sent
+	DailyHour int
+	// PollInterval is how often the scheduler checks if there are digests to send
+	PollInterval time.Duration
+}
+
+// DefaultOptions are the options used for values that are not set
+var DefaultOptions = Options{
+	DailyHour:    8,
+	PollInterval: time.Minute,
+}
+
+// OptionsFromEnv returns the options defined in the EMAIL_DIGEST_DAILY_HOUR env variable
+func OptionsFromEnv() Options {
+	opts := DefaultOptions
+
+	value := os.Getenv("EMAIL_DIGEST_DAILY_HOUR")
+	if value != "" {
+		hour, err := strconv.Atoi(value)
+		if err != nil || hour < 0 || hour > 23 {
+			log.WithField("value", value).Warnf("invalid EMAIL_DIGEST_DAILY_HOUR, using the default hour %d", opts.DailyHour)
+		} else {
+			opts.DailyHour = hour
+		}
+	}
+
+	return opts
+}
+
+// Scheduler sends the matches collected for the hourly and daily digests as a single email per email address,
+// or multiple emails if the PDFs of the matches are too large to attach to a single email
+// The matches are stored in the database as models.DigestMatch until the digest is sent
+type Scheduler struct {
+	dbConn db.Connection
+	opts   Options
+	// now returns the current time, can be replaced in tests
+	now func() time.Time
+	// getPDF generates the PDF of a CV, can be replaced in tests
+	getPDF func(cv models.CV, options *models.PdfOptions) (*os.File, error)
+	// sendMail queues the digest email, can be replaced in tests
+	sendMail func(message models.EmailMessage, profileIDs, matchIDs []primitive.ObjectID) error
+	// maxAttachmentSize is the maximum size of the zip file with PDFs attached to a digest email, can be replaced in tests
+	maxAttachmentSize int
+
+	m       sync.Mutex
+	started bool
+	stop    chan struct{}
+	// running is done once the scheduler loop exited
+	running sync.WaitGroup
+}
+
+// NewScheduler creates a new digest scheduler that sends the digests using emailService
+// Call (*Scheduler).Start to start sending the digests
+func NewScheduler(dbConn db.Connection, emailService *emailservice.Service, opts Options) *Scheduler {
+	if opts.DailyHour < 0 || opts.DailyHour > 23 {
+		opts.DailyHour = DefaultOptions.DailyHour
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultOptions.PollInterval
+	}
+
+	return &Scheduler{
+		dbConn: dbConn,
+		opts:   opts,
+		now:    time.Now,
+		getPDF: func(cv models.CV, options *models.PdfOptions) (*os.File, error) {
+			return cv.GetPDF(options, nil)
+		},
+		sendMail:          emailService.Send,
+		maxAttachmentSize: emailservice.MaxAttachmentsSize,
+		stop:              make(chan struct{}),
+	}
+}
+
+// Start starts checking for digests to send in the background
+// Calling Start more than once does nothing
+func (s *Scheduler) Start() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+
+		ticker := time.NewTicker(s.opts.PollInterval)
+		defer ticker.Stop()
+		for {
+			s.sendDue()
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the scheduler and waits for the digests that are being sent or ctx to expire
+// The digests that are not yet sent remain in the database and are sent after the next start
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.m.Lock()
+	if s.started {
+		close(s.stop)
+		s.started = false
+	}
+	s.m.Unlock()
+
+	err := shutdown.WaitGroup(ctx, &s.running)
+	if err != nil {
+		return fmt.Errorf("not all digests are sent: %s", err.Error())
+	}
+	return nil
+}
+
+// periodStart returns the start of the current digest period of delivery
+// Matches created before this moment belong to a previous period and should be sent
+func (s *Scheduler) periodStart(delivery models.ProfileEmailDelivery, now time.Time) time.Time {
+	if delivery == models.ProfileEmailDeliveryHourly {
+		return now.Truncate(time.Hour)
+	}
+
+	start := time.Date(now.Year(), now.Month(), now.Day(), s.opts.DailyHour, 0, 0, 0, now.Location())
+	if start.After(now) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// sendDue sends the digests of the periods that have passed
+func (s *Scheduler) sendDue() {
+	now := s.now()
+	for _, delivery := range []models.ProfileEmailDelivery{models.ProfileEmailDeliveryHourly, models.ProfileEmailDeliveryDaily} {
+		matches, err := models.GetDigestMatchesBefore(s.dbConn, delivery, s.periodStart(delivery, now))
+		if err != nil {
+			log.WithError(err).WithField("delivery", delivery).Error("unable to get the matches for the digests")
+			continue
+		}
+
+		// Group the matches per email address while keeping the order of the matches
+		perEmail := map[string][]models.DigestMatch{}
+		emails := []string{}
+		for _, aMatch := range matches {
+			if _, ok := perEmail[aMatch.Email]; !ok {
+				emails = append(emails, aMatch.Email)
+			}
+			perEmail[aMatch.Email] = append(perEmail[aMatch.Email], aMatch)
+		}
+
+		for _, address := range emails {
+			err = s.send(address, perEmail[address])
+			if err != nil {
+				// The matches that are not yet sent are kept so the digest is tried again on the next check
+				log.WithField("email", address).WithField("delivery", delivery).WithError(err).Error("unable to send digest")
+			}
+		}
+	}
+}
+
+// send sends the digest with matches to address and removes the sent matches
+// The custom digest template of the first match is used, or if not set the template of the key of the first match
+// If the PDFs of the matches don't fit in the maximum attachment size of a single email the digest is split over multiple emails
+func (s *Scheduler) send(address string, matches []models.DigestMatch) error {
+	emailTemplate, err := models.GetEmailTemplateFor(s.dbConn, models.EmailTemplateKindDigest, matches[0].EmailTemplateID, matches[0].Match.KeyID)
+	if err != nil {
+		return err
+	}
+
+	part := digestPart{}
+	for idx, aMatch := range matches {
+		pdf := s.pdf(idx, aMatch)
+		if pdf != nil && len(part.matches) > 0 && part.zipSize+pdf.zipSize() > s.maxAttachmentSize {
+			err = s.sendPart(address, emailTemplate, part)
+			if err != nil {
+				return err
+			}
+			part = digestPart{}
+		}
+		part.add(aMatch, pdf)
+	}
+	return s.sendPart(address, emailTemplate, part)
+}
+
+// sendPart sends a single digest email with the matches of part to address and removes the sent matches
+func (s *Scheduler) sendPart(address string, emailTemplate *models.EmailTemplate, part digestPart) error {
+	content, err := models.GetDigestEmail(emailTemplate, part.matches)
+	if err != nil {
+		return err
+	}
+
+	message := content.Message(address)
+	attachment := part.zip()
+	if attachment != nil {
+		message.Attachments = []models.EmailAttachment{{
+			Filename:    "matches.zip",
+			ContentType: "application/zip",
+			Content:     attachment,
+		}}
+	}
+
+	profileIDs := []primitive.ObjectID{}
+	matchIDs := make([]primitive.ObjectID, len(part.matches))
+	for idx, aMatch := range part.matches {
+		matchIDs[idx] = aMatch.Match.ID
+		if !containsID(profileIDs, aMatch.ProfileID) {
+			profileIDs = append(profileIDs, aMatch.ProfileID)
+		}
+	}
+
+	err = s.sendMail(message, profileIDs, matchIDs)
+	if err != nil {
+		return err
+	}
+
+	for idx := range part.matches {
+		err = s.dbConn.DeleteByID(&part.matches[idx])
+		if err != nil {
+			log.WithField("email", address).WithError(err).Error("unable to remove a sent digest match")
+		}
+	}
+	return nil
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, entry := range ids {
+		if entry == id {
+			return true
+		}
+	}
+	return false
+}
+
+// digestPDF is the PDF of the CV of a digest match
+type digestPDF struct {
+	fileName string
+	content  []byte
+}
+
+// zipSize returns the maximum size the PDF adds to a zip file
+// PDFs are mostly compressed already so deflate can make them slightly larger, next to that every file has headers in the zip file
+func (pdf *digestPDF) zipSize() int {
+	return len(pdf.content) + len(pdf.content)/100 + 2*len(pdf.fileName) + 256
+}
+
+// pdf returns the PDF of the CV of aMatch, the idx is the index of the match in the digest
+// Returns nil if no PDF can be generated or if it is too large to attach so a broken PDF doesn't block the whole digest
+func (s *Scheduler) pdf(idx int, aMatch models.DigestMatch) *digestPDF {
+	logger := log.WithField("reference_number", aMatch.CV.ReferenceNumber)
+
+	pdfFile, err := s.getPDF(aMatch.CV, aMatch.PdfOptions)
+	if err != nil {
+		logger.WithError(err).Error("unable to generate the PDF for a digest")
+		return nil
+	}
+	content, err := io.ReadAll(pdfFile)
+	pdfFile.Close()
+	os.Remove(pdfFile.Name())
+	if err != nil {
+		logger.WithError(err).Error("unable to read the PDF for a digest")
+		return nil
+	}
+
+	pdf := &digestPDF{
+		// The same CV can be matched to multiple profiles so the index is added to make the file names unique
+		fileName: fmt.Sprintf("%d-%s.pdf", idx+1, strings.ReplaceAll(aMatch.CV.ReferenceNumber, "/", "-")),
+		content:  content,
+	}
+	if pdf.zipSize() > s.maxAttachmentSize {
+		logger.WithField("size", len(content)).Error("the PDF is too large to add to a digest")
+		return nil
+	}
+	return pdf
+}
+
+// digestPart contains the matches that are sent together in a single digest email
+type digestPart struct {
+	matches []models.DigestMatch
+	pdfs    []*digestPDF
+	// zipSize is the maximum size of the zip file with the pdfs
+	zipSize int
+}
+
+// add adds aMatch with its pdf to the part, pdf can be nil if the match has no PDF
+func (p *digestPart) add(aMatch models.DigestMatch, pdf *digestPDF) {
+	p.matches = append(p.matches, aMatch)
+	if pdf != nil {
+		p.pdfs = append(p.pdfs, pdf)
+		p.zipSize += pdf.zipSize()
+	}
+}
+
+// zip returns a zip file with the PDFs of the part, returns nil if there are no PDFs at all
+func (p *digestPart) zip() []byte {
+	if len(p.pdfs) == 0 {
+		return nil
+	}
+
+	buff := bytes.NewBuffer(nil)
+	zipWriter := zip.NewWriter(buff)
+	for _, pdf := range p.pdfs {
+		fileWriter, err := zipWriter.Create(pdf.fileName)
+		if err == nil {
+			_, err = fileWriter.Write(pdf.content)
+		}
+		if err != nil {
+			log.WithError(err).Error("unable to add the PDF to the digest attachment")
+			return nil
+		}
+	}
+
+	err := zipWriter.Close()
+	if err != nil {
+		log.WithError(err).Error("unable to create the digest attachment")
+		return nil
+	}
+	return buff.Bytes()
+}
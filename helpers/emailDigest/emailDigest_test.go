@@ -0,0 +1,225 @@
+package emailDigest
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	"github.com/script-development/RT-CV/helpers/locale"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMain(m *testing.M) {
+	// The email templates are loaded relative to the project root
+	err := os.Chdir("../..")
+	if err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type testScheduler struct {
+	*Scheduler
+	sent []models.EmailMessage
+	// sentMatchIDs contains the match ids passed with every sent message
+	sentMatchIDs [][]primitive.ObjectID
+}
+
+func newTestScheduler(conn db.Connection, now time.Time) *testScheduler {
+	s := &testScheduler{Scheduler: NewScheduler(conn, nil, Options{DailyHour: 8})}
+	s.now = func() time.Time { return now }
+	s.getPDF = func(cv models.CV, _ *models.PdfOptions) (*os.File, error) {
+		f, err := os.CreateTemp("", "cv-*.pdf")
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.WriteString("pdf of " + cv.ReferenceNumber)
+		if err == nil {
+			_, err = f.Seek(0, 0)
+		}
+		return f, err
+	}
+	s.sendMail = func(message models.EmailMessage, _, matchIDs []primitive.ObjectID) error {
+		s.sent = append(s.sent, message)
+		s.sentMatchIDs = append(s.sentMatchIDs, matchIDs)
+		return nil
+	}
+	return s
+}
+
+func insertDigestMatch(t *testing.T, conn db.Connection, createdAt time.Time, address string, delivery models.ProfileEmailDelivery, referenceNr string) {
+	profile := models.Profile{M: db.NewM(), Name: "profile"}
+	mail := models.ProfileSendEmailData{Email: address, Delivery: delivery}
+	cv := models.CV{ReferenceNumber: referenceNr}
+	NoError(t, conn.Insert(models.NewDigestMatch(createdAt, mail, profile, models.Match{M: db.NewM()}, cv, "scraper")))
+}
+
+func countDigestMatches(t *testing.T, conn db.Connection) int {
+	matches := []models.DigestMatch{}
+	NoError(t, conn.Find(&models.DigestMatch{}, &matches, nil))
+	return len(matches)
+}
+
+func TestPeriodStart(t *testing.T) {
+	s := NewScheduler(testingdb.NewDB(), nil, Options{DailyHour: 8})
+	now := time.Date(2022, time.March, 16, 10, 30, 0, 0, time.UTC)
+
+	Equal(t, time.Date(2022, time.March, 16, 10, 0, 0, 0, time.UTC), s.periodStart(models.ProfileEmailDeliveryHourly, now))
+	Equal(t, time.Date(2022, time.March, 16, 8, 0, 0, 0, time.UTC), s.periodStart(models.ProfileEmailDeliveryDaily, now))
+
+	// Before the daily hour the period started the day before
+	early := time.Date(2022, time.March, 16, 7, 0, 0, 0, time.UTC)
+	Equal(t, time.Date(2022, time.March, 15, 8, 0, 0, 0, time.UTC), s.periodStart(models.ProfileEmailDeliveryDaily, early))
+}
+
+func TestSendDue(t *testing.T) {
+	conn := testingdb.NewDB()
+	now := time.Date(2022, time.March, 16, 10, 30, 0, 0, time.UTC)
+
+	// Due, the hour of these matches has passed
+	insertDigestMatch(t, conn, now.Add(-time.Hour), "a@example.com", models.ProfileEmailDeliveryHourly, "1")
+	insertDigestMatch(t, conn, now.Add(-time.Hour+time.Minute), "a@example.com", models.ProfileEmailDeliveryHourly, "2")
+	insertDigestMatch(t, conn, now.Add(-time.Hour), "b@example.com", models.ProfileEmailDeliveryHourly, "3")
+	// Not yet due, made in the current hour
+	insertDigestMatch(t, conn, now.Add(-time.Minute), "a@example.com", models.ProfileEmailDeliveryHourly, "4")
+	// Not yet due, made after today's daily digest
+	insertDigestMatch(t, conn, now.Add(-time.Hour), "c@example.com", models.ProfileEmailDeliveryDaily, "5")
+
+	s := newTestScheduler(conn, now)
+	s.sendDue()
+
+	if Len(t, s.sent, 2) {
+		Equal(t, []string{"a@example.com"}, s.sent[0].To)
+		Equal(t, "2 nieuwe matches", s.sent[0].Subject)
+		Equal(t, []string{"b@example.com"}, s.sent[1].To)
+		Equal(t, "Nieuwe match voor profile", s.sent[1].Subject)
+		Len(t, s.sentMatchIDs[0], 2)
+		Len(t, s.sentMatchIDs[1], 1)
+
+		if Len(t, s.sent[0].Attachments, 1) {
+			Equal(t, "matches.zip", s.sent[0].Attachments[0].Filename)
+			Equal(t, []string{"1-1.pdf", "2-2.pdf"}, zipFileNames(t, s.sent[0].Attachments[0]))
+		}
+	}
+	Equal(t, 2, countDigestMatches(t, conn))
+
+	// The next day the remaining matches are due
+	s = newTestScheduler(conn, now.AddDate(0, 0, 1))
+	s.sendDue()
+	Len(t, s.sent, 2)
+	Equal(t, 0, countDigestMatches(t, conn))
+}
+
+func TestSendDueKeepsFailedDigests(t *testing.T) {
+	conn := testingdb.NewDB()
+	now := time.Date(2022, time.March, 16, 10, 30, 0, 0, time.UTC)
+	insertDigestMatch(t, conn, now.Add(-time.Hour), "a@example.com", models.ProfileEmailDeliveryHourly, "1")
+
+	s := newTestScheduler(conn, now)
+	s.sendMail = func(models.EmailMessage, []primitive.ObjectID, []primitive.ObjectID) error {
+		return errors.New("email service unavailable")
+	}
+	s.sendDue()
+	Equal(t, 1, countDigestMatches(t, conn))
+
+	// A failing PDF should not block the digest
+	s = newTestScheduler(conn, now)
+	s.getPDF = func(models.CV, *models.PdfOptions) (*os.File, error) { return nil, errors.New("no pdf generator") }
+	s.sendDue()
+	if Len(t, s.sent, 1) {
+		Empty(t, s.sent[0].Attachments)
+	}
+	Equal(t, 0, countDigestMatches(t, conn))
+}
+
+func TestSendDueUsesLocaleAndTemplate(t *testing.T) {
+	conn := testingdb.NewDB()
+	now := time.Date(2022, time.March, 16, 10, 30, 0, 0, time.UTC)
+
+	keyID := primitive.NewObjectID()
+	keyTemplate := &models.EmailTemplate{
+		M:       db.NewM(),
+		Kind:    models.EmailTemplateKindDigest,
+		KeyID:   &keyID,
+		Subject: `{{ len .Matches }} x {{ locale }}`,
+		HTML:    `{{ range .Matches }}<p>{{ .MatchText }}</p>{{ end }}`,
+	}
+	NoError(t, conn.Insert(keyTemplate))
+
+	profession := "driver"
+	profile := models.Profile{M: db.NewM(), Name: "profile", Locale: locale.EN}
+	mail := models.ProfileSendEmailData{Email: "a@example.com", Delivery: models.ProfileEmailDeliveryHourly}
+	aMatch := models.Match{M: db.NewM(), KeyID: keyID, DesiredProfession: &profession}
+	NoError(t, conn.Insert(models.NewDigestMatch(now.Add(-time.Hour), mail, profile, aMatch, models.CV{ReferenceNumber: "1"}, "scraper")))
+
+	s := newTestScheduler(conn, now)
+	s.sendDue()
+	if Len(t, s.sent, 1) {
+		Equal(t, "1 x en", s.sent[0].Subject)
+		Equal(t, "<p>desired profession driver</p>", s.sent[0].HTML)
+	}
+}
+
+func zipFileNames(t *testing.T, attachment models.EmailAttachment) []string {
+	zipReader, err := zip.NewReader(bytes.NewReader(attachment.Content), int64(len(attachment.Content)))
+	NoError(t, err)
+	names := []string{}
+	for _, f := range zipReader.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestSendDueSplitsLargeDigests(t *testing.T) {
+	conn := testingdb.NewDB()
+	now := time.Date(2022, time.March, 16, 10, 30, 0, 0, time.UTC)
+	for _, referenceNr := range []string{"1", "2", "3"} {
+		insertDigestMatch(t, conn, now.Add(-time.Hour), "a@example.com", models.ProfileEmailDeliveryHourly, referenceNr)
+	}
+
+	// Only 2 PDFs fit in a single attachment
+	s := newTestScheduler(conn, now)
+	s.maxAttachmentSize = 600
+	sendMail := s.sendMail
+	s.sendMail = func(message models.EmailMessage, profileIDs, matchIDs []primitive.ObjectID) error {
+		if len(s.sent) == 1 {
+			return errors.New("email service unavailable")
+		}
+		return sendMail(message, profileIDs, matchIDs)
+	}
+	s.sendDue()
+	if Len(t, s.sent, 1) {
+		Equal(t, "2 nieuwe matches", s.sent[0].Subject)
+		Len(t, s.sentMatchIDs[0], 2)
+		if Len(t, s.sent[0].Attachments, 1) {
+			Equal(t, []string{"1-1.pdf", "2-2.pdf"}, zipFileNames(t, s.sent[0].Attachments[0]))
+		}
+	}
+	// Only the matches of the part that failed are kept
+	Equal(t, 1, countDigestMatches(t, conn))
+
+	s = newTestScheduler(conn, now)
+	s.maxAttachmentSize = 600
+	s.sendDue()
+	if Len(t, s.sent, 1) && Len(t, s.sent[0].Attachments, 1) {
+		Equal(t, []string{"1-3.pdf"}, zipFileNames(t, s.sent[0].Attachments[0]))
+	}
+	Equal(t, 0, countDigestMatches(t, conn))
+
+	// PDFs that are too large to attach are left out
+	insertDigestMatch(t, conn, now.Add(-time.Hour), "a@example.com", models.ProfileEmailDeliveryHourly, "4")
+	s = newTestScheduler(conn, now)
+	s.maxAttachmentSize = 100
+	s.sendDue()
+	if Len(t, s.sent, 1) {
+		Empty(t, s.sent[0].Attachments)
+	}
+	Equal(t, 0, countDigestMatches(t, conn))
+}
@@ -0,0 +1,199 @@
+package emailservice
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dkimSignedHeaders are the headers included in the DKIM signature if they are present in the email
+var dkimSignedHeaders = []string{
+	"From",
+	"Reply-To",
+	"To",
+	"Cc",
+	"Subject",
+	"Date",
+	"Message-Id",
+	"Mime-Version",
+	"Content-Type",
+	"Content-Transfer-Encoding",
+}
+
+// DKIMSigner signs emails using DKIM (RFC 6376) with the rsa-sha256 algorithm and relaxed/relaxed canonicalization
+// The public key must be published in the TXT record <selector>._domainkey.<domain>
+type DKIMSigner struct {
+	domain   string
+	selector string
+	key      *rsa.PrivateKey
+	// now returns the current time, can be replaced in tests
+	now func() time.Time
+}
+
+// NewDKIMSigner creates a DKIM signer from a PEM encoded RSA private key in the PKCS #1 or PKCS #8 format
+func NewDKIMSigner(domain, selector string, privateKeyPEM []byte) (*DKIMSigner, error) {
+	if domain == "" {
+		return nil, errors.New("dkim: domain must be set")
+	}
+	if selector == "" {
+		return nil, errors.New("dkim: selector must be set")
+	}
+
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("dkim: private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsedKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("dkim: %s", err.Error())
+		}
+		key = parsedKey
+	case "PRIVATE KEY":
+		parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("dkim: %s", err.Error())
+		}
+		rsaKey, ok := parsedKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("dkim: only RSA private keys are supported")
+		}
+		key = rsaKey
+	default:
+		return nil, fmt.Errorf("dkim: unsupported PEM block %s, expected a RSA PRIVATE KEY or PRIVATE KEY", block.Type)
+	}
+
+	return &DKIMSigner{
+		domain:   domain,
+		selector: selector,
+		key:      key,
+		now:      time.Now,
+	}, nil
+}
+
+// Sign returns the message with a DKIM-Signature header prepended
+// The message must use CRLF line endings as generated by (*email.Email).Bytes
+func (s *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	header, body := splitMessage(message)
+	fields := parseHeaderFields(header)
+
+	bodyHash := sha256.Sum256(dkimRelaxedBody(body))
+
+	// Per header name the last instance is signed
+	signedNames := []string{}
+	signedFields := []string{}
+	for _, name := range dkimSignedHeaders {
+		for idx := len(fields) - 1; idx >= 0; idx-- {
+			if strings.EqualFold(headerFieldName(fields[idx]), name) {
+				signedNames = append(signedNames, strings.ToLower(name))
+				signedFields = append(signedFields, fields[idx])
+				break
+			}
+		}
+	}
+	if len(signedNames) == 0 || signedNames[0] != "from" {
+		return nil, errors.New("dkim: the email has no From header")
+	}
+
+	signatureField := "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;\r\n" +
+		"\td=" + s.domain + "; s=" + s.selector + "; t=" + fmt.Sprint(s.now().Unix()) + ";\r\n" +
+		"\th=" + strings.Join(signedNames, ":") + ";\r\n" +
+		"\tbh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n" +
+		"\tb="
+
+	hash := sha256.New()
+	for _, field := range signedFields {
+		hash.Write([]byte(dkimRelaxedHeader(field)))
+	}
+	// The signature header itself is signed without the value of b= and without the trailing CRLF
+	hash.Write([]byte(strings.TrimSuffix(dkimRelaxedHeader(signatureField), "\r\n")))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("dkim: %s", err.Error())
+	}
+
+	signed := bytes.NewBufferString(signatureField)
+	signed.WriteString(base64.StdEncoding.EncodeToString(signature))
+	signed.WriteString("\r\n")
+	signed.Write(message)
+	return signed.Bytes(), nil
+}
+
+// splitMessage splits a message in the header, including the CRLF of the last header field, and the body
+func splitMessage(message []byte) (header []byte, body []byte) {
+	idx := bytes.Index(message, []byte("\r\n\r\n"))
+	if idx == -1 {
+		return message, nil
+	}
+	return message[:idx+2], message[idx+4:]
+}
+
+// parseHeaderFields splits a header in its fields, a field includes its continuation lines and trailing CRLF
+func parseHeaderFields(header []byte) []string {
+	fields := []string{}
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+		} else {
+			fields = append(fields, line)
+		}
+	}
+	return fields
+}
+
+// headerFieldName returns the name of a header field
+func headerFieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimRight(name, " \t")
+}
+
+// dkimRelaxedHeader returns the relaxed canonicalization of a header field (RFC 6376 section 3.4.2)
+func dkimRelaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	name = strings.ToLower(strings.TrimRight(name, " \t"))
+	value = strings.NewReplacer("\r\n", "").Replace(value)
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return name + ":" + value + "\r\n"
+}
+
+// dkimRelaxedBody returns the relaxed canonicalization of a body (RFC 6376 section 3.4.4)
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for idx, line := range lines {
+		// Reduce all sequences of whitespace within a line to a single space and remove the whitespace at the end
+		canonical := strings.Join(strings.FieldsFunc(line, isWSP), " ")
+		if len(line) > 0 && isWSP(rune(line[0])) && canonical != "" {
+			canonical = " " + canonical
+		}
+		lines[idx] = canonical
+	}
+
+	// Ignore all empty lines at the end of the body
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
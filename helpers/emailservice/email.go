@@ -1,116 +1,384 @@
 package emailservice
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"errors"
-	"net/smtp"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/jordan-wright/email"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/shutdown"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var ch = make(chan *email.Email)
-
-// SendMail sends an email based on the given content
-func SendMail(content *email.Email) {
-	if content == nil {
-		return
-	}
-	ch <- content
-}
-
 // EmailServerConfiguration contains the configuration for the email server
 type EmailServerConfiguration struct {
 	// Hostname and Port of the smtp server
 	Host string
 	Port string
 
+	// TLSMode defines how the connection to the server is secured,
+	// if empty TLSModeImplicit is used for port 465 and TLSModeStartTLS for other ports
+	TLSMode TLSMode
+	// TLSCAFile is an optional PEM file with the certificate authorities used to verify the certificate of the server,
+	// if empty the system certificate authorities are used
+	TLSCAFile string
+	// TLSSkipVerify disables the verification of the certificate of the server, only use this for testing
+	TLSSkipVerify bool
+
 	// Authentication fields
-	Identity string
-	Username string
-	Password string
+	// AuthMethod is the SMTP authentication mechanism,
+	// if empty AuthMethodPlain is used if a username is set and otherwise AuthMethodNone
+	AuthMethod AuthMethod
+	Identity   string
+	Username   string
+	Password   string
 
 	// The email address to send emails from
 	From string
+
+	// DKIM signing is enabled if DKIMPrivateKeyFile is set
+	// DKIMPrivateKeyFile is a PEM file with the RSA private key used to sign the emails
+	DKIMPrivateKeyFile string
+	// DKIMSelector is the selector of the DNS record containing the public key
+	DKIMSelector string
+	// DKIMDomain is the signing domain, if empty the domain of From is used
+	DKIMDomain string
 }
 
 // EmailServerConfigurationFromEnv generates the EmailServerConfiguration from the environment variables
 func EmailServerConfigurationFromEnv() EmailServerConfiguration {
 	return EmailServerConfiguration{
-		Identity: os.Getenv("EMAIL_IDENTITY"),
-		Username: os.Getenv("EMAIL_USER"),
-		Password: os.Getenv("EMAIL_PASSWORD"),
-		Host:     os.Getenv("EMAIL_HOST"),
-		Port:     os.Getenv("EMAIL_PORT"),
-		From:     os.Getenv("EMAIL_FROM"),
-	}
-}
-
-// ErrNoConf = email service not configured
-var ErrNoConf = errors.New("email service not configured")
-
-// Setup sets up the email sender
-func Setup(conf EmailServerConfiguration, onMailSend func(err error)) error {
-	if conf.Host == "" || conf.From == "" {
-		log.Warn("Email not configured (EMAIL_HOST and EMAIL_FROM must be set), DISABELING EMAIL SUPPORT")
-		go func() {
-			for data := range ch {
-				log.Infof("sending no mail to %v as email server is not configured", data.To)
-				if onMailSend != nil {
-					onMailSend(ErrNoConf)
-				}
+		Identity:           os.Getenv("EMAIL_IDENTITY"),
+		Username:           os.Getenv("EMAIL_USER"),
+		Password:           os.Getenv("EMAIL_PASSWORD"),
+		Host:               os.Getenv("EMAIL_HOST"),
+		Port:               os.Getenv("EMAIL_PORT"),
+		From:               os.Getenv("EMAIL_FROM"),
+		TLSMode:            TLSMode(strings.ToLower(os.Getenv("EMAIL_TLS_MODE"))),
+		TLSCAFile:          os.Getenv("EMAIL_TLS_CA_FILE"),
+		TLSSkipVerify:      strings.ToLower(os.Getenv("EMAIL_TLS_SKIP_VERIFY")) == "true",
+		AuthMethod:         AuthMethod(strings.ToLower(os.Getenv("EMAIL_AUTH_METHOD"))),
+		DKIMPrivateKeyFile: os.Getenv("EMAIL_DKIM_PRIVATE_KEY_FILE"),
+		DKIMSelector:       os.Getenv("EMAIL_DKIM_SELECTOR"),
+		DKIMDomain:         os.Getenv("EMAIL_DKIM_DOMAIN"),
+	}
+}
+
+// Options contains the settings of a Service
+type Options struct {
+	// MaxAttempts is the amount of times an email is tried before it's marked as failed
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry, every next retry waits twice as long
+	RetryDelay time.Duration
+	// MaxConcurrent is the maximum amount of emails sent at the same time
+	MaxConcurrent int
+}
+
+// DefaultOptions are the options used for values that are not set
+var DefaultOptions = Options{
+	MaxAttempts:   4,
+	RetryDelay:    time.Second,
+	MaxConcurrent: 4,
+}
+
+// OptionsFromEnv returns the options defined in the EMAIL_MAX_ATTEMPTS and EMAIL_MAX_CONCURRENT env variables
+func OptionsFromEnv() Options {
+	opts := DefaultOptions
+
+	envInt := func(key string, fallback int) int {
+		value := os.Getenv(key)
+		if value == "" {
+			return fallback
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			log.WithField("value", value).Warnf("invalid %s, using the default value %d", key, fallback)
+			return fallback
+		}
+		return parsed
+	}
+	opts.MaxAttempts = envInt("EMAIL_MAX_ATTEMPTS", opts.MaxAttempts)
+	opts.MaxConcurrent = envInt("EMAIL_MAX_CONCURRENT", opts.MaxConcurrent)
+
+	return opts
+}
+
+// MaxAttachmentsSize is the maximum total size in bytes of the attachments of an email
+// The attachments are stored in the database until the email is sent and most mail servers refuse emails larger than 10 to 25MB
+const MaxAttachmentsSize = 10 * 1024 * 1024
+
+var (
+	// ErrShuttingDown is returned by (*Service).Send once the email service is shutting down
+	ErrShuttingDown = errors.New("the email service is shutting down")
+	// ErrNotRetryable is returned by (*Service).Retry for deliveries that are not failed or have no message
+	ErrNotRetryable = errors.New("only failed email deliveries of which the message is kept can be retried")
+	// ErrAttachmentsTooLarge is returned by (*Service).Send if the attachments of the message exceed MaxAttachmentsSize
+	ErrAttachmentsTooLarge = fmt.Errorf("the attachments of the email exceed the maximum size of %dMB", MaxAttachmentsSize/1024/1024)
+)
+
+// Service sends emails in the background using a Transport
+// Every email is logged in the database as a models.EmailDelivery
+type Service struct {
+	dbConn    db.Connection
+	transport Transport
+	opts      Options
+	// now returns the current time, can be replaced in tests
+	now func() time.Time
+
+	m            sync.Mutex
+	shuttingDown bool
+	// semaphore limits the amount of emails sent at the same time
+	semaphore chan struct{}
+	// inProgress contains the deliveries that are not yet finished
+	inProgress sync.WaitGroup
+}
+
+// NewService creates a new email service that sends the emails using transport
+func NewService(dbConn db.Connection, transport Transport, opts Options) *Service {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultOptions.MaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultOptions.RetryDelay
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = DefaultOptions.MaxConcurrent
+	}
+
+	return &Service{
+		dbConn:    dbConn,
+		transport: transport,
+		opts:      opts,
+		now:       time.Now,
+		semaphore: make(chan struct{}, opts.MaxConcurrent),
+	}
+}
+
+// ResumeInterruptedDeliveries sends the deliveries that were still queued during the last shutdown of the server
+// This should be called once on startup
+func (s *Service) ResumeInterruptedDeliveries() {
+	deliveries, err := models.GetQueuedEmailDeliveries(s.dbConn)
+	if err != nil {
+		log.WithError(err).Error("unable to get the interrupted email deliveries")
+		return
+	}
+
+	resumed := 0
+	for idx := range deliveries {
+		delivery := &deliveries[idx]
+		logger := log.WithField("delivery_id", delivery.ID.Hex())
+
+		err = s.loadMessage(delivery)
+		if err != nil {
+			// Without the message the email can't be sent anymore
+			logger.WithError(err).Error("unable to resume an interrupted email delivery")
+			delivery.Status = models.EmailDeliveryStatusFailed
+			delivery.LastError = "unable to resume the delivery after a restart of the server, " + err.Error()
+			delivery.UpdatedAt = jsonHelpers.RFC3339Nano(s.now())
+			err = s.dbConn.UpdateByID(delivery)
+			if err != nil {
+				logger.WithError(err).Error("unable to update email delivery log")
 			}
-		}()
-		return nil
+			continue
+		}
+
+		err = s.queue(delivery, false)
+		if err != nil {
+			logger.WithError(err).Error("unable to resume an interrupted email delivery")
+			continue
+		}
+		resumed++
 	}
-	if conf.Port == "" {
-		conf.Port = "25"
+
+	if resumed > 0 {
+		log.WithField("count", resumed).Info("Resumed email deliveries interrupted by a restart")
+	}
+}
+
+// loadMessage loads the attachment contents of the message of a delivery stored in the database
+func (s *Service) loadMessage(delivery *models.EmailDelivery) error {
+	if delivery.Message == nil {
+		return errors.New("the message of the email is not kept")
+	}
+	return delivery.Message.LoadAttachmentContents(s.dbConn)
+}
+
+// Send logs a new delivery and sends message in the background
+// profileIDs and matchIDs are the profiles and matches the email is about
+func (s *Service) Send(message models.EmailMessage, profileIDs, matchIDs []primitive.ObjectID) error {
+	if message.Size() > MaxAttachmentsSize {
+		return ErrAttachmentsTooLarge
+	}
+
+	now := s.now()
+	delivery := &models.EmailDelivery{
+		M:          db.NewM(),
+		To:         message.To,
+		Subject:    message.Subject,
+		ProfileIDs: profileIDs,
+		MatchIDs:   matchIDs,
+		Status:     models.EmailDeliveryStatusQueued,
+		Message:    &message,
+		CreatedAt:  jsonHelpers.RFC3339Nano(now),
+		UpdatedAt:  jsonHelpers.RFC3339Nano(now),
+	}
+	return s.queue(delivery, true)
+}
+
+// Retry sends a failed delivery again
+// Returns an error wrapping ErrNotRetryable if the delivery is not failed or its message is not kept
+func (s *Service) Retry(delivery models.EmailDelivery) error {
+	if delivery.Status != models.EmailDeliveryStatusFailed || delivery.Message == nil {
+		return ErrNotRetryable
+	}
+	err := s.loadMessage(&delivery)
+	if err != nil {
+		return fmt.Errorf("%w, %s", ErrNotRetryable, err.Error())
+	}
+
+	delivery.Status = models.EmailDeliveryStatusQueued
+	delivery.LastError = ""
+	delivery.UpdatedAt = jsonHelpers.RFC3339Nano(s.now())
+	return s.queue(&delivery, false)
+}
+
+// queue stores the delivery and sends it in the background
+func (s *Service) queue(delivery *models.EmailDelivery, isNew bool) error {
+	s.m.Lock()
+	if s.shuttingDown {
+		s.m.Unlock()
+		return ErrShuttingDown
+	}
+	s.inProgress.Add(1)
+	s.m.Unlock()
+
+	var err error
+	if isNew && delivery.Message != nil {
+		// The attachments are stored separately so they are not part of the delivery
+		err = delivery.Message.StoreAttachmentContents(s.dbConn, delivery.ID)
+		if err != nil {
+			s.inProgress.Done()
+			return err
+		}
+	}
+
+	// The database might keep a reference to the entry so we always store a copy of the delivery
+	stored := *delivery
+	if isNew {
+		err = s.dbConn.Insert(&stored)
 	} else {
-		parsedPort, err := strconv.Atoi(conf.Port)
-		if err != nil || parsedPort <= 0 {
-			return errors.New("invalid port number " + conf.Port)
+		err = s.dbConn.UpdateByID(&stored)
+	}
+	if err != nil {
+		if isNew && delivery.Message != nil {
+			delivery.Message.DeleteAttachmentContents(s.dbConn)
 		}
+		s.inProgress.Done()
+		return err
 	}
 
-	poolSize := 4
+	go func() {
+		defer s.inProgress.Done()
+		s.deliver(delivery)
+	}()
+	return nil
+}
+
+// deliver sends the message of delivery and retries it if that fails
+func (s *Service) deliver(delivery *models.EmailDelivery) {
+	logger := log.WithField("delivery_id", delivery.ID.Hex()).WithField("to", delivery.To)
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			logger.Info("retrying sending mail")
+		} else {
+			logger.Info("sending mail")
+		}
+
+		err := s.attempt(delivery.Message)
+		delivery.Attempts++
+		delivery.LastError = ""
+		switch {
+		case err == nil:
+			delivery.Status = models.EmailDeliveryStatusSent
+			// The message is only needed for retries
+			deleteErr := delivery.Message.DeleteAttachmentContents(s.dbConn)
+			if deleteErr != nil {
+				logger.WithError(deleteErr).Error("unable to remove the attachments of a sent email")
+			}
+			delivery.Message = nil
+		case err == ErrNoConf || attempt >= s.opts.MaxAttempts:
+			delivery.Status = models.EmailDeliveryStatusFailed
+			delivery.LastError = err.Error()
+			logger.WithError(err).WithField("attempts", delivery.Attempts).Error("unable to send email")
+		default:
+			delivery.LastError = err.Error()
+			logger.WithError(err).Error("sending email")
+		}
+
+		delivery.UpdatedAt = jsonHelpers.RFC3339Nano(s.now())
+		updated := *delivery
+		updateErr := s.dbConn.UpdateByID(&updated)
+		if updateErr != nil {
+			logger.WithError(updateErr).Error("unable to update email delivery log")
+		}
 
-	auth := smtp.PlainAuth(conf.Identity, conf.Username, conf.Password, conf.Host)
-	tlsConfig := tls.Config{
-		ServerName:         conf.Host,
-		InsecureSkipVerify: true,
+		if delivery.Status != models.EmailDeliveryStatusQueued {
+			return
+		}
+		time.Sleep(s.retryDelay(attempt))
 	}
-	address := conf.Host + ":" + conf.Port
+}
 
-	for i := 0; i < poolSize; i++ {
-		go func(from string, auth smtp.Auth, tlsConfig tls.Config, address string) {
-			for e := range ch {
-				retryCount := 0
-				for retryCount < 4 {
-					if retryCount > 0 {
-						log.Infof("retrying sending mail to %v", e.To)
-					} else {
-						log.Infof("sending mail to %s", e.To)
-					}
+// attempt sends message once while respecting the concurrency limit
+func (s *Service) attempt(message *models.EmailMessage) error {
+	s.semaphore <- struct{}{}
+	defer func() { <-s.semaphore }()
 
-					e.From = from
+	e := email.NewEmail()
+	e.To = message.To
+	e.Subject = message.Subject
+	e.HTML = []byte(message.HTML)
+	e.Text = []byte(message.Text)
+	for _, attachment := range message.Attachments {
+		_, err := e.Attach(bytes.NewReader(attachment.Content), attachment.Filename, attachment.ContentType)
+		if err != nil {
+			return err
+		}
+	}
 
-					err := e.SendWithStartTLS(address, auth, &tlsConfig)
-					if onMailSend != nil {
-						onMailSend(err)
-					}
+	return s.transport.Send(e)
+}
 
-					if err == nil {
-						break
-					}
-					log.WithError(err).Error("sending email")
-					retryCount++
-				}
-			}
-		}(conf.From, auth, tlsConfig, address)
+// retryDelay returns the delay before the next attempt of a delivery that failed attempts times
+func (s *Service) retryDelay(attempts int) time.Duration {
+	delay := s.opts.RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
 	}
+	return delay
+}
 
-	log.Info("Email service running..")
+// Shutdown stops accepting new emails and waits for the queued emails to be sent or ctx to expire
+// Emails that are not sent are resumed on the next start by ResumeInterruptedDeliveries
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.m.Lock()
+	s.shuttingDown = true
+	s.m.Unlock()
+
+	err := shutdown.WaitGroup(ctx, &s.inProgress)
+	if err != nil {
+		return fmt.Errorf("not all emails are sent: %s", err.Error())
+	}
 	return nil
 }
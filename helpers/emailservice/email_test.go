@@ -0,0 +1,285 @@
+package emailservice
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	"github.com/script-development/RT-CV/helpers/shutdown"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestService(transport Transport) (*Service, db.Connection) {
+	conn := testingdb.NewDB()
+	return NewService(conn, transport, Options{MaxAttempts: 3, RetryDelay: time.Millisecond}), conn
+}
+
+func testMessage(to string) models.EmailMessage {
+	return models.EmailMessage{
+		To:      []string{to},
+		Subject: "subject",
+		HTML:    "<p>body</p>",
+		Text:    "body",
+		Attachments: []models.EmailAttachment{{
+			Filename:    "match.pdf",
+			ContentType: "application/pdf",
+			Content:     []byte("pdf content"),
+		}},
+	}
+}
+
+func waitForDeliveries(t *testing.T, s *Service) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// Waits for the deliveries in progress without shutting down the service
+	NoError(t, shutdown.WaitGroup(ctx, &s.inProgress))
+}
+
+func getDeliveries(t *testing.T, conn db.Connection) []models.EmailDelivery {
+	deliveries, err := models.GetEmailDeliveries(conn, nil, models.Page{})
+	NoError(t, err)
+	return deliveries
+}
+
+func countAttachmentContents(t *testing.T, conn db.Connection) uint64 {
+	count, err := conn.Count(&models.EmailAttachmentContent{}, nil)
+	NoError(t, err)
+	return count
+}
+
+// withoutAttachmentContents returns the delivery as it would be read from the database,
+// the testing database keeps the attachment contents that are not stored in a real database
+func withoutAttachmentContents(t *testing.T, delivery models.EmailDelivery) models.EmailDelivery {
+	data, err := bson.Marshal(delivery)
+	NoError(t, err)
+	res := models.EmailDelivery{}
+	NoError(t, bson.Unmarshal(data, &res))
+	return res
+}
+
+func TestSend(t *testing.T) {
+	transport := NewMemoryTransport()
+	s, conn := newTestService(transport)
+
+	profileID := primitive.NewObjectID()
+	matchID := primitive.NewObjectID()
+	NoError(t, s.Send(testMessage("a@example.com"), []primitive.ObjectID{profileID}, []primitive.ObjectID{matchID}))
+	waitForDeliveries(t, s)
+
+	sent := transport.Sent()
+	if Len(t, sent, 1) {
+		Equal(t, []string{"a@example.com"}, sent[0].To)
+		Equal(t, "subject", sent[0].Subject)
+		Equal(t, "<p>body</p>", string(sent[0].HTML))
+		if Len(t, sent[0].Attachments, 1) {
+			Equal(t, "match.pdf", sent[0].Attachments[0].Filename)
+			Equal(t, "pdf content", string(sent[0].Attachments[0].Content))
+		}
+	}
+
+	deliveries := getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		delivery := deliveries[0]
+		Equal(t, models.EmailDeliveryStatusSent, delivery.Status)
+		Equal(t, 1, delivery.Attempts)
+		Equal(t, []primitive.ObjectID{profileID}, delivery.ProfileIDs)
+		Equal(t, []primitive.ObjectID{matchID}, delivery.MatchIDs)
+		// The message is not kept after it is sent
+		Nil(t, delivery.Message)
+	}
+	Equal(t, uint64(0), countAttachmentContents(t, conn))
+}
+
+func TestSendAttachmentsTooLarge(t *testing.T) {
+	transport := NewMemoryTransport()
+	s, conn := newTestService(transport)
+
+	message := testMessage("a@example.com")
+	message.Attachments[0].Content = make([]byte, MaxAttachmentsSize+1)
+	Equal(t, ErrAttachmentsTooLarge, s.Send(message, nil, nil))
+	waitForDeliveries(t, s)
+
+	Empty(t, transport.Sent())
+	Empty(t, getDeliveries(t, conn))
+	Equal(t, uint64(0), countAttachmentContents(t, conn))
+}
+
+func TestSendFailsAndRetry(t *testing.T) {
+	transport := NewMemoryTransport()
+	transport.SetError(errors.New("connection refused"))
+	s, conn := newTestService(transport)
+
+	NoError(t, s.Send(testMessage("a@example.com"), nil, nil))
+	waitForDeliveries(t, s)
+
+	deliveries := getDeliveries(t, conn)
+	if !Len(t, deliveries, 1) {
+		return
+	}
+	delivery := deliveries[0]
+	Equal(t, models.EmailDeliveryStatusFailed, delivery.Status)
+	Equal(t, 3, delivery.Attempts)
+	Equal(t, "connection refused", delivery.LastError)
+	NotNil(t, delivery.Message)
+	Empty(t, transport.Sent())
+
+	// The attachment contents are stored separately from the delivery
+	delivery = withoutAttachmentContents(t, delivery)
+	if Len(t, delivery.Message.Attachments, 1) {
+		Nil(t, delivery.Message.Attachments[0].Content)
+		Equal(t, len("pdf content"), delivery.Message.Attachments[0].Size)
+	}
+	Equal(t, uint64(1), countAttachmentContents(t, conn))
+
+	transport.SetError(nil)
+	NoError(t, s.Retry(delivery))
+	waitForDeliveries(t, s)
+
+	delivery, err := models.GetEmailDelivery(conn, delivery.ID)
+	NoError(t, err)
+	Equal(t, models.EmailDeliveryStatusSent, delivery.Status)
+	Equal(t, 4, delivery.Attempts)
+	Empty(t, delivery.LastError)
+	if Len(t, transport.Sent(), 1) && Len(t, transport.Sent()[0].Attachments, 1) {
+		Equal(t, "pdf content", string(transport.Sent()[0].Attachments[0].Content))
+	}
+	Equal(t, uint64(0), countAttachmentContents(t, conn))
+
+	// Sent deliveries can't be retried
+	Equal(t, ErrNotRetryable, s.Retry(delivery))
+}
+
+func TestSendNotConfigured(t *testing.T) {
+	s, conn := newTestService(DisabledTransport{})
+
+	NoError(t, s.Send(testMessage("a@example.com"), nil, nil))
+	waitForDeliveries(t, s)
+
+	// ErrNoConf is not retried
+	deliveries := getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		Equal(t, models.EmailDeliveryStatusFailed, deliveries[0].Status)
+		Equal(t, 1, deliveries[0].Attempts)
+		Equal(t, ErrNoConf.Error(), deliveries[0].LastError)
+	}
+}
+
+func TestResumeInterruptedDeliveries(t *testing.T) {
+	transport := NewMemoryTransport()
+	s, conn := newTestService(transport)
+
+	// A delivery that was queued when the server stopped, stored like a real database would store it
+	message := testMessage("a@example.com")
+	queued := models.EmailDelivery{M: db.NewM(), Status: models.EmailDeliveryStatusQueued, Message: &message}
+	NoError(t, message.StoreAttachmentContents(conn, queued.ID))
+	queued = withoutAttachmentContents(t, queued)
+	withoutMessage := &models.EmailDelivery{M: db.NewM(), Status: models.EmailDeliveryStatusQueued}
+	sent := &models.EmailDelivery{M: db.NewM(), Status: models.EmailDeliveryStatusSent}
+	NoError(t, conn.Insert(&queued, withoutMessage, sent))
+
+	s.ResumeInterruptedDeliveries()
+	waitForDeliveries(t, s)
+
+	if Len(t, transport.Sent(), 1) && Len(t, transport.Sent()[0].Attachments, 1) {
+		Equal(t, "pdf content", string(transport.Sent()[0].Attachments[0].Content))
+	}
+
+	delivery, err := models.GetEmailDelivery(conn, queued.ID)
+	NoError(t, err)
+	Equal(t, models.EmailDeliveryStatusSent, delivery.Status)
+	Equal(t, uint64(0), countAttachmentContents(t, conn))
+
+	// Deliveries without a message can't be resumed
+	delivery, err = models.GetEmailDelivery(conn, withoutMessage.ID)
+	NoError(t, err)
+	Equal(t, models.EmailDeliveryStatusFailed, delivery.Status)
+	NotEmpty(t, delivery.LastError)
+
+	delivery, err = models.GetEmailDelivery(conn, sent.ID)
+	NoError(t, err)
+	Equal(t, models.EmailDeliveryStatusSent, delivery.Status)
+}
+
+func TestShutdown(t *testing.T) {
+	transport := NewMemoryTransport()
+	s, _ := newTestService(transport)
+
+	for i := 0; i < 3; i++ {
+		NoError(t, s.Send(testMessage("a@example.com"), nil, nil))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	NoError(t, s.Shutdown(ctx))
+	Len(t, transport.Sent(), 3)
+
+	// New emails should be refused after the shutdown
+	Equal(t, ErrShuttingDown, s.Send(testMessage("a@example.com"), nil, nil))
+}
+
+func TestMboxTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emails.mbox")
+	s, _ := newTestService(NewMboxTransport(path, "rtcv@example.com"))
+
+	message := testMessage("a@example.com")
+	message.Text = "From the start of a line"
+	NoError(t, s.Send(message, nil, nil))
+	waitForDeliveries(t, s)
+	NoError(t, s.Send(testMessage("b@example.com"), nil, nil))
+	waitForDeliveries(t, s)
+
+	content, err := os.ReadFile(path)
+	NoError(t, err)
+	Equal(t, 2, strings.Count(string(content), "From rtcv@example.com "))
+	Contains(t, string(content), "To: <a@example.com>")
+	Contains(t, string(content), "To: <b@example.com>")
+	Contains(t, string(content), ">From the start of a line")
+}
+
+func tryLoadEmailEnv() {
+	for _, envFileName := range []string{".env", "../../.env"} {
+		env, err := godotenv.Read(envFileName)
+		if err != nil {
+			continue
+		}
+
+		// Set mail env vars
+		for key, value := range env {
+			if strings.HasPrefix(key, "EMAIL_") && os.Getenv(key) == "" {
+				os.Setenv(key, value)
+			}
+		}
+		return
+	}
+}
+
+func TestSendMailUsingEnv(t *testing.T) {
+	tryLoadEmailEnv()
+
+	emailConf := EmailServerConfigurationFromEnv()
+	if emailConf.Host == "" || emailConf.From == "" {
+		t.Skip("Missing email server env variables to test sending emails")
+	}
+
+	transport, err := NewSMTPTransport(emailConf)
+	NoError(t, err)
+	s, conn := newTestService(transport)
+
+	NoError(t, s.Send(testMessage("example@localhost"), nil, nil))
+	waitForDeliveries(t, s)
+
+	deliveries := getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		Equal(t, models.EmailDeliveryStatusSent, deliveries[0].Status, deliveries[0].LastError)
+	}
+}
@@ -0,0 +1,318 @@
+package emailservice
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jordan-wright/email"
+)
+
+// TLSMode defines how the connection to the smtp server is secured
+type TLSMode string
+
+const (
+	// TLSModeImplicit connects using TLS, this is usually done on port 465
+	TLSModeImplicit = TLSMode("tls")
+	// TLSModeStartTLS upgrades the connection using STARTTLS and fails if the server does not support it
+	TLSModeStartTLS = TLSMode("starttls")
+	// TLSModeStartTLSOptional upgrades the connection using STARTTLS if the server supports it
+	TLSModeStartTLSOptional = TLSMode("starttls-optional")
+	// TLSModeNone never encrypts the connection, this should only be used with a local development mail server
+	TLSModeNone = TLSMode("none")
+)
+
+// Valid returns whether m is a known TLS mode
+func (m TLSMode) Valid() bool {
+	switch m {
+	case TLSModeImplicit, TLSModeStartTLS, TLSModeStartTLSOptional, TLSModeNone:
+		return true
+	default:
+		return false
+	}
+}
+
+// AuthMethod is the mechanism used to authenticate to the smtp server
+type AuthMethod string
+
+const (
+	// AuthMethodNone does not authenticate
+	AuthMethodNone = AuthMethod("none")
+	// AuthMethodPlain uses AUTH PLAIN, only allowed on encrypted connections
+	AuthMethodPlain = AuthMethod("plain")
+	// AuthMethodLogin uses AUTH LOGIN, only allowed on encrypted connections
+	AuthMethodLogin = AuthMethod("login")
+	// AuthMethodCRAMMD5 uses AUTH CRAM-MD5
+	AuthMethodCRAMMD5 = AuthMethod("cram-md5")
+)
+
+// ErrStartTLSNotSupported is returned when TLSModeStartTLS is used and the server does not support STARTTLS
+var ErrStartTLSNotSupported = errors.New("the smtp server does not support STARTTLS")
+
+// smtpTimeout is the maximum time sending a single email may take
+const smtpTimeout = time.Minute
+
+// SMTPTransport sends the emails to a SMTP server
+type SMTPTransport struct {
+	from         string
+	envelopeFrom string
+	host         string
+	address      string
+	tlsMode      TLSMode
+	tlsConfig    *tls.Config
+	auth         smtp.Auth
+	dkim         *DKIMSigner
+}
+
+// NewSMTPTransport creates a transport that sends the emails using the server in conf
+func NewSMTPTransport(conf EmailServerConfiguration) (*SMTPTransport, error) {
+	if conf.Host == "" || conf.From == "" {
+		return nil, ErrNoConf
+	}
+	if conf.Port == "" {
+		conf.Port = "25"
+	} else {
+		parsedPort, err := strconv.Atoi(conf.Port)
+		if err != nil || parsedPort <= 0 {
+			return nil, errors.New("invalid port number " + conf.Port)
+		}
+	}
+
+	fromAddress, err := mail.ParseAddress(conf.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %s: %s", conf.From, err.Error())
+	}
+
+	if conf.TLSMode == "" {
+		conf.TLSMode = TLSModeStartTLS
+		if conf.Port == "465" {
+			conf.TLSMode = TLSModeImplicit
+		}
+	} else if !conf.TLSMode.Valid() {
+		return nil, fmt.Errorf("unknown tls mode %s, expected tls, starttls, starttls-optional or none", conf.TLSMode)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         conf.Host,
+		InsecureSkipVerify: conf.TLSSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if conf.TLSCAFile != "" {
+		caPEM, err := os.ReadFile(conf.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the tls ca file: %s", err.Error())
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("the tls ca file contains no PEM encoded certificates")
+		}
+	}
+
+	if conf.AuthMethod == "" {
+		conf.AuthMethod = AuthMethodNone
+		if conf.Username != "" {
+			conf.AuthMethod = AuthMethodPlain
+		}
+	}
+	var auth smtp.Auth
+	switch conf.AuthMethod {
+	case AuthMethodNone:
+	case AuthMethodPlain:
+		auth = smtp.PlainAuth(conf.Identity, conf.Username, conf.Password, conf.Host)
+	case AuthMethodLogin:
+		auth = &loginAuth{username: conf.Username, password: conf.Password, host: conf.Host}
+	case AuthMethodCRAMMD5:
+		auth = smtp.CRAMMD5Auth(conf.Username, conf.Password)
+	default:
+		return nil, fmt.Errorf("unknown auth method %s, expected none, plain, login or cram-md5", conf.AuthMethod)
+	}
+
+	var dkim *DKIMSigner
+	if conf.DKIMPrivateKeyFile != "" {
+		keyPEM, err := os.ReadFile(conf.DKIMPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the dkim private key: %s", err.Error())
+		}
+		domain := conf.DKIMDomain
+		if domain == "" {
+			domain = fromAddress.Address[strings.LastIndex(fromAddress.Address, "@")+1:]
+		}
+		dkim, err = NewDKIMSigner(domain, conf.DKIMSelector, keyPEM)
+		if err != nil {
+			return nil, err
+		}
+	} else if conf.DKIMSelector != "" {
+		return nil, errors.New("a dkim selector is set without a dkim private key file")
+	}
+
+	return &SMTPTransport{
+		from:         conf.From,
+		envelopeFrom: fromAddress.Address,
+		host:         conf.Host,
+		address:      net.JoinHostPort(conf.Host, conf.Port),
+		tlsMode:      conf.TLSMode,
+		tlsConfig:    tlsConfig,
+		auth:         auth,
+		dkim:         dkim,
+	}, nil
+}
+
+// Send implements Transport
+func (t *SMTPTransport) Send(e *email.Email) error {
+	e.From = t.from
+	message, err := e.Bytes()
+	if err != nil {
+		return err
+	}
+	if t.dkim != nil {
+		message, err = t.dkim.Sign(message)
+		if err != nil {
+			return err
+		}
+	}
+
+	recipients := []string{}
+	for _, recipient := range append(append(append([]string{}, e.To...), e.Cc...), e.Bcc...) {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, address.Address)
+	}
+	if len(recipients) == 0 {
+		return errors.New("the email has no recipients")
+	}
+
+	c, err := t.connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.Mail(t.envelopeFrom)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		err = c.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// connect connects to the smtp server, secures the connection according to the tls mode and authenticates
+func (t *SMTPTransport) connect() (*smtp.Client, error) {
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if t.tlsMode == TLSModeImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.address, t.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", t.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = conn.SetDeadline(time.Now().Add(smtpTimeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	err = t.secureAndAuthenticate(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (t *SMTPTransport) secureAndAuthenticate(c *smtp.Client) error {
+	if t.tlsMode == TLSModeStartTLS || t.tlsMode == TLSModeStartTLSOptional {
+		supported, _ := c.Extension("STARTTLS")
+		if supported {
+			err := c.StartTLS(t.tlsConfig)
+			if err != nil {
+				return err
+			}
+		} else if t.tlsMode == TLSModeStartTLS {
+			return ErrStartTLSNotSupported
+		}
+	}
+
+	if t.auth == nil {
+		return nil
+	}
+	supported, _ := c.Extension("AUTH")
+	if !supported {
+		return errors.New("the smtp server does not support authentication")
+	}
+	return c.Auth(t.auth)
+}
+
+// loginAuth implements the LOGIN authentication mechanism
+// net/smtp only provides PLAIN and CRAM-MD5 but LOGIN is still required by some mail servers
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start implements smtp.Auth
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like smtp.PlainAuth we never send the password over an unencrypted connection to a remote server
+	isLocalhost := server.Name == "localhost" || server.Name == "127.0.0.1" || server.Name == "::1"
+	if !server.TLS && !isLocalhost {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next implements smtp.Auth
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	prompt := strings.ToLower(string(fromServer))
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt %s", fromServer)
+	}
+}
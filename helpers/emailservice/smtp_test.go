@@ -0,0 +1,420 @@
+package emailservice
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jordan-wright/email"
+	. "github.com/stretchr/testify/assert"
+)
+
+// smtpStubMessage is an email received by the smtp stub
+type smtpStubMessage struct {
+	from          string
+	to            []string
+	data          string
+	tls           bool
+	authMechanism string
+}
+
+// smtpStub is a minimal in process smtp server used to test the SMTPTransport
+type smtpStub struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	// startTLS makes the server advertise STARTTLS
+	startTLS bool
+	// authMechanisms are the advertised authentication mechanisms
+	authMechanisms []string
+	username       string
+	password       string
+
+	m        sync.Mutex
+	messages []smtpStubMessage
+}
+
+// newTestCertificate creates a self signed certificate for 127.0.0.1
+// The certificate is also written to a PEM file so it can be used as ca file
+func newTestCertificate(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rtcv smtp stub"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+// newSMTPStub starts a smtp stub, if implicitTLS is set the listener only accepts TLS connections
+// Returns the stub and the ca file that can be used to verify its certificate
+func newSMTPStub(t *testing.T, implicitTLS bool, configure func(*smtpStub)) (*smtpStub, string) {
+	cert, caFile := newTestCertificate(t)
+	stub := &smtpStub{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		username:  "user",
+		password:  "secret",
+	}
+	if configure != nil {
+		configure(stub)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	if implicitTLS {
+		listener = tls.NewListener(listener, stub.tlsConfig)
+	}
+	stub.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.handle(conn)
+		}
+	}()
+
+	return stub, caFile
+}
+
+// conf returns the configuration to send mails to the stub
+func (s *smtpStub) conf() EmailServerConfiguration {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return EmailServerConfiguration{
+		Host:     "127.0.0.1",
+		Port:     port,
+		From:     "RT-CV <rtcv@example.com>",
+		Username: s.username,
+		Password: s.password,
+	}
+}
+
+func (s *smtpStub) received() []smtpStubMessage {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]smtpStubMessage{}, s.messages...)
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	_, isTLS := conn.(*tls.Conn)
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 127.0.0.1 ESMTP stub")
+
+	message := smtpStubMessage{}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			extensions := []string{"127.0.0.1"}
+			if s.startTLS && !isTLS {
+				extensions = append(extensions, "STARTTLS")
+			}
+			if len(s.authMechanisms) > 0 {
+				extensions = append(extensions, "AUTH "+strings.Join(s.authMechanisms, " "))
+			}
+			for idx, extension := range extensions {
+				separator := "-"
+				if idx == len(extensions)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, extension)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			mechanism, ok := s.auth(text, arg)
+			if !ok {
+				text.PrintfLine("535 authentication failed")
+				continue
+			}
+			message.authMechanism = mechanism
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			message.from = arg
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			message.to = append(message.to, arg)
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 send the data")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			message.tls = isTLS
+			s.m.Lock()
+			s.messages = append(s.messages, message)
+			s.m.Unlock()
+			message = smtpStubMessage{}
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// auth handles the AUTH command and returns the used mechanism and if the credentials are valid
+func (s *smtpStub) auth(text *textproto.Conn, arg string) (string, bool) {
+	mechanism, initialResponse, _ := strings.Cut(arg, " ")
+	mechanism = strings.ToUpper(mechanism)
+
+	challenge := func(prompt string) string {
+		text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, _ := text.ReadLine()
+		response, _ := base64.StdEncoding.DecodeString(line)
+		return string(response)
+	}
+
+	switch mechanism {
+	case "PLAIN":
+		response, _ := base64.StdEncoding.DecodeString(initialResponse)
+		parts := strings.Split(string(response), "\x00")
+		return mechanism, len(parts) == 3 && parts[1] == s.username && parts[2] == s.password
+	case "LOGIN":
+		username := challenge("Username:")
+		password := challenge("Password:")
+		return mechanism, username == s.username && password == s.password
+	case "CRAM-MD5":
+		nonce := "<1896.697170952@127.0.0.1>"
+		username, digest, _ := strings.Cut(challenge(nonce), " ")
+		mac := hmac.New(md5.New, []byte(s.password))
+		mac.Write([]byte(nonce))
+		return mechanism, username == s.username && digest == hex.EncodeToString(mac.Sum(nil))
+	default:
+		return mechanism, false
+	}
+}
+
+func testEmail() *email.Email {
+	e := email.NewEmail()
+	e.To = []string{"Receiver <a@example.com>"}
+	e.Subject = "test subject"
+	e.HTML = []byte("<p>test body</p>")
+	return e
+}
+
+func TestSMTPTransportStartTLS(t *testing.T) {
+	stub, caFile := newSMTPStub(t, false, func(s *smtpStub) {
+		s.startTLS = true
+		s.authMechanisms = []string{"PLAIN"}
+	})
+
+	conf := stub.conf()
+	conf.TLSCAFile = caFile
+	transport, err := NewSMTPTransport(conf)
+	NoError(t, err)
+	NoError(t, transport.Send(testEmail()))
+
+	messages := stub.received()
+	if Len(t, messages, 1) {
+		True(t, messages[0].tls)
+		Equal(t, "PLAIN", messages[0].authMechanism)
+		Equal(t, "FROM:<rtcv@example.com>", messages[0].from)
+		Equal(t, []string{"TO:<a@example.com>"}, messages[0].to)
+		Contains(t, messages[0].data, "Subject: test subject")
+		NotContains(t, messages[0].data, "DKIM-Signature")
+	}
+}
+
+func TestSMTPTransportVerifiesCertificates(t *testing.T) {
+	stub, _ := newSMTPStub(t, false, func(s *smtpStub) {
+		s.startTLS = true
+		s.authMechanisms = []string{"PLAIN"}
+	})
+
+	// The self signed certificate of the stub is not trusted by default
+	transport, err := NewSMTPTransport(stub.conf())
+	NoError(t, err)
+	err = transport.Send(testEmail())
+	Error(t, err)
+	Contains(t, err.Error(), "certificate")
+	Empty(t, stub.received())
+
+	conf := stub.conf()
+	conf.TLSSkipVerify = true
+	transport, err = NewSMTPTransport(conf)
+	NoError(t, err)
+	NoError(t, transport.Send(testEmail()))
+	Len(t, stub.received(), 1)
+}
+
+func TestSMTPTransportStartTLSModes(t *testing.T) {
+	stub, _ := newSMTPStub(t, false, nil)
+	conf := stub.conf()
+	conf.Username = ""
+
+	// STARTTLS is required by default
+	transport, err := NewSMTPTransport(conf)
+	NoError(t, err)
+	Equal(t, ErrStartTLSNotSupported, transport.Send(testEmail()))
+
+	for _, mode := range []TLSMode{TLSModeStartTLSOptional, TLSModeNone} {
+		conf.TLSMode = mode
+		transport, err = NewSMTPTransport(conf)
+		NoError(t, err)
+		NoError(t, transport.Send(testEmail()), mode)
+	}
+
+	messages := stub.received()
+	if Len(t, messages, 2) {
+		False(t, messages[0].tls)
+		False(t, messages[1].tls)
+		Empty(t, messages[0].authMechanism)
+	}
+}
+
+func TestSMTPTransportImplicitTLS(t *testing.T) {
+	stub, caFile := newSMTPStub(t, true, func(s *smtpStub) {
+		s.authMechanisms = []string{"PLAIN"}
+	})
+
+	conf := stub.conf()
+	conf.TLSMode = TLSModeImplicit
+	conf.TLSCAFile = caFile
+	transport, err := NewSMTPTransport(conf)
+	NoError(t, err)
+	NoError(t, transport.Send(testEmail()))
+
+	messages := stub.received()
+	if Len(t, messages, 1) {
+		True(t, messages[0].tls)
+		Equal(t, "PLAIN", messages[0].authMechanism)
+	}
+}
+
+func TestSMTPTransportAuthMethods(t *testing.T) {
+	stub, caFile := newSMTPStub(t, false, func(s *smtpStub) {
+		s.startTLS = true
+		s.authMechanisms = []string{"PLAIN", "LOGIN", "CRAM-MD5"}
+	})
+
+	for _, method := range []AuthMethod{AuthMethodPlain, AuthMethodLogin, AuthMethodCRAMMD5} {
+		conf := stub.conf()
+		conf.TLSCAFile = caFile
+		conf.AuthMethod = method
+		transport, err := NewSMTPTransport(conf)
+		NoError(t, err, method)
+		NoError(t, transport.Send(testEmail()), method)
+
+		conf.Password = "wrong"
+		transport, err = NewSMTPTransport(conf)
+		NoError(t, err, method)
+		Error(t, transport.Send(testEmail()), method)
+	}
+
+	messages := stub.received()
+	if Len(t, messages, 3) {
+		Equal(t, "PLAIN", messages[0].authMechanism)
+		Equal(t, "LOGIN", messages[1].authMechanism)
+		Equal(t, "CRAM-MD5", messages[2].authMechanism)
+	}
+}
+
+func TestSMTPTransportDKIM(t *testing.T) {
+	stub, caFile := newSMTPStub(t, false, func(s *smtpStub) {
+		s.startTLS = true
+		s.authMechanisms = []string{"PLAIN"}
+	})
+
+	key, keyFile := newTestDKIMKey(t)
+	conf := stub.conf()
+	conf.TLSCAFile = caFile
+	conf.DKIMPrivateKeyFile = keyFile
+	conf.DKIMSelector = "rtcv"
+	transport, err := NewSMTPTransport(conf)
+	NoError(t, err)
+	NoError(t, transport.Send(testEmail()))
+
+	messages := stub.received()
+	if Len(t, messages, 1) {
+		data := strings.ReplaceAll(messages[0].data, "\n", "\r\n")
+		// The domain defaults to the domain of the from address
+		Contains(t, data, "d=example.com; s=rtcv;")
+		NoError(t, verifyDKIM(&key.PublicKey, []byte(data)))
+	}
+}
+
+func TestNewSMTPTransport(t *testing.T) {
+	conf := EmailServerConfiguration{Host: "mail.example.com", From: "rtcv@example.com"}
+
+	transport, err := NewSMTPTransport(conf)
+	NoError(t, err)
+	Equal(t, TLSModeStartTLS, transport.tlsMode)
+	Equal(t, "mail.example.com:25", transport.address)
+	Nil(t, transport.auth)
+	False(t, transport.tlsConfig.InsecureSkipVerify)
+
+	conf.Port = "465"
+	conf.Username = "user"
+	transport, err = NewSMTPTransport(conf)
+	NoError(t, err)
+	Equal(t, TLSModeImplicit, transport.tlsMode)
+	NotNil(t, transport.auth)
+
+	invalidConfs := []func(conf *EmailServerConfiguration){
+		func(conf *EmailServerConfiguration) { conf.Port = "abc" },
+		func(conf *EmailServerConfiguration) { conf.From = "not an address" },
+		func(conf *EmailServerConfiguration) { conf.TLSMode = "ssl" },
+		func(conf *EmailServerConfiguration) { conf.AuthMethod = "xoauth2" },
+		func(conf *EmailServerConfiguration) { conf.TLSCAFile = "./does-not-exist.pem" },
+		func(conf *EmailServerConfiguration) { conf.DKIMSelector = "rtcv" },
+		func(conf *EmailServerConfiguration) { conf.DKIMPrivateKeyFile = "./does-not-exist.pem" },
+	}
+	for idx, modify := range invalidConfs {
+		invalidConf := conf
+		modify(&invalidConf)
+		_, err = NewSMTPTransport(invalidConf)
+		Error(t, err, idx)
+	}
+}
@@ -0,0 +1,146 @@
+package emailservice
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/jordan-wright/email"
+)
+
+// Transport sends an email
+type Transport interface {
+	Send(e *email.Email) error
+}
+
+// ErrNoConf = email service not configured
+var ErrNoConf = errors.New("email service not configured")
+
+// TransportFromEnv returns the transport selected by the EMAIL_TRANSPORT env variable
+//
+// smtp (default) sends the emails using the server defined by EmailServerConfigurationFromEnv,
+// mbox appends the emails to the file defined by EMAIL_MBOX_PATH (default ./emails.mbox) and is meant for development,
+// memory keeps the emails in memory and is meant for testing
+func TransportFromEnv() (Transport, error) {
+	conf := EmailServerConfigurationFromEnv()
+
+	switch kind := strings.ToLower(os.Getenv("EMAIL_TRANSPORT")); kind {
+	case "", "smtp":
+		if conf.Host == "" || conf.From == "" {
+			log.Warn("Email not configured (EMAIL_HOST and EMAIL_FROM must be set), DISABELING EMAIL SUPPORT")
+			return DisabledTransport{}, nil
+		}
+		return NewSMTPTransport(conf)
+	case "mbox":
+		path := os.Getenv("EMAIL_MBOX_PATH")
+		if path == "" {
+			path = "./emails.mbox"
+		}
+		log.WithField("path", path).Info("Emails are written to a mbox file instead of being sent")
+		return NewMboxTransport(path, conf.From), nil
+	case "memory":
+		log.Info("Emails are kept in memory instead of being sent")
+		return NewMemoryTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_TRANSPORT %s, expected smtp, mbox or memory", kind)
+	}
+}
+
+// DisabledTransport is used when no email server is configured, it refuses every email with ErrNoConf
+type DisabledTransport struct{}
+
+// Send implements Transport
+func (DisabledTransport) Send(e *email.Email) error {
+	log.Infof("sending no mail to %v as email server is not configured", e.To)
+	return ErrNoConf
+}
+
+// MboxTransport appends the emails to a mbox file, this is useful during development to inspect the emails without sending them
+type MboxTransport struct {
+	path string
+	from string
+	m    sync.Mutex
+}
+
+// NewMboxTransport creates a transport that appends the emails to the mbox file at path
+// from is used as sender, if empty rtcv@localhost is used
+func NewMboxTransport(path, from string) *MboxTransport {
+	if from == "" {
+		from = "rtcv@localhost"
+	}
+	return &MboxTransport{path: path, from: from}
+}
+
+// Send implements Transport
+func (t *MboxTransport) Send(e *email.Email) error {
+	e.From = t.from
+	raw, err := e.Bytes()
+	if err != nil {
+		return err
+	}
+
+	buff := bytes.NewBufferString("From " + t.from + " " + time.Now().UTC().Format(time.ANSIC) + "\n")
+	for _, line := range strings.SplitAfter(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n") {
+		// Lines starting with "From " would be seen as the start of a new message
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			buff.WriteString(">")
+		}
+		buff.WriteString(line)
+	}
+	buff.WriteString("\n\n")
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	f, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buff.Bytes())
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// MemoryTransport keeps the emails in memory, this is useful for tests
+type MemoryTransport struct {
+	m    sync.Mutex
+	sent []*email.Email
+	err  error
+}
+
+// NewMemoryTransport creates a new in memory transport
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+// Send implements Transport
+func (t *MemoryTransport) Send(e *email.Email) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	t.sent = append(t.sent, e)
+	return nil
+}
+
+// Sent returns the emails sent so far
+func (t *MemoryTransport) Sent() []*email.Email {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return append([]*email.Email{}, t.sent...)
+}
+
+// SetError makes all the next sends fail with err, if err is nil sending succeeds again
+func (t *MemoryTransport) SetError(err error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.err = err
+}
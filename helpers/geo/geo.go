@@ -0,0 +1,141 @@
+package geo
+
+import (
+	_ "embed" // Required for embedding the pc4 centroids
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// earthRadiusKm is the mean radius of the earth
+const earthRadiusKm = 6371.0
+
+// Coordinates is a point on the earth in decimal degrees
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Valid returns true if the coordinates are within the valid latitude and longitude ranges
+func (c Coordinates) Valid() bool {
+	return c.Lat >= -90 && c.Lat <= 90 && c.Lng >= -180 && c.Lng <= 180
+}
+
+// DistanceKm returns the distance between c and other in kilometers using the haversine formula
+func (c Coordinates) DistanceKm(other Coordinates) float64 {
+	toRadians := func(degrees float64) float64 {
+		return degrees * math.Pi / 180
+	}
+
+	latA, latB := toRadians(c.Lat), toRadians(other.Lat)
+	deltaLat := latB - latA
+	deltaLng := toRadians(other.Lng - c.Lng)
+
+	h := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(latA)*math.Cos(latB)*math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+//go:embed pc4_centroids.csv
+var pc4CentroidsCSV string
+
+var (
+	pc4Centroids     map[uint16]Coordinates
+	pc4CentroidsOnce sync.Once
+	pc4CentroidsLock sync.RWMutex
+)
+
+func loadEmbeddedPC4Centroids() {
+	pc4CentroidsOnce.Do(func() {
+		centroids, err := parsePC4Centroids(pc4CentroidsCSV)
+		if err != nil {
+			// The file is embedded into the binary so this can only happen if the file itself is incorrect
+			panic("invalid pc4_centroids.csv, " + err.Error())
+		}
+		pc4CentroidsLock.Lock()
+		pc4Centroids = centroids
+		pc4CentroidsLock.Unlock()
+	})
+}
+
+// LoadPC4CentroidsFile adds the centroids in the file at path to the known centroids
+// The file must have the same format as pc4_centroids.csv, the centroids in the file take precedence over the embedded ones
+// This should be called once on startup
+func LoadPC4CentroidsFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	centroids, err := parsePC4Centroids(string(data))
+	if err != nil {
+		return err
+	}
+
+	loadEmbeddedPC4Centroids()
+	pc4CentroidsLock.Lock()
+	defer pc4CentroidsLock.Unlock()
+	merged := make(map[uint16]Coordinates, len(pc4Centroids)+len(centroids))
+	for pc4, coordinates := range pc4Centroids {
+		merged[pc4] = coordinates
+	}
+	for pc4, coordinates := range centroids {
+		merged[pc4] = coordinates
+	}
+	pc4Centroids = merged
+	return nil
+}
+
+// DutchPC4Coordinates returns the centroid of a dutch PC4 area (the 4 digits of a dutch postcode)
+// The second return value is false if the postcode is not known
+func DutchPC4Coordinates(pc4 uint16) (Coordinates, bool) {
+	loadEmbeddedPC4Centroids()
+	pc4CentroidsLock.RLock()
+	defer pc4CentroidsLock.RUnlock()
+	coordinates, ok := pc4Centroids[pc4]
+	return coordinates, ok
+}
+
+func parsePC4Centroids(data string) (map[uint16]Coordinates, error) {
+	res := map[uint16]Coordinates{}
+
+	for idx, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		lineErr := func(msg string) error {
+			return errors.New("line " + strconv.Itoa(idx+1) + ": " + msg)
+		}
+
+		parts := strings.Split(line, ",")
+		if len(parts) != 3 {
+			return nil, lineErr("expected 3 columns")
+		}
+
+		pc4, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil || pc4 < 1000 || pc4 > 9999 {
+			return nil, lineErr("invalid pc4")
+		}
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, lineErr("invalid latitude")
+		}
+		lng, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return nil, lineErr("invalid longitude")
+		}
+
+		coordinates := Coordinates{Lat: lat, Lng: lng}
+		if !coordinates.Valid() {
+			return nil, lineErr("coordinates out of range")
+		}
+		res[uint16(pc4)] = coordinates
+	}
+
+	return res, nil
+}
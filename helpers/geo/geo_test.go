@@ -0,0 +1,76 @@
+package geo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestDistanceKm(t *testing.T) {
+	amsterdam := Coordinates{Lat: 52.3731, Lng: 4.8922}
+	utrecht := Coordinates{Lat: 52.0920, Lng: 5.1190}
+
+	Equal(t, 0.0, amsterdam.DistanceKm(amsterdam))
+
+	// Amsterdam to Utrecht is roughly 35 km in a straight line
+	distance := amsterdam.DistanceKm(utrecht)
+	InDelta(t, 35, distance, 1)
+	Equal(t, distance, utrecht.DistanceKm(amsterdam))
+}
+
+func TestDutchPC4Coordinates(t *testing.T) {
+	coordinates, ok := DutchPC4Coordinates(3511)
+	True(t, ok)
+	True(t, coordinates.Valid())
+
+	// Postcodes that are not known have no coordinates instead of an estimate
+	_, ok = DutchPC4Coordinates(1035)
+	False(t, ok)
+	_, ok = DutchPC4Coordinates(999)
+	False(t, ok)
+}
+
+func TestLoadPC4CentroidsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pc4.csv")
+	NoError(t, os.WriteFile(path, []byte("1036,52.4,4.93\n3581,52.09,5.14\n"), 0600))
+	NoError(t, LoadPC4CentroidsFile(path))
+
+	coordinates, ok := DutchPC4Coordinates(1036)
+	True(t, ok)
+	Equal(t, Coordinates{Lat: 52.4, Lng: 4.93}, coordinates)
+
+	// The file overrides the embedded centroids and the others are kept
+	coordinates, ok = DutchPC4Coordinates(3581)
+	True(t, ok)
+	Equal(t, Coordinates{Lat: 52.09, Lng: 5.14}, coordinates)
+	_, ok = DutchPC4Coordinates(3511)
+	True(t, ok)
+
+	NoError(t, os.WriteFile(path, []byte("1035,52.4\n"), 0600))
+	Error(t, LoadPC4CentroidsFile(path))
+	Error(t, LoadPC4CentroidsFile(filepath.Join(t.TempDir(), "does-not-exist.csv")))
+}
+
+func TestParsePC4Centroids(t *testing.T) {
+	centroids, err := parsePC4Centroids("# comment\n1011,52.1,4.9\n\n9711,53.2,6.5\n")
+	NoError(t, err)
+	Equal(t, map[uint16]Coordinates{
+		1011: {Lat: 52.1, Lng: 4.9},
+		9711: {Lat: 53.2, Lng: 6.5},
+	}, centroids)
+
+	invalidInputs := []string{
+		"1011,52.1",
+		"abc,52.1,4.9",
+		"100,52.1,4.9",
+		"1011,a,4.9",
+		"1011,52.1,b",
+		"1011,91,4.9",
+	}
+	for _, input := range invalidInputs {
+		_, err = parsePC4Centroids(input)
+		Error(t, err, input)
+	}
+}
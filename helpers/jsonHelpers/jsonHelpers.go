@@ -265,6 +265,68 @@ var DriversLicenses = []DriversLicense{
 	NewDriversLicense("W"),
 }
 
+// driversLicenseImplications contains for every drivers license the drivers licenses it directly implies
+// A license implies another license if the holder is also allowed to drive the vehicles of the other license,
+// either because of the EU equivalences or because the other license is required to obtain the license
+// Based on article 4 and 6 of the EU directive 2006/126/EC
+var driversLicenseImplications = map[DriversLicense][]DriversLicense{
+	NewDriversLicense("A"):   {NewDriversLicense("A2")},
+	NewDriversLicense("A2"):  {NewDriversLicense("A1")},
+	NewDriversLicense("A1"):  {NewDriversLicense("AM")},
+	NewDriversLicense("B"):   {NewDriversLicense("AM"), NewDriversLicense("B1")},
+	NewDriversLicense("BE"):  {NewDriversLicense("B")},
+	NewDriversLicense("C1"):  {NewDriversLicense("B")},
+	NewDriversLicense("C1E"): {NewDriversLicense("C1"), NewDriversLicense("BE")},
+	NewDriversLicense("C"):   {NewDriversLicense("C1")},
+	NewDriversLicense("CE"):  {NewDriversLicense("C"), NewDriversLicense("C1E")},
+	NewDriversLicense("D1"):  {NewDriversLicense("B")},
+	NewDriversLicense("D1E"): {NewDriversLicense("D1"), NewDriversLicense("BE")},
+	NewDriversLicense("D"):   {NewDriversLicense("D1")},
+	NewDriversLicense("DE"):  {NewDriversLicense("D"), NewDriversLicense("D1E")},
+}
+
+// impliedDriversLicenses contains for every drivers license all the drivers licenses it implies,
+// including the licenses implied by the implied licenses
+var impliedDriversLicenses = func() map[DriversLicense][]DriversLicense {
+	res := map[DriversLicense][]DriversLicense{}
+	for license := range driversLicenseImplications {
+		implied := []DriversLicense{}
+		seen := map[DriversLicense]bool{license: true}
+		toCheck := driversLicenseImplications[license]
+		for len(toCheck) > 0 {
+			entry := toCheck[0]
+			toCheck = toCheck[1:]
+			if seen[entry] {
+				continue
+			}
+			seen[entry] = true
+			implied = append(implied, entry)
+			toCheck = append(toCheck, driversLicenseImplications[entry]...)
+		}
+		res[license] = implied
+	}
+	return res
+}()
+
+// Implies returns true if the holder of dl is also allowed to drive the vehicles of other
+// A drivers license always implies itself
+func (dl DriversLicense) Implies(other DriversLicense) bool {
+	if dl == other {
+		return true
+	}
+	for _, implied := range impliedDriversLicenses[dl] {
+		if implied == other {
+			return true
+		}
+	}
+	return false
+}
+
+// Implied returns all the drivers licenses implied by dl excluding dl itself
+func (dl DriversLicense) Implied() []DriversLicense {
+	return impliedDriversLicenses[dl]
+}
+
 // Strings converts a drivers license identifier into a string
 func (dl DriversLicense) String() string {
 	return string(bytes.TrimRightFunc(dl[:], func(r rune) bool { return r == 0 }))
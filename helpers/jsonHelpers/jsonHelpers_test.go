@@ -84,3 +84,49 @@ func TestDriversLicense(t *testing.T) {
 		Equal(t, `"`+licenseString+`"`, string(licenseAsJSON))
 	}
 }
+
+func TestDriversLicenseImplies(t *testing.T) {
+	implied := [][2]string{
+		{"B", "B"},
+		{"CE", "C"},
+		{"CE", "C1"},
+		{"CE", "C1E"},
+		{"CE", "BE"},
+		{"CE", "B"},
+		{"C", "B"},
+		{"D", "B"},
+		{"D", "D1"},
+		{"C1E", "C1"},
+		{"DE", "BE"},
+		{"A", "AM"},
+		{"B", "AM"},
+	}
+	for _, entry := range implied {
+		True(t, NewDriversLicense(entry[0]).Implies(NewDriversLicense(entry[1])), entry[0]+" should imply "+entry[1])
+	}
+
+	notImplied := [][2]string{
+		{"B", "C"},
+		{"C", "CE"},
+		{"C", "D"},
+		{"D", "C"},
+		{"C1", "C"},
+		{"B", "A"},
+		{"T", "B"},
+	}
+	for _, entry := range notImplied {
+		False(t, NewDriversLicense(entry[0]).Implies(NewDriversLicense(entry[1])), entry[0]+" should not imply "+entry[1])
+	}
+
+	// Every implied drivers license should be a known drivers license
+	knownLicenses := map[DriversLicense]bool{}
+	for _, license := range DriversLicenses {
+		knownLicenses[license] = true
+	}
+	for license := range driversLicenseImplications {
+		True(t, knownLicenses[license], license.String())
+		for _, implied := range license.Implied() {
+			True(t, knownLicenses[implied], implied.String())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package locale
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Locale is a language we have a message catalog for
+type Locale string
+
+// The locales we have message catalogs for
+const (
+	NL Locale = "nl"
+	EN Locale = "en"
+)
+
+// Default is used when no locale is set
+// All the emails used to be dutch so profiles without a locale keep getting dutch emails
+const Default = NL
+
+// Locales contains all the supported locales
+var Locales = []Locale{NL, EN}
+
+// Valid returns true if l is a supported locale or empty, an empty locale defaults to Default
+func (l Locale) Valid() bool {
+	if l == "" {
+		return true
+	}
+	_, ok := catalogs[l]
+	return ok
+}
+
+// OrDefault returns l if it is a supported locale and Default otherwise
+func (l Locale) OrDefault() Locale {
+	if _, ok := catalogs[l]; ok {
+		return l
+	}
+	return Default
+}
+
+// T returns the message in the catalog of l formatted with args
+// If the message is missing in the catalog of l the message of the default catalog is used,
+// if it's also missing there the message key is returned so a missing translation is visible but not breaking
+func (l Locale) T(message Message, args ...interface{}) string {
+	format, ok := catalogs[l.OrDefault()][message]
+	if !ok {
+		format, ok = catalogs[Default][message]
+		if !ok {
+			return string(message)
+		}
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// JoinList joins items into a human readable list, for example "a, b and c"
+func (l Locale) JoinList(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	default:
+		return l.T(MsgListAnd, strings.Join(items[:len(items)-1], ", "), items[len(items)-1])
+	}
+}
+
+// FormatDecimal formats value with one decimal using the decimal separator of l
+func (l Locale) FormatDecimal(value float64) string {
+	return strings.Replace(strconv.FormatFloat(value, 'f', 1, 64), ".", l.T(MsgDecimalSeparator), 1)
+}
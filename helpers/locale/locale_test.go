@@ -0,0 +1,48 @@
+package locale
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestCatalogsComplete(t *testing.T) {
+	for _, l := range Locales {
+		for message := range catalogs[Default] {
+			_, ok := catalogs[l][message]
+			True(t, ok, "%s is missing in the %s catalog", message, l)
+		}
+		Equal(t, len(catalogs[Default]), len(catalogs[l]), l)
+	}
+}
+
+func TestT(t *testing.T) {
+	Equal(t, "Nieuwe match voor a", NL.T(MsgEmailSubjectMatch, "a"))
+	Equal(t, "New match for a", EN.T(MsgEmailSubjectMatch, "a"))
+
+	// Unknown and empty locales fall back to the default locale
+	Equal(t, "Nieuwe match voor a", Locale("").T(MsgEmailSubjectMatch, "a"))
+	Equal(t, "Nieuwe match voor a", Locale("fr").T(MsgEmailSubjectMatch, "a"))
+
+	// Unknown messages are returned as is
+	Equal(t, "thisMessageDoesNotExist", EN.T("thisMessageDoesNotExist"))
+}
+
+func TestValid(t *testing.T) {
+	True(t, Locale("").Valid())
+	True(t, NL.Valid())
+	True(t, EN.Valid())
+	False(t, Locale("fr").Valid())
+}
+
+func TestJoinList(t *testing.T) {
+	Equal(t, "", NL.JoinList(nil))
+	Equal(t, "a", NL.JoinList([]string{"a"}))
+	Equal(t, "a, b en c", NL.JoinList([]string{"a", "b", "c"}))
+	Equal(t, "a and b", EN.JoinList([]string{"a", "b"}))
+}
+
+func TestFormatDecimal(t *testing.T) {
+	Equal(t, "2,5", NL.FormatDecimal(2.5))
+	Equal(t, "2.5", EN.FormatDecimal(2.5))
+}
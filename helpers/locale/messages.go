@@ -0,0 +1,187 @@
+package locale
+
+// Message is the key of a message in the catalogs
+// In email templates messages can be used with the t function, for example {{ t "emailHeading" }}
+type Message string
+
+// The messages of the catalogs
+const (
+	MsgListAnd          Message = "listAnd"
+	MsgDecimalSeparator Message = "decimalSeparator"
+
+	MsgMatchYearsSinceWorkLessThanOne      Message = "matchYearsSinceWorkLessThanOne"
+	MsgMatchYearsSinceWorkOne              Message = "matchYearsSinceWorkOne"
+	MsgMatchYearsSinceWork                 Message = "matchYearsSinceWork"
+	MsgMatchYearsSinceEducationLessThanOne Message = "matchYearsSinceEducationLessThanOne"
+	MsgMatchYearsSinceEducationOne         Message = "matchYearsSinceEducationOne"
+	MsgMatchYearsSinceEducation            Message = "matchYearsSinceEducation"
+	MsgMatchAge                            Message = "matchAge"
+	MsgMatchEducation                      Message = "matchEducation"
+	MsgMatchDesiredProfession              Message = "matchDesiredProfession"
+	MsgMatchProfessionExperienced          Message = "matchProfessionExperienced"
+	MsgMatchProfessionExperiencedYears     Message = "matchProfessionExperiencedYears"
+	MsgMatchDriversLicense                 Message = "matchDriversLicense"
+	MsgMatchDriversLicenseImplied          Message = "matchDriversLicenseImplied"
+	MsgMatchDesiredDriversLicense          Message = "matchDesiredDriversLicense"
+	MsgMatchLanguage                       Message = "matchLanguage"
+	MsgMatchLanguageLevels                 Message = "matchLanguageLevels"
+	MsgMatchLanguageSpoken                 Message = "matchLanguageSpoken"
+	MsgMatchLanguageWritten                Message = "matchLanguageWritten"
+	MsgMatchSkill                          Message = "matchSkill"
+	MsgMatchZipCode                        Message = "matchZipCode"
+	MsgMatchDistance                       Message = "matchDistance"
+
+	MsgLanguageLevelUnknown    Message = "languageLevelUnknown"
+	MsgLanguageLevelReasonable Message = "languageLevelReasonable"
+	MsgLanguageLevelGood       Message = "languageLevelGood"
+	MsgLanguageLevelExcellent  Message = "languageLevelExcellent"
+
+	MsgEmailSubjectMatch  Message = "emailSubjectMatch"
+	MsgEmailSubjectDigest Message = "emailSubjectDigest"
+
+	MsgEmailTitle                Message = "emailTitle"
+	MsgEmailHeading              Message = "emailHeading"
+	MsgEmailFoundWith            Message = "emailFoundWith"
+	MsgEmailOn                   Message = "emailOn"
+	MsgEmailMatchedOn            Message = "emailMatchedOn"
+	MsgEmailWhatNow              Message = "emailWhatNow"
+	MsgEmailContactSoon          Message = "emailContactSoon"
+	MsgEmailCandidateName        Message = "emailCandidateName"
+	MsgEmailPhoneNumber          Message = "emailPhoneNumber"
+	MsgEmailEmail                Message = "emailEmail"
+	MsgEmailCompetences          Message = "emailCompetences"
+	MsgEmailInterests            Message = "emailInterests"
+	MsgEmailReference            Message = "emailReference"
+	MsgEmailPersonalPresentation Message = "emailPersonalPresentation"
+	MsgEmailFeedback             Message = "emailFeedback"
+	MsgEmailFeedbackLink         Message = "emailFeedbackLink"
+	MsgEmailContact              Message = "emailContact"
+	MsgEmailTerms                Message = "emailTerms"
+
+	MsgDigestTitle     Message = "digestTitle"
+	MsgDigestIntroOne  Message = "digestIntroOne"
+	MsgDigestIntroMany Message = "digestIntroMany"
+	MsgDigestIntro     Message = "digestIntro"
+	MsgDigestFoundWith Message = "digestFoundWith"
+)
+
+var catalogs = map[Locale]map[Message]string{
+	NL: {
+		MsgListAnd:          "%s en %s",
+		MsgDecimalSeparator: ",",
+
+		MsgMatchYearsSinceWorkLessThanOne:      "minder dan 1 jaar geleden sinds laatste werk ervaaring",
+		MsgMatchYearsSinceWorkOne:              "1 jaar sinds laatste werk ervaaring",
+		MsgMatchYearsSinceWork:                 "%d jaren sinds laatste werk ervaaring",
+		MsgMatchYearsSinceEducationLessThanOne: "minder dan 1 jaar sinds laatste opleiding",
+		MsgMatchYearsSinceEducationOne:         "1 jaar sinds laatste opleiding",
+		MsgMatchYearsSinceEducation:            "%d jaren sinds laatste opleiding",
+		MsgMatchAge:                            "%d jaar oud",
+		MsgMatchEducation:                      "opleiding %s",
+		MsgMatchDesiredProfession:              "gewenste werkveld %s",
+		MsgMatchProfessionExperienced:          "gewerkt als %s",
+		MsgMatchProfessionExperiencedYears:     "%s jaar gewerkt als %s",
+		MsgMatchDriversLicense:                 "rijbewijs %s",
+		MsgMatchDriversLicenseImplied:          "rijbewijs %s (voldoet aan %s)",
+		MsgMatchDesiredDriversLicense:          "gewenste rijbewijs",
+		MsgMatchLanguage:                       "spreekt %s",
+		MsgMatchLanguageLevels:                 "spreekt %s (minimaal %s)",
+		MsgMatchLanguageSpoken:                 "spreken %s",
+		MsgMatchLanguageWritten:                "schrijven %s",
+		MsgMatchSkill:                          "vaardigheid %s",
+		MsgMatchZipCode:                        "postcode in range %s",
+		MsgMatchDistance:                       "woont op %.0f km afstand",
+
+		MsgLanguageLevelUnknown:    "onbekend",
+		MsgLanguageLevelReasonable: "redelijk",
+		MsgLanguageLevelGood:       "goed",
+		MsgLanguageLevelExcellent:  "uitstekend",
+
+		MsgEmailSubjectMatch:  "Nieuwe match voor %s",
+		MsgEmailSubjectDigest: "%d nieuwe matches",
+
+		MsgEmailTitle:                "Nieuwe Match",
+		MsgEmailHeading:              "Nieuwe match!",
+		MsgEmailFoundWith:            "Yes, een nieuwe match! Deze kandidaat is gevonden met het zoekprofiel",
+		MsgEmailOn:                   "op",
+		MsgEmailMatchedOn:            "De match is gemaakt op basis van de volgende eigenschappen",
+		MsgEmailWhatNow:              "En nu?",
+		MsgEmailContactSoon:          "Zorg ervoor dat je zo snel mogelijk contact opneemt!",
+		MsgEmailCandidateName:        "Naam kandidaat",
+		MsgEmailPhoneNumber:          "Telefoonnummer",
+		MsgEmailEmail:                "E-mailadres",
+		MsgEmailCompetences:          "Competenties",
+		MsgEmailInterests:            "Interesses",
+		MsgEmailReference:            "Referentie",
+		MsgEmailPersonalPresentation: "Persoonlijke presentatie",
+		MsgEmailFeedback:             "Vragen, opmerkingen of gaat er iets niet goed,",
+		MsgEmailFeedbackLink:         "laat het ons weten",
+		MsgEmailContact:              "Contact",
+		MsgEmailTerms:                "Algemene Voorwaarden",
+
+		MsgDigestTitle:     "Nieuwe Matches",
+		MsgDigestIntroOne:  "Yes, een nieuwe match!",
+		MsgDigestIntroMany: "Yes, %d nieuwe matches!",
+		MsgDigestIntro:     "Hieronder vind je de kandidaten die sinds de vorige samenvatting zijn gevonden, de CV's zitten als PDF in de bijlage.",
+		MsgDigestFoundWith: "Gevonden met het zoekprofiel",
+	},
+	EN: {
+		MsgListAnd:          "%s and %s",
+		MsgDecimalSeparator: ".",
+
+		MsgMatchYearsSinceWorkLessThanOne:      "less than 1 year since the last work experience",
+		MsgMatchYearsSinceWorkOne:              "1 year since the last work experience",
+		MsgMatchYearsSinceWork:                 "%d years since the last work experience",
+		MsgMatchYearsSinceEducationLessThanOne: "less than 1 year since the last education",
+		MsgMatchYearsSinceEducationOne:         "1 year since the last education",
+		MsgMatchYearsSinceEducation:            "%d years since the last education",
+		MsgMatchAge:                            "%d years old",
+		MsgMatchEducation:                      "education %s",
+		MsgMatchDesiredProfession:              "desired profession %s",
+		MsgMatchProfessionExperienced:          "worked as %s",
+		MsgMatchProfessionExperiencedYears:     "worked %s years as %s",
+		MsgMatchDriversLicense:                 "drivers license %s",
+		MsgMatchDriversLicenseImplied:          "drivers license %s (meets %s)",
+		MsgMatchDesiredDriversLicense:          "desired drivers license",
+		MsgMatchLanguage:                       "speaks %s",
+		MsgMatchLanguageLevels:                 "speaks %s (at least %s)",
+		MsgMatchLanguageSpoken:                 "speaking %s",
+		MsgMatchLanguageWritten:                "writing %s",
+		MsgMatchSkill:                          "skill %s",
+		MsgMatchZipCode:                        "postal code in range %s",
+		MsgMatchDistance:                       "lives %.0f km away",
+
+		MsgLanguageLevelUnknown:    "unknown",
+		MsgLanguageLevelReasonable: "reasonable",
+		MsgLanguageLevelGood:       "good",
+		MsgLanguageLevelExcellent:  "excellent",
+
+		MsgEmailSubjectMatch:  "New match for %s",
+		MsgEmailSubjectDigest: "%d new matches",
+
+		MsgEmailTitle:                "New Match",
+		MsgEmailHeading:              "New match!",
+		MsgEmailFoundWith:            "Yes, a new match! This candidate was found with the search profile",
+		MsgEmailOn:                   "on",
+		MsgEmailMatchedOn:            "The match is based on the following properties",
+		MsgEmailWhatNow:              "What now?",
+		MsgEmailContactSoon:          "Make sure to get in touch as soon as possible!",
+		MsgEmailCandidateName:        "Candidate name",
+		MsgEmailPhoneNumber:          "Phone number",
+		MsgEmailEmail:                "Email address",
+		MsgEmailCompetences:          "Competences",
+		MsgEmailInterests:            "Interests",
+		MsgEmailReference:            "Reference",
+		MsgEmailPersonalPresentation: "Personal presentation",
+		MsgEmailFeedback:             "Questions, remarks or is something not working,",
+		MsgEmailFeedbackLink:         "let us know",
+		MsgEmailContact:              "Contact",
+		MsgEmailTerms:                "Terms and Conditions",
+
+		MsgDigestTitle:     "New Matches",
+		MsgDigestIntroOne:  "Yes, a new match!",
+		MsgDigestIntroMany: "Yes, %d new matches!",
+		MsgDigestIntro:     "Below you find the candidates found since the previous digest, the CVs are attached as PDF.",
+		MsgDigestFoundWith: "Found with the search profile",
+	},
+}
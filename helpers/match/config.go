@@ -0,0 +1,37 @@
+package match
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Config contains the server wide settings of the matcher
+type Config struct {
+	// DisableAgeMatching makes the matcher ignore the age criteria of all profiles
+	// Rules about age discrimination differ per use case so this allows a server to opt out of age matching entirely
+	DisableAgeMatching bool
+}
+
+// ConfigFromEnv returns the matcher config defined in the env variables
+func ConfigFromEnv() Config {
+	return Config{
+		DisableAgeMatching: strings.ToLower(os.Getenv("DISABLE_AGE_MATCHING")) == "true",
+	}
+}
+
+var config atomic.Value
+
+func init() {
+	config.Store(Config{})
+}
+
+// SetConfig changes the config used by the matcher
+func SetConfig(c Config) {
+	config.Store(c)
+}
+
+// GetConfig returns the config used by the matcher
+func GetConfig() Config {
+	return config.Load().(Config)
+}
@@ -0,0 +1,85 @@
+package match
+
+import (
+	"sort"
+	"time"
+
+	"github.com/script-development/RT-CV/models"
+)
+
+// daysPerYear is the average amount of days in a year including leap years
+const daysPerYear = 365.25
+
+// workPeriod is a period in which a CV worked in a profession
+type workPeriod struct {
+	from time.Time
+	to   time.Time
+}
+
+// workExperiencePeriod returns the period of a work experience
+// Work experiences that are still ongoing end now, the second return value is false if the period is unknown
+func workExperiencePeriod(workExp models.WorkExperience, now time.Time) (workPeriod, bool) {
+	if workExp.StartDate == nil {
+		return workPeriod{}, false
+	}
+
+	var to time.Time
+	if workExp.StillEmployed {
+		to = now
+	} else if workExp.EndDate != nil {
+		to = workExp.EndDate.Time()
+		if to.After(now) {
+			to = now
+		}
+	} else {
+		// We don't know when this work experience ended
+		return workPeriod{}, false
+	}
+
+	from := workExp.StartDate.Time()
+	if !to.After(from) {
+		return workPeriod{}, false
+	}
+	return workPeriod{from: from, to: to}, true
+}
+
+// experienceYears returns the total amount of years covered by the periods
+// Overlapping periods are only counted once, so two jobs at the same time don't count double
+func experienceYears(periods []workPeriod) float64 {
+	if len(periods) == 0 {
+		return 0
+	}
+
+	sorted := make([]workPeriod, len(periods))
+	copy(sorted, periods)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].from.Before(sorted[b].from)
+	})
+
+	var total time.Duration
+	current := sorted[0]
+	for _, period := range sorted[1:] {
+		if !period.from.After(current.to) {
+			// The periods overlap, extend the current period
+			if period.to.After(current.to) {
+				current.to = period.to
+			}
+			continue
+		}
+		total += current.to.Sub(current.from)
+		current = period
+	}
+	total += current.to.Sub(current.from)
+
+	return total.Hours() / 24 / daysPerYear
+}
+
+// ageAt returns the age in whole years of someone born on dateOfBirth at the moment now
+func ageAt(dateOfBirth, now time.Time) int {
+	age := now.Year() - dateOfBirth.Year()
+	if now.Month() < dateOfBirth.Month() || now.Month() == dateOfBirth.Month() && now.Day() < dateOfBirth.Day() {
+		// Not yet had a birthday this year
+		age--
+	}
+	return age
+}
@@ -0,0 +1,137 @@
+package match
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Criterion is the name of something the matcher checks
+// The names are equal to the json field names of the profile field(s) that define the criterion
+type Criterion string
+
+// The criteria checked by the matcher in the order they are checked
+const (
+	CriterionActive                Criterion = "active"
+	CriterionActivePeriod          Criterion = "activePeriod"
+	CriterionSchedule              Criterion = "schedule"
+	CriterionAllowedScrapers       Criterion = "allowedScrapers"
+	CriterionExclusions            Criterion = "exclusions"
+	CriterionAge                   Criterion = "age"
+	CriterionAvailableWithinDays   Criterion = "availableWithinDays"
+	CriterionYearsSinceEducation   Criterion = "yearsSinceEducation"
+	CriterionEducations            Criterion = "educations"
+	CriterionDesiredProfessions    Criterion = "desiredProfessions"
+	CriterionProfessionExperienced Criterion = "professionExperienced"
+	CriterionYearsSinceWork        Criterion = "yearsSinceWork"
+	CriterionDriversLicenses       Criterion = "driversLicenses"
+	CriterionLanguages             Criterion = "languages"
+	CriterionSkills                Criterion = "skills"
+	CriterionAtLeastOne            Criterion = "atLeastOne"
+	CriterionCriteria              Criterion = "criteria"
+	CriterionZipCodes              Criterion = "zipCodes"
+	CriterionMinimumScore          Criterion = "minimumScore"
+	CriterionMatchQuota            Criterion = "matchQuota"
+)
+
+// Explanation explains why a profile did or did not match a CV
+type Explanation struct {
+	ProfileID   primitive.ObjectID `json:"profileId"`
+	ProfileName string             `json:"profileName"`
+	Matched     bool               `json:"matched"`
+	Score       float64            `json:"score" description:"the score the match would have, also set if the profile did not match"`
+	Steps       []ExplanationStep  `json:"steps" description:"the criteria evaluated in the order they where evaluated"`
+}
+
+// ExplanationStep contains the result of a single criterion evaluated by the matcher
+type ExplanationStep struct {
+	Criterion Criterion `json:"criterion"`
+	Passed    bool      `json:"passed"`
+	Required  bool      `json:"required" description:"if true and passed is false the profile did not match because of this criterion"`
+	Reason    string    `json:"reason"`
+}
+
+// profileMatcher keeps track of the state of matching a single profile
+// If explanation is nil nothing is recorded and the matcher stops at the first failed required criterion
+type profileMatcher struct {
+	explanation *Explanation
+	failed      bool
+}
+
+// pass records a criterion that was met
+func (m *profileMatcher) pass(criterion Criterion, reason string, args ...interface{}) {
+	if m.explanation == nil {
+		return
+	}
+
+	m.explanation.Steps = append(m.explanation.Steps, ExplanationStep{
+		Criterion: criterion,
+		Passed:    true,
+		Reason:    fmt.Sprintf(reason, args...),
+	})
+}
+
+// fail records a criterion that was not met
+// If required is true the profile won't match the CV
+//
+// Returns true if the caller should stop matching this profile,
+// this is always false when explaining as we want to report all failed criteria
+func (m *profileMatcher) fail(criterion Criterion, required bool, reason string, args ...interface{}) (stop bool) {
+	if required {
+		m.failed = true
+	}
+
+	if m.explanation == nil {
+		return required
+	}
+
+	m.explanation.Steps = append(m.explanation.Steps, ExplanationStep{
+		Criterion: criterion,
+		Passed:    false,
+		Required:  required,
+		Reason:    fmt.Sprintf(reason, args...),
+	})
+	return false
+}
+
+// quoteList formats a list of values for usage in an explanation reason
+func quoteList(values []string) string {
+	if len(values) == 0 {
+		return "nothing"
+	}
+
+	quoted := make([]string, len(values))
+	for idx, value := range values {
+		quoted[idx] = "'" + value + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// reasonTimeFormat is the format of the moments in an explanation reason
+const reasonTimeFormat = "2006-01-02 15:04"
+
+// activePeriodDescription formats the active period of a profile for usage in an explanation reason
+func activePeriodDescription(profile *models.Profile) string {
+	switch {
+	case profile.ActiveFrom != nil && profile.ActiveUntil != nil:
+		return "from " + profile.ActiveFrom.Time().Format(reasonTimeFormat) + " until " + profile.ActiveUntil.Time().Format(reasonTimeFormat)
+	case profile.ActiveFrom != nil:
+		return "from " + profile.ActiveFrom.Time().Format(reasonTimeFormat)
+	default:
+		return "until " + profile.ActiveUntil.Time().Format(reasonTimeFormat)
+	}
+}
+
+// rangeDescription formats a range of which min and max are optional (0) for usage in an explanation reason
+func rangeDescription(min, max int) string {
+	switch {
+	case min > 0 && max > 0:
+		return fmt.Sprintf("%d to %d", min, max)
+	case max > 0:
+		return fmt.Sprintf("at most %d", max)
+	default:
+		return fmt.Sprintf("at least %d", min)
+	}
+}
@@ -0,0 +1,311 @@
+package match
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/postalcode"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// minParallelCandidates is the minimal amount of candidates before we spread the matching over multiple goroutines
+// Below this the overhead of the goroutines is bigger than the time we win
+const minParallelCandidates = 32
+
+// Index is a pre-indexed set of profiles that can be matched against a CV much faster than Match
+//
+// The index only looks at criteria that can be checked exactly, like the allowed scrapers, zipcode ranges and required drivers licenses,
+// to quickly select the profiles that might match a CV.
+// The fuzzy criteria (educations, professions, etc..) are not indexed as the fuzzy matcher tolerates typos and the index would otherwise drop real matches.
+// The selected candidates are matched in parallel using the same logic as Match, so the results of both are equal.
+//
+// The profiles are prepared for matching when the index is created and only read after that,
+// so the index is safe to use from multiple goroutines as long as the profiles are not changed.
+type Index struct {
+	profiles []*models.Profile
+	// Workers is the maximum amount of goroutines used to match the candidates of a CV
+	// Defaults to GOMAXPROCS
+	Workers int
+
+	// anyScraper contains the profiles that allow all scrapers
+	anyScraper bitset
+	// byScraper contains the profiles that allow a specific scraper
+	byScraper map[primitive.ObjectID]bitset
+
+	// noZipcode contains the profiles without zipcode criteria
+	noZipcode bitset
+	// zipRadius contains the profiles with zip radiuses, these are only checked for dutch zipcodes
+	zipRadius bitset
+	// zipRanges contains the zipcode ranges of the profiles sorted by the start of the range
+	zipRanges map[postalcode.Country][]indexedZipRange
+
+	// noRequiredDriversLicense contains the profiles that do not require a drivers license
+	noRequiredDriversLicense bitset
+	// byRequiredDriversLicense contains the profiles that require one of their drivers licenses
+	byRequiredDriversLicense map[jsonHelpers.DriversLicense]bitset
+}
+
+type indexedZipRange struct {
+	from, to     uint32
+	profileIndex int
+}
+
+// NewIndex creates an index of the profiles
+// Profiles that are not yet prepared for matching are prepared by NewIndex
+// Changes to the profiles after creating the index are not reflected in the index
+func NewIndex(profiles []*models.Profile) *Index {
+	i := &Index{
+		profiles:                 profiles,
+		Workers:                  runtime.GOMAXPROCS(0),
+		anyScraper:               newBitset(len(profiles)),
+		byScraper:                map[primitive.ObjectID]bitset{},
+		noZipcode:                newBitset(len(profiles)),
+		zipRadius:                newBitset(len(profiles)),
+		zipRanges:                map[postalcode.Country][]indexedZipRange{},
+		noRequiredDriversLicense: newBitset(len(profiles)),
+		byRequiredDriversLicense: map[jsonHelpers.DriversLicense]bitset{},
+	}
+
+	for idx, profile := range profiles {
+		if !profile.PreparedForMatching() {
+			profile.PrepareForMatching()
+		}
+
+		if !profile.Active {
+			// Inactive profiles never match so we do not add them to any set
+			continue
+		}
+
+		if len(profile.AllowedScrapers) == 0 {
+			i.anyScraper.set(idx)
+		} else {
+			for _, id := range profile.AllowedScrapers {
+				set, ok := i.byScraper[id]
+				if !ok {
+					set = newBitset(len(profiles))
+					i.byScraper[id] = set
+				}
+				set.set(idx)
+			}
+		}
+
+		if len(profile.Zipcodes) == 0 && len(profile.ZipRadiuses) == 0 {
+			i.noZipcode.set(idx)
+		}
+		if len(profile.ZipRadiuses) > 0 {
+			i.zipRadius.set(idx)
+		}
+		for _, zipcode := range profile.Zipcodes {
+			from, to := zipcode.From, zipcode.To
+			if from > to {
+				from, to = to, from
+			}
+			country := zipcode.Country.OrDefault()
+			i.zipRanges[country] = append(i.zipRanges[country], indexedZipRange{from: from, to: to, profileIndex: idx})
+		}
+
+		if !profile.MustDriversLicense || profile.Criteria != nil || len(profile.DriversLicenses) == 0 {
+			i.noRequiredDriversLicense.set(idx)
+		} else {
+			// A profile that requires a drivers license without any valid drivers license can never match
+			// so it might end up in none of the sets
+			for _, l := range profile.DriversLicenses {
+				normalizedDriversLicense := strings.ToUpper(strings.ReplaceAll(l.Name, " ", ""))
+				if len(normalizedDriversLicense) == 0 {
+					continue
+				}
+				driversLicense := jsonHelpers.NewDriversLicense(normalizedDriversLicense)
+				set, ok := i.byRequiredDriversLicense[driversLicense]
+				if !ok {
+					set = newBitset(len(profiles))
+					i.byRequiredDriversLicense[driversLicense] = set
+				}
+				set.set(idx)
+			}
+		}
+	}
+
+	for _, ranges := range i.zipRanges {
+		sort.Slice(ranges, func(a, b int) bool {
+			return ranges[a].from < ranges[b].from
+		})
+	}
+
+	return i
+}
+
+// candidates returns the indexes of the profiles that might match the CV
+// Every profile that is not returned is guaranteed to not match the CV
+func (i *Index) candidates(scraperKey *models.APIKey, cv models.CV) []int {
+	// Allowed scrapers
+	res := i.anyScraper.clone()
+	if set, ok := i.byScraper[scraperKey.ID]; ok {
+		res.or(set)
+	}
+
+	// Zipcodes
+	zipcodes := i.noZipcode.clone()
+	if len(cv.PersonalDetails.Zip) != 0 {
+		// Like matchProfile unknown countries fall back to the default country
+		country, _ := postalcode.ParseCountry(cv.PersonalDetails.Country)
+		cvZip, err := postalcode.Parse(country, strings.TrimSpace(cv.PersonalDetails.Zip))
+		if err == nil {
+			if cvZip.Country == postalcode.CountryNL {
+				zipcodes.or(i.zipRadius)
+			}
+			if cvZip.Country.ValidNumber(cvZip.Number) {
+				ranges := i.zipRanges[cvZip.Country]
+				end := sort.Search(len(ranges), func(idx int) bool {
+					return ranges[idx].from > cvZip.Number
+				})
+				for _, zipRange := range ranges[:end] {
+					if zipRange.to >= cvZip.Number {
+						zipcodes.set(zipRange.profileIndex)
+					}
+				}
+			}
+		}
+	}
+	res.and(zipcodes)
+
+	// Required drivers licenses
+	driversLicenses := i.noRequiredDriversLicense.clone()
+	for _, cvDriversLicense := range cv.DriversLicenses {
+		if set, ok := i.byRequiredDriversLicense[cvDriversLicense]; ok {
+			driversLicenses.or(set)
+		}
+		for _, implied := range cvDriversLicense.Implied() {
+			if set, ok := i.byRequiredDriversLicense[implied]; ok {
+				driversLicenses.or(set)
+			}
+		}
+	}
+	res.and(driversLicenses)
+
+	return res.indexes()
+}
+
+// Match tries to match the indexed profiles to a CV
+// The results are equal to those of Match
+func (i *Index) Match(scraperKey *models.APIKey, cv models.CV) []FoundMatch {
+	now := time.Now()
+	freeText := newCVFreeText(&cv)
+	candidates := i.candidates(scraperKey, cv)
+
+	// results contains for every candidate the match or nil if the candidate did not match
+	results := make([]*FoundMatch, len(candidates))
+	matchCandidate := func(candidateIdx int) {
+		profileIdx := candidates[candidateIdx]
+		profile := i.profiles[profileIdx]
+
+		match, matched := matchProfile(scraperKey, profile, cv, freeText, now, nil)
+		if matched {
+			results[candidateIdx] = &FoundMatch{
+				Profile: *profile,
+				Matches: match,
+			}
+		}
+	}
+
+	workers := i.Workers
+	if workers > len(candidates)/minParallelCandidates {
+		workers = len(candidates) / minParallelCandidates
+	}
+	if workers <= 1 {
+		for candidateIdx := range candidates {
+			matchCandidate(candidateIdx)
+		}
+	} else {
+		// Every worker takes the next candidate until all candidates are matched,
+		// that way one slow profile doesn't hold up the profiles after it
+		var next int64 = -1
+		var wg sync.WaitGroup
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for {
+					candidateIdx := int(atomic.AddInt64(&next, 1))
+					if candidateIdx >= len(candidates) {
+						return
+					}
+					matchCandidate(candidateIdx)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	res := []FoundMatch{}
+	for _, result := range results {
+		if result != nil {
+			res = append(res, *result)
+		}
+	}
+
+	// The candidates are in the same order as the profiles so sorting gives the same order as Match
+	sortByScore(res)
+
+	return res
+}
+
+// Explain explains for every indexed profile why it did or did not match the CV
+// See the Explain function for more info
+func (i *Index) Explain(scraperKey *models.APIKey, cv models.CV) []Explanation {
+	res := make([]Explanation, len(i.profiles))
+	now := time.Now()
+	freeText := newCVFreeText(&cv)
+	for idx, profile := range i.profiles {
+		res[idx] = explainProfile(scraperKey, profile, cv, freeText, now)
+	}
+	return res
+}
+
+// bitset is a set of profile indexes
+type bitset []uint64
+
+func newBitset(size int) bitset {
+	return make(bitset, (size+63)/64)
+}
+
+func (b bitset) set(idx int) {
+	b[idx/64] |= 1 << (uint(idx) % 64)
+}
+
+func (b bitset) clone() bitset {
+	res := make(bitset, len(b))
+	copy(res, b)
+	return res
+}
+
+func (b bitset) or(other bitset) {
+	for idx := range b {
+		b[idx] |= other[idx]
+	}
+}
+
+func (b bitset) and(other bitset) {
+	for idx := range b {
+		b[idx] &= other[idx]
+	}
+}
+
+// indexes returns the indexes of all the set bits in ascending order
+func (b bitset) indexes() []int {
+	res := []int{}
+	for wordIdx, word := range b {
+		for bit := 0; word != 0; bit++ {
+			if word&1 == 1 {
+				res = append(res, wordIdx*64+bit)
+			}
+			word >>= 1
+		}
+	}
+	return res
+}
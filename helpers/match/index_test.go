@@ -0,0 +1,242 @@
+package match
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/postalcode"
+	"github.com/script-development/RT-CV/mock"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testProfessions = []string{
+	"Bakker",
+	"Chauffeur",
+	"Vrachtwagenchauffeur",
+	"Heftruckchauffeur",
+	"Timmerman",
+	"Loodgieter",
+	"Elektricien",
+	"Kok",
+	"Verpleegkundige",
+	"Schilder",
+}
+
+var testEducations = []string{
+	"Bakkerij",
+	"Logistiek",
+	"Bouwkunde",
+	"Installatietechniek",
+	"Zorg en welzijn",
+}
+
+var testDriversLicenses = []string{"B", "C", "CE", "D", "BE"}
+
+// generateProfiles generates random profiles, the same seed always results in the same profiles
+func generateProfiles(seed int64, amount int) []*models.Profile {
+	r := rand.New(rand.NewSource(seed))
+	pick := func(options []string) string {
+		return options[r.Intn(len(options))]
+	}
+
+	profiles := make([]*models.Profile, amount)
+	for idx := range profiles {
+		profile := &models.Profile{
+			M:      db.NewM(),
+			Name:   fmt.Sprintf("profile %d", idx),
+			Active: r.Intn(10) != 0,
+		}
+
+		switch r.Intn(4) {
+		case 0:
+			profile.AllowedScrapers = []primitive.ObjectID{mock.Key1.ID}
+		case 1:
+			profile.AllowedScrapers = []primitive.ObjectID{mock.Key2.ID}
+		}
+
+		if r.Intn(2) == 0 {
+			profile.DesiredProfessions = []models.ProfileProfession{{Name: pick(testProfessions)}}
+			profile.MustDesiredProfession = r.Intn(2) == 0
+		}
+		if r.Intn(2) == 0 {
+			profile.ProfessionExperienced = []models.ProfileProfession{{Name: pick(testProfessions)}}
+			profile.MustExpProfession = r.Intn(2) == 0
+		}
+		if r.Intn(3) == 0 {
+			profile.Educations = []models.ProfileEducation{{Name: pick(testEducations)}}
+			profile.MustEducation = r.Intn(2) == 0
+		}
+		if r.Intn(2) == 0 {
+			profile.DriversLicenses = []models.ProfileDriversLicense{{Name: pick(testDriversLicenses)}}
+			profile.MustDriversLicense = r.Intn(2) == 0
+		}
+
+		switch r.Intn(5) {
+		case 0, 1:
+			from := uint32(1000 + r.Intn(8000))
+			profile.Zipcodes = []models.ProfileZipcode{{From: from, To: from + uint32(r.Intn(1000))}}
+		case 2:
+			profile.Zipcodes = []models.ProfileZipcode{{Country: postalcode.CountryBE, From: 1000, To: 4999}}
+		case 3:
+			profile.ZipRadiuses = []models.ProfileZipRadius{{Zipcode: 1012, RadiusKm: float64(5 + r.Intn(100))}}
+		}
+
+		if r.Intn(10) == 0 {
+			profile.Criteria = &models.ProfileCriteriaExpression{Or: []models.ProfileCriteriaExpression{
+				{Criterion: models.ProfileCriterionDriversLicenses},
+				{Not: &models.ProfileCriteriaExpression{Criterion: models.ProfileCriterionDesiredProfessions}},
+			}}
+		}
+
+		profiles[idx] = profile
+	}
+	return profiles
+}
+
+// generateCVs generates random CVs, the same seed always results in the same CVs
+func generateCVs(seed int64, amount int) []models.CV {
+	r := rand.New(rand.NewSource(seed))
+	pick := func(options []string) string {
+		return options[r.Intn(len(options))]
+	}
+
+	zipcodes := []struct{ country, zip string }{
+		{"", "1012AB"},
+		{"", "3511"},
+		{"", "9779AB"},
+		{"Nederland", "5611"},
+		{"België", "2000"},
+		{"Deutschland", "10115"},
+		{"France", "75001"},
+		{"Holanda", "3511"},
+		{"", "AAAAAA"},
+		{"", ""},
+	}
+
+	cvs := make([]models.CV, amount)
+	for idx := range cvs {
+		zipcode := zipcodes[r.Intn(len(zipcodes))]
+		cv := models.CV{
+			PersonalDetails: models.PersonalDetails{Zip: zipcode.zip, Country: zipcode.country},
+			PreferredJobs:   []string{pick(testProfessions)},
+			WorkExperiences: []models.WorkExperience{{Profession: pick(testProfessions)}},
+			Educations:      []models.Education{{Name: pick(testEducations), HasDiploma: true}},
+		}
+		if r.Intn(3) != 0 {
+			cv.DriversLicenses = []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense(pick(testDriversLicenses))}
+		}
+		cvs[idx] = cv
+	}
+	return cvs
+}
+
+// matchedProfileIDs returns the matched profiles ids with their scores in the order they where matched
+func matchedProfileIDs(matches []FoundMatch) []string {
+	res := make([]string, len(matches))
+	for idx, match := range matches {
+		res[idx] = fmt.Sprintf("%s %f", match.Profile.ID.Hex(), match.Matches.Score)
+	}
+	return res
+}
+
+func TestIndexMatchEqualsMatch(t *testing.T) {
+	profiles := generateProfiles(1, 500)
+	index := NewIndex(profiles)
+
+	for _, workers := range []int{1, 4} {
+		index.Workers = workers
+		for idx, cv := range generateCVs(2, 100) {
+			for _, key := range []*models.APIKey{mock.Key1, mock.Key2} {
+				expected := Match(key, profiles, cv)
+				actual := index.Match(key, cv)
+				Equal(t, matchedProfileIDs(expected), matchedProfileIDs(actual), "cv %d", idx)
+			}
+		}
+	}
+}
+
+func TestIndexCandidates(t *testing.T) {
+	profiles := []*models.Profile{
+		// 0: inactive
+		{M: db.NewM(), Active: false},
+		// 1: only allowed for key 1
+		{M: db.NewM(), Active: true, AllowedScrapers: []primitive.ObjectID{mock.Key1.ID}},
+		// 2: zipcode range
+		{M: db.NewM(), Active: true, Zipcodes: []models.ProfileZipcode{{From: 2000, To: 1000}}},
+		// 3: requires drivers license C
+		{M: db.NewM(), Active: true, MustDriversLicense: true, DriversLicenses: []models.ProfileDriversLicense{{Name: "c"}}},
+		// 4: no criteria
+		{M: db.NewM(), Active: true},
+		// 5: zip radius
+		{M: db.NewM(), Active: true, ZipRadiuses: []models.ProfileZipRadius{{Zipcode: 1012, RadiusKm: 10}}},
+	}
+	index := NewIndex(profiles)
+
+	Equal(t, []int{4}, index.candidates(mock.Key2, models.CV{}))
+	Equal(t, []int{1, 4}, index.candidates(mock.Key1, models.CV{}))
+
+	// The range of profile 2 is swapped, that should still work
+	Equal(t, []int{2, 4, 5}, index.candidates(mock.Key2, models.CV{
+		PersonalDetails: models.PersonalDetails{Zip: "1500AB"},
+	}))
+	Equal(t, []int{4}, index.candidates(mock.Key2, models.CV{
+		PersonalDetails: models.PersonalDetails{Zip: "1500", Country: "België"},
+	}))
+	// Unknown countries are assumed to be dutch
+	Equal(t, []int{2, 4, 5}, index.candidates(mock.Key2, models.CV{
+		PersonalDetails: models.PersonalDetails{Zip: "1500AB", Country: "Holanda"},
+	}))
+
+	// CE implies C
+	Equal(t, []int{3, 4}, index.candidates(mock.Key2, models.CV{
+		DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("CE")},
+	}))
+	Equal(t, []int{4}, index.candidates(mock.Key2, models.CV{
+		DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("B")},
+	}))
+}
+
+func benchmarkMatch(b *testing.B, profilesAmount int, match func(profiles []*models.Profile) func(cv models.CV) []FoundMatch) {
+	profiles := generateProfiles(1, profilesAmount)
+	cvs := generateCVs(2, 50)
+
+	for _, profile := range profiles {
+		profile.PrepareForMatching()
+	}
+	matchCV := match(profiles)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		matchCV(cvs[n%len(cvs)])
+	}
+}
+
+func sequentialMatch(profiles []*models.Profile) func(cv models.CV) []FoundMatch {
+	return func(cv models.CV) []FoundMatch {
+		return Match(mock.Key2, profiles, cv)
+	}
+}
+
+func indexedMatch(profiles []*models.Profile) func(cv models.CV) []FoundMatch {
+	index := NewIndex(profiles)
+	return func(cv models.CV) []FoundMatch {
+		return index.Match(mock.Key2, cv)
+	}
+}
+
+func BenchmarkMatch1000(b *testing.B)       { benchmarkMatch(b, 1000, sequentialMatch) }
+func BenchmarkMatch10000(b *testing.B)      { benchmarkMatch(b, 10000, sequentialMatch) }
+func BenchmarkIndexMatch1000(b *testing.B)  { benchmarkMatch(b, 1000, indexedMatch) }
+func BenchmarkIndexMatch10000(b *testing.B) { benchmarkMatch(b, 10000, indexedMatch) }
+func BenchmarkNewIndex10000(b *testing.B) {
+	profiles := generateProfiles(1, 10000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		NewIndex(profiles)
+	}
+}
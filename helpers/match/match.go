@@ -1,16 +1,20 @@
 package match
 
 import (
+	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/apex/log"
-	fuzzymatcher "github.com/mjarkk/fuzzy-matcher"
 	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/geo"
 	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/postalcode"
+	"github.com/script-development/RT-CV/helpers/webhooks"
 	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // FoundMatch contains a match and why something is matched
@@ -20,307 +24,936 @@ type FoundMatch struct {
 }
 
 // Match tries to match a profile to a CV
+// The returned matches are sorted by their score, the best match comes first
+// Profiles that are not prepared using (*models.Profile).PrepareForMatching are prepared again on every call
 func Match(scraperKey *models.APIKey, profiles []*models.Profile, cv models.CV) []FoundMatch {
 	res := []FoundMatch{}
 
 	now := time.Now()
+	freeText := newCVFreeText(&cv)
 
 	for _, profile := range profiles {
-		if !profile.Active {
+		match, matched := matchProfile(scraperKey, profile, cv, freeText, now, nil)
+		if !matched {
 			continue
 		}
 
-		// There are a lot of CVs that fail on this check on the end
-		// Lets make those cases quick as we can easily check that
-		if len(profile.Zipcodes) != 0 && len(cv.PersonalDetails.Zip) == 0 {
-			continue
+		res = append(res, FoundMatch{
+			Profile: *profile,
+			Matches: match,
+		})
+	}
+
+	sortByScore(res)
+
+	return res
+}
+
+// Explain explains for every profile why it did or did not match the CV
+// Unlike Match this does not stop at the first failed criterion so all failed criteria of a profile are reported
+func Explain(scraperKey *models.APIKey, profiles []*models.Profile, cv models.CV) []Explanation {
+	res := make([]Explanation, len(profiles))
+
+	now := time.Now()
+	freeText := newCVFreeText(&cv)
+
+	for idx, profile := range profiles {
+		res[idx] = explainProfile(scraperKey, profile, cv, freeText, now)
+	}
+
+	return res
+}
+
+// explainProfile explains why a single profile did or did not match the CV
+func explainProfile(scraperKey *models.APIKey, profile *models.Profile, cv models.CV, freeText *cvFreeText, now time.Time) Explanation {
+	explanation := Explanation{
+		ProfileID:   profile.ID,
+		ProfileName: profile.Name,
+		Steps:       []ExplanationStep{},
+	}
+	match, matched := matchProfile(scraperKey, profile, cv, freeText, now, &explanation)
+	explanation.Matched = matched
+	explanation.Score = match.Score
+	return explanation
+}
+
+// matchProfile tries to match a single profile to a CV
+// freeText should be created from the same cv and is used to search for skills in the free text of the cv
+// If explanation is not nil every evaluated criterion is added to it
+func matchProfile(
+	scraperKey *models.APIKey,
+	profile *models.Profile,
+	cv models.CV,
+	freeText *cvFreeText,
+	now time.Time,
+	explanation *Explanation,
+) (models.Match, bool) {
+	if !profile.PreparedForMatching() {
+		// Never modify the profile of the caller as it might be matched by other goroutines at the same time
+		prepared := *profile
+		prepared.PrepareForMatching()
+		profile = &prepared
+	}
+
+	m := profileMatcher{explanation: explanation}
+
+	match := models.Match{
+		M:         db.NewM(),
+		ProfileID: profile.ID,
+		When:      jsonHelpers.RFC3339Nano(now),
+	}
+
+	if profile.Active {
+		m.pass(CriterionActive, "profile is active")
+	} else if m.fail(CriterionActive, true, "profile is not active") {
+		return match, false
+	}
+
+	// Check the active period and schedule
+	if profile.ActiveFrom != nil || profile.ActiveUntil != nil {
+		period := activePeriodDescription(profile)
+		if profile.ActivePeriodContains(now) {
+			m.pass(CriterionActivePeriod, "%s is within the active period, %s", now.Format(reasonTimeFormat), period)
+		} else if m.fail(CriterionActivePeriod, true, "%s is outside the active period, %s", now.Format(reasonTimeFormat), period) {
+			return match, false
+		}
+	}
+	if len(profile.Schedule) > 0 {
+		schedules := make([]string, len(profile.Schedule))
+		for idx, schedule := range profile.Schedule {
+			schedules[idx] = schedule.String()
+		}
+		moment := now.Weekday().String() + " " + now.Format("15:04")
+		if profile.ScheduleContains(now) {
+			m.pass(CriterionSchedule, "%s is within the schedule %s", moment, strings.Join(schedules, ", "))
+		} else if m.fail(CriterionSchedule, true, "%s is outside the schedule %s", moment, strings.Join(schedules, ", ")) {
+			return match, false
 		}
+	}
 
-		match := models.Match{
-			M:         db.NewM(),
-			ProfileID: profile.ID,
-			When:      jsonHelpers.RFC3339Nano(now),
+	// There are a lot of CVs that fail on this check on the end
+	// Lets make those cases quick as we can easily check that
+	if (len(profile.Zipcodes) != 0 || len(profile.ZipRadiuses) != 0) && len(cv.PersonalDetails.Zip) == 0 {
+		if m.fail(CriterionZipCodes, true, "cv has no zipcode") {
+			return match, false
 		}
+	}
 
-		// Check domain
-		if len(profile.AllowedScrapers) > 0 {
-			foundMatch := false
-			for _, id := range profile.AllowedScrapers {
-				if id == scraperKey.ID {
-					foundMatch = true
-					break
-				}
-			}
-			if !foundMatch {
-				continue
+	weights := profile.GetScoreWeights()
+	score := 0.0
+
+	// If the profile has a criteria expression the expression decides which criteria are required
+	useMustFlags := profile.Criteria == nil
+
+	// Check domain
+	if len(profile.AllowedScrapers) > 0 {
+		foundMatch := false
+		for _, id := range profile.AllowedScrapers {
+			if id == scraperKey.ID {
+				foundMatch = true
+				break
 			}
 		}
+		if foundMatch {
+			m.pass(CriterionAllowedScrapers, "scraper key %s is allowed", scraperKey.ID.Hex())
+		} else if m.fail(CriterionAllowedScrapers, true, "scraper key %s is not allowed", scraperKey.ID.Hex()) {
+			return match, false
+		}
+	}
 
-		// Check years since education
-		if profile.YearsSinceEducation > 0 {
-			mustBeAfter := now.AddDate(-profile.YearsSinceEducation, 0, 0)
-			lastEducativeYear := time.Date(1980, time.January, 1, 0, 0, 0, 0, time.Local)
+	// Check exclusions
+	// This is done before all other criteria as an excluded CV can never match
+	if !profile.Exclusions.IsEmpty() {
+		exclusions := profile.Exclusions
+		excluded := false
 
-			for _, cvEducation := range cv.Educations {
-				if len(cvEducation.Name) == 0 || cvEducation.EndDate == nil {
+		if len(exclusions.PreferredJobs) > 0 {
+			for _, cvPreferredJob := range cv.PreferredJobs {
+				if len(cvPreferredJob) == 0 {
 					continue
 				}
-
-				t := cvEducation.EndDate.Time()
-				if t.After(lastEducativeYear) {
-					lastEducativeYear = t
+				excludedIdx := profile.ExcludedPreferredJobsFuzzyMatcher.Match(cvPreferredJob)
+				if excludedIdx == -1 {
+					continue
 				}
+				excluded = true
+				if m.fail(
+					CriterionExclusions,
+					true,
+					"preferred job '%s' fuzzy-matched excluded '%s'",
+					cvPreferredJob,
+					exclusions.PreferredJobs[excludedIdx],
+				) {
+					return match, false
+				}
+				break
 			}
+		}
 
-			if lastEducativeYear.Before(mustBeAfter) {
-				continue
+		if len(exclusions.WorkExperiences) > 0 {
+			for _, workExp := range cv.WorkExperiences {
+				if len(workExp.Profession) == 0 {
+					continue
+				}
+				excludedIdx := profile.ExcludedWorkExperiencesFuzzyMatcher.Match(workExp.Profession)
+				if excludedIdx == -1 {
+					continue
+				}
+				excluded = true
+				if m.fail(
+					CriterionExclusions,
+					true,
+					"work experience '%s' fuzzy-matched excluded '%s'",
+					workExp.Profession,
+					exclusions.WorkExperiences[excludedIdx],
+				) {
+					return match, false
+				}
+				break
 			}
+		}
 
-			yearsSinceEducation := now.Year() - lastEducativeYear.Year()
-			match.YearsSinceEducation = &yearsSinceEducation
+		if len(exclusions.Educations) > 0 {
+			for _, cvEducation := range cv.Educations {
+				if len(cvEducation.Name) == 0 {
+					continue
+				}
+				excludedIdx := profile.ExcludedEducationsFuzzyMatcher.Match(cvEducation.Name)
+				if excludedIdx == -1 {
+					continue
+				}
+				excluded = true
+				if m.fail(
+					CriterionExclusions,
+					true,
+					"education '%s' fuzzy-matched excluded '%s'",
+					cvEducation.Name,
+					exclusions.Educations[excludedIdx],
+				) {
+					return match, false
+				}
+				break
+			}
 		}
 
-		// Check education and courses
-		matchedAnEducationOrCourse := false
-		checkedForEducationOrCourse := len(profile.Educations) > 0
-		if checkedForEducationOrCourse {
-			if len(cv.Educations) > 0 && profile.EducationFuzzyMatcher == nil {
-				// The fuzzy matcher is not yet setup, lets set it up here
-				names := make([]string, len(profile.Educations))
-				for idx, education := range profile.Educations {
-					names[idx] = education.Name
+		if exclusions.YearsSinceWork != nil {
+			stillEmployed := false
+			lastWorkYear := 0
+			for _, workExp := range cv.WorkExperiences {
+				if workExp.StillEmployed {
+					stillEmployed = true
+					break
+				}
+				if workExp.EndDate != nil && workExp.EndDate.Time().Year() > lastWorkYear {
+					lastWorkYear = workExp.EndDate.Time().Year()
 				}
-				profile.EducationFuzzyMatcher = fuzzymatcher.NewMatcher(names...)
 			}
 
-			if len(cv.Educations) > 0 {
-				for _, cvEducation := range cv.Educations {
-					if len(cvEducation.Name) == 0 {
-						continue
-					}
+			yearsSinceLastWork := now.Year() - lastWorkYear
+			if !stillEmployed && lastWorkYear != 0 && yearsSinceLastWork > *exclusions.YearsSinceWork {
+				excluded = true
+				if m.fail(
+					CriterionExclusions,
+					true,
+					"last work ended %d year(s) ago, more than the excluded %d year(s)",
+					yearsSinceLastWork,
+					*exclusions.YearsSinceWork,
+				) {
+					return match, false
+				}
+			}
+		}
 
-					if !cvEducation.HasDiploma && profile.MustEducationFinished {
-						continue
-					}
+		if !excluded {
+			m.pass(CriterionExclusions, "cv matched none of the exclusions")
+		}
+	}
 
-					educationIdx := profile.EducationFuzzyMatcher.Match(cvEducation.Name)
-					if educationIdx == -1 {
-						continue
-					}
+	// Check age
+	if profile.HasAgeCriteria() {
+		dateOfBirth := cv.PersonalDetails.DateOfBirth
+		if GetConfig().DisableAgeMatching {
+			m.pass(CriterionAge, "age criteria ignored, age matching is disabled on this server")
+		} else if dateOfBirth == nil {
+			if m.fail(CriterionAge, true, "cv has no date of birth") {
+				return match, false
+			}
+		} else {
+			age := ageAt(dateOfBirth.Time(), now)
+			if age >= profile.MinAge && (profile.MaxAge == 0 || age <= profile.MaxAge) {
+				match.Age = &age
+				m.pass(CriterionAge, "age %d is %s", age, rangeDescription(profile.MinAge, profile.MaxAge))
+			} else if m.fail(CriterionAge, true, "age %d is not %s", age, rangeDescription(profile.MinAge, profile.MaxAge)) {
+				return match, false
+			}
+		}
+	}
 
-					match.Education = &profile.Educations[educationIdx].Name
-					matchedAnEducationOrCourse = true
-					break
-				}
+	// Check availability
+	if profile.AvailableWithinDays != nil {
+		availableWithinDays := *profile.AvailableWithinDays
+		if cv.AvailableFrom == nil {
+			m.pass(CriterionAvailableWithinDays, "cv has no available from date, assumed to be available now")
+		} else {
+			availableFrom := cv.AvailableFrom.Time()
+			if !availableFrom.After(now.AddDate(0, 0, availableWithinDays)) {
+				m.pass(
+					CriterionAvailableWithinDays,
+					"available from %s, within %d day(s)",
+					availableFrom.Format("2006-01-02"),
+					availableWithinDays,
+				)
+			} else if m.fail(
+				CriterionAvailableWithinDays,
+				true,
+				"available from %s, not within %d day(s)",
+				availableFrom.Format("2006-01-02"),
+				availableWithinDays,
+			) {
+				return match, false
 			}
+		}
+	}
+
+	// Check years since education
+	if profile.YearsSinceEducation > 0 {
+		mustBeAfter := now.AddDate(-profile.YearsSinceEducation, 0, 0)
+		lastEducativeYear := time.Date(1980, time.January, 1, 0, 0, 0, 0, time.Local)
 
-			if !matchedAnEducationOrCourse && profile.MustEducation {
-				// CV doesn't have any matched education
+		for _, cvEducation := range cv.Educations {
+			if len(cvEducation.Name) == 0 || cvEducation.EndDate == nil {
 				continue
 			}
+
+			t := cvEducation.EndDate.Time()
+			if t.After(lastEducativeYear) {
+				lastEducativeYear = t
+			}
+		}
+
+		yearsSinceEducation := now.Year() - lastEducativeYear.Year()
+		if !lastEducativeYear.Before(mustBeAfter) {
+			match.YearsSinceEducation = &yearsSinceEducation
+			m.pass(CriterionYearsSinceEducation, "last education ended %d year(s) ago", yearsSinceEducation)
+		} else if m.fail(
+			CriterionYearsSinceEducation,
+			true,
+			"last education ended %d year(s) ago, more than %d year(s)",
+			yearsSinceEducation,
+			profile.YearsSinceEducation,
+		) {
+			return match, false
 		}
+	}
 
-		// Check profession
-		matchedADesiredProfession := false
-		checkedForDesiredProfession := len(profile.DesiredProfessions) > 0
-		if checkedForDesiredProfession {
-			if profile.DesiredProfessionsFuzzyMatcher == nil {
-				profileProfessionNames := make([]string, len(profile.DesiredProfessions))
-				for idx, p := range profile.DesiredProfessions {
-					profileProfessionNames[idx] = p.Name
+	// Check education and courses
+	matchedAnEducationOrCourse := false
+	checkedForEducationOrCourse := len(profile.Educations) > 0
+	if checkedForEducationOrCourse {
+		cvEducationNames := []string{}
+		if len(cv.Educations) > 0 {
+			for _, cvEducation := range cv.Educations {
+				if len(cvEducation.Name) == 0 {
+					continue
 				}
-				profile.DesiredProfessionsFuzzyMatcher = fuzzymatcher.NewMatcher(profileProfessionNames...)
-			}
 
-			for _, cvPreferredJob := range cv.PreferredJobs {
-				if len(cvPreferredJob) == 0 {
+				if !cvEducation.HasDiploma && profile.MustEducationFinished {
 					continue
 				}
 
-				matchedDesiredProfession := profile.DesiredProfessionsFuzzyMatcher.Match(cvPreferredJob)
-				if matchedDesiredProfession != -1 {
-					match.DesiredProfession = &profile.DesiredProfessions[matchedDesiredProfession].Name
-					matchedADesiredProfession = true
-					break
+				cvEducationNames = append(cvEducationNames, cvEducation.Name)
+				educationIdx := profile.EducationFuzzyMatcher.Match(cvEducation.Name)
+				if educationIdx == -1 {
+					continue
 				}
+
+				match.Education = &profile.Educations[educationIdx].Name
+				matchedAnEducationOrCourse = true
+				score += weights.Education
+				m.pass(CriterionEducations, "education '%s' fuzzy-matched '%s'", cvEducation.Name, *match.Education)
+				break
 			}
+		}
 
-			if !matchedADesiredProfession && profile.MustDesiredProfession {
-				// CV doesn't have any matching professions
-				continue
+		if !matchedAnEducationOrCourse {
+			profileEducationNames := make([]string, len(profile.Educations))
+			for idx, education := range profile.Educations {
+				profileEducationNames[idx] = education.Name
+			}
+
+			// CV doesn't have any matched education
+			if m.fail(
+				CriterionEducations,
+				profile.MustEducation && useMustFlags,
+				"no education fuzzy-matched %s, cv educations: %s",
+				quoteList(profileEducationNames),
+				quoteList(cvEducationNames),
+			) {
+				return match, false
 			}
 		}
+	}
 
-		// check profession experienced
-		matchedAProfile := false
-		checkedForProfessionExperienced := len(profile.ProfessionExperienced) > 0
-		if checkedForProfessionExperienced {
-			matchedProfileIdx := -1
-			for _, workExp := range cv.WorkExperiences {
-				if profile.ProfessionExperiencedFuzzyMatcher == nil {
-					// The fuzzy matcher is not yet setup, lets set it up here
-					names := make([]string, len(profile.ProfessionExperienced))
-					for idx, profile := range profile.ProfessionExperienced {
-						names[idx] = profile.Name
-					}
+	// Check profession
+	matchedADesiredProfession := false
+	checkedForDesiredProfession := len(profile.DesiredProfessions) > 0
+	if checkedForDesiredProfession {
+		for _, cvPreferredJob := range cv.PreferredJobs {
+			if len(cvPreferredJob) == 0 {
+				continue
+			}
 
-					profile.ProfessionExperiencedFuzzyMatcher = fuzzymatcher.NewMatcher(names...)
-				}
+			matchedDesiredProfession := profile.DesiredProfessionsFuzzyMatcher.Match(cvPreferredJob)
+			if matchedDesiredProfession != -1 {
+				match.DesiredProfession = &profile.DesiredProfessions[matchedDesiredProfession].Name
+				matchedADesiredProfession = true
+				score += weights.DesiredProfession
+				m.pass(CriterionDesiredProfessions, "preferred job '%s' fuzzy-matched '%s'", cvPreferredJob, *match.DesiredProfession)
+				break
+			}
+		}
 
-				if len(workExp.Profession) == 0 {
-					continue
-				}
+		if !matchedADesiredProfession {
+			profileProfessionNames := make([]string, len(profile.DesiredProfessions))
+			for idx, p := range profile.DesiredProfessions {
+				profileProfessionNames[idx] = p.Name
+			}
 
-				match := profile.ProfessionExperiencedFuzzyMatcher.Match(workExp.Profession)
-				if match != -1 {
-					matchedProfileIdx = match
-					break
-				}
+			// CV doesn't have any matching professions
+			if m.fail(
+				CriterionDesiredProfessions,
+				profile.MustDesiredProfession && useMustFlags,
+				"no preferred job fuzzy-matched %s, cv preferred jobs: %s",
+				quoteList(profileProfessionNames),
+				quoteList(cv.PreferredJobs),
+			) {
+				return match, false
 			}
+		}
+	}
 
-			if matchedProfileIdx != -1 {
-				matchedAProfile = true
-				match.ProfessionExperienced = &profile.ProfessionExperienced[matchedProfileIdx].Name
-			} else if profile.MustExpProfession {
+	// check profession experienced
+	matchedAProfile := false
+	checkedForProfessionExperienced := len(profile.ProfessionExperienced) > 0
+	if checkedForProfessionExperienced {
+		// The work periods of the work experiences that matched a profession of the profile by the index of that profession
+		// professionsOrder contains the matched professions in the order they were first matched
+		matchedPeriods := map[int][]workPeriod{}
+		matchedWorkExp := map[int]string{}
+		professionsOrder := []int{}
+		cvProfessions := []string{}
+		hoursMismatches := []string{}
+		for _, workExp := range cv.WorkExperiences {
+			if len(workExp.Profession) == 0 {
 				continue
 			}
-		}
 
-		// Check years since work
-		if profile.YearsSinceWork != nil && *profile.YearsSinceWork > 0 {
-			profileMustYearsSinceWork := *profile.YearsSinceWork
-			nowYear := now.Year()
-			lastWorkYear := 0
+			cvProfessions = append(cvProfessions, workExp.Profession)
+			professionIdx := profile.ProfessionExperiencedFuzzyMatcher.Match(workExp.Profession)
+			if professionIdx == -1 {
+				continue
+			}
+			if !profile.WeeklyHoursMetBy(workExp.WeeklyHoursWorked) {
+				hoursMismatches = append(hoursMismatches, fmt.Sprintf("%s (%d hours)", workExp.Profession, workExp.WeeklyHoursWorked))
+				continue
+			}
 
-			for _, cvWorkExp := range cv.WorkExperiences {
-				if cvWorkExp.EndDate == nil {
-					continue
-				}
+			if _, ok := matchedWorkExp[professionIdx]; !ok {
+				matchedWorkExp[professionIdx] = workExp.Profession
+				professionsOrder = append(professionsOrder, professionIdx)
+			}
+			period, ok := workExperiencePeriod(workExp, now)
+			if ok {
+				matchedPeriods[professionIdx] = append(matchedPeriods[professionIdx], period)
+			}
+		}
 
-				endDateYear := cvWorkExp.EndDate.Time().Year()
-				if endDateYear > lastWorkYear {
-					lastWorkYear = endDateYear
+		matchedProfileIdx := -1
+		mostExperiencedIdx := -1
+		mostYearsExperience := 0.0
+		for _, professionIdx := range professionsOrder {
+			years := experienceYears(matchedPeriods[professionIdx])
+			if years >= profile.MinYearsExperience {
+				matchedProfileIdx = professionIdx
+				if len(matchedPeriods[professionIdx]) > 0 {
+					match.YearsExperience = &years
 				}
+				break
+			}
+			if mostExperiencedIdx == -1 || years > mostYearsExperience {
+				mostExperiencedIdx = professionIdx
+				mostYearsExperience = years
+			}
+		}
+
+		if matchedProfileIdx != -1 {
+			matchedAProfile = true
+			match.ProfessionExperienced = &profile.ProfessionExperienced[matchedProfileIdx].Name
+			score += weights.ProfessionExperienced
+			if profile.MinYearsExperience > 0 {
+				m.pass(
+					CriterionProfessionExperienced,
+					"work experience '%s' fuzzy-matched '%s' with %.1f year(s) of experience, at least %.1f year(s)",
+					matchedWorkExp[matchedProfileIdx],
+					*match.ProfessionExperienced,
+					*match.YearsExperience,
+					profile.MinYearsExperience,
+				)
+			} else {
+				m.pass(
+					CriterionProfessionExperienced,
+					"work experience '%s' fuzzy-matched '%s'",
+					matchedWorkExp[matchedProfileIdx],
+					*match.ProfessionExperienced,
+				)
+			}
+		} else {
+			profileProfessionNames := make([]string, len(profile.ProfessionExperienced))
+			for idx, p := range profile.ProfessionExperienced {
+				profileProfessionNames[idx] = p.Name
 			}
 
-			// Sanity check
-			if lastWorkYear > nowYear {
-				lastWorkYear = nowYear
+			var failed bool
+			required := profile.MustExpProfession && useMustFlags
+			if mostExperiencedIdx != -1 {
+				failed = m.fail(
+					CriterionProfessionExperienced,
+					required,
+					"work experience '%s' fuzzy-matched '%s' with %.1f year(s) of experience, less than %.1f year(s)",
+					matchedWorkExp[mostExperiencedIdx],
+					profile.ProfessionExperienced[mostExperiencedIdx].Name,
+					mostYearsExperience,
+					profile.MinYearsExperience,
+				)
+			} else if len(hoursMismatches) > 0 {
+				failed = m.fail(
+					CriterionProfessionExperienced,
+					required,
+					"no work experience with %s weekly hours fuzzy-matched %s, matched work experiences with other weekly hours: %s",
+					rangeDescription(profile.MinWeeklyHours, profile.MaxWeeklyHours),
+					quoteList(profileProfessionNames),
+					quoteList(hoursMismatches),
+				)
+			} else {
+				failed = m.fail(
+					CriterionProfessionExperienced,
+					required,
+					"no work experience fuzzy-matched %s, cv work experiences: %s",
+					quoteList(profileProfessionNames),
+					quoteList(cvProfessions),
+				)
+			}
+			if failed {
+				return match, false
 			}
+		}
+	}
 
-			yearsSinceLastWork := nowYear - lastWorkYear
-			if yearsSinceLastWork > profileMustYearsSinceWork {
-				// To long ago since last work
+	// Check years since work
+	if profile.YearsSinceWork != nil && *profile.YearsSinceWork > 0 {
+		profileMustYearsSinceWork := *profile.YearsSinceWork
+		nowYear := now.Year()
+		lastWorkYear := 0
+
+		for _, cvWorkExp := range cv.WorkExperiences {
+			if cvWorkExp.EndDate == nil {
 				continue
 			}
 
+			endDateYear := cvWorkExp.EndDate.Time().Year()
+			if endDateYear > lastWorkYear {
+				lastWorkYear = endDateYear
+			}
+		}
+
+		// Sanity check
+		if lastWorkYear > nowYear {
+			lastWorkYear = nowYear
+		}
+
+		yearsSinceLastWork := nowYear - lastWorkYear
+		if yearsSinceLastWork <= profileMustYearsSinceWork {
 			match.YearsSinceWork = &yearsSinceLastWork
+			m.pass(CriterionYearsSinceWork, "last work ended %d year(s) ago", yearsSinceLastWork)
+		} else if lastWorkYear == 0 {
+			if m.fail(CriterionYearsSinceWork, true, "cv has no work experience with an end date") {
+				return match, false
+			}
+		} else if m.fail(
+			CriterionYearsSinceWork,
+			true,
+			"last work ended %d year(s) ago, more than %d year(s)",
+			yearsSinceLastWork,
+			profileMustYearsSinceWork,
+		) {
+			// To long ago since last work
+			return match, false
 		}
+	}
 
-		// Check drivers license
-		matchedADriversLicense := false
-		checkedForDriversLicense := len(profile.DriversLicenses) > 0
-		if checkedForDriversLicense {
-			if profile.NormalizedDriversLicensesCache == nil {
-				profile.NormalizedDriversLicensesCache = []jsonHelpers.DriversLicense{}
-				for _, l := range profile.DriversLicenses {
-					normalizedDriversLicense := strings.ToUpper(strings.ReplaceAll(l.Name, " ", ""))
-					if len(normalizedDriversLicense) == 0 {
-						continue
-					}
-					profile.NormalizedDriversLicensesCache = append(
-						profile.NormalizedDriversLicensesCache,
-						jsonHelpers.NewDriversLicense(normalizedDriversLicense),
-					)
+	// Check drivers license
+	matchedADriversLicense := false
+	checkedForDriversLicense := len(profile.DriversLicenses) > 0
+	if checkedForDriversLicense {
+		// A CV drivers license can also satisfy a required drivers license if it implies the required one,
+		// for example a CV with CE satisfies C and B
+		// An exact match is preferred over an implied one so we report the most relevant drivers license
+		var requiredDriversLicense, matchedDriversLicense jsonHelpers.DriversLicense
+	driversLicensesLoop:
+		for _, normalizedDriversLicense := range profile.NormalizedDriversLicensesCache {
+			for _, cvDriversLicense := range cv.DriversLicenses {
+				if normalizedDriversLicense == cvDriversLicense {
+					matchedADriversLicense = true
+					requiredDriversLicense = normalizedDriversLicense
+					matchedDriversLicense = cvDriversLicense
+					break driversLicensesLoop
 				}
 			}
-
-		driversLicensesLoop:
-			for _, normalizedDriversLicense := range profile.NormalizedDriversLicensesCache {
-				for _, cvDriversLicense := range cv.DriversLicenses {
-					if normalizedDriversLicense == cvDriversLicense {
-						matchedADriversLicense = true
-						break driversLicensesLoop
-					}
+			for _, cvDriversLicense := range cv.DriversLicenses {
+				if cvDriversLicense.Implies(normalizedDriversLicense) {
+					matchedADriversLicense = true
+					requiredDriversLicense = normalizedDriversLicense
+					matchedDriversLicense = cvDriversLicense
+					break driversLicensesLoop
 				}
 			}
+		}
 
-			if matchedADriversLicense {
-				match.DriversLicense = true
-			} else if profile.MustDriversLicense {
-				// CV doesn't have any matching drivers license
-				continue
+		if matchedADriversLicense {
+			match.DriversLicense = true
+			match.MatchedDriversLicense = &models.MatchedDriversLicense{
+				Required: requiredDriversLicense.String(),
+				Held:     matchedDriversLicense.String(),
+			}
+			score += weights.DriversLicense
+			if requiredDriversLicense == matchedDriversLicense {
+				m.pass(CriterionDriversLicenses, "cv has drivers license %s", matchedDriversLicense.String())
+			} else {
+				m.pass(
+					CriterionDriversLicenses,
+					"cv has drivers license %s which implies %s",
+					matchedDriversLicense.String(),
+					requiredDriversLicense.String(),
+				)
+			}
+		} else {
+			profileDriversLicenses := make([]string, len(profile.NormalizedDriversLicensesCache))
+			for idx, l := range profile.NormalizedDriversLicensesCache {
+				profileDriversLicenses[idx] = l.String()
+			}
+			cvDriversLicenses := make([]string, len(cv.DriversLicenses))
+			for idx, l := range cv.DriversLicenses {
+				cvDriversLicenses[idx] = l.String()
+			}
+
+			// CV doesn't have any matching drivers license
+			if m.fail(
+				CriterionDriversLicenses,
+				profile.MustDriversLicense && useMustFlags,
+				"none of the drivers licenses %s found, cv drivers licenses: %s",
+				quoteList(profileDriversLicenses),
+				quoteList(cvDriversLicenses),
+			) {
+				return match, false
 			}
 		}
+	}
 
-		// Check if at least one of the matches is true
-		if checkedForEducationOrCourse || checkedForDesiredProfession || checkedForDriversLicense || checkedForProfessionExperienced {
-			if !matchedAnEducationOrCourse && !matchedADesiredProfession && !matchedADriversLicense && !matchedAProfile {
+	// Check languages
+	matchedALanguage := false
+	checkedForLanguage := len(profile.Languages) > 0
+	if checkedForLanguage {
+		for _, cvLanguage := range cv.Languages {
+			if len(cvLanguage.Name) == 0 {
+				continue
+			}
+
+			languageIdx := profile.LanguagesFuzzyMatcher.Match(cvLanguage.Name)
+			if languageIdx == -1 || !profile.Languages[languageIdx].MetBy(cvLanguage) {
 				continue
 			}
+
+			match.Language = &profile.Languages[languageIdx]
+			matchedALanguage = true
+			score += weights.Language
+			m.pass(CriterionLanguages, "language '%s' meets the requirements of '%s'", cvLanguage.Name, match.Language.Name)
+			break
 		}
 
-		// Check zipcodes
-		if len(profile.Zipcodes) != 0 {
-			zipStr := strings.TrimSpace(cv.PersonalDetails.Zip)
-			zipStrLen := len(zipStr)
-			if zipStrLen != 4 && zipStrLen != 6 {
-				// Client has invalid zipcode
+		if !matchedALanguage {
+			profileLanguages := make([]string, len(profile.Languages))
+			for idx, language := range profile.Languages {
+				profileLanguages[idx] = fmt.Sprintf(
+					"%s (spoken %s, written %s)",
+					language.Name,
+					language.LevelSpoken.String(),
+					language.LevelWritten.String(),
+				)
+			}
+			cvLanguages := make([]string, len(cv.Languages))
+			for idx, language := range cv.Languages {
+				cvLanguages[idx] = fmt.Sprintf(
+					"%s (spoken %s, written %s)",
+					language.Name,
+					language.LevelSpoken.String(),
+					language.LevelWritten.String(),
+				)
+			}
+
+			// CV doesn't have any language that meets the requirements
+			if m.fail(
+				CriterionLanguages,
+				profile.MustLanguage && useMustFlags,
+				"no language met the requirements of %s, cv languages: %s",
+				quoteList(profileLanguages),
+				quoteList(cvLanguages),
+			) {
+				return match, false
+			}
+		}
+	}
+
+	// Check skills
+	matchedASkill := false
+	checkedForSkill := len(profile.Skills) > 0
+	if checkedForSkill {
+		cvCompetences := []string{}
+		for _, competence := range cv.Competences {
+			if len(competence.Name) == 0 {
 				continue
 			}
-			cvZipNr, err := strconv.Atoi(zipStr[:4])
-			if err != nil {
-				// Client has invalid zipcode
+
+			cvCompetences = append(cvCompetences, competence.Name)
+			skillIdx := profile.SkillsFuzzyMatcher.Match(competence.Name)
+			if skillIdx == -1 {
 				continue
 			}
-			cvZipNrUint16 := uint16(cvZipNr)
 
+			match.Skill = &profile.Skills[skillIdx].Name
+			matchedASkill = true
+			m.pass(CriterionSkills, "competence '%s' fuzzy-matched '%s'", competence.Name, *match.Skill)
+			break
+		}
+
+		if !matchedASkill {
+			// Free text is too long to fuzzy match so we search for the skills as keywords
+			for idx, normalizedSkill := range profile.NormalizedSkillsCache {
+				source, found := freeText.find(normalizedSkill)
+				if !found {
+					continue
+				}
+
+				match.Skill = &profile.Skills[idx].Name
+				matchedASkill = true
+				m.pass(CriterionSkills, "found '%s' in the %s", *match.Skill, source)
+				break
+			}
+		}
+
+		if matchedASkill {
+			score += weights.Skill
+		} else {
+			profileSkills := make([]string, len(profile.Skills))
+			for idx, skill := range profile.Skills {
+				profileSkills[idx] = skill.Name
+			}
+
+			// CV doesn't have any of the skills
+			if m.fail(
+				CriterionSkills,
+				profile.MustSkill && useMustFlags,
+				"no competence fuzzy-matched %s and none of them were found in the competence descriptions, interests or personal presentation, cv competences: %s",
+				quoteList(profileSkills),
+				quoteList(cvCompetences),
+			) {
+				return match, false
+			}
+		}
+	}
+
+	if profile.Criteria != nil {
+		// Check the criteria expression
+		met := map[models.ProfileCriterion]bool{
+			models.ProfileCriterionEducations:            matchedAnEducationOrCourse,
+			models.ProfileCriterionDesiredProfessions:    matchedADesiredProfession,
+			models.ProfileCriterionProfessionExperienced: matchedAProfile,
+			models.ProfileCriterionDriversLicenses:       matchedADriversLicense,
+			models.ProfileCriterionLanguages:             matchedALanguage,
+			models.ProfileCriterionSkills:                matchedASkill,
+		}
+		criteriaMet := profile.Criteria.Evaluate(func(criterion models.ProfileCriterion) bool {
+			return met[criterion]
+		})
+		if criteriaMet {
+			m.pass(CriterionCriteria, "criteria %s met", profile.Criteria.String())
+		} else if m.fail(CriterionCriteria, true, "criteria %s not met", profile.Criteria.String()) {
+			return match, false
+		}
+	} else if checkedForEducationOrCourse || checkedForDesiredProfession || checkedForDriversLicense || checkedForProfessionExperienced || checkedForLanguage || checkedForSkill {
+		// Check if at least one of the matches is true
+		if matchedAnEducationOrCourse || matchedADesiredProfession || matchedADriversLicense || matchedAProfile || matchedALanguage || matchedASkill {
+			m.pass(CriterionAtLeastOne, "at least one of the education, profession, drivers license, language or skill criteria matched")
+		} else if m.fail(
+			CriterionAtLeastOne,
+			true,
+			"none of the education, profession, drivers license, language or skill criteria matched",
+		) {
+			return match, false
+		}
+	}
+
+	// Check zipcodes
+	if (len(profile.Zipcodes) != 0 || len(profile.ZipRadiuses) != 0) && len(cv.PersonalDetails.Zip) != 0 {
+		zipStr := strings.TrimSpace(cv.PersonalDetails.Zip)
+		// Unknown countries fall back to the default country
+		country, countryKnown := postalcode.ParseCountry(cv.PersonalDetails.Country)
+		cvZip, zipErr := postalcode.Parse(country, zipStr)
+
+		if zipErr != nil {
+			// Client has invalid zipcode
+			reason := fmt.Sprintf("zipcode %s is not a valid %s zipcode, %s", zipStr, country, zipErr.Error())
+			if !countryKnown {
+				reason += fmt.Sprintf(" (unknown country %s)", cv.PersonalDetails.Country)
+			}
+			if m.fail(CriterionZipCodes, true, "%s", reason) {
+				return match, false
+			}
+		} else {
 			cvZipInRange := false
 			for idx, zipcode := range profile.Zipcodes {
-				if zipcode.IsWithinCithAndArea(cvZipNrUint16) {
+				if zipcode.Contains(cvZip) {
 					match.ZipCode = &profile.Zipcodes[idx]
 					cvZipInRange = true
+					score += weights.ZipDistance * zipcodeFactor(zipcode, cvZip.Number)
+					m.pass(CriterionZipCodes, "zipcode %s within %s", cvZip, zipcode)
 					break
 				}
 			}
 
+			cvZipCoordinatesKnown := false
+			if !cvZipInRange && len(profile.ZipRadiuses) != 0 && cvZip.Country == postalcode.CountryNL {
+				var cvZipCoordinates geo.Coordinates
+				cvZipCoordinates, cvZipCoordinatesKnown = geo.DutchPC4Coordinates(uint16(cvZip.Number))
+				if cvZipCoordinatesKnown {
+					for _, zipRadius := range profile.ZipRadiuses {
+						center, ok := zipRadius.CenterCoordinates()
+						if !ok {
+							continue
+						}
+
+						distance := center.DistanceKm(cvZipCoordinates)
+						if distance > zipRadius.RadiusKm {
+							continue
+						}
+
+						match.DistanceKm = &distance
+						cvZipInRange = true
+						score += weights.ZipDistance * radiusFactor(distance, zipRadius.RadiusKm)
+						m.pass(CriterionZipCodes, "zipcode %s is %.1f km from the centre, within %.1f km", cvZip, distance, zipRadius.RadiusKm)
+						break
+					}
+				}
+			}
+
 			if !cvZipInRange {
+				areas := make([]string, 0, len(profile.Zipcodes)+len(profile.ZipRadiuses))
+				for _, zipcode := range profile.Zipcodes {
+					areas = append(areas, zipcode.String())
+				}
+				for _, zipRadius := range profile.ZipRadiuses {
+					if zipRadius.Center != nil {
+						areas = append(areas, fmt.Sprintf("%.1f km around %f,%f", zipRadius.RadiusKm, zipRadius.Center.Lat, zipRadius.Center.Lng))
+					} else {
+						areas = append(areas, fmt.Sprintf("%.1f km around %d", zipRadius.RadiusKm, zipRadius.Zipcode))
+					}
+				}
+
+				zipDescription := cvZip.String()
+				if cvZip.Country != postalcode.DefaultCountry {
+					zipDescription = string(cvZip.Country) + " " + zipDescription
+				}
+
+				reason := "zipcode %s outside %s"
+				if len(profile.ZipRadiuses) != 0 && !cvZipCoordinatesKnown {
+					reason += ", the coordinates of the zipcode are unknown"
+				}
+
 				// no matching zipcode
-				continue
+				if m.fail(CriterionZipCodes, true, reason, zipDescription, strings.Join(areas, ", ")) {
+					return match, false
+				}
 			}
 		}
+	}
 
-		res = append(res, FoundMatch{
-			Profile: *profile,
-			Matches: match,
-		})
+	score += weights.Recency * recencyFactor(cv, now)
+	match.Score = score
+	if profile.MinimumScore > 0 {
+		if score >= profile.MinimumScore {
+			m.pass(CriterionMinimumScore, "score %.2f is at least %.2f", score, profile.MinimumScore)
+		} else if m.fail(CriterionMinimumScore, true, "score %.2f is lower than %.2f", score, profile.MinimumScore) {
+			return match, false
+		}
 	}
 
-	return res
+	return match, !m.failed
 }
 
 // HandleMatch sends a match to the desired destination based on the OnMatch field in the profile
-func (match FoundMatch) HandleMatch(cv models.CV, pdfFile *os.File, keyName string) {
+// Webhooks are delivered in the background by webhookSender, their results can be found in the webhook delivery log
+// Emails are sent in the background by emailService, their results can be found in the email delivery log
+// The emails are rendered with emailTemplate or with the built in template if emailTemplate is nil
+// The http calls and email addresses in sent are skipped, the ones that are queued successfully are added to sent
+// Returns the last error that occurred while queueing the webhooks or creating and queueing the emails
+func (match FoundMatch) HandleMatch(cv models.CV, pdfFile *os.File, keyName string, webhookSender *webhooks.Sender, emailService *emailservice.Service, emailTemplate *models.EmailTemplate, sent *models.MatchSendProgress) error {
 	onMatch := match.Profile.OnMatch
 
-	for _, http := range onMatch.HTTPCall {
-		go func(http models.ProfileHTTPCallData) {
-			http.MakeRequest(match.Profile, match.Matches)
-		}(http)
+	var lastErr error
+	for idx, http := range onMatch.HTTPCall {
+		if sent.HTTPCallSent(idx) {
+			continue
+		}
+		err := webhookSender.Send(http, models.WebhookPayload{
+			ProfileID: match.Profile.ID,
+			Match:     match.Matches,
+			CV:        cv,
+			Profile:   match.Profile,
+		})
+		if err != nil {
+			log.WithError(err).WithField("uri", http.URI).Error("unable to queue webhook")
+			lastErr = err
+			continue
+		}
+		sent.HTTPCalls = append(sent.HTTPCalls, idx)
+	}
+
+	pendingMail := []models.ProfileSendEmailData{}
+	for _, email := range onMatch.SendMail {
+		if !sent.EmailSent(email.Email) {
+			pendingMail = append(pendingMail, email)
+		}
+	}
+	if len(pendingMail) == 0 {
+		return lastErr
 	}
 
-	emailsLen := len(onMatch.SendMail)
-	if emailsLen != 0 {
-		emailBody, err := cv.GetEmailHTML(match.Profile, match.Matches.GetMatchSentence(), keyName)
+	emailContent, err := cv.GetMatchEmail(emailTemplate, match.Profile, match.Matches, keyName)
+	if err != nil {
+		log.WithError(err).Error("unable to generate email body from CV")
+		return err
+	}
+
+	for _, email := range pendingMail {
+		message, err := email.NewEmailMessage(emailContent, pdfFile)
+		if err == nil {
+			err = emailService.Send(message, []primitive.ObjectID{match.Profile.ID}, []primitive.ObjectID{match.Matches.ID})
+		}
 		if err != nil {
-			log.WithError(err).Error("unable to generate email body from CV")
-		} else {
-			for _, email := range onMatch.SendMail {
-				err := email.SendEmail(match.Profile, emailBody.Bytes(), pdfFile)
-				if err != nil {
-					log.WithError(err).Error("unable to send email")
-				}
-			}
+			log.WithError(err).Error("unable to send email")
+			lastErr = err
+			continue
 		}
+		sent.Emails = append(sent.Emails, email.Email)
 	}
+	return lastErr
 }
@@ -4,7 +4,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/geo"
 	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/postalcode"
 	"github.com/script-development/RT-CV/mock"
 	"github.com/script-development/RT-CV/models"
 	. "github.com/stretchr/testify/assert"
@@ -50,14 +53,14 @@ func TestMatchZipCode(t *testing.T) {
 		// Valid 1 to 1 match
 		MustMatchSingle(
 			t,
-			models.Profile{Zipcodes: []models.ProfileDutchZipcode{{From: 1000, To: 2000}}},
+			models.Profile{Zipcodes: []models.ProfileZipcode{{From: 1000, To: 2000}}},
 			models.CV{PersonalDetails: models.PersonalDetails{Zip: caseItem}},
 		)
 
 		// Outside of range
 		MustNotMatchSingle(
 			t,
-			models.Profile{Zipcodes: []models.ProfileDutchZipcode{{From: 6000, To: 9000}}},
+			models.Profile{Zipcodes: []models.ProfileZipcode{{From: 6000, To: 9000}}},
 			models.CV{PersonalDetails: models.PersonalDetails{Zip: caseItem}},
 		)
 	}
@@ -65,14 +68,14 @@ func TestMatchZipCode(t *testing.T) {
 	// invalid CV zip code
 	MustNotMatchSingle(
 		t,
-		models.Profile{Zipcodes: []models.ProfileDutchZipcode{{From: 1000, To: 2000}}},
+		models.Profile{Zipcodes: []models.ProfileZipcode{{From: 1000, To: 2000}}},
 		models.CV{PersonalDetails: models.PersonalDetails{Zip: "AAAAAA"}},
 	)
 
 	// Multiple zip codes
 	MustMatchSingle(
 		t,
-		models.Profile{Zipcodes: []models.ProfileDutchZipcode{
+		models.Profile{Zipcodes: []models.ProfileZipcode{
 			{From: 1000, To: 2000},
 			{From: 3000, To: 3500},
 			{From: 4000, To: 5000},
@@ -84,11 +87,55 @@ func TestMatchZipCode(t *testing.T) {
 	// Reverse zip code
 	MustMatchSingle(
 		t,
-		models.Profile{Zipcodes: []models.ProfileDutchZipcode{{From: 6000, To: 2000}}},
+		models.Profile{Zipcodes: []models.ProfileZipcode{{From: 6000, To: 2000}}},
 		models.CV{PersonalDetails: models.PersonalDetails{Zip: "4100AB"}},
 	)
 }
 
+func TestMatchZipCodeCountries(t *testing.T) {
+	profile := models.Profile{Zipcodes: []models.ProfileZipcode{
+		{From: 1000, To: 2000},
+		{Country: postalcode.CountryBE, From: 9000, To: 9999},
+		{Country: postalcode.CountryDE, From: 40000, To: 49999},
+	}}
+
+	matchingCVs := []models.PersonalDetails{
+		{Zip: "1500AB", Country: "Nederland"},
+		{Zip: "9000", Country: "België"},
+		{Zip: "B-9050", Country: "Belgium"},
+		{Zip: "47051", Country: "Deutschland"},
+		// Empty and unknown countries are assumed to be dutch
+		{Zip: "1500AB"},
+		{Zip: "1500 AB", Country: "Holanda"},
+	}
+	for _, personalDetails := range matchingCVs {
+		MustMatchSingle(t, profile, models.CV{PersonalDetails: personalDetails})
+	}
+
+	notMatchingCVs := []models.PersonalDetails{
+		// Within the dutch range but belgian
+		{Zip: "1500", Country: "Belgium"},
+		// Within the belgian range but dutch
+		{Zip: "9500AB", Country: "Netherlands"},
+		// Outside of the german range
+		{Zip: "10115", Country: "Germany"},
+		// German zipcodes have 5 digits
+		{Zip: "4705", Country: "Germany"},
+		// Unknown country so it's parsed as a dutch zipcode and dutch zipcodes have 4 digits
+		{Zip: "75001", Country: "France"},
+	}
+	for _, personalDetails := range notMatchingCVs {
+		MustNotMatchSingle(t, profile, models.CV{PersonalDetails: personalDetails})
+	}
+
+	// Zip radiuses only work for dutch zipcodes
+	MustNotMatchSingle(
+		t,
+		models.Profile{ZipRadiuses: []models.ProfileZipRadius{{Zipcode: 3511, RadiusKm: 50}}},
+		models.CV{PersonalDetails: models.PersonalDetails{Zip: "1012", Country: "Belgium"}},
+	)
+}
+
 func TestMatchEducation(t *testing.T) {
 	// No educations in CV
 	MustNotMatchSingle(
@@ -220,6 +267,47 @@ func TestMatchDesiredProfession(t *testing.T) {
 	)
 }
 
+func TestMatchNormalizedTerms(t *testing.T) {
+	cases := []struct {
+		profileTerm string
+		cvTerm      string
+	}{
+		{"Verpleegkundige", "verpléégkundige"},
+		{"Verpleegkundige", "Ｖｅｒｐｌｅｅｇｋｕｎｄｉｇｅ"},
+		{"Verkoopmedewerker", "Verkoop medewerkster"},
+		{"Storingscoördinator", "storings coordinator"},
+		{"Administratief medewerker", "Administratieve medewerkers"},
+		{"Chauffeur", "Vrachtwagenchauffeur"},
+	}
+	for _, testCase := range cases {
+		MustMatchSingle(
+			t,
+			models.Profile{
+				MustDesiredProfession: true,
+				DesiredProfessions:    []models.ProfileProfession{{Name: testCase.profileTerm}},
+			},
+			models.CV{PreferredJobs: []string{testCase.cvTerm}},
+		)
+	}
+
+	// A broader CV term should not match a more specific profile term
+	MustNotMatchSingle(
+		t,
+		models.Profile{
+			MustDesiredProfession: true,
+			DesiredProfessions:    []models.ProfileProfession{{Name: "Vrachtwagenchauffeur"}},
+		},
+		models.CV{PreferredJobs: []string{"Chauffeur"}},
+	)
+
+	// Exclusions are also normalized
+	MustNotMatchSingle(
+		t,
+		models.Profile{Exclusions: models.ProfileExclusions{PreferredJobs: []string{"Verpleegkundige"}}},
+		models.CV{PreferredJobs: []string{"verpléégkundigen"}},
+	)
+}
+
 func TestMatchDesiredProfessionExperienced(t *testing.T) {
 	// Match on profession experienced
 	MustMatchSingle(
@@ -278,6 +366,219 @@ func TestMatchDriversLicense(t *testing.T) {
 		},
 		models.CV{DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("B")}},
 	)
+
+	// Higher drivers licenses imply lower ones
+	truckDriverProfile := models.Profile{
+		Active:             true,
+		MustDriversLicense: true,
+		DriversLicenses:    []models.ProfileDriversLicense{{Name: "C"}},
+	}
+	MustMatchSingle(
+		t,
+		truckDriverProfile,
+		models.CV{DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("CE")}},
+	)
+	MustNotMatchSingle(
+		t,
+		truckDriverProfile,
+		models.CV{DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("C1")}},
+	)
+
+	// The drivers license that satisfied the requirement should be reported
+	matches := Match(mock.Key2, []*models.Profile{&truckDriverProfile}, models.CV{
+		DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("B"), jsonHelpers.NewDriversLicense("CE")},
+	})
+	Len(t, matches, 1)
+	Equal(t, &models.MatchedDriversLicense{Required: "C", Held: "CE"}, matches[0].Matches.MatchedDriversLicense)
+
+	// An exact match is preferred over an implied one
+	matches = Match(mock.Key2, []*models.Profile{&truckDriverProfile}, models.CV{
+		DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("CE"), jsonHelpers.NewDriversLicense("C")},
+	})
+	Len(t, matches, 1)
+	Equal(t, &models.MatchedDriversLicense{Required: "C", Held: "C"}, matches[0].Matches.MatchedDriversLicense)
+}
+
+func TestMatchExclusions(t *testing.T) {
+	profile := models.Profile{
+		DesiredProfessions: []models.ProfileProfession{{Name: "Bakker"}},
+		Exclusions: models.ProfileExclusions{
+			PreferredJobs:   []string{"stagiair"},
+			WorkExperiences: []string{"vrijwilliger"},
+			Educations:      []string{"Pro gangster"},
+		},
+	}
+
+	MustMatchSingle(t, profile, models.CV{
+		PreferredJobs:   []string{"Bakker"},
+		WorkExperiences: []models.WorkExperience{{Profession: "Bakker"}},
+		Educations:      []models.Education{{Name: "Informatica"}},
+	})
+
+	excludedCVs := []models.CV{
+		{PreferredJobs: []string{"Bakker", "stagiair"}},
+		{
+			PreferredJobs:   []string{"Bakker"},
+			WorkExperiences: []models.WorkExperience{{Profession: "Vrijwilliger"}},
+		},
+		{
+			PreferredJobs: []string{"Bakker"},
+			Educations:    []models.Education{{Name: "Pro gangster"}},
+		},
+	}
+	for _, cv := range excludedCVs {
+		MustNotMatchSingle(t, profile, cv)
+	}
+
+	// Exclude CVs of which the last work is to long ago
+	yearsSinceWork := 2
+	profile = models.Profile{
+		DesiredProfessions: []models.ProfileProfession{{Name: "Bakker"}},
+		Exclusions:         models.ProfileExclusions{YearsSinceWork: &yearsSinceWork},
+	}
+	MustNotMatchSingle(t, profile, models.CV{
+		PreferredJobs: []string{"Bakker"},
+		WorkExperiences: []models.WorkExperience{
+			{EndDate: jsonHelpers.RFC3339Nano(time.Now().AddDate(-5, 0, 0)).ToPtr()},
+		},
+	})
+	MustMatchSingle(t, profile, models.CV{
+		PreferredJobs: []string{"Bakker"},
+		WorkExperiences: []models.WorkExperience{
+			{EndDate: jsonHelpers.RFC3339Nano(time.Now().AddDate(-5, 0, 0)).ToPtr()},
+			{StillEmployed: true},
+		},
+	})
+	MustMatchSingle(t, profile, models.CV{PreferredJobs: []string{"Bakker"}})
+
+	// All hit exclusions should be explained
+	profile = models.Profile{
+		Active: true,
+		Exclusions: models.ProfileExclusions{
+			PreferredJobs:   []string{"stagiair"},
+			WorkExperiences: []string{"vrijwilliger"},
+		},
+	}
+	explanations := Explain(mock.Key2, []*models.Profile{&profile}, models.CV{
+		PreferredJobs:   []string{"stagiair"},
+		WorkExperiences: []models.WorkExperience{{Profession: "vrijwilliger"}},
+	})
+	Len(t, explanations, 1)
+	False(t, explanations[0].Matched)
+	failedExclusions := 0
+	for _, step := range explanations[0].Steps {
+		if step.Criterion == CriterionExclusions {
+			False(t, step.Passed)
+			True(t, step.Required)
+			failedExclusions++
+		}
+	}
+	Equal(t, 2, failedExclusions)
+}
+
+func TestMatchCriteriaExpression(t *testing.T) {
+	// (desiredProfessions AND driversLicenses) OR (professionExperienced AND educations)
+	profile := models.Profile{
+		DesiredProfessions:    []models.ProfileProfession{{Name: "Bakker"}},
+		DriversLicenses:       []models.ProfileDriversLicense{{Name: "B"}},
+		ProfessionExperienced: []models.ProfileProfession{{Name: "Vrachtwagen chauffeur"}},
+		Educations:            []models.ProfileEducation{{Name: "Logistiek"}},
+		Criteria: &models.ProfileCriteriaExpression{Or: []models.ProfileCriteriaExpression{
+			{And: []models.ProfileCriteriaExpression{
+				{Criterion: models.ProfileCriterionDesiredProfessions},
+				{Criterion: models.ProfileCriterionDriversLicenses},
+			}},
+			{And: []models.ProfileCriteriaExpression{
+				{Criterion: models.ProfileCriterionProfessionExperienced},
+				{Criterion: models.ProfileCriterionEducations},
+			}},
+		}},
+	}
+
+	MustMatchSingle(t, profile, models.CV{
+		PreferredJobs:   []string{"Bakker"},
+		DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("B")},
+	})
+	MustMatchSingle(t, profile, models.CV{
+		WorkExperiences: []models.WorkExperience{{Profession: "Vrachtwagen chauffeur"}},
+		Educations:      []models.Education{{Name: "Logistiek"}},
+	})
+
+	// Only one side of both AND expressions
+	MustNotMatchSingle(t, profile, models.CV{
+		PreferredJobs: []string{"Bakker"},
+		Educations:    []models.Education{{Name: "Logistiek"}},
+	})
+
+	// The must flags are ignored when a criteria expression is set
+	profile.MustLanguage = true
+	profile.Languages = []models.ProfileLanguage{{Name: "Engels"}}
+	MustMatchSingle(t, profile, models.CV{
+		PreferredJobs:   []string{"Bakker"},
+		DriversLicenses: []jsonHelpers.DriversLicense{jsonHelpers.NewDriversLicense("B")},
+	})
+
+	// Not
+	MustNotMatchSingle(
+		t,
+		models.Profile{
+			DesiredProfessions: []models.ProfileProfession{{Name: "Bakker"}},
+			Criteria: &models.ProfileCriteriaExpression{
+				Not: &models.ProfileCriteriaExpression{Criterion: models.ProfileCriterionDesiredProfessions},
+			},
+		},
+		models.CV{PreferredJobs: []string{"Bakker"}},
+	)
+}
+
+func TestMatchSynonyms(t *testing.T) {
+	profile := models.Profile{
+		Active:                true,
+		MustDesiredProfession: true,
+		DesiredProfessions:    []models.ProfileProfession{{Name: "Chauffeur"}},
+	}
+	cv := models.CV{PreferredJobs: []string{"Truck driver"}}
+
+	// Without synonyms a truck driver is not a chauffeur
+	matches := Match(mock.Key2, []*models.Profile{&profile}, cv)
+	Len(t, matches, 0)
+
+	chauffeur := models.SynonymSet{M: db.NewM(), Kind: models.SynonymKindProfession, Terms: []string{"chauffeur"}}
+	truckDriver := models.SynonymSet{
+		M:        db.NewM(),
+		Kind:     models.SynonymKindProfession,
+		Terms:    []string{"truck driver"},
+		ParentID: &chauffeur.ID,
+	}
+	models.NewSynonymIndex([]models.SynonymSet{chauffeur, truckDriver}).ExpandProfile(&profile)
+
+	// The original profile term should be reported
+	matches = Match(mock.Key2, []*models.Profile{&profile}, cv)
+	Len(t, matches, 1)
+	Equal(t, "Chauffeur", *matches[0].Matches.DesiredProfession)
+}
+
+func TestMatchDoesNotModifyProfile(t *testing.T) {
+	profile := models.Profile{
+		Active:                true,
+		MustDesiredProfession: true,
+		DesiredProfessions:    []models.ProfileProfession{{Name: "Chauffeur"}},
+	}
+	cv := models.CV{PreferredJobs: []string{"Chauffeur"}}
+
+	// Unprepared profiles are matched using a prepared copy
+	Len(t, Match(mock.Key2, []*models.Profile{&profile}, cv), 1)
+	False(t, profile.PreparedForMatching())
+	Nil(t, profile.DesiredProfessionsFuzzyMatcher)
+
+	profile.PrepareForMatching()
+	True(t, profile.PreparedForMatching())
+	NotNil(t, profile.DesiredProfessionsFuzzyMatcher)
+	Len(t, Match(mock.Key2, []*models.Profile{&profile}, cv), 1)
+
+	// Expanding the profile requires it to be prepared again
+	models.NewSynonymIndex(nil).ExpandProfile(&profile)
+	False(t, profile.PreparedForMatching())
 }
 
 func TestGetMatchSentence(t *testing.T) {
@@ -291,7 +592,7 @@ func TestGetMatchSentence(t *testing.T) {
 	sentence = (&models.Match{YearsSinceWork: &yearsSinceWork, YearsSinceEducation: &yearsSinceWork}).GetMatchSentence()
 	Equal(t, "3 jaren sinds laatste werk ervaaring en 3 jaren sinds laatste opleiding", sentence)
 
-	zipCode := models.ProfileDutchZipcode{
+	zipCode := models.ProfileZipcode{
 		From: 2000,
 		To:   5000,
 	}
@@ -315,4 +616,517 @@ func TestGetMatchSentence(t *testing.T) {
 		", gewenste rijbewijs" +
 		" en postcode in range 2000 - 5000"
 	Equal(t, expectedResult, sentence)
+
+	sentence = (&models.Match{Language: &models.ProfileLanguage{Name: "Engels"}}).GetMatchSentence()
+	Equal(t, "spreekt Engels", sentence)
+
+	sentence = (&models.Match{Language: &models.ProfileLanguage{
+		Name:         "Engels",
+		LevelSpoken:  models.LanguageLevelGood,
+		LevelWritten: models.LanguageLevelReasonable,
+	}}).GetMatchSentence()
+	Equal(t, "spreekt Engels (minimaal spreken goed, schrijven redelijk)", sentence)
+
+	sentence = (&models.Match{
+		DriversLicense:        true,
+		MatchedDriversLicense: &models.MatchedDriversLicense{Required: "C", Held: "CE"},
+	}).GetMatchSentence()
+	Equal(t, "rijbewijs CE (voldoet aan C)", sentence)
+
+	sentence = (&models.Match{
+		DriversLicense:        true,
+		MatchedDriversLicense: &models.MatchedDriversLicense{Required: "B", Held: "B"},
+	}).GetMatchSentence()
+	Equal(t, "rijbewijs B", sentence)
+
+	distanceKm := 12.4
+	sentence = (&models.Match{DistanceKm: &distanceKm}).GetMatchSentence()
+	Equal(t, "woont op 12 km afstand", sentence)
+
+	sentence = (&models.Match{ZipCode: &models.ProfileZipcode{Country: postalcode.CountryDE, From: 1000, To: 9999}}).GetMatchSentence()
+	Equal(t, "postcode in range DE 01000 - 09999", sentence)
+}
+
+func TestMatchScore(t *testing.T) {
+	profile := models.Profile{
+		Active:             true,
+		DesiredProfessions: []models.ProfileProfession{{Name: "Bananenplukker"}},
+		Educations:         []models.ProfileEducation{{Name: "Bananenplukker"}},
+		ScoreWeights: &models.ProfileScoreWeights{
+			DesiredProfession: 2,
+			Education:         0.5,
+		},
+	}
+
+	matches := Match(mock.Key2, []*models.Profile{&profile}, models.CV{
+		PreferredJobs: []string{"Bananenplukker"},
+	})
+	Len(t, matches, 1)
+	Equal(t, 2.0, matches[0].Matches.Score)
+
+	matches = Match(mock.Key2, []*models.Profile{&profile}, models.CV{
+		PreferredJobs: []string{"Bananenplukker"},
+		Educations:    []models.Education{{Name: "Bananenplukker"}},
+	})
+	Len(t, matches, 1)
+	Equal(t, 2.5, matches[0].Matches.Score)
+
+	// The score is below the minimum score
+	profile.MinimumScore = 2.1
+	MustNotMatchSingle(t, profile, models.CV{PreferredJobs: []string{"Bananenplukker"}})
+	MustMatchSingle(t, profile, models.CV{
+		PreferredJobs: []string{"Bananenplukker"},
+		Educations:    []models.Education{{Name: "Bananenplukker"}},
+	})
+}
+
+func TestMatchScoreZipDistanceAndRecency(t *testing.T) {
+	profile := models.Profile{
+		Active:       true,
+		Zipcodes:     []models.ProfileZipcode{{From: 1000, To: 2000}},
+		ScoreWeights: &models.ProfileScoreWeights{ZipDistance: 1, Recency: 1},
+	}
+
+	// Center of the range and still employed
+	matches := Match(mock.Key2, []*models.Profile{&profile}, models.CV{
+		PersonalDetails: models.PersonalDetails{Zip: "1500AB"},
+		WorkExperiences: []models.WorkExperience{{StillEmployed: true}},
+	})
+	Len(t, matches, 1)
+	Equal(t, 2.0, matches[0].Matches.Score)
+
+	// Edge of the range and stopped working 3 years ago
+	matches = Match(mock.Key2, []*models.Profile{&profile}, models.CV{
+		PersonalDetails: models.PersonalDetails{Zip: "2000AB"},
+		WorkExperiences: []models.WorkExperience{{EndDate: jsonHelpers.RFC3339Nano(time.Now().AddDate(-3, 0, 0)).ToPtr()}},
+	})
+	Len(t, matches, 1)
+	Equal(t, 0.75, matches[0].Matches.Score)
+}
+
+func TestMatchSortedByScore(t *testing.T) {
+	lowProfile := &models.Profile{
+		Name:               "low",
+		Active:             true,
+		DesiredProfessions: []models.ProfileProfession{{Name: "Bananenplukker"}},
+	}
+	highProfile := &models.Profile{
+		Name:               "high",
+		Active:             true,
+		DesiredProfessions: []models.ProfileProfession{{Name: "Bananenplukker"}},
+		Educations:         []models.ProfileEducation{{Name: "Bananenplukker"}},
+	}
+
+	matches := Match(mock.Key2, []*models.Profile{lowProfile, highProfile}, models.CV{
+		PreferredJobs: []string{"Bananenplukker"},
+		Educations:    []models.Education{{Name: "Bananenplukker"}},
+	})
+	Len(t, matches, 2)
+	Equal(t, "high", matches[0].Profile.Name)
+	Equal(t, "low", matches[1].Profile.Name)
+	Greater(t, matches[0].Matches.Score, matches[1].Matches.Score)
+}
+
+func TestExplain(t *testing.T) {
+	profile := &models.Profile{
+		Active:             true,
+		MustEducation:      true,
+		Educations:         []models.ProfileEducation{{Name: "Verpleegkunde"}},
+		DesiredProfessions: []models.ProfileProfession{{Name: "Bananenplukker"}},
+		Zipcodes:           []models.ProfileZipcode{{From: 1000, To: 2000}},
+	}
+
+	explanations := Explain(mock.Key2, []*models.Profile{profile}, models.CV{
+		PreferredJobs:   []string{"Bananenplukker"},
+		Educations:      []models.Education{{Name: "Pro gangster"}},
+		PersonalDetails: models.PersonalDetails{Zip: "9779AB"},
+	})
+	Len(t, explanations, 1)
+	explanation := explanations[0]
+	False(t, explanation.Matched)
+
+	// Explain doesn't stop at the first failed criterion
+	failedCriteria := []Criterion{}
+	passedCriteria := []Criterion{}
+	for _, step := range explanation.Steps {
+		if step.Passed {
+			passedCriteria = append(passedCriteria, step.Criterion)
+		} else {
+			failedCriteria = append(failedCriteria, step.Criterion)
+		}
+	}
+	Equal(t, []Criterion{CriterionEducations, CriterionZipCodes}, failedCriteria)
+	Equal(t, []Criterion{CriterionActive, CriterionDesiredProfessions, CriterionAtLeastOne}, passedCriteria)
+
+	for _, step := range explanation.Steps {
+		switch step.Criterion {
+		case CriterionEducations:
+			Equal(t, "no education fuzzy-matched 'Verpleegkunde', cv educations: 'Pro gangster'", step.Reason)
+			True(t, step.Required)
+		case CriterionZipCodes:
+			Equal(t, "zipcode 9779 outside 1000-2000", step.Reason)
+		}
+	}
+
+	// A matching profile should result in a matched explanation
+	explanations = Explain(mock.Key2, []*models.Profile{profile}, models.CV{
+		Educations:      []models.Education{{Name: "Verpleegkunde"}},
+		PersonalDetails: models.PersonalDetails{Zip: "1500AB"},
+	})
+	True(t, explanations[0].Matched)
+	for _, step := range explanations[0].Steps {
+		if step.Criterion == CriterionDesiredProfessions {
+			// Not matching a desired profession is fine as the profile doesn't require it
+			False(t, step.Passed)
+			False(t, step.Required)
+		} else {
+			True(t, step.Passed, step.Reason)
+		}
+	}
+}
+
+func TestMatchLanguages(t *testing.T) {
+	profile := models.Profile{
+		MustLanguage: true,
+		Languages: []models.ProfileLanguage{{
+			Name:         "Engels",
+			LevelSpoken:  models.LanguageLevelGood,
+			LevelWritten: models.LanguageLevelReasonable,
+		}},
+	}
+
+	// Levels are equal to the minimal levels
+	MustMatchSingle(t, profile, models.CV{Languages: []models.Language{{
+		Name:         "Engels",
+		LevelSpoken:  models.LanguageLevelGood,
+		LevelWritten: models.LanguageLevelReasonable,
+	}}})
+
+	// Levels are higher than the minimal levels
+	MustMatchSingle(t, profile, models.CV{Languages: []models.Language{{
+		Name:         "Engels",
+		LevelSpoken:  models.LanguageLevelExcellent,
+		LevelWritten: models.LanguageLevelExcellent,
+	}}})
+
+	// Spoken level too low
+	MustNotMatchSingle(t, profile, models.CV{Languages: []models.Language{{
+		Name:         "Engels",
+		LevelSpoken:  models.LanguageLevelReasonable,
+		LevelWritten: models.LanguageLevelExcellent,
+	}}})
+
+	// Other language
+	MustNotMatchSingle(t, profile, models.CV{Languages: []models.Language{{
+		Name:         "Duits",
+		LevelSpoken:  models.LanguageLevelExcellent,
+		LevelWritten: models.LanguageLevelExcellent,
+	}}})
+
+	// The matched language requirement should be reported
+	profile.Active = true
+	matches := Match(mock.Key2, []*models.Profile{&profile}, models.CV{Languages: []models.Language{
+		{Name: "Duits", LevelSpoken: models.LanguageLevelExcellent},
+		{Name: "Engels", LevelSpoken: models.LanguageLevelGood, LevelWritten: models.LanguageLevelGood},
+	}})
+	Len(t, matches, 1)
+	Equal(t, &profile.Languages[0], matches[0].Matches.Language)
+}
+
+func TestMatchSkills(t *testing.T) {
+	profile := models.Profile{
+		MustSkill: true,
+		Skills:    []models.ProfileSkill{{Name: "Heftruck rijden"}, {Name: "Java"}},
+	}
+
+	// Competence names are fuzzy matched
+	MustMatchSingle(t, profile, models.CV{Competences: []models.Competence{{Name: "Heftruck rijden"}}})
+
+	// Free text is searched for the skills as keywords
+	MustMatchSingle(t, profile, models.CV{
+		PersonalPresentation: "Ik heb 5 jaar ervaring met java en python",
+	})
+	MustMatchSingle(t, profile, models.CV{
+		Competences: []models.Competence{{Name: "Logistiek", Description: "Ervaren in heftrucks rijden en orderpicken"}},
+	})
+	MustMatchSingle(t, profile, models.CV{
+		Interests: []models.Interest{{Name: "Programmeren", Description: "Vooral in Java"}},
+	})
+
+	// A keyword must be a whole word
+	MustNotMatchSingle(t, profile, models.CV{
+		PersonalPresentation: "Ik programmeer graag in javascript",
+	})
+
+	MustNotMatchSingle(t, profile, models.CV{})
+
+	// The matched skill should be reported
+	profile.Active = true
+	cv := models.CV{PersonalPresentation: "Kan goed heftruck rijden"}
+	matches := Match(mock.Key2, []*models.Profile{&profile}, cv)
+	Len(t, matches, 1)
+	Equal(t, "Heftruck rijden", *matches[0].Matches.Skill)
+
+	explanation := Explain(mock.Key2, []*models.Profile{&profile}, cv)[0]
+	True(t, explanation.Matched)
+	Contains(t, explanation.Steps, ExplanationStep{
+		Criterion: CriterionSkills,
+		Passed:    true,
+		Reason:    "found 'Heftruck rijden' in the personal presentation",
+	})
+}
+
+func TestExperienceYears(t *testing.T) {
+	date := func(year int, month time.Month) time.Time {
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	Equal(t, 0.0, experienceYears(nil))
+
+	// Overlapping and contained periods are counted once
+	InDelta(t, 5.0, experienceYears([]workPeriod{
+		{from: date(2012, 1), to: date(2015, 1)},
+		{from: date(2010, 1), to: date(2013, 1)},
+		{from: date(2011, 1), to: date(2012, 1)},
+	}), 0.01)
+
+	// Gaps between periods are not counted
+	InDelta(t, 3.0, experienceYears([]workPeriod{
+		{from: date(2010, 1), to: date(2011, 1)},
+		{from: date(2015, 1), to: date(2017, 1)},
+	}), 0.01)
+}
+
+func TestMatchYearsExperience(t *testing.T) {
+	now := time.Now()
+	yearsAgo := func(years int) *jsonHelpers.RFC3339Nano {
+		return jsonHelpers.RFC3339Nano(now.AddDate(-years, 0, 0)).ToPtr()
+	}
+
+	profile := models.Profile{
+		MustExpProfession:     true,
+		ProfessionExperienced: []models.ProfileProfession{{Name: "Chauffeur"}},
+		MinYearsExperience:    4,
+	}
+
+	// Overlapping work experiences are counted once
+	MustNotMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", StartDate: yearsAgo(6), EndDate: yearsAgo(3)},
+		{Profession: "Chauffeur", StartDate: yearsAgo(5), EndDate: yearsAgo(4)},
+	}})
+	MustMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", StartDate: yearsAgo(6), EndDate: yearsAgo(3)},
+		{Profession: "Chauffeur", StartDate: yearsAgo(4), EndDate: yearsAgo(2)},
+	}})
+
+	// Still employed counts until now
+	MustMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", StartDate: yearsAgo(5), StillEmployed: true},
+	}})
+
+	// Other professions don't count
+	MustNotMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", StartDate: yearsAgo(3), EndDate: yearsAgo(1)},
+		{Profession: "Kapper", StartDate: yearsAgo(10), EndDate: yearsAgo(3)},
+	}})
+
+	// Without dates we don't know the experience
+	MustNotMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{{Profession: "Chauffeur"}}})
+
+	// The years of experience should be reported
+	profile.Active = true
+	matches := Match(mock.Key2, []*models.Profile{&profile}, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", StartDate: yearsAgo(5), StillEmployed: true},
+	}})
+	Len(t, matches, 1)
+	InDelta(t, 5.0, *matches[0].Matches.YearsExperience, 0.01)
+}
+
+func TestMatchWeeklyHours(t *testing.T) {
+	profile := models.Profile{
+		MustExpProfession:     true,
+		ProfessionExperienced: []models.ProfileProfession{{Name: "Chauffeur"}},
+		MinWeeklyHours:        24,
+		MaxWeeklyHours:        32,
+	}
+
+	MustMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", WeeklyHoursWorked: 40},
+		{Profession: "Chauffeur", WeeklyHoursWorked: 24},
+	}})
+	MustNotMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", WeeklyHoursWorked: 40},
+	}})
+	MustNotMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", WeeklyHoursWorked: 16},
+	}})
+
+	// Unknown weekly hours
+	MustNotMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{{Profession: "Chauffeur"}}})
+
+	// Only a maximum
+	profile.MinWeeklyHours = 0
+	MustMatchSingle(t, profile, models.CV{WorkExperiences: []models.WorkExperience{
+		{Profession: "Chauffeur", WeeklyHoursWorked: 16},
+	}})
+}
+
+func TestAgeAt(t *testing.T) {
+	dateOfBirth := time.Date(2000, time.June, 15, 0, 0, 0, 0, time.UTC)
+	Equal(t, 21, ageAt(dateOfBirth, time.Date(2022, time.June, 14, 0, 0, 0, 0, time.UTC)))
+	Equal(t, 22, ageAt(dateOfBirth, time.Date(2022, time.June, 15, 0, 0, 0, 0, time.UTC)))
+	Equal(t, 22, ageAt(dateOfBirth, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestMatchAge(t *testing.T) {
+	bornYearsAgo := func(years int) models.PersonalDetails {
+		return models.PersonalDetails{
+			DateOfBirth: jsonHelpers.RFC3339Nano(time.Now().AddDate(-years, 0, -1)).ToPtr(),
+		}
+	}
+
+	profile := models.Profile{MinAge: 18, MaxAge: 30}
+
+	MustMatchSingle(t, profile, models.CV{PersonalDetails: bornYearsAgo(18)})
+	MustMatchSingle(t, profile, models.CV{PersonalDetails: bornYearsAgo(30)})
+	MustNotMatchSingle(t, profile, models.CV{PersonalDetails: bornYearsAgo(17)})
+	MustNotMatchSingle(t, profile, models.CV{PersonalDetails: bornYearsAgo(31)})
+	MustNotMatchSingle(t, profile, models.CV{})
+
+	// Only a minimum age
+	profile.MaxAge = 0
+	MustMatchSingle(t, profile, models.CV{PersonalDetails: bornYearsAgo(70)})
+
+	// The age should be reported
+	profile.Active = true
+	matches := Match(mock.Key2, []*models.Profile{&profile}, models.CV{PersonalDetails: bornYearsAgo(25)})
+	Len(t, matches, 1)
+	Equal(t, 25, *matches[0].Matches.Age)
+}
+
+func TestMatchAgeDisabled(t *testing.T) {
+	SetConfig(Config{DisableAgeMatching: true})
+	defer SetConfig(Config{})
+
+	profile := models.Profile{MinAge: 18, MaxAge: 30}
+	MustMatchSingle(t, profile, models.CV{})
+
+	profile.Active = true
+	matches := Match(mock.Key2, []*models.Profile{&profile}, models.CV{PersonalDetails: models.PersonalDetails{
+		DateOfBirth: jsonHelpers.RFC3339Nano(time.Now().AddDate(-50, 0, 0)).ToPtr(),
+	}})
+	Len(t, matches, 1)
+	Nil(t, matches[0].Matches.Age)
+}
+
+func TestMatchAvailableWithinDays(t *testing.T) {
+	availableInDays := func(days int) *jsonHelpers.RFC3339Nano {
+		return jsonHelpers.RFC3339Nano(time.Now().AddDate(0, 0, days)).ToPtr()
+	}
+
+	days := 30
+	profile := models.Profile{AvailableWithinDays: &days}
+
+	MustMatchSingle(t, profile, models.CV{AvailableFrom: availableInDays(-10)})
+	MustMatchSingle(t, profile, models.CV{AvailableFrom: availableInDays(29)})
+	MustNotMatchSingle(t, profile, models.CV{AvailableFrom: availableInDays(31)})
+
+	// CVs without an available from date are available now
+	MustMatchSingle(t, profile, models.CV{})
+}
+
+func TestMatchActivePeriod(t *testing.T) {
+	hoursFromNow := func(hours int) *jsonHelpers.RFC3339Nano {
+		return jsonHelpers.RFC3339Nano(time.Now().Add(time.Hour * time.Duration(hours))).ToPtr()
+	}
+
+	MustMatchSingle(t, models.Profile{ActiveFrom: hoursFromNow(-1), ActiveUntil: hoursFromNow(1)}, models.CV{})
+	MustMatchSingle(t, models.Profile{ActiveUntil: hoursFromNow(1)}, models.CV{})
+	MustNotMatchSingle(t, models.Profile{ActiveFrom: hoursFromNow(1)}, models.CV{})
+	MustNotMatchSingle(t, models.Profile{ActiveUntil: hoursFromNow(-1)}, models.CV{})
+}
+
+func TestMatchSchedule(t *testing.T) {
+	today := time.Now().Weekday()
+	tomorrow := (today + 1) % 7
+
+	MustMatchSingle(t, models.Profile{Schedule: []models.ProfileSchedule{
+		{Weekday: tomorrow, FromHour: 0, ToHour: 24},
+		{Weekday: today, FromHour: 0, ToHour: 24},
+	}}, models.CV{})
+	MustNotMatchSingle(t, models.Profile{Schedule: []models.ProfileSchedule{
+		{Weekday: tomorrow, FromHour: 0, ToHour: 24},
+	}}, models.CV{})
+}
+
+func TestMatchZipRadius(t *testing.T) {
+	// Utrecht centre with a radius of 50km
+	utrechtRadius := models.Profile{ZipRadiuses: []models.ProfileZipRadius{{Zipcode: 3511, RadiusKm: 50}}}
+
+	// Amsterdam is around 35km from Utrecht
+	MustMatchSingle(t, utrechtRadius, models.CV{PersonalDetails: models.PersonalDetails{Zip: "1012AB"}})
+
+	// Groningen is way to far away
+	MustNotMatchSingle(t, utrechtRadius, models.CV{PersonalDetails: models.PersonalDetails{Zip: "9711AB"}})
+
+	// Zipcode without known coordinates, its coordinates are never estimated from a nearby zipcode
+	MustNotMatchSingle(t, utrechtRadius, models.CV{PersonalDetails: models.PersonalDetails{Zip: "1000AB"}})
+	MustNotMatchSingle(t, utrechtRadius, models.CV{PersonalDetails: models.PersonalDetails{Zip: "3584CS"}})
+
+	// Centre defined by coordinates
+	MustMatchSingle(
+		t,
+		models.Profile{ZipRadiuses: []models.ProfileZipRadius{{
+			Center:   &geo.Coordinates{Lat: 53.2, Lng: 6.56},
+			RadiusKm: 10,
+		}}},
+		models.CV{PersonalDetails: models.PersonalDetails{Zip: "9711AB"}},
+	)
+
+	// The distance should be stored on the match
+	utrechtRadius.Active = true
+	matches := Match(mock.Key2, []*models.Profile{&utrechtRadius}, models.CV{
+		PersonalDetails: models.PersonalDetails{Zip: "1012AB"},
+	})
+	Len(t, matches, 1)
+	NotNil(t, matches[0].Matches.DistanceKm)
+	InDelta(t, 35, *matches[0].Matches.DistanceKm, 1)
+
+	// A zip range or a zip radius can match
+	MustMatchSingle(
+		t,
+		models.Profile{
+			Zipcodes:    []models.ProfileZipcode{{From: 9000, To: 9999}},
+			ZipRadiuses: []models.ProfileZipRadius{{Zipcode: 3511, RadiusKm: 50}},
+		},
+		models.CV{PersonalDetails: models.PersonalDetails{Zip: "1012AB"}},
+	)
+}
+
+func TestMatchQuota(t *testing.T) {
+	withQuota := models.Profile{M: db.NewM(), Active: true, MaxMatchesPerDay: 1}
+	withoutQuota := models.Profile{M: db.NewM(), Active: true}
+	profiles := []*models.Profile{&withQuota, &withoutQuota}
+	cv := models.CV{}
+
+	checked := 0
+	quotaReached := func(profile *models.Profile) (bool, error) {
+		checked++
+		return profile.ID == withQuota.ID, nil
+	}
+
+	matches, err := RemoveMatchesOverQuota(Match(mock.Key2, profiles, cv), quotaReached)
+	NoError(t, err)
+	Len(t, matches, 1)
+	Equal(t, withoutQuota.ID, matches[0].Profile.ID)
+	Equal(t, 1, checked, "only profiles with a quota should be checked")
+
+	explanations := Explain(mock.Key2, profiles, cv)
+	True(t, explanations[0].Matched)
+	NoError(t, ExplainMatchQuota(explanations, profiles, quotaReached))
+	False(t, explanations[0].Matched)
+	True(t, explanations[1].Matched)
+	lastStep := explanations[0].Steps[len(explanations[0].Steps)-1]
+	Equal(t, CriterionMatchQuota, lastStep.Criterion)
+	Equal(t, "reached the maximum of 1 matches per day", lastStep.Reason)
 }
@@ -0,0 +1,68 @@
+package match
+
+import (
+	"fmt"
+
+	"github.com/script-development/RT-CV/models"
+)
+
+// QuotaReachedFunc returns true if the profile reached its match quota
+// The matcher itself does not use the database so the caller provides the check, usually using (*models.Profile).MatchQuotaReached
+type QuotaReachedFunc func(profile *models.Profile) (bool, error)
+
+// RemoveMatchesOverQuota removes the matches of the profiles that reached their match quota
+// Only the profiles with a match quota are checked
+func RemoveMatchesOverQuota(matches []FoundMatch, quotaReached QuotaReachedFunc) ([]FoundMatch, error) {
+	res := make([]FoundMatch, 0, len(matches))
+	for _, match := range matches {
+		if match.Profile.HasMatchQuota() {
+			reached, err := quotaReached(&match.Profile)
+			if err != nil {
+				return nil, err
+			}
+			if reached {
+				continue
+			}
+		}
+		res = append(res, match)
+	}
+	return res, nil
+}
+
+// ExplainMatchQuota adds the match quota criterion to the explanations of the profiles with a match quota
+// The explanations must be in the same order as the profiles, like the result of Explain
+func ExplainMatchQuota(explanations []Explanation, profiles []*models.Profile, quotaReached QuotaReachedFunc) error {
+	for idx, profile := range profiles {
+		if !profile.HasMatchQuota() {
+			continue
+		}
+
+		reached, err := quotaReached(profile)
+		if err != nil {
+			return err
+		}
+
+		step := ExplanationStep{Criterion: CriterionMatchQuota, Passed: !reached}
+		if reached {
+			step.Required = true
+			step.Reason = "reached the maximum of " + quotaDescription(profile)
+			explanations[idx].Matched = false
+		} else {
+			step.Reason = "within the maximum of " + quotaDescription(profile)
+		}
+		explanations[idx].Steps = append(explanations[idx].Steps, step)
+	}
+	return nil
+}
+
+// quotaDescription formats the match quota of a profile for usage in an explanation reason
+func quotaDescription(profile *models.Profile) string {
+	switch {
+	case profile.MaxMatchesPerDay > 0 && profile.MaxMatchesPerWeek > 0:
+		return fmt.Sprintf("%d matches per day and %d matches per week", profile.MaxMatchesPerDay, profile.MaxMatchesPerWeek)
+	case profile.MaxMatchesPerDay > 0:
+		return fmt.Sprintf("%d matches per day", profile.MaxMatchesPerDay)
+	default:
+		return fmt.Sprintf("%d matches per week", profile.MaxMatchesPerWeek)
+	}
+}
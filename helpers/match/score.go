@@ -0,0 +1,77 @@
+package match
+
+import (
+	"sort"
+	"time"
+
+	"github.com/script-development/RT-CV/models"
+)
+
+// zipcodeFactor returns a value between 0.5 and 1 that tells how close the cvZipcode is to the center of the zipcode range
+// A zipcode in the center of the range results in 1 and a zipcode on the edge of the range results in 0.5
+func zipcodeFactor(zipcode models.ProfileZipcode, cvZipcode uint32) float64 {
+	from, to := float64(zipcode.From), float64(zipcode.To)
+	if from > to {
+		from, to = to, from
+	}
+
+	halfRange := (to - from) / 2
+	if halfRange == 0 {
+		return 1
+	}
+
+	distance := float64(cvZipcode) - (from + halfRange)
+	if distance < 0 {
+		distance = -distance
+	}
+	if distance > halfRange {
+		distance = halfRange
+	}
+
+	return 1 - distance/halfRange/2
+}
+
+// radiusFactor returns a value between 0.5 and 1 that tells how close a zipcode is to the centre of a zip radius
+// A zipcode on the centre results in 1 and a zipcode on the edge of the radius results in 0.5
+func radiusFactor(distanceKm, radiusKm float64) float64 {
+	if radiusKm <= 0 {
+		return 1
+	}
+	if distanceKm > radiusKm {
+		distanceKm = radiusKm
+	}
+	return 1 - distanceKm/radiusKm/2
+}
+
+// recencyFactor returns a value between 0 and 1 that tells how recent the last work experience of the cv is
+// Someone that is still employed or stopped working this year results in 1, every year since the last work lowers the value
+// If the cv has no work experience with an end date 0 is returned
+func recencyFactor(cv models.CV, now time.Time) float64 {
+	lastWork := time.Time{}
+	for _, workExp := range cv.WorkExperiences {
+		if workExp.StillEmployed {
+			return 1
+		}
+		if workExp.EndDate != nil && workExp.EndDate.Time().After(lastWork) {
+			lastWork = workExp.EndDate.Time()
+		}
+	}
+
+	if lastWork.IsZero() {
+		return 0
+	}
+
+	yearsSinceWork := now.Year() - lastWork.Year()
+	if yearsSinceWork <= 0 {
+		return 1
+	}
+	return 1 / float64(1+yearsSinceWork)
+}
+
+// sortByScore sorts the found matches from the highest to the lowest score
+// Matches with an equal score keep their original order
+func sortByScore(matches []FoundMatch) {
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].Matches.Score > matches[b].Matches.Score
+	})
+}
@@ -0,0 +1,80 @@
+package match
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/script-development/RT-CV/helpers/wordvalidator"
+	"github.com/script-development/RT-CV/models"
+)
+
+// freeTextSource is a part of a CV that is searched for skill keywords
+type freeTextSource struct {
+	name string
+	// texts are normalized using wordvalidator.NormalizeForMatching and surrounded by spaces
+	// so a keyword can be searched for as a sequence of whole words
+	texts []string
+}
+
+// cvFreeText contains the normalized free text of a CV
+// The text is only normalized when a profile needs it and is shared by all profiles matched against the CV,
+// it's safe to use from multiple goroutines
+type cvFreeText struct {
+	cv      *models.CV
+	once    sync.Once
+	sources []freeTextSource
+}
+
+func newCVFreeText(cv *models.CV) *cvFreeText {
+	return &cvFreeText{cv: cv}
+}
+
+func (t *cvFreeText) normalize() {
+	competenceDescriptions := []string{}
+	for _, competence := range t.cv.Competences {
+		competenceDescriptions = append(competenceDescriptions, competence.Description)
+	}
+	interests := []string{}
+	for _, interest := range t.cv.Interests {
+		interests = append(interests, interest.Name, interest.Description)
+	}
+
+	sources := []freeTextSource{
+		{name: "competence descriptions", texts: competenceDescriptions},
+		{name: "interests", texts: interests},
+		{name: "personal presentation", texts: []string{t.cv.PersonalPresentation}},
+	}
+	for _, source := range sources {
+		texts := []string{}
+		for _, text := range source.texts {
+			normalized := wordvalidator.NormalizeForMatching(text)
+			if len(normalized) == 0 {
+				continue
+			}
+			texts = append(texts, " "+normalized+" ")
+		}
+		if len(texts) > 0 {
+			t.sources = append(t.sources, freeTextSource{name: source.name, texts: texts})
+		}
+	}
+}
+
+// find searches for a keyword normalized using wordvalidator.NormalizeForMatching
+// and returns the name of the part of the CV it was found in
+func (t *cvFreeText) find(normalizedKeyword string) (string, bool) {
+	if len(normalizedKeyword) == 0 {
+		return "", false
+	}
+
+	t.once.Do(t.normalize)
+
+	keyword := " " + normalizedKeyword + " "
+	for _, source := range t.sources {
+		for _, text := range source.texts {
+			if strings.Contains(text, keyword) {
+				return source.name, true
+			}
+		}
+	}
+	return "", false
+}
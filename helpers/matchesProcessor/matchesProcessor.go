@@ -0,0 +1,370 @@
+package matchesProcessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/match"
+	"github.com/script-development/RT-CV/helpers/webhooks"
+	"github.com/script-development/RT-CV/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Options contains the settings of a Processor
+type Options struct {
+	// Workers is the amount of jobs that can be processed at the same time
+	Workers int
+	// MaxAttempts is the amount of times a job is tried before it's marked as failed
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry of a failed job, every next retry waits twice as long
+	RetryDelay time.Duration
+	// PollInterval is how often the database is checked for jobs that are ready to be retried
+	PollInterval time.Duration
+}
+
+// DefaultOptions are the options used for values that are not set
+var DefaultOptions = Options{
+	Workers:      2,
+	MaxAttempts:  5,
+	RetryDelay:   time.Minute,
+	PollInterval: 10 * time.Second,
+}
+
+// OptionsFromEnv returns the options defined in the MATCH_PROCESSING_WORKERS and MATCH_PROCESSING_MAX_ATTEMPTS env variables
+func OptionsFromEnv() Options {
+	opts := DefaultOptions
+	envInt := func(key string, fallback int) int {
+		value := os.Getenv(key)
+		if value == "" {
+			return fallback
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			log.WithField("value", value).Warnf("invalid %s, using the default value %d", key, fallback)
+			return fallback
+		}
+		return parsed
+	}
+	opts.Workers = envInt("MATCH_PROCESSING_WORKERS", opts.Workers)
+	opts.MaxAttempts = envInt("MATCH_PROCESSING_MAX_ATTEMPTS", opts.MaxAttempts)
+	return opts
+}
+
+// Processor processes the matches made to CVs in the background
+// - save the matches for analytics and for detecting duplicates
+// - send emails with the matches or send http requests
+//
+// The matches to process are stored as jobs in the database so they survive a restart of the server,
+// failed jobs are retried with an increasing delay
+type Processor struct {
+	dbConn        db.Connection
+	opts          Options
+	webhookSender *webhooks.Sender
+	emailService  *emailservice.Service
+	// now returns the current time, can be replaced in tests
+	now func() time.Time
+
+	// wake is used to signal the dispatcher there might be new jobs
+	wake chan struct{}
+	jobs chan *models.MatchJob
+
+	m        sync.Mutex
+	started  bool
+	stopping bool
+	inFlight map[primitive.ObjectID]bool
+	// stop is closed once the processor should stop handing out jobs
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// storeLock makes sure only one job at a time checks for duplicates and match quotas and saves the matches
+	// without it 2 workers could both conclude a profile hasn't reached its quota yet
+	storeLock sync.Mutex
+}
+
+// NewProcessor creates a new matches processor
+// Call (*Processor).Start to start processing jobs
+// webhookSender is used to deliver the matches to the httpCall addresses of profiles and emailService to send the emails
+func NewProcessor(dbConn db.Connection, opts Options, webhookSender *webhooks.Sender, emailService *emailservice.Service) *Processor {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultOptions.Workers
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultOptions.MaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultOptions.RetryDelay
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultOptions.PollInterval
+	}
+
+	return &Processor{
+		dbConn:        dbConn,
+		opts:          opts,
+		webhookSender: webhookSender,
+		emailService:  emailService,
+		now:           time.Now,
+		wake:          make(chan struct{}, 1),
+		jobs:          make(chan *models.MatchJob),
+		stop:          make(chan struct{}),
+		inFlight:      map[primitive.ObjectID]bool{},
+	}
+}
+
+// Start resumes the jobs that were interrupted by a restart and starts the workers
+// Calling Start more than once does nothing
+func (p *Processor) Start() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.started {
+		return
+	}
+	p.started = true
+
+	resumed, err := models.ResetProcessingMatchJobs(p.dbConn)
+	if err != nil {
+		log.WithError(err).Error("unable to resume interrupted match jobs")
+	} else if resumed > 0 {
+		log.WithField("count", resumed).Info("Resuming interrupted match jobs")
+	}
+
+	for i := 0; i < p.opts.Workers; i++ {
+		go p.worker()
+	}
+	go p.dispatcher()
+}
+
+// NewJob contains the matches made to a CV that should be processed
+type NewJob struct {
+	Debug            bool
+	MatchedProfiles  []match.FoundMatch
+	CV               models.CV
+	KeyID, RequestID primitive.ObjectID
+	KeyName          string
+}
+
+// ErrShuttingDown is returned by (*Processor).Append once the processor is shutting down
+var ErrShuttingDown = errors.New("the server is shutting down, try again later")
+
+// Append stores the matches made to a CV as a job and notifies the workers about it
+func (p *Processor) Append(newJob NewJob) error {
+	p.m.Lock()
+	stopping := p.stopping
+	p.m.Unlock()
+	if stopping {
+		return ErrShuttingDown
+	}
+
+	if len(newJob.MatchedProfiles) == 0 {
+		return nil
+	}
+
+	job := models.NewMatchJob(p.now())
+	job.Debug = newJob.Debug
+	job.CV = newJob.CV
+	job.KeyID = newJob.KeyID
+	job.KeyName = newJob.KeyName
+	job.RequestID = newJob.RequestID
+	for _, aMatch := range newJob.MatchedProfiles {
+		job.Matches = append(job.Matches, models.MatchJobMatch{
+			Match:   aMatch.Matches,
+			Profile: aMatch.Profile,
+		})
+	}
+
+	err := p.dbConn.Insert(job)
+	if err != nil {
+		return err
+	}
+
+	p.notify()
+	return nil
+}
+
+// notify wakes up the dispatcher without blocking
+func (p *Processor) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatcher hands out the runnable jobs to the workers
+func (p *Processor) dispatcher() {
+	ticker := time.NewTicker(p.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		p.dispatch()
+		select {
+		case <-p.wake:
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *Processor) dispatch() {
+	jobs, err := models.GetRunnableMatchJobs(p.dbConn, p.now())
+	if err != nil {
+		log.WithError(err).Error("unable to get the match jobs to process")
+		return
+	}
+
+	for idx := range jobs {
+		job := jobs[idx]
+
+		p.m.Lock()
+		alreadyInFlight := p.inFlight[job.ID]
+		p.inFlight[job.ID] = true
+		p.m.Unlock()
+		if alreadyInFlight {
+			continue
+		}
+
+		job.Status = models.MatchJobStatusProcessing
+		err = p.dbConn.UpdateByID(&job)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID.Hex()).Error("unable to mark match job as processing")
+			p.done(job.ID)
+			continue
+		}
+
+		select {
+		case p.jobs <- &job:
+		case <-p.stop:
+			// The job is marked as processing, it's resumed on the next start
+			p.done(job.ID)
+			return
+		}
+	}
+}
+
+// done removes a job from the jobs that are being processed
+func (p *Processor) done(jobID primitive.ObjectID) {
+	p.m.Lock()
+	delete(p.inFlight, jobID)
+	p.m.Unlock()
+}
+
+func (p *Processor) worker() {
+	for job := range p.jobs {
+		p.run(job)
+		p.done(job.ID)
+	}
+}
+
+// run processes a job and updates its state in the database based on the result
+func (p *Processor) run(job *models.MatchJob) {
+	logger := log.WithField("request_id", job.RequestID.Hex()).WithField("job_id", job.ID.Hex())
+
+	err := p.process(job, logger)
+	if err == nil {
+		err = p.dbConn.DeleteByID(job)
+		if err != nil {
+			logger.WithError(err).Error("unable to remove processed match job")
+		}
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	if job.Attempts >= p.opts.MaxAttempts {
+		job.Status = models.MatchJobStatusFailed
+		logger.WithError(err).WithField("attempts", job.Attempts).Error("processing match job failed, giving up")
+	} else {
+		job.Status = models.MatchJobStatusPending
+		job.NextRunAt = jsonHelpers.RFC3339Nano(p.now().Add(p.retryDelay(job.Attempts)))
+		logger.WithError(err).WithField("attempts", job.Attempts).Warn("processing match job failed, retrying later")
+	}
+
+	err = p.dbConn.UpdateByID(job)
+	if err != nil {
+		logger.WithError(err).Error("unable to update failed match job")
+	}
+}
+
+// retryDelay returns the delay before the next attempt of a job that failed attempts times
+func (p *Processor) retryDelay(attempts int) time.Duration {
+	delay := p.opts.RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// StopAccepting makes (*Processor).Append return ErrShuttingDown for new jobs
+func (p *Processor) StopAccepting() {
+	p.m.Lock()
+	p.stopping = true
+	p.m.Unlock()
+}
+
+// Shutdown stops accepting new jobs and waits until all runnable jobs are processed or ctx expires
+// Jobs that are not processed stay in the database and are resumed on the next start
+// An error is returned if there are jobs left that are not processed
+func (p *Processor) Shutdown(ctx context.Context) error {
+	p.StopAccepting()
+
+	p.m.Lock()
+	started := p.started
+	p.m.Unlock()
+
+	if started {
+		ticker := time.NewTicker(20 * time.Millisecond)
+	waitLoop:
+		for {
+			drained, err := p.drained()
+			if err != nil {
+				log.WithError(err).Error("unable to check if all match jobs are processed")
+			} else if drained {
+				break
+			}
+
+			p.notify()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				break waitLoop
+			}
+		}
+		ticker.Stop()
+		p.stopOnce.Do(func() { close(p.stop) })
+	}
+
+	remaining := uint64(0)
+	for _, status := range []models.MatchJobStatus{models.MatchJobStatusPending, models.MatchJobStatusProcessing} {
+		count, err := models.CountMatchJobsWithStatus(p.dbConn, status)
+		if err != nil {
+			return err
+		}
+		remaining += count
+	}
+	if remaining > 0 {
+		return fmt.Errorf("%d match jobs are not processed, they will be resumed on the next start", remaining)
+	}
+	return nil
+}
+
+// drained returns true if there are no jobs being processed and no jobs that can be processed right now
+func (p *Processor) drained() (bool, error) {
+	p.m.Lock()
+	inFlight := len(p.inFlight)
+	p.m.Unlock()
+	if inFlight > 0 {
+		return false, nil
+	}
+
+	jobs, err := models.GetRunnableMatchJobs(p.dbConn, p.now())
+	return len(jobs) == 0, err
+}
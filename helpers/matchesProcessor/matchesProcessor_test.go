@@ -0,0 +1,321 @@
+package matchesProcessor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/match"
+	"github.com/script-development/RT-CV/helpers/webhooks"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+)
+
+// failingInsertDB is a database connection that fails to insert matches if fail is set
+// and waits with inserting matches until block is closed if block is set
+type failingInsertDB struct {
+	*testingdb.TestConnection
+	fail  bool
+	block chan struct{}
+}
+
+func (c *failingInsertDB) Insert(data ...db.Entry) error {
+	if len(data) > 0 && data[0].CollectionName() == (&models.Match{}).CollectionName() {
+		if c.block != nil {
+			<-c.block
+		}
+		if c.fail {
+			return errors.New("insert failed")
+		}
+	}
+	return c.TestConnection.Insert(data...)
+}
+
+var testKeyID = db.NewM().ID
+
+func newTestProcessor(conn db.Connection, opts Options) *Processor {
+	return NewProcessor(conn, opts, webhooks.NewSender(conn, webhooks.Options{}), emailservice.NewService(conn, emailservice.NewMemoryTransport(), emailservice.Options{}))
+}
+
+func newTestJob(t *testing.T, p *Processor, referenceNr string, profiles ...models.Profile) *models.MatchJob {
+	matches := []match.FoundMatch{}
+	for _, profile := range profiles {
+		matches = append(matches, match.FoundMatch{
+			Matches: models.Match{M: db.NewM(), ProfileID: profile.ID, When: jsonHelpers.RFC3339Nano(p.now())},
+			Profile: profile,
+		})
+	}
+
+	err := p.Append(NewJob{
+		MatchedProfiles: matches,
+		CV:              models.CV{ReferenceNumber: referenceNr},
+		KeyID:           testKeyID,
+	})
+	NoError(t, err)
+
+	jobs, err := models.GetRunnableMatchJobs(p.dbConn, p.now())
+	NoError(t, err)
+	NotEmpty(t, jobs)
+	return &jobs[len(jobs)-1]
+}
+
+func countMatches(t *testing.T, conn db.Connection) uint64 {
+	count, err := conn.Count(&models.Match{}, nil)
+	NoError(t, err)
+	return count
+}
+
+func countJobs(t *testing.T, conn db.Connection) uint64 {
+	count, err := conn.Count(&models.MatchJob{}, nil)
+	NoError(t, err)
+	return count
+}
+
+func TestProcessJob(t *testing.T) {
+	conn := testingdb.NewDB()
+	p := newTestProcessor(conn, Options{})
+
+	profile := models.Profile{M: db.NewM(), Name: "profile"}
+	job := newTestJob(t, p, "123", profile)
+	p.run(job)
+
+	// The match should be stored and the job removed
+	Equal(t, uint64(1), countMatches(t, conn))
+	Equal(t, uint64(0), countJobs(t, conn))
+
+	// The same CV matched again should not result in a new match
+	job = newTestJob(t, p, "123", profile)
+	p.run(job)
+	Equal(t, uint64(1), countMatches(t, conn))
+	Equal(t, uint64(0), countJobs(t, conn))
+}
+
+func TestProcessJobDigest(t *testing.T) {
+	conn := testingdb.NewDB()
+	p := newTestProcessor(conn, Options{})
+
+	// Only digest recipients so no email or PDF is created while processing the job
+	profile := models.Profile{M: db.NewM(), Name: "profile", OnMatch: models.ProfileOnMatch{SendMail: []models.ProfileSendEmailData{
+		{Email: "hourly@example.com", Delivery: models.ProfileEmailDeliveryHourly},
+		{Email: "daily@example.com", Delivery: models.ProfileEmailDeliveryDaily},
+	}}}
+	p.run(newTestJob(t, p, "123", profile))
+	Equal(t, uint64(0), countJobs(t, conn))
+
+	digestMatches := []models.DigestMatch{}
+	NoError(t, conn.Find(&models.DigestMatch{}, &digestMatches, nil))
+	if Len(t, digestMatches, 2) {
+		emails := []string{digestMatches[0].Email, digestMatches[1].Email}
+		ElementsMatch(t, []string{"hourly@example.com", "daily@example.com"}, emails)
+		Equal(t, "123", digestMatches[0].CV.ReferenceNumber)
+		Equal(t, profile.ID, digestMatches[0].ProfileID)
+	}
+}
+
+func TestProcessJobMatchQuota(t *testing.T) {
+	conn := testingdb.NewDB()
+	p := newTestProcessor(conn, Options{})
+
+	profile := models.Profile{M: db.NewM(), MaxMatchesPerDay: 1}
+	p.run(newTestJob(t, p, "1", profile))
+	p.run(newTestJob(t, p, "2", profile))
+
+	Equal(t, uint64(1), countMatches(t, conn))
+	Equal(t, uint64(0), countJobs(t, conn))
+}
+
+func TestProcessJobRetry(t *testing.T) {
+	conn := &failingInsertDB{TestConnection: testingdb.NewDB(), fail: true}
+	p := newTestProcessor(conn, Options{MaxAttempts: 2, RetryDelay: time.Minute})
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	job := newTestJob(t, p, "123", models.Profile{M: db.NewM()})
+	p.run(job)
+
+	// The job should be retried after the retry delay
+	Equal(t, 1, job.Attempts)
+	Equal(t, models.MatchJobStatusPending, job.Status)
+	Equal(t, "insert failed", job.LastError)
+	Equal(t, now.Add(time.Minute), job.NextRunAt.Time())
+	jobs, err := models.GetRunnableMatchJobs(conn, now)
+	NoError(t, err)
+	Len(t, jobs, 0)
+
+	// After too many attempts the job should be marked as failed
+	p.run(job)
+	Equal(t, 2, job.Attempts)
+	Equal(t, models.MatchJobStatusFailed, job.Status)
+	failedJobs, err := models.GetMatchJobsWithStatus(conn, models.MatchJobStatusFailed)
+	NoError(t, err)
+	Len(t, failedJobs, 1)
+	Equal(t, uint64(0), countMatches(t, conn))
+}
+
+func TestProcessJobSendProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	conn := testingdb.NewDB()
+	p := newTestProcessor(conn, Options{MaxAttempts: 2})
+
+	// The body template of the last call can't be rendered so queueing that webhook fails
+	// The first 2 calls have the same uri but are different calls
+	profile := models.Profile{M: db.NewM(), OnMatch: models.ProfileOnMatch{HTTPCall: []models.ProfileHTTPCallData{
+		{URI: server.URL + "/a"},
+		{URI: server.URL + "/a", Method: "POST"},
+		{URI: server.URL + "/b", BodyTemplate: "{{ .Unknown }}"},
+	}}}
+	job := newTestJob(t, p, "123", profile)
+	p.run(job)
+	Equal(t, models.MatchJobStatusPending, job.Status)
+	if Len(t, job.Matches, 1) {
+		False(t, job.Matches[0].Handled)
+		Equal(t, []int{0, 1}, job.Matches[0].Sent.HTTPCalls)
+	}
+	deliveries, err := models.GetWebhookDeliveries(conn, nil, nil, models.Page{})
+	NoError(t, err)
+	Len(t, deliveries, 2)
+
+	// The retry should only send the webhook that was not yet queued
+	job.Matches[0].Profile.OnMatch.HTTPCall[2].BodyTemplate = ""
+	p.run(job)
+	Equal(t, uint64(0), countJobs(t, conn))
+	deliveries, err = models.GetWebhookDeliveries(conn, nil, nil, models.Page{})
+	NoError(t, err)
+	if Len(t, deliveries, 3) {
+		calls := []string{}
+		for _, delivery := range deliveries {
+			calls = append(calls, delivery.Method+" "+delivery.URI)
+		}
+		ElementsMatch(t, []string{"GET " + server.URL + "/a", "POST " + server.URL + "/a", "GET " + server.URL + "/b"}, calls)
+	}
+	NoError(t, p.webhookSender.Shutdown(context.Background()))
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := newTestProcessor(testingdb.NewDB(), Options{RetryDelay: time.Second})
+	Equal(t, time.Second, p.retryDelay(1))
+	Equal(t, time.Second*2, p.retryDelay(2))
+	Equal(t, time.Second*8, p.retryDelay(4))
+}
+
+func TestResumeInterruptedJobs(t *testing.T) {
+	conn := testingdb.NewDB()
+
+	// A job that was being processed when the server stopped
+	job := models.NewMatchJob(time.Now())
+	job.Status = models.MatchJobStatusProcessing
+	job.Matches = []models.MatchJobMatch{{Match: models.Match{M: db.NewM()}, Profile: models.Profile{M: db.NewM()}}}
+	NoError(t, conn.Insert(job))
+
+	p := newTestProcessor(conn, Options{Workers: 2})
+	p.Start()
+
+	Eventually(t, func() bool {
+		return countJobs(t, conn) == 0
+	}, time.Second*5, time.Millisecond*10)
+	Equal(t, uint64(1), countMatches(t, conn))
+}
+
+func TestProcessorWorkers(t *testing.T) {
+	conn := testingdb.NewDB()
+	p := newTestProcessor(conn, Options{Workers: 3})
+	p.Start()
+
+	for i := 0; i < 20; i++ {
+		err := p.Append(NewJob{
+			MatchedProfiles: []match.FoundMatch{{Profile: models.Profile{M: db.NewM()}}},
+			CV:              models.CV{ReferenceNumber: "ref"},
+		})
+		NoError(t, err)
+	}
+
+	Eventually(t, func() bool {
+		return countJobs(t, conn) == 0
+	}, time.Second*5, time.Millisecond*10)
+	Equal(t, uint64(20), countMatches(t, conn))
+}
+
+func TestShutdownDrainsJobs(t *testing.T) {
+	conn := testingdb.NewDB()
+
+	// Insert the jobs before starting so they are all waiting when the shutdown begins
+	for i := 0; i < 10; i++ {
+		job := models.NewMatchJob(time.Now())
+		job.Matches = []models.MatchJobMatch{{Match: models.Match{M: db.NewM()}, Profile: models.Profile{M: db.NewM()}}}
+		NoError(t, conn.Insert(job))
+	}
+
+	p := newTestProcessor(conn, Options{Workers: 2})
+	p.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	NoError(t, p.Shutdown(ctx))
+	Equal(t, uint64(0), countJobs(t, conn))
+	Equal(t, uint64(10), countMatches(t, conn))
+
+	// New jobs should be refused after the shutdown
+	err := p.Append(NewJob{
+		MatchedProfiles: []match.FoundMatch{{Profile: models.Profile{M: db.NewM()}}},
+	})
+	Equal(t, ErrShuttingDown, err)
+	Equal(t, uint64(0), countJobs(t, conn))
+}
+
+func TestShutdownReportsUnprocessedJobs(t *testing.T) {
+	conn := &failingInsertDB{TestConnection: testingdb.NewDB(), fail: true}
+	p := newTestProcessor(conn, Options{Workers: 1})
+	p.Start()
+
+	NoError(t, p.Append(NewJob{
+		MatchedProfiles: []match.FoundMatch{{Profile: models.Profile{M: db.NewM()}}},
+	}))
+
+	// The job fails and is scheduled for a retry so it's left in the database
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err := p.Shutdown(ctx)
+	Error(t, err)
+	Contains(t, err.Error(), "1 match jobs are not processed")
+	Equal(t, uint64(1), countJobs(t, conn))
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	conn := &failingInsertDB{TestConnection: testingdb.NewDB(), block: make(chan struct{})}
+	defer close(conn.block)
+	p := newTestProcessor(conn, Options{Workers: 1})
+	p.Start()
+
+	// The job is stuck while the deadline passes
+	NoError(t, p.Append(NewJob{
+		MatchedProfiles: []match.FoundMatch{{Profile: models.Profile{M: db.NewM()}}},
+	}))
+	Eventually(t, func() bool {
+		count, err := models.CountMatchJobsWithStatus(conn, models.MatchJobStatusProcessing)
+		return err == nil && count == 1
+	}, time.Second*5, time.Millisecond*10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	Error(t, p.Shutdown(ctx))
+
+	// The job should be left behind as processing so it's resumed on the next start
+	processingJobs, err := models.GetMatchJobsWithStatus(conn, models.MatchJobStatusProcessing)
+	NoError(t, err)
+	Len(t, processingJobs, 1)
+}
+
+func init() {
+	// Keep the test output clean
+	log.SetLevel(log.FatalLevel)
+}
@@ -0,0 +1,212 @@
+package matchesProcessor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/match"
+	"github.com/script-development/RT-CV/models"
+)
+
+// process processes the matches of a job
+// - save the matches of this reference number for analytics and for detecting duplicates
+// - send emails with the matches or send http requests
+//
+// The progress is stored on the job so a retry continues where the previous attempt stopped
+func (p *Processor) process(job *models.MatchJob, logger *log.Entry) error {
+	if !job.MatchesStored {
+		err := p.storeMatches(job, logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	if job.Debug {
+		return nil
+	}
+
+	return p.sendMatches(job, logger)
+}
+
+// storeMatches removes the duplicated matches and the matches of profiles that reached their quota
+// and saves the remaining matches
+func (p *Processor) storeMatches(job *models.MatchJob, logger *log.Entry) error {
+	p.storeLock.Lock()
+	defer p.storeLock.Unlock()
+
+	// Get earlier matches on this reference number
+	earlierMatches, err := models.GetMatchesOnReferenceNr(p.dbConn, job.CV.ReferenceNumber, &job.KeyID)
+	if err != nil {
+		return err
+	}
+
+	// Remove matches that were already made earlier
+	// We loop in reverse so we can remove items from the slice
+	for idx := len(job.Matches) - 1; idx >= 0; idx-- {
+		for _, earlierMatch := range earlierMatches {
+			if job.Matches[idx].Profile.ID == earlierMatch.ProfileID {
+				job.Matches = append(job.Matches[:idx], job.Matches[idx+1:]...)
+				break
+			}
+		}
+	}
+
+	// Remove matches of profiles that already reached their match quota
+	// The storeLock makes sure the counts include the matches stored by other workers
+	if !job.Debug {
+		now := p.now()
+		for idx := len(job.Matches) - 1; idx >= 0; idx-- {
+			profile := job.Matches[idx].Profile
+			if !profile.HasMatchQuota() {
+				continue
+			}
+
+			reached, err := profile.MatchQuotaReached(p.dbConn, now)
+			if err != nil {
+				return err
+			}
+			if reached {
+				logger.WithField("profile_id", profile.ID.Hex()).Info("profile reached its match quota, ignoring match")
+				job.Matches = append(job.Matches[:idx], job.Matches[idx+1:]...)
+			}
+		}
+	}
+
+	if len(job.Matches) > 0 {
+		analyticsData := make([]models.Match, len(job.Matches))
+		for idx, jobMatch := range job.Matches {
+			analyticsData[idx] = jobMatch.Match
+			analyticsData[idx].RequestID = job.RequestID
+			analyticsData[idx].KeyID = job.KeyID
+			analyticsData[idx].Debug = job.Debug
+			analyticsData[idx].ReferenceNr = job.CV.ReferenceNumber
+		}
+
+		entries := make([]db.Entry, len(analyticsData))
+		for idx := range analyticsData {
+			entries[idx] = &analyticsData[idx]
+		}
+		err = p.dbConn.Insert(entries...)
+		if err != nil {
+			logger.WithField("analytics_entries_count", len(entries)).WithError(err).Error("analytics data insertion failed")
+			return err
+		}
+
+		for idx := range job.Matches {
+			job.Matches[idx].Match = analyticsData[idx]
+		}
+	}
+
+	job.MatchesStored = true
+	err = p.dbConn.UpdateByID(job)
+	if err != nil {
+		// Not being able to save the progress is not a reason to fail the job,
+		// at worst the next attempt detects the matches as duplicates
+		logger.WithError(err).Error("unable to save the progress of a match job")
+	}
+	return nil
+}
+
+// sendMatches sends the emails and http calls of the matches that are not yet handled
+func (p *Processor) sendMatches(job *models.MatchJob, logger *log.Entry) error {
+	var defaultPdf *os.File
+	defer func() {
+		if defaultPdf != nil {
+			defaultPdf.Close()
+			os.Remove(defaultPdf.Name())
+		}
+	}()
+
+	var lastErr error
+	for idx := range job.Matches {
+		jobMatch := &job.Matches[idx]
+		if jobMatch.Handled {
+			continue
+		}
+
+		err := p.sendMatch(job, jobMatch, &defaultPdf)
+		if err != nil {
+			logger.WithError(err).WithField("profile_id", jobMatch.Profile.ID.Hex()).Error("unable to send match")
+			lastErr = err
+		} else {
+			jobMatch.Handled = true
+		}
+
+		// Save the progress after every match so a retry, also after a restart of the server,
+		// only sends the emails and http calls that are not yet queued
+		err = p.dbConn.UpdateByID(job)
+		if err != nil {
+			logger.WithError(err).Error("unable to save the progress of a match job")
+		}
+	}
+	return lastErr
+}
+
+// sendMatch queues the digests, emails and http calls of a single match of job
+// The progress is stored in jobMatch, defaultPdf is created once it's needed and reused for the other matches
+func (p *Processor) sendMatch(job *models.MatchJob, jobMatch *models.MatchJobMatch, defaultPdf **os.File) error {
+	aMatch := match.FoundMatch{Matches: jobMatch.Match, Profile: jobMatch.Profile}
+
+	// The email addresses that receive a digest get the match later on from the digest scheduler
+	immediateMail := []models.ProfileSendEmailData{}
+	digestMail := []models.ProfileSendEmailData{}
+	for _, mail := range jobMatch.Profile.OnMatch.SendMail {
+		if mail.Delivery.IsDigest() {
+			digestMail = append(digestMail, mail)
+		} else if !jobMatch.Sent.EmailSent(mail.Email) {
+			immediateMail = append(immediateMail, mail)
+		}
+	}
+	if len(digestMail) > 0 && !jobMatch.DigestQueued {
+		err := p.queueDigestMatches(job, jobMatch, digestMail)
+		if err != nil {
+			return fmt.Errorf("unable to queue match for digest: %s", err.Error())
+		}
+		jobMatch.DigestQueued = true
+	}
+	aMatch.Profile.OnMatch.SendMail = immediateMail
+	onMatch := aMatch.Profile.OnMatch
+
+	if len(onMatch.SendMail) == 0 {
+		return aMatch.HandleMatch(job.CV, nil, job.KeyName, p.webhookSender, p.emailService, nil, &jobMatch.Sent)
+	}
+
+	emailTemplate, err := models.GetEmailTemplateFor(p.dbConn, models.EmailTemplateKindMatch, aMatch.Profile.MatchEmailTemplateID, jobMatch.Match.KeyID)
+	if err != nil {
+		return fmt.Errorf("unable to get the email template: %s", err.Error())
+	}
+
+	if onMatch.HasPDFOptions() {
+		// This pdf has custom options
+		customPDFFile, err := job.CV.GetPDF(onMatch.PdfOptions, nil)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			customPDFFile.Close()
+			os.Remove(customPDFFile.Name())
+		}()
+		return aMatch.HandleMatch(job.CV, customPDFFile, job.KeyName, p.webhookSender, p.emailService, emailTemplate, &jobMatch.Sent)
+	}
+
+	if *defaultPdf == nil {
+		// If the profile has the default PDF options we only have to create the PDF once and reuse it
+		*defaultPdf, err = job.CV.GetPDF(nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return aMatch.HandleMatch(job.CV, *defaultPdf, job.KeyName, p.webhookSender, p.emailService, emailTemplate, &jobMatch.Sent)
+}
+
+// queueDigestMatches adds the match to the digests of the email addresses in mail
+func (p *Processor) queueDigestMatches(job *models.MatchJob, jobMatch *models.MatchJobMatch, mail []models.ProfileSendEmailData) error {
+	now := p.now()
+	entries := make([]db.Entry, len(mail))
+	for idx, recipient := range mail {
+		entries[idx] = models.NewDigestMatch(now, recipient, jobMatch.Profile, jobMatch.Match, job.CV, job.KeyName)
+	}
+	return p.dbConn.Insert(entries...)
+}
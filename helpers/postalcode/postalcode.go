@@ -0,0 +1,187 @@
+package postalcode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Country is a ISO 3166-1 alpha-2 country code of a country we support postal codes for
+type Country string
+
+// The countries we can parse postal codes for
+const (
+	CountryNL Country = "NL"
+	CountryBE Country = "BE"
+	CountryDE Country = "DE"
+)
+
+// DefaultCountry is used when no country is known
+// Most CVs and profiles are dutch and predate the country support so they are assumed to be dutch
+const DefaultCountry = CountryNL
+
+// countryAliases maps the lowercase names scrapers use for a country to the country
+var countryAliases = map[string]Country{
+	"nl":              CountryNL,
+	"nld":             CountryNL,
+	"netherlands":     CountryNL,
+	"the netherlands": CountryNL,
+	"nederland":       CountryNL,
+	"holland":         CountryNL,
+
+	"be":       CountryBE,
+	"bel":      CountryBE,
+	"belgium":  CountryBE,
+	"belgie":   CountryBE,
+	"belgië":   CountryBE,
+	"belgique": CountryBE,
+	"belgien":  CountryBE,
+
+	"de":          CountryDE,
+	"deu":         CountryDE,
+	"germany":     CountryDE,
+	"deutschland": CountryDE,
+	"duitsland":   CountryDE,
+	"allemagne":   CountryDE,
+}
+
+// ParseCountry converts a country name or code as found in a CV into a Country
+// An empty or unknown value results in the DefaultCountry,
+// before countries were supported all zipcodes were parsed as dutch zipcodes and scrapers do not always set a country we know
+// The second return value is false if the value is not empty and not a known country
+func ParseCountry(name string) (Country, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return DefaultCountry, true
+	}
+	country, ok := countryAliases[name]
+	if !ok {
+		return DefaultCountry, false
+	}
+	return country, true
+}
+
+// Valid returns true if the country is supported
+// An empty country is valid and means the DefaultCountry
+func (c Country) Valid() bool {
+	switch c {
+	case "", CountryNL, CountryBE, CountryDE:
+		return true
+	default:
+		return false
+	}
+}
+
+// OrDefault returns the country or the DefaultCountry if the country is empty
+func (c Country) OrDefault() Country {
+	if c == "" {
+		return DefaultCountry
+	}
+	return c
+}
+
+// digits returns the amount of digits of the numeric part of a postal code of the country
+func (c Country) digits() int {
+	if c.OrDefault() == CountryDE {
+		return 5
+	}
+	return 4
+}
+
+// NumberRange returns the lowest and highest possible numeric part of a postal code of the country
+func (c Country) NumberRange() (min uint32, max uint32) {
+	switch c.OrDefault() {
+	case CountryDE:
+		return 1_000, 99_999
+	default:
+		return 1_000, 9_999
+	}
+}
+
+// ValidNumber returns true if nr can be the numeric part of a postal code of the country
+func (c Country) ValidNumber(nr uint32) bool {
+	min, max := c.NumberRange()
+	return nr >= min && nr <= max
+}
+
+// Code is a parsed postal code
+type Code struct {
+	Country Country
+	// Number is the numeric part of the postal code,
+	// for dutch postal codes this is the 4 digits without the letters
+	Number uint32
+}
+
+// String formats the numeric part of the postal code
+func (c Code) String() string {
+	return fmt.Sprintf("%0*d", c.Country.digits(), c.Number)
+}
+
+// Parse parses a postal code of the country
+// Spaces and the country prefix (for example "B-1000" or "D-10115") are allowed
+func Parse(country Country, code string) (Code, error) {
+	country = country.OrDefault()
+	if !country.Valid() {
+		return Code{}, fmt.Errorf("unsupported country %s", country)
+	}
+
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	for _, prefix := range countryPrefixes(country) {
+		if strings.HasPrefix(normalized, prefix) {
+			normalized = normalized[len(prefix):]
+			break
+		}
+	}
+
+	digits := country.digits()
+	if len(normalized) < digits {
+		return Code{}, errors.New("too short")
+	}
+
+	numberPart, rest := normalized[:digits], normalized[digits:]
+	for _, c := range numberPart {
+		if c < '0' || c > '9' {
+			return Code{}, errors.New("expected " + strconv.Itoa(digits) + " digits")
+		}
+	}
+	nr, err := strconv.ParseUint(numberPart, 10, 32)
+	if err != nil {
+		return Code{}, err
+	}
+
+	switch country {
+	case CountryNL:
+		// Dutch postal codes have 2 optional letters after the digits
+		if len(rest) != 0 && (len(rest) != 2 || !isLetter(rest[0]) || !isLetter(rest[1])) {
+			return Code{}, errors.New("expected 2 letters after the digits")
+		}
+	default:
+		if len(rest) != 0 {
+			return Code{}, errors.New("unexpected characters after the digits")
+		}
+	}
+
+	if !country.ValidNumber(uint32(nr)) {
+		return Code{}, errors.New("out of range")
+	}
+
+	return Code{Country: country, Number: uint32(nr)}, nil
+}
+
+func countryPrefixes(country Country) []string {
+	switch country {
+	case CountryNL:
+		return []string{"NL-"}
+	case CountryBE:
+		return []string{"BE-", "B-"}
+	case CountryDE:
+		return []string{"DE-", "D-"}
+	default:
+		return nil
+	}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
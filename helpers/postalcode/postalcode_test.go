@@ -0,0 +1,81 @@
+package postalcode
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestParseCountry(t *testing.T) {
+	testCases := map[string]Country{
+		"":            CountryNL,
+		"Netherlands": CountryNL,
+		" nederland ": CountryNL,
+		"NL":          CountryNL,
+		"België":      CountryBE,
+		"Belgium":     CountryBE,
+		"be":          CountryBE,
+		"Deutschland": CountryDE,
+		"Duitsland":   CountryDE,
+		"DE":          CountryDE,
+	}
+	for input, expected := range testCases {
+		country, ok := ParseCountry(input)
+		True(t, ok, input)
+		Equal(t, expected, country, input)
+	}
+
+	// Unknown countries fall back to the default country
+	country, ok := ParseCountry("France")
+	False(t, ok)
+	Equal(t, CountryNL, country)
+}
+
+func TestParse(t *testing.T) {
+	validCases := []struct {
+		country  Country
+		input    string
+		expected Code
+	}{
+		{"", "9779AB", Code{CountryNL, 9779}},
+		{CountryNL, "9779", Code{CountryNL, 9779}},
+		{CountryNL, "9779 ab", Code{CountryNL, 9779}},
+		{CountryNL, "NL-1012AB", Code{CountryNL, 1012}},
+		{CountryBE, "1000", Code{CountryBE, 1000}},
+		{CountryBE, "B-9000", Code{CountryBE, 9000}},
+		{CountryDE, "10115", Code{CountryDE, 10115}},
+		{CountryDE, "01067", Code{CountryDE, 1067}},
+		{CountryDE, "D-80331", Code{CountryDE, 80331}},
+	}
+	for _, testCase := range validCases {
+		code, err := Parse(testCase.country, testCase.input)
+		NoError(t, err, testCase.input)
+		Equal(t, testCase.expected, code, testCase.input)
+	}
+
+	invalidCases := []struct {
+		country Country
+		input   string
+	}{
+		{CountryNL, ""},
+		{CountryNL, "977"},
+		{CountryNL, "0779AB"},
+		{CountryNL, "9779A"},
+		{CountryNL, "9779A1"},
+		{CountryNL, "abcdef"},
+		{CountryBE, "10000"},
+		{CountryBE, "1000AB"},
+		{CountryDE, "1011"},
+		{CountryDE, "00100"},
+		{"FR", "75001"},
+	}
+	for _, testCase := range invalidCases {
+		_, err := Parse(testCase.country, testCase.input)
+		Error(t, err, testCase.input)
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	Equal(t, "9779", Code{CountryNL, 9779}.String())
+	Equal(t, "01067", Code{CountryDE, 1067}.String())
+}
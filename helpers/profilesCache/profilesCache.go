@@ -0,0 +1,154 @@
+package profilesCache
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/match"
+	"github.com/script-development/RT-CV/models"
+)
+
+// DefaultTTL is the time after which the cache is refreshed if it wasn't invalidated before that
+const DefaultTTL = time.Hour * 24
+
+// TTLFromEnv returns the cache ttl defined in the PROFILES_CACHE_TTL env variable
+// The value should be a go duration like 30m or 12h, if not set or invalid DefaultTTL is returned
+func TTLFromEnv() time.Duration {
+	value := os.Getenv("PROFILES_CACHE_TTL")
+	if value == "" {
+		return DefaultTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.WithField("value", value).Warn("invalid PROFILES_CACHE_TTL, using the default ttl")
+		return DefaultTTL
+	}
+	return ttl
+}
+
+// Snapshot is a read only view of the profiles used by the matcher
+// A snapshot is never changed after it's created, an invalidation of the cache creates a new snapshot
+// so requests that are still using an older snapshot are not affected
+type Snapshot struct {
+	CreatedAt time.Time
+	// Profiles are in the same order as the explanations returned by Index.Explain
+	Profiles []*models.Profile
+	Index    *match.Index
+
+	generation uint64
+}
+
+// Cache caches the active profiles used by the matcher
+// It's safe to use the cache from multiple goroutines
+type Cache struct {
+	dbConn db.Connection
+	ttl    time.Duration
+	// now returns the current time, can be replaced in tests
+	now func() time.Time
+
+	m          sync.RWMutex
+	snapshot   *Snapshot
+	generation uint64
+
+	// loadLock makes sure only one goroutine at a time loads the profiles from the database
+	loadLock sync.Mutex
+}
+
+// NewCache creates a new profiles cache
+func NewCache(dbConn db.Connection, ttl time.Duration) *Cache {
+	return &Cache{
+		dbConn: dbConn,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Invalidate makes sure the next Get loads the profiles from the database again
+// Should be called after a profile or something the profiles depend on is created, updated or deleted
+func (c *Cache) Invalidate() {
+	c.m.Lock()
+	c.generation++
+	c.snapshot = nil
+	c.m.Unlock()
+}
+
+// current returns the current snapshot if it's still usable
+func (c *Cache) current() (*Snapshot, uint64) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	snapshot := c.snapshot
+	if snapshot == nil || snapshot.generation != c.generation || !snapshot.CreatedAt.Add(c.ttl).After(c.now()) {
+		return nil, c.generation
+	}
+	return snapshot, c.generation
+}
+
+// Get returns the current snapshot of the profiles
+// If the cache is empty, invalidated or outdated the profiles are loaded from the database
+func (c *Cache) Get() (*Snapshot, error) {
+	snapshot, _ := c.current()
+	if snapshot != nil {
+		return snapshot, nil
+	}
+
+	c.loadLock.Lock()
+	defer c.loadLock.Unlock()
+
+	// Another goroutine might have loaded the profiles while we where waiting for the lock
+	snapshot, generation := c.current()
+	if snapshot != nil {
+		return snapshot, nil
+	}
+
+	log.Info("updating the profiles cache")
+	snapshot, err := c.load(generation)
+	if err != nil {
+		return nil, err
+	}
+
+	c.m.Lock()
+	if c.generation == generation {
+		c.snapshot = snapshot
+	}
+	// If the cache was invalidated while loading we still return the snapshot to this caller
+	// as it's not older than the data the caller asked for, but the next caller will load a new one
+	c.m.Unlock()
+
+	return snapshot, nil
+}
+
+// load loads a new snapshot from the database
+func (c *Cache) load(generation uint64) (*Snapshot, error) {
+	profilesFromDB, err := models.GetActualActiveProfiles(c.dbConn)
+	if err != nil {
+		return nil, err
+	}
+	synonyms, err := models.GetSynonymIndex(c.dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	// The profiles are deep copied so the snapshot doesn't share any data with the database connection,
+	// after preparing them for matching the snapshot is only read
+	profiles := make([]*models.Profile, len(profilesFromDB))
+	for idx, profileFromDB := range profilesFromDB {
+		profile, err := profileFromDB.Clone()
+		if err != nil {
+			return nil, err
+		}
+		synonyms.ExpandProfile(&profile)
+		profile.PrepareForMatching()
+		profiles[idx] = &profile
+	}
+
+	return &Snapshot{
+		CreatedAt:  c.now(),
+		Profiles:   profiles,
+		Index:      match.NewIndex(profiles),
+		generation: generation,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package profilesCache
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/mock"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestTTLFromEnv(t *testing.T) {
+	defer os.Unsetenv("PROFILES_CACHE_TTL")
+
+	os.Unsetenv("PROFILES_CACHE_TTL")
+	Equal(t, DefaultTTL, TTLFromEnv())
+
+	os.Setenv("PROFILES_CACHE_TTL", "30m")
+	Equal(t, time.Minute*30, TTLFromEnv())
+
+	os.Setenv("PROFILES_CACHE_TTL", "not a duration")
+	Equal(t, DefaultTTL, TTLFromEnv())
+
+	os.Setenv("PROFILES_CACHE_TTL", "-1h")
+	Equal(t, DefaultTTL, TTLFromEnv())
+}
+
+func TestCacheGet(t *testing.T) {
+	cache := NewCache(mock.NewMockDB(), DefaultTTL)
+
+	snapshot, err := cache.Get()
+	NoError(t, err)
+	NotEmpty(t, snapshot.Profiles)
+	NotNil(t, snapshot.Index)
+
+	// A second get should return the same snapshot
+	secondSnapshot, err := cache.Get()
+	NoError(t, err)
+	True(t, snapshot == secondSnapshot)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	dbConn := mock.NewMockDB()
+	cache := NewCache(dbConn, DefaultTTL)
+
+	snapshot, err := cache.Get()
+	NoError(t, err)
+	profilesCount := len(snapshot.Profiles)
+
+	newProfile := *mock.Profile1
+	newProfile.M = db.NewM()
+	NoError(t, dbConn.Insert(&newProfile))
+
+	// Without invalidating the cache the new profile should not be visible
+	snapshot, err = cache.Get()
+	NoError(t, err)
+	Len(t, snapshot.Profiles, profilesCount)
+
+	cache.Invalidate()
+
+	newSnapshot, err := cache.Get()
+	NoError(t, err)
+	Len(t, newSnapshot.Profiles, profilesCount+1)
+
+	// The old snapshot should not be changed
+	Len(t, snapshot.Profiles, profilesCount)
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewCache(mock.NewMockDB(), time.Hour)
+	cache.now = func() time.Time { return now }
+
+	snapshot, err := cache.Get()
+	NoError(t, err)
+
+	now = now.Add(time.Minute * 59)
+	sameSnapshot, err := cache.Get()
+	NoError(t, err)
+	True(t, snapshot == sameSnapshot)
+
+	now = now.Add(time.Minute * 2)
+	newSnapshot, err := cache.Get()
+	NoError(t, err)
+	False(t, snapshot == newSnapshot)
+}
+
+func TestCacheConcurrentUsage(t *testing.T) {
+	dbConn := mock.NewMockDB()
+	cache := NewCache(dbConn, DefaultTTL)
+
+	cv := models.CV{
+		WorkExperiences: []models.WorkExperience{{Profession: "Dancer"}},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				snapshot, err := cache.Get()
+				NoError(t, err)
+				snapshot.Index.Match(mock.Key2, cv)
+				snapshot.Index.Explain(mock.Key2, cv)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				cache.Invalidate()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,78 @@
+package shutdown
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// DefaultTimeout is the maximum time the shutdown may take if SHUTDOWN_TIMEOUT is not set
+const DefaultTimeout = 30 * time.Second
+
+// TimeoutFromEnv returns the shutdown timeout defined in the SHUTDOWN_TIMEOUT env variable
+// The value should be a go duration like 30s or 2m, if not set or invalid DefaultTimeout is returned
+func TimeoutFromEnv() time.Duration {
+	value := os.Getenv("SHUTDOWN_TIMEOUT")
+	if value == "" {
+		return DefaultTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		log.WithField("value", value).Warn("invalid SHUTDOWN_TIMEOUT, using the default timeout")
+		return DefaultTimeout
+	}
+	return timeout
+}
+
+// Step is a part of the shutdown
+type Step struct {
+	Name string
+	// Fn should stop the work of this step and return once all work is done or ctx expires
+	// An error means not all work was finished
+	Fn func(ctx context.Context) error
+}
+
+// Run runs the steps one after another, all steps share the deadline of ctx
+// A failing step does not stop the steps after it
+// Returns true if all steps succeeded
+func Run(ctx context.Context, steps ...Step) bool {
+	ok := true
+	for _, step := range steps {
+		logger := log.WithField("step", step.Name)
+		logger.Info("Shutting down")
+
+		err := step.Fn(ctx)
+		if err != nil {
+			logger.WithError(err).Error("Shutdown did not finish cleanly")
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Wait runs fn and waits for it to return or ctx to expire
+// Note that fn keeps running in the background if ctx expires first
+func Wait(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitGroup waits for wg to finish or ctx to expire
+func WaitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	return Wait(ctx, func() error {
+		wg.Wait()
+		return nil
+	})
+}
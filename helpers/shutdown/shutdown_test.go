@@ -0,0 +1,60 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	ran := []string{}
+	step := func(name string, err error) Step {
+		return Step{Name: name, Fn: func(context.Context) error {
+			ran = append(ran, name)
+			return err
+		}}
+	}
+
+	True(t, Run(context.Background(), step("a", nil), step("b", nil)))
+	Equal(t, []string{"a", "b"}, ran)
+
+	// A failing step should not stop the steps after it
+	ran = []string{}
+	False(t, Run(context.Background(), step("a", errors.New("failed")), step("b", nil)))
+	Equal(t, []string{"a", "b"}, ran)
+}
+
+func TestWaitGroup(t *testing.T) {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		wg.Done()
+	}()
+	NoError(t, WaitGroup(context.Background(), &wg))
+
+	// Should give up once the deadline is reached
+	wg.Add(1)
+	defer wg.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	Equal(t, context.DeadlineExceeded, WaitGroup(ctx, &wg))
+}
+
+func TestTimeoutFromEnv(t *testing.T) {
+	defer os.Unsetenv("SHUTDOWN_TIMEOUT")
+
+	os.Unsetenv("SHUTDOWN_TIMEOUT")
+	Equal(t, DefaultTimeout, TimeoutFromEnv())
+
+	os.Setenv("SHUTDOWN_TIMEOUT", "1m")
+	Equal(t, time.Minute, TimeoutFromEnv())
+
+	os.Setenv("SHUTDOWN_TIMEOUT", "not a duration")
+	Equal(t, DefaultTimeout, TimeoutFromEnv())
+}
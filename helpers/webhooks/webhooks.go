@@ -0,0 +1,356 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/crypto"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/shutdown"
+	"github.com/script-development/RT-CV/models"
+)
+
+// Options contains the settings of a Sender
+type Options struct {
+	// Timeout is the maximum duration of a single request
+	Timeout time.Duration
+	// MaxAttempts is the amount of times a webhook is tried before it's marked as failed
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry, every next retry waits twice as long
+	RetryDelay time.Duration
+	// MaxConcurrentPerEndpoint is the maximum amount of requests made at the same time to the same host
+	MaxConcurrentPerEndpoint int
+	// SecretsKey is used to encrypt the signing secrets of the profile http calls, signing is disabled if not set
+	SecretsKey string
+}
+
+// DefaultOptions are the options used for values that are not set
+var DefaultOptions = Options{
+	Timeout:                  10 * time.Second,
+	MaxAttempts:              5,
+	RetryDelay:               time.Second,
+	MaxConcurrentPerEndpoint: 4,
+}
+
+// OptionsFromEnv returns the options defined in the WEBHOOK_TIMEOUT, WEBHOOK_MAX_ATTEMPTS, WEBHOOK_MAX_CONCURRENT_PER_ENDPOINT and WEBHOOK_SECRETS_KEY env variables
+func OptionsFromEnv() Options {
+	opts := DefaultOptions
+
+	opts.SecretsKey = os.Getenv("WEBHOOK_SECRETS_KEY")
+	if opts.SecretsKey != "" && len(opts.SecretsKey) < 16 {
+		log.Warn("WEBHOOK_SECRETS_KEY must have a minimal length of 16 chars, signing webhooks is disabled")
+		opts.SecretsKey = ""
+	}
+
+	if value := os.Getenv("WEBHOOK_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			log.WithField("value", value).Warn("invalid WEBHOOK_TIMEOUT, using the default timeout")
+		} else {
+			opts.Timeout = timeout
+		}
+	}
+
+	envInt := func(key string, fallback int) int {
+		value := os.Getenv(key)
+		if value == "" {
+			return fallback
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			log.WithField("value", value).Warnf("invalid %s, using the default value %d", key, fallback)
+			return fallback
+		}
+		return parsed
+	}
+	opts.MaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", opts.MaxAttempts)
+	opts.MaxConcurrentPerEndpoint = envInt("WEBHOOK_MAX_CONCURRENT_PER_ENDPOINT", opts.MaxConcurrentPerEndpoint)
+
+	return opts
+}
+
+// ErrShuttingDown is returned by (*Sender).Send once the sender is shutting down
+var ErrShuttingDown = errors.New("the webhook sender is shutting down")
+
+const (
+	// TimestampHeader contains the unix timestamp in seconds of the moment the request was signed
+	TimestampHeader = "X-RTCV-Timestamp"
+	// SignatureHeader contains the signature of a request, formatted as "sha256=" followed by the hex encoded HMAC-SHA256 of the timestamp and body
+	// For calls in the query payload mode the query string is signed instead of the body
+	// The receiver should verify the header value using crypto.VerifyTimestampedPayload and reject requests with a timestamp older than a few minutes to prevent replay attacks
+	SignatureHeader = "X-RTCV-Signature"
+)
+
+// Sender delivers the matches to the httpCall addresses of profiles in the background
+// Every delivery is logged in the database as a models.WebhookDelivery
+type Sender struct {
+	dbConn db.Connection
+	opts   Options
+	// now returns the current time, can be replaced in tests
+	now func() time.Time
+
+	m            sync.Mutex
+	shuttingDown bool
+	// endpoints contains a semaphore per host to limit the concurrent requests to that host
+	endpoints map[string]chan struct{}
+	// inProgress contains the deliveries that are not yet finished
+	inProgress sync.WaitGroup
+}
+
+// NewSender creates a new webhook sender
+func NewSender(dbConn db.Connection, opts Options) *Sender {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultOptions.Timeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultOptions.MaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultOptions.RetryDelay
+	}
+	if opts.MaxConcurrentPerEndpoint <= 0 {
+		opts.MaxConcurrentPerEndpoint = DefaultOptions.MaxConcurrentPerEndpoint
+	}
+
+	return &Sender{
+		dbConn:    dbConn,
+		opts:      opts,
+		now:       time.Now,
+		endpoints: map[string]chan struct{}{},
+	}
+}
+
+// ResumeInterruptedDeliveries continues the deliveries that were still pending during the last shutdown of the server
+// This should be called once on startup
+func (s *Sender) ResumeInterruptedDeliveries() {
+	deliveries, err := models.GetPendingWebhookDeliveries(s.dbConn)
+	if err != nil {
+		log.WithError(err).Error("unable to get the interrupted webhook deliveries")
+		return
+	}
+
+	resumed := 0
+	for idx := range deliveries {
+		delivery := &deliveries[idx]
+		logger := log.WithField("delivery_id", delivery.ID.Hex())
+
+		req, signingSecret, err := s.request(delivery)
+		if err != nil {
+			// Without the request the webhook can't be sent anymore
+			logger.WithError(err).Error("unable to resume an interrupted webhook delivery")
+			delivery.Status = models.WebhookDeliveryStatusFailed
+			delivery.LastError = "unable to resume the delivery after a restart of the server, " + err.Error()
+			delivery.Call = nil
+			delivery.Payload = nil
+			delivery.UpdatedAt = jsonHelpers.RFC3339Nano(s.now())
+			err = s.dbConn.UpdateByID(delivery)
+			if err != nil {
+				logger.WithError(err).Error("unable to update webhook delivery log")
+			}
+			continue
+		}
+
+		err = s.queue(req, signingSecret, delivery, false)
+		if err != nil {
+			logger.WithError(err).Error("unable to resume an interrupted webhook delivery")
+			continue
+		}
+		resumed++
+	}
+
+	if resumed > 0 {
+		log.WithField("count", resumed).Info("Resumed webhook deliveries interrupted by a restart")
+	}
+}
+
+// request returns the request and signing secret of a delivery stored in the database
+func (s *Sender) request(delivery *models.WebhookDelivery) (*models.ProfileHTTPCallRequest, []byte, error) {
+	if delivery.Call == nil {
+		return nil, nil, errors.New("the request of the webhook is not kept")
+	}
+
+	req, err := delivery.Call.NewRequestWithPayload(delivery.Payload, s.opts.SecretsKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signingSecret, err := delivery.Call.DecryptSigningSecret(s.opts.SecretsKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decrypt signing secret: %s", err.Error())
+	}
+	return req, signingSecret, nil
+}
+
+// EncryptSecrets encrypts the signing secrets and secret header values of the http calls of onMatch
+// Calls and headers without a new secret keep the secret of the call in previous with the same uri
+func (s *Sender) EncryptSecrets(onMatch *models.ProfileOnMatch, previous []models.ProfileHTTPCallData) error {
+	return onMatch.EncryptSecrets(s.opts.SecretsKey, previous)
+}
+
+// Send logs a new delivery and sends the payload to the address of call in the background
+// If the call has a signing secret the requests are signed, see SignatureHeader
+func (s *Sender) Send(call models.ProfileHTTPCallData, payload models.WebhookPayload) error {
+	renderedPayload, err := call.RenderPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	delivery := &models.WebhookDelivery{
+		M:         db.NewM(),
+		ProfileID: payload.ProfileID,
+		MatchID:   payload.Match.ID,
+		URI:       call.URI,
+		Method:    call.GetMethod(),
+		Status:    models.WebhookDeliveryStatusPending,
+		CreatedAt: jsonHelpers.RFC3339Nano(now),
+		UpdatedAt: jsonHelpers.RFC3339Nano(now),
+		Call:      &call,
+		Payload:   renderedPayload,
+	}
+
+	req, signingSecret, err := s.request(delivery)
+	if err != nil {
+		return err
+	}
+	return s.queue(req, signingSecret, delivery, true)
+}
+
+// queue stores the delivery and delivers it in the background
+func (s *Sender) queue(req *models.ProfileHTTPCallRequest, signingSecret []byte, delivery *models.WebhookDelivery, isNew bool) error {
+	s.m.Lock()
+	if s.shuttingDown {
+		s.m.Unlock()
+		return ErrShuttingDown
+	}
+	s.inProgress.Add(1)
+	s.m.Unlock()
+
+	// The database might keep a reference to the entry so we always store a copy of the delivery
+	stored := *delivery
+	var err error
+	if isNew {
+		err = s.dbConn.Insert(&stored)
+	} else {
+		err = s.dbConn.UpdateByID(&stored)
+	}
+	if err != nil {
+		s.inProgress.Done()
+		return err
+	}
+
+	go func() {
+		defer s.inProgress.Done()
+		s.deliver(req, signingSecret, delivery)
+	}()
+	return nil
+}
+
+// deliver makes the request and retries it on network errors and 5xx responses
+func (s *Sender) deliver(req *models.ProfileHTTPCallRequest, signingSecret []byte, delivery *models.WebhookDelivery) {
+	logger := log.WithField("delivery_id", delivery.ID.Hex()).WithField("profile_id", delivery.ProfileID.Hex())
+
+	for {
+		statusCode, err := s.attempt(req, signingSecret)
+		delivery.Attempts++
+		delivery.StatusCode = statusCode
+		delivery.LastError = ""
+		if err != nil {
+			delivery.LastError = err.Error()
+		} else if statusCode >= 400 {
+			delivery.LastError = fmt.Sprintf("received status code %d", statusCode)
+		}
+
+		retryable := err != nil || statusCode >= 500
+		switch {
+		case delivery.LastError == "":
+			delivery.Status = models.WebhookDeliveryStatusDelivered
+		case !retryable || delivery.Attempts >= s.opts.MaxAttempts:
+			delivery.Status = models.WebhookDeliveryStatusFailed
+			logger.WithField("attempts", delivery.Attempts).WithField("error", delivery.LastError).Error("unable to deliver webhook")
+		}
+		if delivery.Status != models.WebhookDeliveryStatusPending {
+			// The request is only kept to resume pending deliveries
+			delivery.Call = nil
+			delivery.Payload = nil
+		}
+
+		delivery.UpdatedAt = jsonHelpers.RFC3339Nano(s.now())
+		updated := *delivery
+		updateErr := s.dbConn.UpdateByID(&updated)
+		if updateErr != nil {
+			logger.WithError(updateErr).Error("unable to update webhook delivery log")
+		}
+
+		if delivery.Status != models.WebhookDeliveryStatusPending {
+			return
+		}
+		time.Sleep(s.retryDelay(delivery.Attempts))
+	}
+}
+
+// attempt makes a single request while respecting the concurrency limit of the endpoint
+func (s *Sender) attempt(req *models.ProfileHTTPCallRequest, signingSecret []byte) (int, error) {
+	semaphore := s.endpointSemaphore(req.URI)
+	semaphore <- struct{}{}
+	defer func() { <-semaphore }()
+
+	// Every attempt is signed again so retries are not rejected by the receiver for having an old timestamp
+	headers := map[string]string{}
+	if signingSecret != nil {
+		timestamp := strconv.FormatInt(s.now().Unix(), 10)
+		headers[TimestampHeader] = timestamp
+		headers[SignatureHeader] = crypto.SignaturePrefix + crypto.SignTimestampedPayload(signingSecret, timestamp, req.SignedContent())
+	}
+
+	return req.Do(headers, s.opts.Timeout)
+}
+
+// endpointSemaphore returns the semaphore of the host of uri
+func (s *Sender) endpointSemaphore(uri string) chan struct{} {
+	endpoint := uri
+	parsedURI, err := url.Parse(uri)
+	if err == nil {
+		endpoint = parsedURI.Host
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	semaphore, ok := s.endpoints[endpoint]
+	if !ok {
+		semaphore = make(chan struct{}, s.opts.MaxConcurrentPerEndpoint)
+		s.endpoints[endpoint] = semaphore
+	}
+	return semaphore
+}
+
+// retryDelay returns the delay before the next attempt of a delivery that failed attempts times
+func (s *Sender) retryDelay(attempts int) time.Duration {
+	delay := s.opts.RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// Shutdown stops accepting new webhooks and waits for the deliveries in progress to finish or ctx to expire
+// Deliveries that are not finished are resumed on the next start by ResumeInterruptedDeliveries
+func (s *Sender) Shutdown(ctx context.Context) error {
+	s.m.Lock()
+	s.shuttingDown = true
+	s.m.Unlock()
+
+	err := shutdown.WaitGroup(ctx, &s.inProgress)
+	if err != nil {
+		return fmt.Errorf("not all webhooks are delivered: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	"github.com/script-development/RT-CV/helpers/crypto"
+	"github.com/script-development/RT-CV/models"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func getDeliveries(t *testing.T, conn db.Connection) []models.WebhookDelivery {
+	deliveries, err := models.GetWebhookDeliveries(conn, nil, nil, models.Page{})
+	NoError(t, err)
+	return deliveries
+}
+
+func TestSend(t *testing.T) {
+	received := make(chan models.WebhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Equal(t, "POST", r.Method)
+		Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		NoError(t, err)
+		payload := models.WebhookPayload{}
+		NoError(t, json.Unmarshal(body, &payload))
+		received <- payload
+	}))
+	defer server.Close()
+
+	conn := testingdb.NewDB()
+	s := NewSender(conn, Options{})
+
+	profileID := db.NewM().ID
+	matchID := db.NewM().ID
+	referenceNumber := "123"
+	err := s.Send(
+		models.ProfileHTTPCallData{URI: server.URL, Method: "POST"},
+		models.WebhookPayload{
+			ProfileID: profileID,
+			Match:     models.Match{M: db.M{ID: matchID}},
+			CV:        models.CV{ReferenceNumber: referenceNumber},
+		},
+	)
+	NoError(t, err)
+	NoError(t, s.Shutdown(context.Background()))
+
+	payload := <-received
+	Equal(t, profileID, payload.ProfileID)
+	Equal(t, matchID, payload.Match.ID)
+	Equal(t, referenceNumber, payload.CV.ReferenceNumber)
+
+	deliveries := getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		Equal(t, models.WebhookDeliveryStatusDelivered, deliveries[0].Status)
+		Equal(t, 1, deliveries[0].Attempts)
+		Equal(t, 200, deliveries[0].StatusCode)
+		Equal(t, profileID, deliveries[0].ProfileID)
+		Equal(t, matchID, deliveries[0].MatchID)
+		// The request is only kept while the delivery is pending
+		Nil(t, deliveries[0].Call)
+		Nil(t, deliveries[0].Payload)
+	}
+
+	Equal(t, ErrShuttingDown, s.Send(models.ProfileHTTPCallData{URI: server.URL}, models.WebhookPayload{}))
+}
+
+func TestSendRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	conn := testingdb.NewDB()
+	s := NewSender(conn, Options{RetryDelay: time.Millisecond})
+	NoError(t, s.Send(models.ProfileHTTPCallData{URI: server.URL}, models.WebhookPayload{}))
+	NoError(t, s.Shutdown(context.Background()))
+
+	Equal(t, int32(3), atomic.LoadInt32(&calls))
+	deliveries := getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		Equal(t, models.WebhookDeliveryStatusDelivered, deliveries[0].Status)
+		Equal(t, 3, deliveries[0].Attempts)
+		Empty(t, deliveries[0].LastError)
+	}
+}
+
+func TestSendFails(t *testing.T) {
+	var calls int32
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	// 5xx responses should be retried until MaxAttempts is reached
+	conn := testingdb.NewDB()
+	s := NewSender(conn, Options{RetryDelay: time.Millisecond, MaxAttempts: 3})
+	NoError(t, s.Send(models.ProfileHTTPCallData{URI: server.URL}, models.WebhookPayload{}))
+	NoError(t, s.Shutdown(context.Background()))
+
+	Equal(t, int32(3), atomic.LoadInt32(&calls))
+	deliveries := getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		Equal(t, models.WebhookDeliveryStatusFailed, deliveries[0].Status)
+		Equal(t, 3, deliveries[0].Attempts)
+		Equal(t, 500, deliveries[0].StatusCode)
+		NotEmpty(t, deliveries[0].LastError)
+	}
+
+	// 4xx responses should not be retried
+	atomic.StoreInt32(&calls, 0)
+	status = http.StatusBadRequest
+	conn = testingdb.NewDB()
+	s = NewSender(conn, Options{RetryDelay: time.Millisecond, MaxAttempts: 3})
+	NoError(t, s.Send(models.ProfileHTTPCallData{URI: server.URL}, models.WebhookPayload{}))
+	NoError(t, s.Shutdown(context.Background()))
+
+	Equal(t, int32(1), atomic.LoadInt32(&calls))
+	deliveries = getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		Equal(t, models.WebhookDeliveryStatusFailed, deliveries[0].Status)
+		Equal(t, 400, deliveries[0].StatusCode)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	conn := testingdb.NewDB()
+	s := NewSender(conn, Options{Timeout: time.Millisecond * 20, MaxAttempts: 1})
+	NoError(t, s.Send(models.ProfileHTTPCallData{URI: server.URL}, models.WebhookPayload{}))
+	NoError(t, s.Shutdown(context.Background()))
+
+	deliveries := getDeliveries(t, conn)
+	if Len(t, deliveries, 1) {
+		Equal(t, models.WebhookDeliveryStatusFailed, deliveries[0].Status)
+		Equal(t, 0, deliveries[0].StatusCode)
+		NotEmpty(t, deliveries[0].LastError)
+	}
+}
+
+func TestMaxConcurrentPerEndpoint(t *testing.T) {
+	var m sync.Mutex
+	var current, max int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		current++
+		if current > max {
+			max = current
+		}
+		m.Unlock()
+
+		time.Sleep(time.Millisecond * 10)
+
+		m.Lock()
+		current--
+		m.Unlock()
+	}))
+	defer server.Close()
+
+	conn := testingdb.NewDB()
+	s := NewSender(conn, Options{MaxConcurrentPerEndpoint: 2})
+	for i := 0; i < 8; i++ {
+		NoError(t, s.Send(models.ProfileHTTPCallData{URI: server.URL}, models.WebhookPayload{}))
+	}
+	NoError(t, s.Shutdown(context.Background()))
+
+	LessOrEqual(t, max, 2)
+	Len(t, getDeliveries(t, conn), 8)
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := NewSender(testingdb.NewDB(), Options{RetryDelay: time.Second})
+	Equal(t, time.Second, s.retryDelay(1))
+	Equal(t, time.Second*2, s.retryDelay(2))
+	Equal(t, time.Second*8, s.retryDelay(4))
+}
+
+func TestResumeInterruptedDeliveries(t *testing.T) {
+	secret := "a-very-secret-signing-key"
+	headerValue := "Bearer secret-token"
+	secretsKey := "testing-webhook-secrets-key"
+
+	type request struct {
+		authorization string
+		signature     string
+		body          string
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		NoError(t, err)
+		received <- request{
+			authorization: r.Header.Get("Authorization"),
+			signature:     r.Header.Get(SignatureHeader),
+			body:          string(body),
+		}
+	}))
+	defer server.Close()
+
+	onMatch := models.ProfileOnMatch{HTTPCall: []models.ProfileHTTPCallData{{
+		URI:           server.URL,
+		Method:        "POST",
+		SigningSecret: &secret,
+		Headers:       []models.ProfileHTTPCallHeader{{Name: "Authorization", SecretValue: &headerValue}},
+	}}}
+	s := NewSender(testingdb.NewDB(), Options{SecretsKey: secretsKey})
+	NoError(t, s.EncryptSecrets(&onMatch, nil))
+
+	// The pending delivery is read back from the database like it would be after a restart
+	data, err := bson.Marshal(models.WebhookDelivery{
+		M:       db.NewM(),
+		URI:     server.URL,
+		Status:  models.WebhookDeliveryStatusPending,
+		Call:    &onMatch.HTTPCall[0],
+		Payload: []byte(`{"profileId":"1"}`),
+	})
+	NoError(t, err)
+	pending := &models.WebhookDelivery{}
+	NoError(t, bson.Unmarshal(data, pending))
+	NotContains(t, string(data), headerValue)
+	NotContains(t, string(data), secret)
+
+	notKept := &models.WebhookDelivery{M: db.NewM(), Status: models.WebhookDeliveryStatusPending}
+	delivered := &models.WebhookDelivery{M: db.NewM(), Status: models.WebhookDeliveryStatusDelivered}
+
+	conn := testingdb.NewDB()
+	NoError(t, conn.Insert(pending, notKept, delivered))
+	s = NewSender(conn, Options{SecretsKey: secretsKey})
+	s.ResumeInterruptedDeliveries()
+	NoError(t, s.Shutdown(context.Background()))
+
+	req := <-received
+	Equal(t, headerValue, req.authorization)
+	Equal(t, `{"profileId":"1"}`, req.body)
+	True(t, strings.HasPrefix(req.signature, crypto.SignaturePrefix))
+
+	for _, delivery := range getDeliveries(t, conn) {
+		switch delivery.ID {
+		case pending.ID:
+			Equal(t, models.WebhookDeliveryStatusDelivered, delivery.Status)
+			Equal(t, 1, delivery.Attempts)
+			Nil(t, delivery.Call)
+		case notKept.ID:
+			Equal(t, models.WebhookDeliveryStatusFailed, delivery.Status)
+			NotEmpty(t, delivery.LastError)
+		default:
+			Equal(t, models.WebhookDeliveryStatusDelivered, delivery.Status)
+		}
+	}
+}
+
+func TestSendSigned(t *testing.T) {
+	secret := "a-very-secret-signing-key"
+	secretsKey := "testing-webhook-secrets-key"
+
+	type request struct {
+		timestamp string
+		signature string
+		body      []byte
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		NoError(t, err)
+		received <- request{
+			timestamp: r.Header.Get(TimestampHeader),
+			signature: r.Header.Get(SignatureHeader),
+			body:      body,
+		}
+	}))
+	defer server.Close()
+
+	onMatch := models.ProfileOnMatch{HTTPCall: []models.ProfileHTTPCallData{{URI: server.URL, SigningSecret: &secret}}}
+	s := NewSender(testingdb.NewDB(), Options{SecretsKey: secretsKey})
+	NoError(t, s.EncryptSecrets(&onMatch, nil))
+
+	now := time.Unix(1600000000, 0)
+	s.now = func() time.Time { return now }
+	NoError(t, s.Send(onMatch.HTTPCall[0], models.WebhookPayload{}))
+	NoError(t, s.Shutdown(context.Background()))
+
+	req := <-received
+	Equal(t, "1600000000", req.timestamp)
+	True(t, strings.HasPrefix(req.signature, "sha256="))
+	// The header value can be verified as is
+	True(t, crypto.VerifyTimestampedPayload([]byte(secret), req.timestamp, req.body, req.signature))
+	False(t, crypto.VerifyTimestampedPayload([]byte(secret), req.timestamp, append(req.body, ' '), req.signature))
+
+	// Without a signing secret the request should not be signed
+	s = NewSender(testingdb.NewDB(), Options{SecretsKey: secretsKey})
+	NoError(t, s.Send(models.ProfileHTTPCallData{URI: server.URL}, models.WebhookPayload{}))
+	NoError(t, s.Shutdown(context.Background()))
+	req = <-received
+	Empty(t, req.timestamp)
+	Empty(t, req.signature)
+
+	// A sender with another secrets key cannot decrypt the signing secret
+	s = NewSender(testingdb.NewDB(), Options{SecretsKey: "another-webhook-secrets-key"})
+	Error(t, s.Send(onMatch.HTTPCall[0], models.WebhookPayload{}))
+}
+
+func TestEncryptSecretsWithoutSecretsKey(t *testing.T) {
+	secret := "a-very-secret-signing-key"
+	onMatch := models.ProfileOnMatch{HTTPCall: []models.ProfileHTTPCallData{{URI: "https://example.com", SigningSecret: &secret}}}
+	Error(t, NewSender(testingdb.NewDB(), Options{}).EncryptSecrets(&onMatch, nil))
+}
@@ -0,0 +1,167 @@
+package wordvalidator
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// minStemLen is the minimal length of a stem, suffixes are not removed if the stem would become shorter than this
+const minStemLen = 3
+
+// dutchSuffixes contains the suffixes removed by Stem, the longest suffixes are checked first
+var dutchSuffixes = []struct {
+	suffix      string
+	replacement string
+	// afterConsonant tells if the suffix is only removed when it follows a consonant
+	afterConsonant bool
+}{
+	{"heden", "heid", false},
+	{"sters", "", false},
+	{"ster", "", false},
+	{"ers", "", false},
+	{"er", "", false},
+	{"en", "", true},
+	{"s", "", true},
+	{"e", "", true},
+}
+
+// dutchCompoundHeads contains common last parts of dutch compound words
+// Most of these are the last part of job titles like verkoopmedewerker or vrachtwagenchauffeur
+var dutchCompoundHeads = []string{
+	"adviseur",
+	"assistent",
+	"begeleider",
+	"beheerder",
+	"chauffeur",
+	"consultant",
+	"coordinator",
+	"docent",
+	"engineer",
+	"kundige",
+	"leider",
+	"manager",
+	"medewerker",
+	"medewerkster",
+	"monteur",
+	"ontwikkelaar",
+	"operator",
+	"planner",
+	"specialist",
+	"technicus",
+	"verkoper",
+	"verzorgende",
+}
+
+func init() {
+	// Check the longest heads first so begeleider is not split into bege and leider
+	sort.SliceStable(dutchCompoundHeads, func(a, b int) bool {
+		return len(dutchCompoundHeads[a]) > len(dutchCompoundHeads[b])
+	})
+}
+
+func isVowel(c byte) bool {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	default:
+		return false
+	}
+}
+
+func endsWithConsonant(word string) bool {
+	if len(word) == 0 {
+		return false
+	}
+	c := word[len(word)-1]
+	return c >= 'a' && c <= 'z' && !isVowel(c)
+}
+
+// Stem reduces a normalized dutch word to its stem
+// This is a light stemmer meant for matching words, the stems are not always real words.
+// For example medewerker, medewerkers and medewerkster all become medewerk
+func Stem(word string) string {
+	stem := word
+	for _, suffix := range dutchSuffixes {
+		if !strings.HasSuffix(stem, suffix.suffix) {
+			continue
+		}
+		base := stem[:len(stem)-len(suffix.suffix)]
+		if utf8.RuneCountInString(base) < minStemLen || suffix.afterConsonant && !endsWithConsonant(base) {
+			continue
+		}
+		stem = base + suffix.replacement
+		break
+	}
+
+	if len(stem) < minStemLen {
+		return stem
+	}
+
+	// administratiev(e) > administratief and huiz(en) > huis
+	switch stem[len(stem)-1] {
+	case 'v':
+		stem = stem[:len(stem)-1] + "f"
+	case 'z':
+		stem = stem[:len(stem)-1] + "s"
+	}
+
+	// bakk(er) > bak
+	last := stem[len(stem)-1]
+	if endsWithConsonant(stem) && stem[len(stem)-2] == last && len(stem) > minStemLen {
+		stem = stem[:len(stem)-1]
+	}
+
+	// verkoop > verkop, so it equals the stem of verkoper
+	l := len(stem)
+	if l > minStemLen && endsWithConsonant(stem) && isVowel(stem[l-2]) && stem[l-2] == stem[l-3] && stem[l-2] != 'i' && stem[l-2] != 'y' {
+		stem = stem[:l-2] + stem[l-1:]
+	}
+
+	return stem
+}
+
+// dutchCompoundHeadInflections contains the endings that can follow a compound head, like the plural s in chauffeurs
+var dutchCompoundHeadInflections = []string{"", "s", "n", "en"}
+
+// SplitCompound splits a normalized dutch compound word into its parts
+// Only compounds ending with a known (possibly inflected) head are split, for example vrachtwagenchauffeurs becomes vrachtwagen and chauffeurs
+// The linking s (as in storingscoordinator) is removed from the first part
+func SplitCompound(word string) []string {
+	for _, head := range dutchCompoundHeads {
+		for _, inflection := range dutchCompoundHeadInflections {
+			inflectedHead := head + inflection
+			if !strings.HasSuffix(word, inflectedHead) {
+				continue
+			}
+
+			prefix := word[:len(word)-len(inflectedHead)]
+			if strings.HasSuffix(prefix, "s") && utf8.RuneCountInString(prefix) > minStemLen {
+				prefix = prefix[:len(prefix)-1]
+			}
+			if utf8.RuneCountInString(prefix) < minStemLen {
+				// The word is the head itself or the prefix is too short to be a word
+				return []string{word}
+			}
+			return append(SplitCompound(prefix), inflectedHead)
+		}
+	}
+	return []string{word}
+}
+
+// NormalizeForMatching normalizes the input so it can be used by the fuzzy matcher
+// On top of NormalizeString compound words are split and every word is stemmed,
+// this makes "Verkoop medewerkster" and "verkoopmedewerker" equal
+func NormalizeForMatching(inStr string) string {
+	words := strings.Split(NormalizeString(inStr), " ")
+	res := make([]string, 0, len(words))
+	for _, word := range words {
+		if len(word) == 0 {
+			continue
+		}
+		for _, part := range SplitCompound(word) {
+			res = append(res, Stem(part))
+		}
+	}
+	return strings.Join(res, " ")
+}
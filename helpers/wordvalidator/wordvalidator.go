@@ -2,21 +2,34 @@ package wordvalidator
 
 import (
 	"strings"
+	"unicode"
 	"unicode/utf8"
 	"unsafe"
 
 	"github.com/agnivade/levenshtein"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 // IsSame returns if a is somewhat equal to b
+// Both inputs are normalized first so differences in casing, diacritics and punctuation are ignored
 func IsSame(a, b string) bool {
 	if strings.EqualFold(a, b) {
 		return true
 	}
 
+	a = NormalizeString(a)
+	b = NormalizeString(b)
+	if a == b {
+		return true
+	}
+
 	maxDiff := 1
 
-	minLen := min(len(a), len(b))
+	aLen := utf8.RuneCountInString(a)
+	bLen := utf8.RuneCountInString(b)
+	minLen := min(aLen, bLen)
 	if minLen > 48 {
 		maxDiff = 8
 	} else if minLen > 16 {
@@ -27,7 +40,7 @@ func IsSame(a, b string) bool {
 		maxDiff = 2
 	}
 
-	lenDiff := len(a) - len(b)
+	lenDiff := aLen - bLen
 	if lenDiff > maxDiff || lenDiff < -maxDiff {
 		return false
 	}
@@ -49,11 +62,19 @@ func min(a, b int) int {
 // - Spaces around the string are removed
 // - Non number and non letter characters are removed
 // - Uppercase characters are converted to lowercase
+// - Diacritics are removed and compatibility characters (like fullwidth letters) are converted to their normal form
 func NormalizeString(inStr string) string {
 	if len(inStr) == 0 {
 		return ""
 	}
 
+	for idx := 0; idx < len(inStr); idx++ {
+		if inStr[idx] >= utf8.RuneSelf {
+			return normalizeUnicodeString(inStr)
+		}
+	}
+
+	// The input only contains ascii characters so we can take the fast path
 	inBytes := []byte(inStr)
 
 	for idx := len(inBytes) - 1; idx >= 0; idx-- {
@@ -94,6 +115,51 @@ func NormalizeString(inStr string) string {
 	return b2s(inBytes)
 }
 
+// unfoldableLetters contains letters that are not removed by removing the diacritics but do have a common ascii form
+var unfoldableLetters = strings.NewReplacer(
+	"ß", "ss",
+	"æ", "ae",
+	"Æ", "ae",
+	"œ", "oe",
+	"Œ", "oe",
+	"ø", "o",
+	"Ø", "o",
+	"ł", "l",
+	"Ł", "l",
+	"đ", "d",
+	"Đ", "d",
+)
+
+// normalizeUnicodeString does the same as NormalizeString but also supports non ascii input
+func normalizeUnicodeString(inStr string) string {
+	// NFKD splits letters with diacritics into the letter and the diacritic and converts compatibility characters,
+	// after that we can remove the diacritics (the nonspacing marks)
+	// The transformer is created here as it's not safe for concurrent use
+	folder := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(folder, unfoldableLetters.Replace(inStr))
+	if err != nil {
+		folded = inStr
+	}
+
+	var res strings.Builder
+	res.Grow(len(folded))
+	pendingSpace := false
+	for _, c := range folded {
+		switch {
+		case unicode.IsSpace(c):
+			pendingSpace = res.Len() > 0
+		case unicode.IsLetter(c) || unicode.IsNumber(c):
+			if pendingSpace {
+				res.WriteByte(' ')
+				pendingSpace = false
+			}
+			res.WriteRune(unicode.ToLower(c))
+		}
+	}
+
+	return res.String()
+}
+
 // b2s converts a byte slice to a string without copying
 // Note that this will mean that changes made after to the byte slice will be reflected in the string and visa versa
 func b2s(b []byte) string {
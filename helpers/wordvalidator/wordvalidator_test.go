@@ -19,6 +19,12 @@ func TestNormalizeString(t *testing.T) {
 		{"duplicated spaces should reduced to 1 space", "A  B   C", "a b c"},
 		{"new line and tab characters should be replace by a space", "A\nB\tC", "a b c"},
 		{"special characters should be removed", "a+b-c(d)", "abcd"},
+		{"diacritics should be removed", "Verpléégkundige coördinator", "verpleegkundige coordinator"},
+		{"fullwidth characters should be converted", "Ｖｅｒｐｌｅｅｇｋｕｎｄｉｇｅ", "verpleegkundige"},
+		{"letters without diacritics should be converted to ascii", "Straße Ærø", "strasse aero"},
+		{"unicode spaces should be replaced by a space", "a\u00a0\u2003b", "a b"},
+		{"unicode punctuation should be removed", "«café»—bar", "cafebar"},
+		{"non latin letters should be kept", "Ωмега", "ωмега"},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -94,6 +100,70 @@ var professions = []Profession{
 	},
 }
 
+func TestStem(t *testing.T) {
+	testCases := map[string]string{
+		"medewerker":      "medewerk",
+		"medewerkers":     "medewerk",
+		"medewerkster":    "medewerk",
+		"medewerksters":   "medewerk",
+		"administratieve": "administratief",
+		"administratief":  "administratief",
+		"bakker":          "bak",
+		"bakkers":         "bak",
+		"verkoper":        "verkop",
+		"verkoop":         "verkop",
+		"chauffeurs":      "chauffeur",
+		"huizen":          "huis",
+		"mogelijkheden":   "mogelijkheid",
+		"kok":             "kok",
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, wordvalidator.Stem(input), input)
+	}
+}
+
+func TestSplitCompound(t *testing.T) {
+	testCases := map[string][]string{
+		"vrachtwagenchauffeur":  {"vrachtwagen", "chauffeur"},
+		"storingscoordinator":   {"storing", "coordinator"},
+		"verkoopmedewerkster":   {"verkoop", "medewerkster"},
+		"verpleegkundige":       {"verpleeg", "kundige"},
+		"begeleider":            {"begeleider"},
+		"chauffeur":             {"chauffeur"},
+		"timmerman":             {"timmerman"},
+		"kassamedewerker":       {"kassa", "medewerker"},
+		"verpleegkundigen":      {"verpleeg", "kundigen"},
+		"vrachtwagenchauffeurs": {"vrachtwagen", "chauffeurs"},
+		"klantenservicemanager": {"klantenservice", "manager"},
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, wordvalidator.SplitCompound(input), input)
+	}
+}
+
+func TestNormalizeForMatching(t *testing.T) {
+	for _, profession := range professions {
+		expected := wordvalidator.NormalizeForMatching(profession.Name)
+		for _, alternative := range profession.Alternatives {
+			assert.Equal(t, expected, wordvalidator.NormalizeForMatching(alternative), alternative)
+		}
+		for _, forbidden := range profession.ForbiddenWords {
+			assert.NotEqual(t, expected, wordvalidator.NormalizeForMatching(forbidden), forbidden)
+		}
+	}
+
+	assert.Equal(t, "", wordvalidator.NormalizeForMatching(" !? "))
+}
+
+func TestIsSameUnicode(t *testing.T) {
+	assert.True(t, wordvalidator.IsSame("Verpléégkundige", "verpleegkundige"))
+	assert.True(t, wordvalidator.IsSame("Ｃａｆé", "cafe"))
+	// The allowed difference should be based on the amount of runes, not bytes
+	// these words differ 2 runes (4 bytes) where only 1 rune is allowed for words of 5 runes
+	assert.False(t, wordvalidator.IsSame("ωмега", "ωмегаωм"))
+	assert.True(t, wordvalidator.IsSame("ωмега", "ωмегаω"))
+}
+
 func TestCaseSentitivity(t *testing.T) {
 	str1 := "AdmInIStrAtiEf medewerker"
 	str2 := "administratief Medewerker"
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -18,9 +19,16 @@ import (
 	"github.com/script-development/RT-CV/db"
 	"github.com/script-development/RT-CV/db/mongo"
 	"github.com/script-development/RT-CV/db/mongo/backup"
+	"github.com/script-development/RT-CV/helpers/emailDigest"
 	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/geo"
+	"github.com/script-development/RT-CV/helpers/match"
+	"github.com/script-development/RT-CV/helpers/matchesProcessor"
+	"github.com/script-development/RT-CV/helpers/profilesCache"
 	"github.com/script-development/RT-CV/helpers/random"
 	"github.com/script-development/RT-CV/helpers/requestLogger"
+	"github.com/script-development/RT-CV/helpers/shutdown"
+	"github.com/script-development/RT-CV/helpers/webhooks"
 	"github.com/script-development/RT-CV/mock"
 	"github.com/script-development/RT-CV/models"
 )
@@ -45,27 +53,21 @@ func main() {
 	// Seed the random package so generated values are "actually" random
 	random.Seed()
 
+	exitSignal := make(chan os.Signal, 1)
+	signal.Notify(exitSignal, syscall.SIGINT, syscall.SIGTERM)
+
+	var cpuProfile *os.File
 	if doProfile {
-		f, err := os.Create("cpu.profile")
+		var err error
+		cpuProfile, err = os.Create("cpu.profile")
 		if err != nil {
 			log.WithField("error", err).Fatal("could not create cpu profile")
 		}
 
-		err = pprof.StartCPUProfile(f)
+		err = pprof.StartCPUProfile(cpuProfile)
 		if err != nil {
 			log.WithField("error", err).Fatal("could not start CPU profile")
 		}
-
-		exitSignal := make(chan os.Signal, 1)
-		signal.Notify(exitSignal, syscall.SIGINT, syscall.SIGTERM)
-		go func() {
-			<-exitSignal
-			pprof.StopCPUProfile()
-			_ = f.Close()
-			fmt.Println("saved cpu profile to cpu.profile")
-			fmt.Println("the profile can be inspected using: go tool pprof -http localhost:3333 cpu.profile")
-			os.Exit(0)
-		}()
 	}
 
 	// Loading the .env if available
@@ -79,13 +81,29 @@ func main() {
 		log.Info("No .env file found")
 	}
 
-	// Initialize the mail service
-	err = emailservice.Setup(emailservice.EmailServerConfigurationFromEnv(), nil)
+	// Initialize the mail transport, the email service itself is created once the database is available
+	emailTransport, err := emailservice.TransportFromEnv()
 	if err != nil {
 		log.WithError(err).Error("Error initializing email service")
 		os.Exit(1)
 	}
 
+	// Configure the matcher
+	matcherConfig := match.ConfigFromEnv()
+	match.SetConfig(matcherConfig)
+	if matcherConfig.DisableAgeMatching {
+		log.Info("Age matching is disabled, the age criteria of profiles are ignored")
+	}
+
+	// Load the complete centroids of the dutch postcodes used by the zip radiuses of profiles
+	pc4CentroidsFile := os.Getenv("PC4_CENTROIDS_FILE")
+	if pc4CentroidsFile != "" {
+		err := geo.LoadPC4CentroidsFile(pc4CentroidsFile)
+		if err != nil {
+			log.Fatalf("Error loading PC4_CENTROIDS_FILE: %s", err.Error())
+		}
+	}
+
 	// Initialize the database
 	var dbConn db.Connection
 	useTestingDB := strings.ToLower(os.Getenv("USE_TESTING_DB")) == "true"
@@ -109,6 +127,13 @@ func main() {
 		&models.Secret{},
 		&models.Match{},
 		&models.Backup{},
+		&models.SynonymSet{},
+		&models.MatchJob{},
+		&models.WebhookDelivery{},
+		&models.DigestMatch{},
+		&models.EmailTemplate{},
+		&models.EmailDelivery{},
+		&models.EmailAttachmentContent{},
 	)
 
 	backupEnabled := strings.ToLower(os.Getenv("MONGODB_BACKUP_ENABLED")) == "true"
@@ -122,6 +147,27 @@ func main() {
 
 	models.CheckDashboardKeyExists(dbConn)
 
+	// The profiles used for matching, shared by the api routes and the profiles deactivation schedule
+	cache := profilesCache.NewCache(dbConn, profilesCache.TTLFromEnv())
+
+	models.StartProfilesDeactivationSchedule(dbConn, cache)
+
+	// Webhooks that were still pending during the last shutdown are delivered again
+	webhookSender := webhooks.NewSender(dbConn, webhooks.OptionsFromEnv())
+	webhookSender.ResumeInterruptedDeliveries()
+
+	// Emails that were still queued during the last shutdown are sent again
+	emailService := emailservice.NewService(dbConn, emailTransport, emailservice.OptionsFromEnv())
+	emailService.ResumeInterruptedDeliveries()
+
+	// Start processing the matches, this also resumes the matches that were not processed before the last shutdown
+	processor := matchesProcessor.NewProcessor(dbConn, matchesProcessor.OptionsFromEnv(), webhookSender, emailService)
+	processor.Start()
+
+	// Send the hourly and daily digest emails, digests that were due during a restart are sent right away
+	digestScheduler := emailDigest.NewScheduler(dbConn, emailService, emailDigest.OptionsFromEnv())
+	digestScheduler.Start()
+
 	// Create a new fiber instance (http server)
 	// do not use fiber Prefork!, this app is not written to support it
 	app := fiber.New(fiber.Config{
@@ -134,7 +180,7 @@ func main() {
 		c.Set("X-App-Version", AppVersion)
 		return err
 	})
-	app.Use(controller.InsertData(dbConn))
+	app.Use(controller.InsertData(dbConn, processor, webhookSender, emailService, cache))
 	app.Use(requestLogger.New())
 
 	// Setup the app routes
@@ -147,5 +193,48 @@ func main() {
 	}
 
 	// Start the webserver
-	log.Fatal(app.Listen(":4000").Error())
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":4000")
+	}()
+
+	select {
+	case err = <-listenErr:
+		log.Fatal(err.Error())
+	case <-exitSignal:
+	}
+
+	// Finish the work in progress before exiting
+	// The exit code is 1 if there is work left that was not finished within the shutdown timeout
+	log.Info("Received exit signal, shutting down..")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdown.TimeoutFromEnv())
+	shutdownOk := shutdown.Run(
+		shutdownCtx,
+		shutdown.Step{Name: "accepting CVs", Fn: func(context.Context) error {
+			processor.StopAccepting()
+			return nil
+		}},
+		shutdown.Step{Name: "webserver", Fn: func(ctx context.Context) error {
+			return shutdown.Wait(ctx, app.Shutdown)
+		}},
+		shutdown.Step{Name: "matches processor", Fn: processor.Shutdown},
+		shutdown.Step{Name: "webhooks", Fn: webhookSender.Shutdown},
+		shutdown.Step{Name: "email digests", Fn: digestScheduler.Shutdown},
+		shutdown.Step{Name: "email service", Fn: emailService.Shutdown},
+		shutdown.Step{Name: "backups", Fn: backup.Shutdown},
+	)
+	cancelShutdown()
+
+	if cpuProfile != nil {
+		pprof.StopCPUProfile()
+		_ = cpuProfile.Close()
+		fmt.Println("saved cpu profile to cpu.profile")
+		fmt.Println("the profile can be inspected using: go tool pprof -http localhost:3333 cpu.profile")
+	}
+
+	if !shutdownOk {
+		log.Error("Shutdown finished with unfinished work")
+		os.Exit(1)
+	}
+	log.Info("Shutdown finished")
 }
@@ -85,7 +85,7 @@ func init() {
 				{Email: "example@script.nl"},
 			},
 		},
-		Zipcodes: []models.ProfileDutchZipcode{{
+		Zipcodes: []models.ProfileZipcode{{
 			From: 2000,
 			To:   8000,
 		}},
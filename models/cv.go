@@ -1,7 +1,6 @@
 package models
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,10 +9,13 @@ import (
 	"os/exec"
 	"path"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mjarkk/jsonschema"
 	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/locale"
 )
 
 // CV contains all information that belongs to a curriculum vitae
@@ -27,10 +29,11 @@ type CV struct {
 	WorkExperiences      []WorkExperience             `json:"workExperiences,omitempty"`
 	PreferredJobs        []string                     `json:"preferredJobs,omitempty"`
 	Languages            []Language                   `json:"languages,omitempty"`
-	Competences          []Competence                 `json:"-"` // Not supported yet
-	Interests            []Interest                   `json:"-"` // Not supported yet
+	Competences          []Competence                 `json:"competences,omitempty" description:"The things the candidate is good at, matched against the skills of a profile"`
+	Interests            []Interest                   `json:"interests,omitempty"`
 	PersonalDetails      PersonalDetails              `json:"personalDetails" jsonSchema:"notRequired"`
-	PersonalPresentation string                       `json:"-"` // Not supported yet
+	PersonalPresentation string                       `json:"personalPresentation,omitempty" jsonSchema:"notRequired" description:"A short text in which the candidate presents themself"`
+	AvailableFrom        *jsonHelpers.RFC3339Nano     `json:"availableFrom,omitempty" jsonSchema:"notRequired" description:"From when the candidate is available for work, if not set the candidate is assumed to be available now"`
 	DriversLicenses      []jsonHelpers.DriversLicense `json:"driversLicenses,omitempty"`
 }
 
@@ -83,6 +86,20 @@ func (ll LanguageLevel) String() string {
 	}
 }
 
+// Localized returns the lowercase name of the language level in the language of l
+func (ll LanguageLevel) Localized(l locale.Locale) string {
+	switch ll {
+	case LanguageLevelReasonable:
+		return l.T(locale.MsgLanguageLevelReasonable)
+	case LanguageLevelGood:
+		return l.T(locale.MsgLanguageLevelGood)
+	case LanguageLevelExcellent:
+		return l.T(locale.MsgLanguageLevelExcellent)
+	default:
+		return l.T(locale.MsgLanguageLevelUnknown)
+	}
+}
+
 const langLevelDescription = `0. Unknown
 1. Reasonable
 2. Good
@@ -165,36 +182,6 @@ func getTemplateFromFile(funcs template.FuncMap, filename string) (*template.Tem
 	return tmpl, nil
 }
 
-// GetEmailHTML generates a HTML document that is used as email body
-func (cv *CV) GetEmailHTML(profile Profile, matchText, domain string) (*bytes.Buffer, error) {
-	tmpl, err := getTemplateFromFile(template.FuncMap{}, "email-template.html")
-	if err != nil {
-		return nil, err
-	}
-
-	input := struct {
-		Profile   Profile
-		Cv        *CV
-		MatchText string
-		LogoURL   string
-		Domain    string
-
-		// The normal `Profile.ID.String()`` is more of a debug value than a real id value so we add the hex to this field
-		ProfileIDHex string
-	}{
-		Profile:      profile,
-		ProfileIDHex: profile.ID.Hex(),
-		Cv:           cv,
-		MatchText:    matchText,
-		LogoURL:      os.Getenv("EMAIL_LOGO_URL"),
-		Domain:       domain,
-	}
-
-	buff := bytes.NewBuffer(nil)
-	err = tmpl.Execute(buff, input)
-	return buff, err
-}
-
 // GetPDF generates a PDF from a cv that can be send
 // the pdfGeneratorProjectPath argument can be used to define the path to the pdf generator project
 func (cv *CV) GetPDF(options *PdfOptions, pdfGeneratorProjectPath *string) (*os.File, error) {
@@ -278,6 +265,9 @@ func (cv *CV) GetPDF(options *PdfOptions, pdfGeneratorProjectPath *string) (*os.
 	return pdfFile, nil
 }
 
+// maxPersonalPresentationLength is the maximum amount of characters of a personal presentation
+const maxPersonalPresentationLength = 10000
+
 // Validate validates the cv and returns an error if it's not valid
 func (cv *CV) Validate() error {
 	// TODO: Needs more validation
@@ -308,6 +298,20 @@ func (cv *CV) Validate() error {
 		}
 	}
 
+	for idx, competence := range cv.Competences {
+		if len(strings.TrimSpace(competence.Name)) == 0 {
+			return fmt.Errorf("competences.%d.name can't be empty", idx)
+		}
+	}
+	for idx, interest := range cv.Interests {
+		if len(strings.TrimSpace(interest.Name)) == 0 {
+			return fmt.Errorf("interests.%d.name can't be empty", idx)
+		}
+	}
+	if utf8.RuneCountInString(cv.PersonalPresentation) > maxPersonalPresentationLength {
+		return fmt.Errorf("personalPresentation can't be longer than %d characters", maxPersonalPresentationLength)
+	}
+
 	return nil
 }
 
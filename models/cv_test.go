@@ -5,47 +5,18 @@ import (
 	"os"
 	"path"
 	"strings"
-	"sync"
 	"testing"
 
-	"github.com/apex/log"
-	"github.com/joho/godotenv"
 	"github.com/script-development/RT-CV/db"
-	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/locale"
 	. "github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func tryLoadEmailEnv() {
-	envFileName := ".env"
-	_, err := os.Stat(envFileName)
-	if err != nil {
-		envFileName = "../.env"
-		_, err = os.Stat(envFileName)
-		if err != nil {
-			return
-		}
-	}
-
-	env, err := godotenv.Read(envFileName)
-	if err != nil {
-		return
-	}
-
-	// Set mail env vars
-	for key, value := range env {
-		if !strings.HasPrefix(key, "EMAIL_") {
-			continue
-		}
-		if os.Getenv(key) != "" {
-			continue
-		}
-		os.Setenv(key, value)
-	}
-}
-
-func TestGetEmailHTML(t *testing.T) {
-	matchTest := "this is a test text that should re-appear in the response html"
+func TestGetMatchEmail(t *testing.T) {
+	skill := "this is a test skill that should re-appear in the response html"
+	aMatch := Match{Skill: &skill}
+	matchTest := aMatch.GetMatchSentence()
 
 	cv := ExampleCV()
 
@@ -55,10 +26,11 @@ func TestGetEmailHTML(t *testing.T) {
 		Name: "profile name",
 	}
 
-	htmlBuff, err := cv.GetEmailHTML(profile, matchTest, "example.org")
+	content, err := cv.GetMatchEmail(nil, profile, aMatch, "example.org")
 	NoError(t, err)
+	Equal(t, "Nieuwe match voor profile name", content.Subject)
 
-	html := htmlBuff.String()
+	html := content.HTML
 	Contains(t, html, matchTest)
 	Contains(t, html, cv.PersonalDetails.FirstName+" "+cv.PersonalDetails.SurName)
 	Contains(t, html, cv.PersonalDetails.Email)
@@ -67,6 +39,44 @@ func TestGetEmailHTML(t *testing.T) {
 	Contains(t, html, cv.ReferenceNumber)
 	Contains(t, html, profile.ID.Hex())
 	Contains(t, html, "example.org")
+	Contains(t, html, cv.Competences[0].Name)
+	Contains(t, html, cv.Interests[0].Name)
+	Contains(t, html, cv.PersonalPresentation)
+	Contains(t, html, `lang="nl"`)
+
+	profile.Locale = locale.EN
+	content, err = cv.GetMatchEmail(nil, profile, aMatch, "example.org")
+	NoError(t, err)
+	Equal(t, "New match for profile name", content.Subject)
+	Contains(t, content.HTML, aMatch.GetLocalizedMatchSentence(locale.EN))
+	Contains(t, content.HTML, "Candidate name")
+	Contains(t, content.HTML, `lang="en"`)
+}
+
+func TestCVValidate(t *testing.T) {
+	validCV := func() CV {
+		return CV{
+			ReferenceNumber:      "1",
+			Competences:          []Competence{{Name: "Stressbestendig"}},
+			Interests:            []Interest{{Name: "Muziek", Description: "Speelt gitaar"}},
+			PersonalPresentation: "Gedreven en enthousiast",
+		}
+	}
+
+	cv := validCV()
+	NoError(t, cv.Validate())
+
+	cv = validCV()
+	cv.Competences = append(cv.Competences, Competence{Description: "no name"})
+	EqualError(t, cv.Validate(), "competences.1.name can't be empty")
+
+	cv = validCV()
+	cv.Interests[0].Name = " "
+	EqualError(t, cv.Validate(), "interests.0.name can't be empty")
+
+	cv = validCV()
+	cv.PersonalPresentation = strings.Repeat("a", maxPersonalPresentationLength+1)
+	Error(t, cv.Validate())
 }
 
 func getBaseProjectPath() string {
@@ -151,43 +161,34 @@ func TestGetNewEmailAttachmentPDF(t *testing.T) {
 	}
 }
 
-func TestSendMail(t *testing.T) {
-	tryLoadEmailEnv()
-
-	emailConf := emailservice.EmailServerConfigurationFromEnv()
-	if emailConf.Host == "" || emailConf.From == "" {
-		t.Skip("Missing email server env variables to test sending emails")
-	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-
-	// Initialize the mail service
-	err := emailservice.Setup(
-		emailConf,
-		func(err error) {
-			NoError(t, err)
-			wg.Done()
-		},
-	)
-	if err != nil {
-		log.WithError(err).Error("Error initializing email service")
-		return
-	}
-
+func TestNewEmailMessage(t *testing.T) {
 	cv := ExampleCV()
 	profile := Profile{
 		M:    db.M{ID: primitive.NewObjectID()},
 		Name: "profile name",
 	}
 
-	emailBody, err := cv.GetEmailHTML(profile, "on data from the void", "example.org")
+	emailContent, err := cv.GetMatchEmail(nil, profile, Match{}, "example.org")
+	NoError(t, err)
+
+	pdfFile, err := os.CreateTemp("", "match-*.pdf")
+	NoError(t, err)
+	defer os.Remove(pdfFile.Name())
+	_, err = pdfFile.WriteString("pdf content")
 	NoError(t, err)
 
 	emailToSendData := &ProfileSendEmailData{Email: "example@localhost"}
-	err = emailToSendData.SendEmail(profile, emailBody.Bytes(), nil)
+	message, err := emailToSendData.NewEmailMessage(emailContent, pdfFile)
 	NoError(t, err)
+	Equal(t, []string{"example@localhost"}, message.To)
+	Equal(t, emailContent.Subject, message.Subject)
+	NotEmpty(t, message.Text)
+	if Len(t, message.Attachments, 1) {
+		Equal(t, "match.pdf", message.Attachments[0].Filename)
+		Equal(t, "pdf content", string(message.Attachments[0].Content))
+	}
 
-	// Wait for the email to succeed
-	wg.Wait()
+	message, err = emailToSendData.NewEmailMessage(emailContent, nil)
+	NoError(t, err)
+	Empty(t, message.Attachments)
 }
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/locale"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DigestMatch is a match waiting to be sent as part of a digest email to an email address of a profile
+// The digest matches are removed once the digest email is sent
+type DigestMatch struct {
+	db.M        `bson:",inline"`
+	Email       string               `json:"email"`
+	Delivery    ProfileEmailDelivery `json:"delivery"`
+	ProfileID   primitive.ObjectID   `json:"profileId" bson:"profileId"`
+	ProfileName string               `json:"profileName" bson:"profileName"`
+	PdfOptions  *PdfOptions          `json:"pdfOptions" bson:"pdfOptions,omitempty"`
+	KeyName     string               `json:"keyName" bson:"keyName"`
+	Locale      locale.Locale        `json:"locale" bson:"locale,omitempty"`
+	// EmailTemplateID is the digest email template of the profile
+	EmailTemplateID *primitive.ObjectID     `json:"emailTemplateId" bson:"emailTemplateId,omitempty"`
+	Match           Match                   `json:"match"`
+	CV              CV                      `json:"cv"`
+	CreatedAt       jsonHelpers.RFC3339Nano `json:"createdAt" bson:"createdAt"`
+}
+
+// CollectionName returns the collection name of the DigestMatch
+func (*DigestMatch) CollectionName() string {
+	return "digestMatches"
+}
+
+// Indexes implements db.Entry
+func (*DigestMatch) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.M{"delivery": 1}},
+		{Keys: bson.M{"email": 1}},
+		{Keys: bson.M{"createdAt": 1}},
+	}
+}
+
+// NewDigestMatch creates a digest match of aMatch for the email address mail of profile
+func NewDigestMatch(now time.Time, mail ProfileSendEmailData, profile Profile, aMatch Match, cv CV, keyName string) *DigestMatch {
+	return &DigestMatch{
+		M:               db.NewM(),
+		Email:           mail.Email,
+		Delivery:        mail.Delivery,
+		ProfileID:       profile.ID,
+		ProfileName:     profile.Name,
+		PdfOptions:      profile.OnMatch.PdfOptions,
+		KeyName:         keyName,
+		Locale:          profile.Locale,
+		EmailTemplateID: profile.DigestEmailTemplateID,
+		Match:           aMatch,
+		CV:              cv,
+		CreatedAt:       jsonHelpers.RFC3339Nano(now),
+	}
+}
+
+// GetDigestMatchesBefore returns the digest matches with delivery created before the given time, the oldest first
+func GetDigestMatchesBefore(conn db.Connection, delivery ProfileEmailDelivery, before time.Time) ([]DigestMatch, error) {
+	matches := []DigestMatch{}
+	err := conn.Find(&DigestMatch{}, &matches, bson.M{
+		"delivery":  delivery,
+		"createdAt": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.Time().Before(matches[j].CreatedAt.Time())
+	})
+	return matches, nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestGetDigestEmail(t *testing.T) {
+	now := time.Now()
+	cv := ExampleCV()
+	otherCV := ExampleCV()
+	otherCV.ReferenceNumber = "other-reference-number"
+
+	profile := Profile{M: db.NewM(), Name: "profile name"}
+	mail := ProfileSendEmailData{Email: "a@example.com", Delivery: ProfileEmailDeliveryDaily}
+	matches := []DigestMatch{
+		*NewDigestMatch(now, mail, profile, Match{}, *cv, "example.org"),
+		*NewDigestMatch(now, mail, profile, Match{}, *otherCV, "example.org"),
+	}
+
+	content, err := GetDigestEmail(nil, matches)
+	NoError(t, err)
+	Equal(t, "2 nieuwe matches", content.Subject)
+
+	html := content.HTML
+	Contains(t, html, "2 nieuwe matches")
+	Contains(t, html, cv.PersonalDetails.FirstName+" "+cv.PersonalDetails.SurName)
+	Contains(t, html, cv.PersonalDetails.Email)
+	Contains(t, html, profile.Name)
+	Contains(t, html, "example.org")
+	Contains(t, html, cv.ReferenceNumber)
+	Contains(t, html, otherCV.ReferenceNumber)
+}
+
+func TestGetDigestMatchesBefore(t *testing.T) {
+	conn := testingdb.NewDB()
+	now := time.Now()
+	profile := Profile{M: db.NewM()}
+
+	insert := func(createdAt time.Time, delivery ProfileEmailDelivery) *DigestMatch {
+		digestMatch := NewDigestMatch(createdAt, ProfileSendEmailData{Email: "a@example.com", Delivery: delivery}, profile, Match{}, CV{}, "")
+		NoError(t, conn.Insert(digestMatch))
+		return digestMatch
+	}
+	newest := insert(now.Add(-time.Minute), ProfileEmailDeliveryHourly)
+	oldest := insert(now.Add(-time.Hour), ProfileEmailDeliveryHourly)
+	insert(now.Add(time.Minute), ProfileEmailDeliveryHourly)
+	insert(now.Add(-time.Hour), ProfileEmailDeliveryDaily)
+
+	matches, err := GetDigestMatchesBefore(conn, ProfileEmailDeliveryHourly, now)
+	NoError(t, err)
+	if Len(t, matches, 2) {
+		Equal(t, oldest.ID, matches[0].ID)
+		Equal(t, newest.ID, matches[1].ID)
+	}
+}
+
+func TestValidateSendMailDelivery(t *testing.T) {
+	for _, delivery := range []ProfileEmailDelivery{"", ProfileEmailDeliveryImmediate, ProfileEmailDeliveryHourly, ProfileEmailDeliveryDaily} {
+		onMatch := ProfileOnMatch{SendMail: []ProfileSendEmailData{{Email: "a@example.com", Delivery: delivery}}}
+		NoError(t, onMatch.ValidateSendMail(), delivery)
+	}
+
+	onMatch := ProfileOnMatch{SendMail: []ProfileSendEmailData{{Email: "a@example.com", Delivery: "weekly"}}}
+	Error(t, onMatch.ValidateSendMail())
+}
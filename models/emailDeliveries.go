@@ -0,0 +1,190 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EmailMessage is the content of an email to send
+type EmailMessage struct {
+	To          []string          `json:"to"`
+	Subject     string            `json:"subject"`
+	HTML        string            `json:"html"`
+	Text        string            `json:"text"`
+	Attachments []EmailAttachment `json:"attachments"`
+}
+
+// EmailAttachment is a file attached to an email
+// The content is not stored in the email delivery, it's stored separately as an EmailAttachmentContent until the email is sent
+type EmailAttachment struct {
+	Filename    string             `json:"filename"`
+	ContentType string             `json:"contentType" bson:"contentType"`
+	Size        int                `json:"size"`
+	ContentID   primitive.ObjectID `json:"-" bson:"contentId"`
+	Content     []byte             `json:"-" bson:"-"`
+}
+
+// EmailAttachmentContent contains the content of an attachment of an email delivery that is not yet sent
+// This keeps the email deliveries small and the content is only kept as long as the email might be sent again
+type EmailAttachmentContent struct {
+	db.M       `bson:",inline"`
+	DeliveryID primitive.ObjectID `bson:"deliveryId"`
+	Content    []byte             `bson:"content"`
+}
+
+// CollectionName returns the collection name of the EmailAttachmentContent
+func (*EmailAttachmentContent) CollectionName() string {
+	return "emailAttachmentContents"
+}
+
+// Indexes implements db.Entry
+func (*EmailAttachmentContent) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.M{"deliveryId": 1}},
+	}
+}
+
+// Size returns the total size of the attachments of the message in bytes
+func (m *EmailMessage) Size() int {
+	size := 0
+	for _, attachment := range m.Attachments {
+		size += len(attachment.Content)
+	}
+	return size
+}
+
+// StoreAttachmentContents stores the contents of the attachments of the message of the delivery deliveryID
+// The ContentID and Size of the attachments are set so the contents can be loaded again using LoadAttachmentContents
+func (m *EmailMessage) StoreAttachmentContents(conn db.Connection, deliveryID primitive.ObjectID) error {
+	if len(m.Attachments) == 0 {
+		return nil
+	}
+
+	entries := make([]db.Entry, len(m.Attachments))
+	for idx := range m.Attachments {
+		attachment := &m.Attachments[idx]
+		content := &EmailAttachmentContent{
+			M:          db.NewM(),
+			DeliveryID: deliveryID,
+			Content:    attachment.Content,
+		}
+		attachment.ContentID = content.ID
+		attachment.Size = len(attachment.Content)
+		entries[idx] = content
+	}
+	return conn.Insert(entries...)
+}
+
+// LoadAttachmentContents loads the contents of the attachments stored by StoreAttachmentContents
+func (m *EmailMessage) LoadAttachmentContents(conn db.Connection) error {
+	for idx := range m.Attachments {
+		attachment := &m.Attachments[idx]
+		content := EmailAttachmentContent{}
+		err := conn.FindOne(&content, bson.M{"_id": attachment.ContentID})
+		if err != nil {
+			return fmt.Errorf("unable to load the content of attachment %s: %s", attachment.Filename, err.Error())
+		}
+		attachment.Content = content.Content
+	}
+	return nil
+}
+
+// DeleteAttachmentContents removes the contents of the attachments stored by StoreAttachmentContents
+func (m *EmailMessage) DeleteAttachmentContents(conn db.Connection) error {
+	for _, attachment := range m.Attachments {
+		err := conn.DeleteByID(&EmailAttachmentContent{M: db.M{ID: attachment.ContentID}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmailDeliveryStatus is the status of an email delivery
+type EmailDeliveryStatus string
+
+const (
+	// EmailDeliveryStatusQueued means the email is being sent or waiting for a retry
+	EmailDeliveryStatusQueued EmailDeliveryStatus = "queued"
+	// EmailDeliveryStatusSent means the email was accepted by the transport
+	EmailDeliveryStatusSent EmailDeliveryStatus = "sent"
+	// EmailDeliveryStatusFailed means the email could not be sent, it can be retried
+	EmailDeliveryStatusFailed EmailDeliveryStatus = "failed"
+)
+
+// Valid returns true if the status is known
+func (s EmailDeliveryStatus) Valid() bool {
+	switch s {
+	case EmailDeliveryStatusQueued, EmailDeliveryStatusSent, EmailDeliveryStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// EmailDelivery is the log entry of an email sent to the email address of a profile
+// The message is kept until the email is sent so queued deliveries can be resumed after a restart and failed deliveries can be retried
+type EmailDelivery struct {
+	db.M       `bson:",inline"`
+	To         []string                `json:"to"`
+	Subject    string                  `json:"subject"`
+	ProfileIDs []primitive.ObjectID    `json:"profileIds" bson:"profileIds" description:"the profiles of the matches in this email"`
+	MatchIDs   []primitive.ObjectID    `json:"matchIds" bson:"matchIds" description:"the matches in this email, a digest email contains multiple matches"`
+	Status     EmailDeliveryStatus     `json:"status"`
+	Attempts   int                     `json:"attempts"`
+	LastError  string                  `json:"lastError" bson:"lastError,omitempty"`
+	Message    *EmailMessage           `json:"-" bson:"message,omitempty"`
+	CreatedAt  jsonHelpers.RFC3339Nano `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  jsonHelpers.RFC3339Nano `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CollectionName returns the collection name of the EmailDelivery
+func (*EmailDelivery) CollectionName() string {
+	return "emailDeliveries"
+}
+
+// Indexes implements db.Entry
+func (*EmailDelivery) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.M{"status": 1}},
+		{Keys: bson.M{"createdAt": -1}},
+	}
+}
+
+// GetEmailDelivery returns an email delivery by id
+func GetEmailDelivery(conn db.Connection, id primitive.ObjectID) (EmailDelivery, error) {
+	delivery := EmailDelivery{}
+	err := conn.FindOne(&delivery, bson.M{"_id": id})
+	return delivery, err
+}
+
+// GetEmailDeliveries returns a page of the email deliveries, the newest first
+// If status is set only the deliveries with that status are returned
+func GetEmailDeliveries(conn db.Connection, status *EmailDeliveryStatus, page Page) ([]EmailDelivery, error) {
+	filter := bson.M{}
+	if status != nil {
+		filter["status"] = *status
+	}
+
+	deliveries := []EmailDelivery{}
+	err := conn.Find(&EmailDelivery{}, &deliveries, filter, page.findOptions(true))
+	return deliveries, err
+}
+
+// GetQueuedEmailDeliveries returns the email deliveries that are not yet sent or failed, the oldest first
+// On startup these are the deliveries that were interrupted by a restart of the server
+func GetQueuedEmailDeliveries(conn db.Connection) ([]EmailDelivery, error) {
+	deliveries := []EmailDelivery{}
+	err := conn.Find(
+		&EmailDelivery{},
+		&deliveries,
+		bson.M{"status": EmailDeliveryStatusQueued},
+		Page{}.findOptions(false),
+	)
+	return deliveries, err
+}
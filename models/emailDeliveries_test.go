@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetEmailDeliveriesOrder(t *testing.T) {
+	conn := testingdb.NewDB()
+
+	now := time.Now()
+	newDelivery := func(status EmailDeliveryStatus, createdAt time.Time) *EmailDelivery {
+		delivery := &EmailDelivery{
+			M:         db.NewM(),
+			Status:    status,
+			CreatedAt: jsonHelpers.RFC3339Nano(createdAt),
+		}
+		NoError(t, conn.Insert(delivery))
+		return delivery
+	}
+	newest := newDelivery(EmailDeliveryStatusQueued, now)
+	sent := newDelivery(EmailDeliveryStatusSent, now.Add(-time.Minute))
+	oldest := newDelivery(EmailDeliveryStatusQueued, now.Add(-time.Hour))
+
+	ids := func(deliveries []EmailDelivery) []primitive.ObjectID {
+		res := []primitive.ObjectID{}
+		for _, delivery := range deliveries {
+			res = append(res, delivery.ID)
+		}
+		return res
+	}
+
+	deliveries, err := GetEmailDeliveries(conn, nil, Page{})
+	NoError(t, err)
+	Equal(t, []primitive.ObjectID{newest.ID, sent.ID, oldest.ID}, ids(deliveries))
+
+	deliveries, err = GetEmailDeliveries(conn, nil, Page{Skip: 1, Limit: 1})
+	NoError(t, err)
+	Equal(t, []primitive.ObjectID{sent.ID}, ids(deliveries))
+
+	// The queued deliveries are resumed on startup so they should be returned the oldest first
+	deliveries, err = GetQueuedEmailDeliveries(conn)
+	NoError(t, err)
+	Equal(t, []primitive.ObjectID{oldest.ID, newest.ID}, ids(deliveries))
+}
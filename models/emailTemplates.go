@@ -0,0 +1,307 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/locale"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"jaytaylor.com/html2text"
+)
+
+// EmailTemplateKind tells for what kind of email a template is used
+type EmailTemplateKind string
+
+const (
+	// EmailTemplateKindMatch is used for the email sent immediately after a match
+	EmailTemplateKindMatch = EmailTemplateKind("match")
+	// EmailTemplateKindDigest is used for the hourly and daily digest emails
+	EmailTemplateKindDigest = EmailTemplateKind("digest")
+)
+
+// Valid returns whether k is a known email template kind
+func (k EmailTemplateKind) Valid() bool {
+	return k == EmailTemplateKindMatch || k == EmailTemplateKindDigest
+}
+
+// builtinFile returns the file name of the built in template of this kind
+func (k EmailTemplateKind) builtinFile() string {
+	if k == EmailTemplateKindDigest {
+		return "email-digest-template.html"
+	}
+	return "email-template.html"
+}
+
+// EmailTemplate is a custom template for the emails sent to the email addresses of profiles
+// A template is used for a profile that refers to it,
+// or if KeyID is set for the matches of all CVs uploaded with that key (tenant) to profiles without their own template
+type EmailTemplate struct {
+	db.M    `bson:",inline"`
+	Name    string              `json:"name"`
+	Kind    EmailTemplateKind   `json:"kind" description:"For what kind of email this template is used, match or digest"`
+	KeyID   *primitive.ObjectID `json:"keyId" bson:"keyId" description:"If set this template is used for the matches of CVs uploaded with this key to profiles without their own template"`
+	Subject string              `json:"subject" description:"A text/template of the email subject with the same fields as the html, if empty the default subject of the locale is used"`
+	HTML    string              `json:"html" description:"A html/template of the email body, see the preview route for the available fields"`
+}
+
+// CollectionName returns the collection name of an email template
+func (*EmailTemplate) CollectionName() string {
+	return "emailTemplates"
+}
+
+// Indexes implements db.Entry
+func (*EmailTemplate) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.M{"kind": 1}},
+		{Keys: bson.M{"keyId": 1}},
+	}
+}
+
+// GetEmailTemplates returns all email templates
+func GetEmailTemplates(conn db.Connection) ([]EmailTemplate, error) {
+	templates := []EmailTemplate{}
+	err := conn.Find(&EmailTemplate{}, &templates, nil)
+	return templates, err
+}
+
+// GetEmailTemplate returns an email template by id
+func GetEmailTemplate(conn db.Connection, id primitive.ObjectID) (EmailTemplate, error) {
+	emailTemplate := EmailTemplate{}
+	err := conn.FindOne(&emailTemplate, bson.M{"_id": id})
+	return emailTemplate, err
+}
+
+// GetEmailTemplateFor returns the custom template of kind to use for an email about a match on a CV uploaded with keyID
+// profileTemplateID is the template set on the profile and takes precedence over the template of the key,
+// returns nil if the built in template should be used
+func GetEmailTemplateFor(conn db.Connection, kind EmailTemplateKind, profileTemplateID *primitive.ObjectID, keyID primitive.ObjectID) (*EmailTemplate, error) {
+	emailTemplate := EmailTemplate{}
+	if profileTemplateID != nil {
+		err := conn.FindOne(&emailTemplate, bson.M{"_id": *profileTemplateID})
+		if err == nil && emailTemplate.Kind == kind {
+			return &emailTemplate, nil
+		}
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+
+	err := conn.FindOne(&emailTemplate, bson.M{"keyId": keyID, "kind": kind})
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &emailTemplate, nil
+}
+
+// Validate validates the email template by parsing and rendering it against example data
+// otherTemplates should contain all the templates in the database and is used to make sure a key has only one template per kind
+func (t EmailTemplate) Validate(otherTemplates []EmailTemplate) error {
+	if t.Name == "" {
+		return errors.New("name: must be set")
+	}
+	if !t.Kind.Valid() {
+		return errors.New(`kind: must be "match" or "digest"`)
+	}
+	if t.HTML == "" {
+		return errors.New("html: must be set")
+	}
+
+	if t.KeyID != nil {
+		for _, other := range otherTemplates {
+			if other.ID != t.ID && other.Kind == t.Kind && other.KeyID != nil && *other.KeyID == *t.KeyID {
+				return fmt.Errorf("keyId: the key already has the %s template %s", t.Kind, other.ID.Hex())
+			}
+		}
+	}
+
+	for _, l := range locale.Locales {
+		_, err := t.Preview(l)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmailContent is the rendered subject and html body of an email
+type EmailContent struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+}
+
+// Message returns an email message with the content to the given addresses
+// The plain text version of the email is generated from the html
+func (c EmailContent) Message(to ...string) EmailMessage {
+	text, _ := html2text.FromString(c.HTML, html2text.Options{})
+	return EmailMessage{
+		To:      to,
+		Subject: c.Subject,
+		HTML:    c.HTML,
+		Text:    text,
+	}
+}
+
+// emailTemplateFuncs returns the functions that can be used in the email templates
+func emailTemplateFuncs(l locale.Locale) map[string]interface{} {
+	return map[string]interface{}{
+		"t": func(message string, args ...interface{}) string {
+			return l.T(locale.Message(message), args...)
+		},
+		"locale": func() string {
+			return string(l.OrDefault())
+		},
+	}
+}
+
+// renderEmail renders an email of kind with data in the locale l
+// If customTemplate is nil the built in template is used
+func renderEmail(customTemplate *EmailTemplate, kind EmailTemplateKind, l locale.Locale, defaultSubject string, data interface{}) (EmailContent, error) {
+	funcs := emailTemplateFuncs(l)
+
+	var tmpl *template.Template
+	var err error
+	if customTemplate == nil || customTemplate.HTML == "" {
+		tmpl, err = getTemplateFromFile(funcs, kind.builtinFile())
+	} else {
+		tmpl, err = template.New("html").Option("missingkey=error").Funcs(funcs).Parse(customTemplate.HTML)
+	}
+	if err != nil {
+		return EmailContent{}, fmt.Errorf("html: %s", err.Error())
+	}
+
+	htmlBuff := bytes.NewBuffer(nil)
+	err = tmpl.Execute(htmlBuff, data)
+	if err != nil {
+		return EmailContent{}, fmt.Errorf("html: %s", err.Error())
+	}
+
+	content := EmailContent{Subject: defaultSubject, HTML: htmlBuff.String()}
+	if customTemplate == nil || customTemplate.Subject == "" {
+		return content, nil
+	}
+
+	subjectTmpl, err := textTemplate.New("subject").Option("missingkey=error").Funcs(funcs).Parse(customTemplate.Subject)
+	if err != nil {
+		return EmailContent{}, fmt.Errorf("subject: %s", err.Error())
+	}
+	subjectBuff := bytes.NewBuffer(nil)
+	err = subjectTmpl.Execute(subjectBuff, data)
+	if err != nil {
+		return EmailContent{}, fmt.Errorf("subject: %s", err.Error())
+	}
+	content.Subject = subjectBuff.String()
+	return content, nil
+}
+
+// matchEmailData is the data of the match email template
+type matchEmailData struct {
+	Profile   Profile
+	Cv        *CV
+	MatchText string
+	LogoURL   string
+	Domain    string
+
+	// The normal `Profile.ID.String()`` is more of a debug value than a real id value so we add the hex to this field
+	ProfileIDHex string
+}
+
+// GetMatchEmail renders the email sent for aMatch of profile on cv in the locale of the profile
+// If customTemplate is nil the built in template is used
+func (cv *CV) GetMatchEmail(customTemplate *EmailTemplate, profile Profile, aMatch Match, domain string) (EmailContent, error) {
+	data := matchEmailData{
+		Profile:      profile,
+		ProfileIDHex: profile.ID.Hex(),
+		Cv:           cv,
+		MatchText:    aMatch.GetLocalizedMatchSentence(profile.Locale),
+		LogoURL:      os.Getenv("EMAIL_LOGO_URL"),
+		Domain:       domain,
+	}
+	subject := profile.Locale.T(locale.MsgEmailSubjectMatch, profile.Name)
+	return renderEmail(customTemplate, EmailTemplateKindMatch, profile.Locale, subject, data)
+}
+
+// digestEmailMatch is a match in the data of the digest email template
+type digestEmailMatch struct {
+	ProfileName string
+	Cv          *CV
+	MatchText   string
+	Domain      string
+}
+
+// digestEmailData is the data of the digest email template
+type digestEmailData struct {
+	Matches []digestEmailMatch
+	LogoURL string
+}
+
+// GetDigestEmail renders the digest email containing matches
+// The locale of the first match is used as the matches can belong to profiles with different locales
+// If customTemplate is nil the built in template is used
+func GetDigestEmail(customTemplate *EmailTemplate, matches []DigestMatch) (EmailContent, error) {
+	if len(matches) == 0 {
+		return EmailContent{}, errors.New("a digest needs at least one match")
+	}
+	l := matches[0].Locale
+
+	data := digestEmailData{
+		Matches: make([]digestEmailMatch, len(matches)),
+		LogoURL: os.Getenv("EMAIL_LOGO_URL"),
+	}
+	for idx := range matches {
+		data.Matches[idx] = digestEmailMatch{
+			ProfileName: matches[idx].ProfileName,
+			Cv:          &matches[idx].CV,
+			MatchText:   matches[idx].Match.GetLocalizedMatchSentence(l),
+			Domain:      matches[idx].KeyName,
+		}
+	}
+
+	subject := l.T(locale.MsgEmailSubjectMatch, matches[0].ProfileName)
+	if len(matches) > 1 {
+		subject = l.T(locale.MsgEmailSubjectDigest, len(matches))
+	}
+	return renderEmail(customTemplate, EmailTemplateKindDigest, l, subject, data)
+}
+
+// Preview renders the template in locale l with example data based on ExampleCV
+// If the html of the template is empty the built in template of its kind is rendered
+func (t EmailTemplate) Preview(l locale.Locale) (EmailContent, error) {
+	cv := ExampleCV()
+	profession := cv.PreferredJobs[0]
+	aMatch := Match{
+		DesiredProfession: &profession,
+		MatchedDriversLicense: &MatchedDriversLicense{
+			Required: "B",
+			Held:     "C",
+		},
+	}
+	profile := Profile{
+		M:      db.NewM(),
+		Name:   "Example profile",
+		Locale: l,
+	}
+	domain := "example.com"
+
+	if t.Kind == EmailTemplateKindDigest {
+		mail := ProfileSendEmailData{Email: "example@example.com", Delivery: ProfileEmailDeliveryDaily}
+		otherCV := ExampleCV()
+		otherCV.ReferenceNumber = "other-reference-number"
+		matches := []DigestMatch{
+			*NewDigestMatch(time.Now(), mail, profile, aMatch, *cv, domain),
+			*NewDigestMatch(time.Now(), mail, profile, aMatch, *otherCV, domain),
+		}
+		return GetDigestEmail(&t, matches)
+	}
+	return cv.GetMatchEmail(&t, profile, aMatch, domain)
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	"github.com/script-development/RT-CV/helpers/locale"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEmailTemplateValidate(t *testing.T) {
+	valid := EmailTemplate{
+		M:       db.NewM(),
+		Name:    "template",
+		Kind:    EmailTemplateKindMatch,
+		Subject: `{{ t "emailSubjectMatch" .Profile.Name }}`,
+		HTML:    `<p>{{ t "emailFoundWith" }} {{ .Profile.Name }}: {{ .Cv.PersonalDetails.FirstName }}</p>`,
+	}
+	NoError(t, valid.Validate(nil))
+
+	digest := valid
+	digest.Kind = EmailTemplateKindDigest
+	digest.Subject = ""
+	digest.HTML = `{{ range .Matches }}<p>{{ .ProfileName }} {{ .MatchText }}</p>{{ end }}`
+	NoError(t, digest.Validate(nil))
+
+	invalid := map[string]func(*EmailTemplate){
+		"no name":               func(e *EmailTemplate) { e.Name = "" },
+		"unknown kind":          func(e *EmailTemplate) { e.Kind = "weekly" },
+		"no html":               func(e *EmailTemplate) { e.HTML = "" },
+		"html parse error":      func(e *EmailTemplate) { e.HTML = "{{ if .Profile.Name }}" },
+		"html unknown field":    func(e *EmailTemplate) { e.HTML = "{{ .ThisFieldDoesNotExist }}" },
+		"subject parse error":   func(e *EmailTemplate) { e.Subject = "{{ .Profile.Name" },
+		"wrong kind of fields":  func(e *EmailTemplate) { e.Kind = EmailTemplateKindDigest },
+		"unknown template func": func(e *EmailTemplate) { e.HTML = "{{ translate .Profile.Name }}" },
+	}
+	for name, modify := range invalid {
+		emailTemplate := valid
+		modify(&emailTemplate)
+		Error(t, emailTemplate.Validate(nil), name)
+	}
+
+	// A key can have only one template per kind
+	keyID := primitive.NewObjectID()
+	withKey := valid
+	withKey.KeyID = &keyID
+	other := valid
+	other.M = db.NewM()
+	other.KeyID = &keyID
+	Error(t, withKey.Validate([]EmailTemplate{other}))
+	NoError(t, withKey.Validate([]EmailTemplate{withKey}))
+	other.Kind = EmailTemplateKindDigest
+	NoError(t, withKey.Validate([]EmailTemplate{other}))
+}
+
+func TestEmailTemplatePreview(t *testing.T) {
+	custom := EmailTemplate{
+		Kind:    EmailTemplateKindMatch,
+		Subject: "Match: {{ .Profile.Name }}",
+		HTML:    `<p lang="{{ locale }}">{{ .MatchText }}</p>`,
+	}
+	content, err := custom.Preview(locale.EN)
+	NoError(t, err)
+	Equal(t, "Match: Example profile", content.Subject)
+	Equal(t, `<p lang="en">desired profession hitman and drivers license C (meets B)</p>`, content.HTML)
+
+	// Without html the built in template is rendered
+	builtin := EmailTemplate{Kind: EmailTemplateKindDigest}
+	content, err = builtin.Preview(locale.NL)
+	NoError(t, err)
+	Equal(t, "2 nieuwe matches", content.Subject)
+	Contains(t, content.HTML, "Yes, 2 nieuwe matches!")
+}
+
+func TestGetEmailTemplateFor(t *testing.T) {
+	conn := testingdb.NewDB()
+	keyID := primitive.NewObjectID()
+	otherKeyID := primitive.NewObjectID()
+
+	profileTemplate := &EmailTemplate{M: db.NewM(), Kind: EmailTemplateKindMatch}
+	keyTemplate := &EmailTemplate{M: db.NewM(), Kind: EmailTemplateKindMatch, KeyID: &keyID}
+	keyDigestTemplate := &EmailTemplate{M: db.NewM(), Kind: EmailTemplateKindDigest, KeyID: &keyID}
+	NoError(t, conn.Insert(profileTemplate, keyTemplate, keyDigestTemplate))
+
+	emailTemplate, err := GetEmailTemplateFor(conn, EmailTemplateKindMatch, &profileTemplate.ID, keyID)
+	NoError(t, err)
+	if NotNil(t, emailTemplate) {
+		Equal(t, profileTemplate.ID, emailTemplate.ID)
+	}
+
+	emailTemplate, err = GetEmailTemplateFor(conn, EmailTemplateKindMatch, nil, keyID)
+	NoError(t, err)
+	if NotNil(t, emailTemplate) {
+		Equal(t, keyTemplate.ID, emailTemplate.ID)
+	}
+
+	// The template of the profile is of another kind so the template of the key is used
+	emailTemplate, err = GetEmailTemplateFor(conn, EmailTemplateKindDigest, &profileTemplate.ID, keyID)
+	NoError(t, err)
+	if NotNil(t, emailTemplate) {
+		Equal(t, keyDigestTemplate.ID, emailTemplate.ID)
+	}
+
+	emailTemplate, err = GetEmailTemplateFor(conn, EmailTemplateKindMatch, nil, otherKeyID)
+	NoError(t, err)
+	Nil(t, emailTemplate)
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MatchJobStatus is the processing status of a match job
+type MatchJobStatus string
+
+const (
+	// MatchJobStatusPending means the job is waiting to be processed, see NextRunAt for when
+	MatchJobStatusPending MatchJobStatus = "pending"
+	// MatchJobStatusProcessing means a worker is currently processing the job
+	MatchJobStatusProcessing MatchJobStatus = "processing"
+	// MatchJobStatusFailed means the job failed too many times and won't be retried
+	MatchJobStatusFailed MatchJobStatus = "failed"
+)
+
+// MatchJob contains the matches made to a CV that still need to be processed
+// (saved for analytics and sent to the emails and http calls of the profiles)
+//
+// Jobs are stored in the database so they are not lost when the server restarts,
+// once a job is successfully processed it's removed from the database
+type MatchJob struct {
+	db.M      `bson:",inline"`
+	Status    MatchJobStatus          `json:"status"`
+	Attempts  int                     `json:"attempts" description:"how many times processing this job failed"`
+	LastError string                  `json:"lastError" bson:"lastError,omitempty" description:"the error of the last failed attempt"`
+	CreatedAt jsonHelpers.RFC3339Nano `json:"createdAt" bson:"createdAt"`
+	NextRunAt jsonHelpers.RFC3339Nano `json:"nextRunAt" bson:"nextRunAt" description:"when the job is processed (again)"`
+
+	Debug     bool               `json:"debug"`
+	CV        CV                 `json:"cv"`
+	Matches   []MatchJobMatch    `json:"matches"`
+	KeyID     primitive.ObjectID `json:"keyId" bson:"keyId"`
+	KeyName   string             `json:"keyName" bson:"keyName"`
+	RequestID primitive.ObjectID `json:"requestId" bson:"requestId"`
+
+	// MatchesStored is set once the matches are saved in the matches collection
+	// so a retry of the job doesn't store them again
+	MatchesStored bool `json:"matchesStored" bson:"matchesStored"`
+}
+
+// MatchJobMatch is a single match within a MatchJob
+type MatchJobMatch struct {
+	Match   Match   `json:"match"`
+	Profile Profile `json:"profile" description:"the profile as it was when the match was made"`
+	// Handled is set once the emails and http calls of this match are sent
+	Handled bool `json:"handled"`
+	// DigestQueued is set once the match is added to the digests of the profile email addresses
+	// so a retry of the job doesn't add them again
+	DigestQueued bool `json:"digestQueued" bson:"digestQueued"`
+	// Sent contains the http calls and email addresses the match is already queued for
+	// so a retry of the job only sends the remaining ones
+	Sent MatchSendProgress `json:"sent"`
+}
+
+// MatchSendProgress contains the http calls and email addresses a match is queued for
+type MatchSendProgress struct {
+	HTTPCalls []int    `json:"httpCalls" bson:"httpCalls,omitempty" description:"the indexes of the http calls in the onMatch of the profile"`
+	Emails    []string `json:"emails" bson:"emails,omitempty" description:"the email addresses"`
+}
+
+// HTTPCallSent returns true if the match is queued for the http call at idx in the onMatch of the profile
+// Calls are identified by their index as a profile can have multiple calls to the same uri with other methods or headers
+func (p *MatchSendProgress) HTTPCallSent(idx int) bool {
+	for _, sent := range p.HTTPCalls {
+		if sent == idx {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailSent returns true if the match is queued for the email address
+func (p *MatchSendProgress) EmailSent(address string) bool {
+	for _, sent := range p.Emails {
+		if sent == address {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectionName returns the collection name of the MatchJob
+func (*MatchJob) CollectionName() string {
+	return "matchJobs"
+}
+
+// Indexes implements db.Entry
+func (*MatchJob) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.M{"status": 1}},
+		{Keys: bson.M{"nextRunAt": 1}},
+	}
+}
+
+// NewMatchJob creates a new pending match job that can be processed right away
+func NewMatchJob(now time.Time) *MatchJob {
+	return &MatchJob{
+		M:         db.NewM(),
+		Status:    MatchJobStatusPending,
+		CreatedAt: jsonHelpers.RFC3339Nano(now),
+		NextRunAt: jsonHelpers.RFC3339Nano(now),
+		Matches:   []MatchJobMatch{},
+	}
+}
+
+// GetRunnableMatchJobs returns the pending match jobs of which the NextRunAt has passed
+// The oldest jobs come first
+func GetRunnableMatchJobs(conn db.Connection, now time.Time) ([]MatchJob, error) {
+	jobs := []MatchJob{}
+	err := conn.Find(&MatchJob{}, &jobs, bson.M{
+		"status":    MatchJobStatusPending,
+		"nextRunAt": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Time().Before(jobs[j].CreatedAt.Time())
+	})
+	return jobs, nil
+}
+
+// GetMatchJobsWithStatus returns all match jobs with a specific status
+func GetMatchJobsWithStatus(conn db.Connection, status MatchJobStatus) ([]MatchJob, error) {
+	jobs := []MatchJob{}
+	err := conn.Find(&MatchJob{}, &jobs, bson.M{"status": status})
+	return jobs, err
+}
+
+// CountMatchJobsWithStatus counts the match jobs with a specific status
+func CountMatchJobsWithStatus(conn db.Connection, status MatchJobStatus) (uint64, error) {
+	return conn.Count(&MatchJob{}, bson.M{"status": status})
+}
+
+// ResetProcessingMatchJobs marks the jobs that were being processed as pending again
+// This should be called on startup as jobs with the processing status at that point
+// were interrupted by a restart of the server
+func ResetProcessingMatchJobs(conn db.Connection) (int, error) {
+	jobs, err := GetMatchJobsWithStatus(conn, MatchJobStatusProcessing)
+	if err != nil {
+		return 0, err
+	}
+
+	for idx := range jobs {
+		jobs[idx].Status = MatchJobStatusPending
+		err = conn.UpdateByID(&jobs[idx])
+		if err != nil {
+			return idx, err
+		}
+	}
+	return len(jobs), nil
+}
@@ -1,13 +1,12 @@
 package models
 
 import (
-	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/script-development/RT-CV/db"
 	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"github.com/script-development/RT-CV/helpers/locale"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -27,19 +26,35 @@ type Match struct {
 	// This is currently only true if the match was made using the /tryMatcher dashboard page
 	Debug bool `bson:",omitempty" json:"debug" description:"is this a debug match, this is currently only true if the match was made using the /tryMatcher dashboard page"`
 
+	// Score tells how good the match is, higher is better
+	// The score is calculated using the score weights of the profile
+	Score float64 `json:"score" bson:"score" description:"how good this match is based on the score weights of the profile, higher is better"`
+
 	// The values below are non nil if a match was found
 	// The result of the match is stored in the value of the field
 
 	// The profile domain match that was found
 	YearsSinceWork      *int `bson:",omitempty" json:"yearsSinceWork"`
 	YearsSinceEducation *int `bson:",omitempty" json:"yearsSinceEducation"`
+	Age                 *int `bson:",omitempty" json:"age" description:"the age of the candidate, only set if the profile has an age range"`
 	// the education name of the profile that was matched
 	Education *string `bson:",omitempty" json:"education"`
 	// The profile desired profession match that was found
-	DesiredProfession     *string              `bson:",omitempty" json:"desiredProfession"`
-	ProfessionExperienced *string              `bson:",omitempty" json:"professionExperienced"`
-	DriversLicense        bool                 `bson:",omitempty" json:"driversLicense"`
-	ZipCode               *ProfileDutchZipcode `bson:",omitempty" json:"zipCode"`
+	DesiredProfession     *string                `bson:",omitempty" json:"desiredProfession"`
+	ProfessionExperienced *string                `bson:",omitempty" json:"professionExperienced"`
+	YearsExperience       *float64               `bson:",omitempty" json:"yearsExperience" description:"the total years of experience in the matched profession experienced, overlapping work experiences are counted once"`
+	DriversLicense        bool                   `bson:",omitempty" json:"driversLicense"`
+	MatchedDriversLicense *MatchedDriversLicense `bson:",omitempty" json:"matchedDriversLicense" description:"the drivers license of the CV that satisfied the drivers license requirement of the profile"`
+	Language              *ProfileLanguage       `bson:",omitempty" json:"language" description:"the language requirement of the profile that was met"`
+	Skill                 *string                `bson:",omitempty" json:"skill" description:"the skill of the profile that was found in the competences, interests or personal presentation of the CV"`
+	ZipCode               *ProfileZipcode        `bson:",omitempty" json:"zipCode"`
+	DistanceKm            *float64               `bson:",omitempty" json:"distanceKm" description:"the distance between the zipcode of the CV and the centre of the matched zip radius"`
+}
+
+// MatchedDriversLicense contains the drivers license that satisfied a drivers license requirement of a profile
+type MatchedDriversLicense struct {
+	Required string `json:"required" description:"the drivers license required by the profile"`
+	Held     string `json:"held" description:"the drivers license of the CV, this can be a higher category that implies the required drivers license"`
 }
 
 // CollectionName returns the collection name of the Profile
@@ -55,6 +70,7 @@ func (*Match) Indexes() []mongo.IndexModel {
 		{Keys: bson.M{"when": 1}},
 		{Keys: bson.M{"when": -1}},
 		{Keys: bson.M{"referenceNr": 1}},
+		{Keys: bson.M{"score": -1}},
 	}
 }
 
@@ -82,6 +98,15 @@ func GetMatchesOnReferenceNr(dbConn db.Connection, referenceNr string, keyID *pr
 	return results, err
 }
 
+// CountMatchesOfProfileSince returns the amount of non debug matches made with a profile since a certain date+time
+func CountMatchesOfProfileSince(dbConn db.Connection, profileID primitive.ObjectID, since time.Time) (uint64, error) {
+	return dbConn.Count(&Match{}, bson.M{
+		"profileId": profileID,
+		"when":      bson.M{"$gte": since},
+		"debug":     bson.M{"$ne": true},
+	})
+}
+
 // GetMatchesSince returns all matches that have been done since a certain date+time
 func GetMatchesSince(dbConn db.Connection, since time.Time, keyID *primitive.ObjectID) ([]Match, error) {
 	query := bson.M{"when": bson.M{"$gt": since}}
@@ -94,55 +119,86 @@ func GetMatchesSince(dbConn db.Connection, since time.Time, keyID *primitive.Obj
 	return results, err
 }
 
-// GetMatchSentence returns a
+// GetMatchSentence returns a dutch sentence describing on what the match was made
 func (m *Match) GetMatchSentence() string {
+	return m.GetLocalizedMatchSentence(locale.Default)
+}
+
+// GetLocalizedMatchSentence returns a sentence in the language of l describing on what the match was made
+func (m *Match) GetLocalizedMatchSentence(l locale.Locale) string {
 	sentences := []string{}
-	addReason := func(reason string) {
-		sentences = append(sentences, reason)
+	addReason := func(message locale.Message, args ...interface{}) {
+		sentences = append(sentences, l.T(message, args...))
 	}
 
 	if m.YearsSinceWork != nil {
 		switch *m.YearsSinceWork {
 		case 0:
-			addReason("minder dan 1 jaar geleden sinds laatste werk ervaaring")
+			addReason(locale.MsgMatchYearsSinceWorkLessThanOne)
 		case 1:
-			addReason("1 jaar sinds laatste werk ervaaring")
+			addReason(locale.MsgMatchYearsSinceWorkOne)
 		default:
-			addReason(strconv.Itoa(*m.YearsSinceWork) + " jaren sinds laatste werk ervaaring")
+			addReason(locale.MsgMatchYearsSinceWork, *m.YearsSinceWork)
 		}
 	}
 	if m.YearsSinceEducation != nil {
 		switch *m.YearsSinceEducation {
 		case 0:
-			addReason("minder dan 1 jaar sinds laatste opleiding")
+			addReason(locale.MsgMatchYearsSinceEducationLessThanOne)
 		case 1:
-			addReason("1 jaar sinds laatste opleiding")
+			addReason(locale.MsgMatchYearsSinceEducationOne)
 		default:
-			addReason(strconv.Itoa(*m.YearsSinceEducation) + " jaren sinds laatste opleiding")
+			addReason(locale.MsgMatchYearsSinceEducation, *m.YearsSinceEducation)
 		}
 	}
+	if m.Age != nil {
+		addReason(locale.MsgMatchAge, *m.Age)
+	}
 	if m.Education != nil {
-		addReason("opleiding " + *m.Education)
+		addReason(locale.MsgMatchEducation, *m.Education)
 	}
 	if m.DesiredProfession != nil {
-		addReason("gewenste werkveld " + *m.DesiredProfession)
+		addReason(locale.MsgMatchDesiredProfession, *m.DesiredProfession)
 	}
 	if m.ProfessionExperienced != nil {
-		addReason("gewerkt als " + *m.ProfessionExperienced)
+		if m.YearsExperience != nil && *m.YearsExperience >= 0.1 {
+			addReason(locale.MsgMatchProfessionExperiencedYears, l.FormatDecimal(*m.YearsExperience), *m.ProfessionExperienced)
+		} else {
+			addReason(locale.MsgMatchProfessionExperienced, *m.ProfessionExperienced)
+		}
 	}
-	if m.DriversLicense {
-		addReason("gewenste rijbewijs")
+	if m.MatchedDriversLicense != nil {
+		if m.MatchedDriversLicense.Held == m.MatchedDriversLicense.Required {
+			addReason(locale.MsgMatchDriversLicense, m.MatchedDriversLicense.Held)
+		} else {
+			addReason(locale.MsgMatchDriversLicenseImplied, m.MatchedDriversLicense.Held, m.MatchedDriversLicense.Required)
+		}
+	} else if m.DriversLicense {
+		addReason(locale.MsgMatchDesiredDriversLicense)
+	}
+	if m.Language != nil {
+		levels := []string{}
+		if m.Language.LevelSpoken != LanguageLevelUnknown {
+			levels = append(levels, l.T(locale.MsgMatchLanguageSpoken, m.Language.LevelSpoken.Localized(l)))
+		}
+		if m.Language.LevelWritten != LanguageLevelUnknown {
+			levels = append(levels, l.T(locale.MsgMatchLanguageWritten, m.Language.LevelWritten.Localized(l)))
+		}
+		if len(levels) == 0 {
+			addReason(locale.MsgMatchLanguage, m.Language.Name)
+		} else {
+			addReason(locale.MsgMatchLanguageLevels, m.Language.Name, strings.Join(levels, ", "))
+		}
+	}
+	if m.Skill != nil {
+		addReason(locale.MsgMatchSkill, *m.Skill)
 	}
 	if m.ZipCode != nil {
-		addReason(fmt.Sprintf("postcode in range %d - %d", m.ZipCode.From, m.ZipCode.To))
+		addReason(locale.MsgMatchZipCode, strings.Replace(m.ZipCode.String(), "-", " - ", 1))
 	}
-
-	switch len(sentences) {
-	case 0:
-		return ""
-	case 1:
-		return sentences[0]
-	default:
-		return fmt.Sprintf("%s en %s", strings.Join(sentences[:len(sentences)-1], ", "), sentences[len(sentences)-1])
+	if m.DistanceKm != nil {
+		addReason(locale.MsgMatchDistance, *m.DistanceKm)
 	}
+
+	return l.JoinList(sentences)
 }
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/script-development/RT-CV/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Page selects a part of a list of entries
+type Page struct {
+	// Skip is the amount of entries to skip, used to get the next pages
+	Skip int64
+	// Limit is the maximum amount of entries, 0 means no limit
+	Limit int64
+}
+
+// findOptions returns the find options to get this page of the entries sorted on createdAt
+// The _id is used as tiebreaker so entries created at the same time keep the same order between pages
+func (p Page) findOptions(newestFirst bool) db.FindOptions {
+	direction := 1
+	if newestFirst {
+		direction = -1
+	}
+	return db.FindOptions{
+		Sort:  bson.D{{Key: "createdAt", Value: direction}, {Key: "_id", Value: direction}},
+		Skip:  p.Skip,
+		Limit: p.Limit,
+	}
+}
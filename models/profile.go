@@ -1,23 +1,24 @@
 package models
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
+	"io"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
 
-	"github.com/jordan-wright/email"
 	fuzzymatcher "github.com/mjarkk/fuzzy-matcher"
 	"github.com/script-development/RT-CV/db"
-	"github.com/script-development/RT-CV/helpers/emailservice"
+	"github.com/script-development/RT-CV/helpers/geo"
 	"github.com/script-development/RT-CV/helpers/jsonHelpers"
-	"github.com/valyala/fasthttp"
+	"github.com/script-development/RT-CV/helpers/locale"
+	"github.com/script-development/RT-CV/helpers/postalcode"
+	"github.com/script-development/RT-CV/helpers/wordvalidator"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"jaytaylor.com/html2text"
 )
 
 // Profile contains all the information about a search profile
@@ -27,12 +28,21 @@ type Profile struct {
 	Active          bool                 `json:"active"`
 	AllowedScrapers []primitive.ObjectID `json:"allowedScrapers" bson:"allowedScrapers" description:"Define a list of scraper keys that can use this profile, if value is undefined or empty all keys are allowed"`
 
+	ActiveFrom        *jsonHelpers.RFC3339Nano `json:"activeFrom" bson:"activeFrom,omitempty" description:"The profile only matches from this moment, if null there is no start"`
+	ActiveUntil       *jsonHelpers.RFC3339Nano `json:"activeUntil" bson:"activeUntil,omitempty" description:"The profile only matches until this moment, once passed the profile is deactivated. If null there is no end"`
+	Schedule          []ProfileSchedule        `json:"schedule" bson:"schedule" description:"The weekdays and hours in which the profile matches, if empty the profile matches at any moment"`
+	MaxMatchesPerDay  int                      `json:"maxMatchesPerDay" bson:"maxMatchesPerDay" description:"The maximum amount of matches per day, 0 means no limit"`
+	MaxMatchesPerWeek int                      `json:"maxMatchesPerWeek" bson:"maxMatchesPerWeek" description:"The maximum amount of matches per week starting on monday, 0 means no limit"`
+
 	MustDesiredProfession bool                `json:"mustDesiredProfession" bson:"mustDesiredProfession"`
 	DesiredProfessions    []ProfileProfession `json:"desiredProfessions" bson:"desiredProfessions"`
 
 	YearsSinceWork        *int                `json:"yearsSinceWork" bson:"yearsSinceWork"`
 	MustExpProfession     bool                `json:"mustExpProfession" bson:"mustExpProfession"`
 	ProfessionExperienced []ProfileProfession `json:"professionExperienced" bson:"professionExperienced"`
+	MinYearsExperience    float64             `json:"minYearsExperience" bson:"minYearsExperience" description:"The minimal total years of experience in a matched profession experienced, overlapping work experiences are counted once and still employed counts until now. 0 means no minimum"`
+	MinWeeklyHours        int                 `json:"minWeeklyHours" bson:"minWeeklyHours" description:"Only work experiences with at least this amount of weekly hours count for the profession experienced, 0 means no minimum"`
+	MaxWeeklyHours        int                 `json:"maxWeeklyHours" bson:"maxWeeklyHours" description:"Only work experiences with at most this amount of weekly hours count for the profession experienced, 0 means no maximum"`
 
 	MustDriversLicense bool                    `json:"mustDriversLicense" bson:"mustDriversLicense"`
 	DriversLicenses    []ProfileDriversLicense `json:"driversLicenses" bson:"driversLicenses"`
@@ -42,22 +52,211 @@ type Profile struct {
 	YearsSinceEducation   int                `json:"yearsSinceEducation" bson:"yearsSinceEducation"`
 	Educations            []ProfileEducation `json:"educations" bson:"educations"`
 
-	Zipcodes []ProfileDutchZipcode `json:"zipCodes" bson:"zipCodes"`
+	MustLanguage bool              `json:"mustLanguage" bson:"mustLanguage"`
+	Languages    []ProfileLanguage `json:"languages" bson:"languages"`
+
+	MustSkill bool           `json:"mustSkill" bson:"mustSkill"`
+	Skills    []ProfileSkill `json:"skills" bson:"skills" description:"Skills or keywords searched for in the competences, interests and personal presentation of a CV"`
+
+	MinAge              int  `json:"minAge" bson:"minAge" description:"The minimal age of the candidate, 0 means no minimum. Ignored if age matching is disabled on the server"`
+	MaxAge              int  `json:"maxAge" bson:"maxAge" description:"The maximal age of the candidate, 0 means no maximum. Ignored if age matching is disabled on the server"`
+	AvailableWithinDays *int `json:"availableWithinDays" bson:"availableWithinDays" description:"The candidate must be available within this amount of days after the CV is matched, if null there is no requirement. CVs without availableFrom are assumed to be available now"`
+
+	Zipcodes    []ProfileZipcode   `json:"zipCodes" bson:"zipCodes"`
+	ZipRadiuses []ProfileZipRadius `json:"zipRadiuses" bson:"zipRadiuses" description:"Areas defined by a centre and a radius, the zipcode of a CV must be within one of these areas or one of the zipCodes ranges"`
+
+	Criteria *ProfileCriteriaExpression `json:"criteria" bson:"criteria" description:"A boolean expression over the criteria that must be met for a CV to match, if set the must* fields and the rule that at least one of the criteria must be met are ignored"`
+
+	Exclusions ProfileExclusions `json:"exclusions" bson:"exclusions" description:"CVs that match one of the exclusions never match this profile, regardless of the other criteria"`
+
+	ScoreWeights *ProfileScoreWeights `json:"scoreWeights" bson:"scoreWeights" description:"The weights used to calculate the score of a match, if undefined the default weights are used"`
+	MinimumScore float64              `json:"minimumScore" bson:"minimumScore" description:"Matches with a score lower than this value are ignored"`
 
 	// What should happen on a match
 	OnMatch ProfileOnMatch `json:"onMatch" bson:"onMatch" description:"What should happen when a match is made on this profile"`
 
+	Locale                locale.Locale       `json:"locale" bson:"locale,omitempty" description:"The language of the emails sent for this profile, nl or en. If empty nl is used"`
+	MatchEmailTemplateID  *primitive.ObjectID `json:"matchEmailTemplateId" bson:"matchEmailTemplateId,omitempty" description:"The custom email template used for the match emails, if null the template of the key that uploaded the CV or the built in template is used"`
+	DigestEmailTemplateID *primitive.ObjectID `json:"digestEmailTemplateId" bson:"digestEmailTemplateId,omitempty" description:"The custom email template used for the digest emails, if null the template of the key that uploaded the CV or the built in template is used"`
+
 	// OldID is used to keep track of converted old profiles
 	OldID *uint64 `bson:"_old_id" json:"-"`
 
 	// Variables set by the matching process only when they needed
 	// These are mainly used for caching so we don't have to calculate values twice
 	// There values where detected using the -profile flag, see main.go for more info
-	EducationFuzzyMatcher             *fuzzymatcher.Matcher        `bson:"-" json:"-"`
-	ProfessionExperiencedFuzzyMatcher *fuzzymatcher.Matcher        `bson:"-" json:"-"`
-	DesiredProfessionsFuzzyMatcher    *fuzzymatcher.Matcher        `bson:"-" json:"-"`
-	DomainPartsCache                  [][]string                   `bson:"-" json:"-"`
-	NormalizedDriversLicensesCache    []jsonHelpers.DriversLicense `bson:"-" json:"-"`
+	EducationFuzzyMatcher               *TermsMatcher                `bson:"-" json:"-"`
+	ProfessionExperiencedFuzzyMatcher   *TermsMatcher                `bson:"-" json:"-"`
+	DesiredProfessionsFuzzyMatcher      *TermsMatcher                `bson:"-" json:"-"`
+	LanguagesFuzzyMatcher               *TermsMatcher                `bson:"-" json:"-"`
+	SkillsFuzzyMatcher                  *TermsMatcher                `bson:"-" json:"-"`
+	NormalizedSkillsCache               []string                     `bson:"-" json:"-"`
+	ExcludedPreferredJobsFuzzyMatcher   *TermsMatcher                `bson:"-" json:"-"`
+	ExcludedWorkExperiencesFuzzyMatcher *TermsMatcher                `bson:"-" json:"-"`
+	ExcludedEducationsFuzzyMatcher      *TermsMatcher                `bson:"-" json:"-"`
+	DomainPartsCache                    [][]string                   `bson:"-" json:"-"`
+	NormalizedDriversLicensesCache      []jsonHelpers.DriversLicense `bson:"-" json:"-"`
+	// preparedForMatching is set by PrepareForMatching
+	preparedForMatching bool
+}
+
+// TermsMatcher fuzzy matches text against a list of terms and their aliases
+// It's safe to use a TermsMatcher from multiple goroutines
+type TermsMatcher struct {
+	// m guards the matcher as the fuzzy matcher keeps state while matching
+	m       sync.Mutex
+	matcher *fuzzymatcher.Matcher
+	// termIdx maps the index of an entry in the matcher to the index of the term the entry belongs to
+	termIdx []int
+}
+
+// NewTermsMatcher creates a new TermsMatcher
+// aliases can be nil, if set it should have the same length as terms
+//
+// The terms and the text to match are normalized using wordvalidator.NormalizeForMatching
+// so differences in diacritics, word forms and compound words are ignored
+func NewTermsMatcher(terms []string, aliases [][]string) *TermsMatcher {
+	entries := make([]string, 0, len(terms))
+	termIdx := make([]int, 0, len(terms))
+	for idx, term := range terms {
+		entries = append(entries, normalizeTerm(term))
+		termIdx = append(termIdx, idx)
+		if aliases != nil {
+			for _, alias := range aliases[idx] {
+				entries = append(entries, normalizeTerm(alias))
+				termIdx = append(termIdx, idx)
+			}
+		}
+	}
+
+	return &TermsMatcher{
+		matcher: fuzzymatcher.NewMatcher(entries...),
+		termIdx: termIdx,
+	}
+}
+
+// Match returns the index of the term that matched text or -1 if nothing matched
+// If an alias matched, the index of the term the alias belongs to is returned
+func (m *TermsMatcher) Match(text string) int {
+	text = wordvalidator.NormalizeForMatching(text)
+	if len(text) == 0 {
+		return -1
+	}
+
+	m.m.Lock()
+	idx := m.matcher.Match(text)
+	m.m.Unlock()
+	if idx == -1 {
+		return -1
+	}
+	return m.termIdx[idx]
+}
+
+// normalizeTerm normalizes a term for the fuzzy matcher
+// If nothing is left of the term after normalizing the original term is used
+func normalizeTerm(term string) string {
+	normalized := wordvalidator.NormalizeForMatching(term)
+	if len(normalized) == 0 {
+		return term
+	}
+	return normalized
+}
+
+// Clone returns a deep copy of the profile
+// The caches used by the matcher and the aliases of the professions and educations are not copied
+func (p Profile) Clone() (Profile, error) {
+	data, err := bson.Marshal(p)
+	if err != nil {
+		return Profile{}, err
+	}
+	clone := Profile{}
+	err = bson.Unmarshal(data, &clone)
+	return clone, err
+}
+
+// PrepareForMatching builds the fuzzy matchers and other caches used by the matcher
+// Once prepared the matcher only reads the profile so it can be matched from multiple goroutines at the same time,
+// the profile should not be changed anymore after this
+func (p *Profile) PrepareForMatching() {
+	p.EducationFuzzyMatcher = nil
+	if len(p.Educations) > 0 {
+		names := make([]string, len(p.Educations))
+		aliases := make([][]string, len(p.Educations))
+		for idx, education := range p.Educations {
+			names[idx] = education.Name
+			aliases[idx] = education.Aliases
+		}
+		p.EducationFuzzyMatcher = NewTermsMatcher(names, aliases)
+	}
+
+	p.DesiredProfessionsFuzzyMatcher = newProfessionsMatcher(p.DesiredProfessions)
+	p.ProfessionExperiencedFuzzyMatcher = newProfessionsMatcher(p.ProfessionExperienced)
+
+	p.LanguagesFuzzyMatcher = nil
+	if len(p.Languages) > 0 {
+		names := make([]string, len(p.Languages))
+		for idx, language := range p.Languages {
+			names[idx] = language.Name
+		}
+		p.LanguagesFuzzyMatcher = NewTermsMatcher(names, nil)
+	}
+
+	p.SkillsFuzzyMatcher = nil
+	p.NormalizedSkillsCache = nil
+	if len(p.Skills) > 0 {
+		names := make([]string, len(p.Skills))
+		p.NormalizedSkillsCache = make([]string, len(p.Skills))
+		for idx, skill := range p.Skills {
+			names[idx] = skill.Name
+			p.NormalizedSkillsCache[idx] = wordvalidator.NormalizeForMatching(skill.Name)
+		}
+		p.SkillsFuzzyMatcher = NewTermsMatcher(names, nil)
+	}
+
+	p.ExcludedPreferredJobsFuzzyMatcher = newOptionalTermsMatcher(p.Exclusions.PreferredJobs)
+	p.ExcludedWorkExperiencesFuzzyMatcher = newOptionalTermsMatcher(p.Exclusions.WorkExperiences)
+	p.ExcludedEducationsFuzzyMatcher = newOptionalTermsMatcher(p.Exclusions.Educations)
+
+	p.NormalizedDriversLicensesCache = []jsonHelpers.DriversLicense{}
+	for _, l := range p.DriversLicenses {
+		normalizedDriversLicense := strings.ToUpper(strings.ReplaceAll(l.Name, " ", ""))
+		if len(normalizedDriversLicense) == 0 {
+			continue
+		}
+		p.NormalizedDriversLicensesCache = append(
+			p.NormalizedDriversLicensesCache,
+			jsonHelpers.NewDriversLicense(normalizedDriversLicense),
+		)
+	}
+
+	p.preparedForMatching = true
+}
+
+// PreparedForMatching returns whether PrepareForMatching was called after the last change to the aliases of the profile
+func (p *Profile) PreparedForMatching() bool {
+	return p.preparedForMatching
+}
+
+// newProfessionsMatcher returns a matcher for the professions and their aliases, or nil if there are no professions
+func newProfessionsMatcher(professions []ProfileProfession) *TermsMatcher {
+	if len(professions) == 0 {
+		return nil
+	}
+	names := make([]string, len(professions))
+	aliases := make([][]string, len(professions))
+	for idx, profession := range professions {
+		names[idx] = profession.Name
+		aliases[idx] = profession.Aliases
+	}
+	return NewTermsMatcher(names, aliases)
+}
+
+// newOptionalTermsMatcher returns a matcher for the terms, or nil if there are no terms
+func newOptionalTermsMatcher(terms []string) *TermsMatcher {
+	if len(terms) == 0 {
+		return nil
+	}
+	return NewTermsMatcher(terms, nil)
 }
 
 // CollectionName returns the collection name of the Profile
@@ -69,11 +268,15 @@ func (*Profile) CollectionName() string {
 func (*Profile) Indexes() []mongo.IndexModel {
 	return []mongo.IndexModel{
 		{Keys: bson.M{"active": 1}},
+		{Keys: bson.M{"activeUntil": 1}},
 		{Keys: bson.M{"desiredProfessions": 1}},
 		{Keys: bson.M{"professionExperienced": 1}},
 		{Keys: bson.M{"driversLicenses": 1}},
 		{Keys: bson.M{"educations": 1}},
+		{Keys: bson.M{"languages": 1}},
+		{Keys: bson.M{"skills": 1}},
 		{Keys: bson.M{"zipCodes": 1}},
+		{Keys: bson.M{"zipRadiuses": 1}},
 		{Keys: bson.M{"onMatch.sendMail": 1}},
 		{Keys: bson.M{"onMatch.httpCall": 1}},
 	}
@@ -90,6 +293,8 @@ func actualActiveProfilesFilter() bson.M {
 					{"professionExperienced": isArrayWContent},
 					{"driversLicenses": isArrayWContent},
 					{"educations": isArrayWContent},
+					{"languages": isArrayWContent},
+					{"skills": isArrayWContent},
 				},
 			},
 			{
@@ -103,7 +308,7 @@ func actualActiveProfilesFilter() bson.M {
 }
 
 // GetActualActiveProfiles returns that we can actually use
-// Matches are not really helpfull if no desiredProfessions, professionExperienced, driversLicenses or educations is set
+// Matches are not really helpfull if no desiredProfessions, professionExperienced, driversLicenses, educations, languages or skills is set
 // Matches without an onMatch property are useless as we can't send the match anywhere
 func GetActualActiveProfiles(conn db.Connection) ([]Profile, error) {
 	profiles := []Profile{}
@@ -139,6 +344,9 @@ func GetProfile(conn db.Connection, id primitive.ObjectID) (Profile, error) {
 type ProfileProfession struct {
 	Name string `json:"name"`
 
+	// Aliases are the synonyms of the name, set by (*SynonymIndex).ExpandProfile
+	Aliases []string `json:"-" bson:"-"`
+
 	// TODO find out what this is about?
 	// HeadFunctionID int
 	// SubsectorLevel1ID int
@@ -157,34 +365,222 @@ type ProfileDriversLicense struct {
 // ProfileEducation contains information about an education
 type ProfileEducation struct {
 	Name string `json:"name"`
+
+	// Aliases are the synonyms of the name, set by (*SynonymIndex).ExpandProfile
+	Aliases []string `json:"-" bson:"-"`
+
 	// HeadEducationID int
 	// SubsectorID     int
 }
 
+// ProfileLanguage contains a language a CV should have and the minimal levels of it
+type ProfileLanguage struct {
+	Name         string        `json:"name"`
+	LevelSpoken  LanguageLevel `json:"levelSpoken" bson:"levelSpoken" description:"The minimal spoken level, 0 (unknown) means any level is fine"`
+	LevelWritten LanguageLevel `json:"levelWritten" bson:"levelWritten" description:"The minimal written level, 0 (unknown) means any level is fine"`
+}
+
+// MetBy returns true if the language of a CV meets the minimal levels of the profile language
+// Note that this does not check the name of the language
+func (l ProfileLanguage) MetBy(cvLanguage Language) bool {
+	return cvLanguage.LevelSpoken >= l.LevelSpoken && cvLanguage.LevelWritten >= l.LevelWritten
+}
+
+// ProfileSkill is a skill or keyword a CV should have
+type ProfileSkill struct {
+	Name string `json:"name"`
+}
+
 // type ProfileProfession struct {
 // 	ID        int `gorm:"primaryKey"`
 // 	ProfileID int
 // 	Name      string
 // }
 
-// ProfileDutchZipcode is dutch zipcode range limited to the number
-type ProfileDutchZipcode struct {
-	From uint16 `json:"from"`
-	To   uint16 `json:"to"`
+// ProfileZipcode is a zipcode range of a country limited to the number part of the zipcode
+type ProfileZipcode struct {
+	Country postalcode.Country `json:"country" bson:"country,omitempty" description:"The ISO 3166-1 alpha-2 code of the country of the zipcodes, supported are NL, BE and DE. Defaults to NL"`
+	From    uint32             `json:"from"`
+	To      uint32             `json:"to"`
 }
 
-// IsWithinCithAndArea checks if the cityAndArea provided are in the range range of the zipcode
-func (p *ProfileDutchZipcode) IsWithinCithAndArea(cityAndArea uint16) bool {
+// Contains checks if the zipcode is within the range of the profile zipcode
+func (p *ProfileZipcode) Contains(zipcode postalcode.Code) bool {
 	if p.From > p.To {
 		// Swap from and to
 		p.From, p.To = p.To, p.From
 	}
 
-	if cityAndArea < 1_000 || cityAndArea >= 10_000 {
-		// Illegal postal code
+	if p.Country.OrDefault() != zipcode.Country || !zipcode.Country.ValidNumber(zipcode.Number) {
 		return false
 	}
-	return p.From <= cityAndArea && p.To >= cityAndArea
+	return p.From <= zipcode.Number && p.To >= zipcode.Number
+}
+
+// String formats the range for usage in a reason or error
+// The country is only included for non dutch zipcodes to keep the common case readable
+func (p ProfileZipcode) String() string {
+	country := p.Country.OrDefault()
+	from := postalcode.Code{Country: country, Number: p.From}.String()
+	to := postalcode.Code{Country: country, Number: p.To}.String()
+	if country == postalcode.DefaultCountry {
+		return from + "-" + to
+	}
+	return string(country) + " " + from + "-" + to
+}
+
+// ValidateProfileZipcodes validates the zipcode ranges of a profile
+func ValidateProfileZipcodes(zipcodes []ProfileZipcode) error {
+	for idx, zipcode := range zipcodes {
+		if !zipcode.Country.Valid() {
+			return fmt.Errorf("zipCodes[%d].country: unsupported country %s", idx, zipcode.Country)
+		}
+		if !zipcode.Country.ValidNumber(zipcode.From) {
+			return fmt.Errorf("zipCodes[%d].from: %d is not a valid %s zipcode", idx, zipcode.From, zipcode.Country.OrDefault())
+		}
+		if !zipcode.Country.ValidNumber(zipcode.To) {
+			return fmt.Errorf("zipCodes[%d].to: %d is not a valid %s zipcode", idx, zipcode.To, zipcode.Country.OrDefault())
+		}
+	}
+	return nil
+}
+
+// ProfileZipRadius is an area around a centre
+// The centre is defined by a dutch zipcode or by coordinates
+type ProfileZipRadius struct {
+	Zipcode  uint16           `json:"zipcode" description:"The 4 digits of the dutch zipcode of the centre, ignored if center is set. Only dutch CVs can match a zip radius as we only know the coordinates of dutch zipcodes"`
+	Center   *geo.Coordinates `json:"center" description:"The coordinates of the centre"`
+	RadiusKm float64          `json:"radiusKm" bson:"radiusKm"`
+}
+
+// CenterCoordinates returns the coordinates of the centre of the area
+// The second return value is false if the centre is a zipcode we don't know the coordinates of
+func (r ProfileZipRadius) CenterCoordinates() (geo.Coordinates, bool) {
+	if r.Center != nil {
+		return *r.Center, true
+	}
+	return geo.DutchPC4Coordinates(r.Zipcode)
+}
+
+// ValidateProfileZipRadiuses validates the zip radiuses of a profile
+func ValidateProfileZipRadiuses(zipRadiuses []ProfileZipRadius) error {
+	for idx, zipRadius := range zipRadiuses {
+		if zipRadius.RadiusKm <= 0 {
+			return fmt.Errorf("zipRadiuses[%d].radiusKm: must be more than 0", idx)
+		}
+		if zipRadius.Center != nil {
+			if !zipRadius.Center.Valid() {
+				return fmt.Errorf("zipRadiuses[%d].center: invalid coordinates", idx)
+			}
+			continue
+		}
+		if zipRadius.Zipcode == 0 {
+			return fmt.Errorf("zipRadiuses[%d]: zipcode or center must be set", idx)
+		}
+		if !postalcode.CountryNL.ValidNumber(uint32(zipRadius.Zipcode)) {
+			return fmt.Errorf("zipRadiuses[%d].zipcode: %d is not a valid dutch zipcode", idx, zipRadius.Zipcode)
+		}
+		_, ok := zipRadius.CenterCoordinates()
+		if !ok {
+			return fmt.Errorf("zipRadiuses[%d].zipcode: unknown zipcode %d, use center instead", idx, zipRadius.Zipcode)
+		}
+	}
+	return nil
+}
+
+// ProfileExclusions defines the CVs a profile never wants to match
+// The terms are fuzzy matched the same way as the desired professions, profession experienced and educations of a profile
+type ProfileExclusions struct {
+	PreferredJobs   []string `json:"preferredJobs" bson:"preferredJobs" description:"Exclude CVs with a preferred job that matches one of these terms"`
+	WorkExperiences []string `json:"workExperiences" bson:"workExperiences" description:"Exclude CVs with a work experience profession that matches one of these terms"`
+	Educations      []string `json:"educations" bson:"educations" description:"Exclude CVs with an education that matches one of these terms"`
+	YearsSinceWork  *int     `json:"yearsSinceWork" bson:"yearsSinceWork" description:"Exclude CVs of which the last work experience ended more than this amount of years ago, CVs that are still employed or have no work experiences with an end date are not excluded"`
+}
+
+// IsEmpty returns true if there are no exclusions defined
+func (e ProfileExclusions) IsEmpty() bool {
+	return len(e.PreferredJobs) == 0 &&
+		len(e.WorkExperiences) == 0 &&
+		len(e.Educations) == 0 &&
+		e.YearsSinceWork == nil
+}
+
+// Validate checks if the exclusions are usable
+func (e ProfileExclusions) Validate() error {
+	lists := []struct {
+		name  string
+		terms []string
+	}{
+		{"preferredJobs", e.PreferredJobs},
+		{"workExperiences", e.WorkExperiences},
+		{"educations", e.Educations},
+	}
+	for _, list := range lists {
+		for idx, term := range list.terms {
+			if len(strings.TrimSpace(term)) == 0 {
+				return fmt.Errorf("exclusions.%s[%d]: cannot be empty", list.name, idx)
+			}
+		}
+	}
+	if e.YearsSinceWork != nil && *e.YearsSinceWork < 0 {
+		return errors.New("exclusions.yearsSinceWork: cannot be negative")
+	}
+	return nil
+}
+
+// ProfileScoreWeights defines how much every matched criterion adds to the score of a match
+type ProfileScoreWeights struct {
+	DesiredProfession     float64 `json:"desiredProfession" bson:"desiredProfession"`
+	ProfessionExperienced float64 `json:"professionExperienced" bson:"professionExperienced"`
+	Education             float64 `json:"education" bson:"education"`
+	DriversLicense        float64 `json:"driversLicense" bson:"driversLicense"`
+	Language              float64 `json:"language" bson:"language"`
+	Skill                 float64 `json:"skill" bson:"skill"`
+	ZipDistance           float64 `json:"zipDistance" bson:"zipDistance" description:"Multiplied with how close the zipcode is to the center of the matched zipcode range or radius, a zipcode at the edge counts for half"`
+	Recency               float64 `json:"recency" bson:"recency" description:"Multiplied with how recent the last work experience of the CV is, still employed counts as fully recent"`
+}
+
+// DefaultProfileScoreWeights are the weights used when a profile has no score weights defined
+var DefaultProfileScoreWeights = ProfileScoreWeights{
+	DesiredProfession:     1,
+	ProfessionExperienced: 1,
+	Education:             1,
+	DriversLicense:        1,
+	Language:              1,
+	Skill:                 1,
+	ZipDistance:           1,
+	Recency:               1,
+}
+
+// GetScoreWeights returns the score weights of the profile or the default weights if none are set
+func (p *Profile) GetScoreWeights() ProfileScoreWeights {
+	if p.ScoreWeights == nil {
+		return DefaultProfileScoreWeights
+	}
+	return *p.ScoreWeights
+}
+
+// Validate checks if the weights are usable
+func (w ProfileScoreWeights) Validate() error {
+	weights := []struct {
+		name   string
+		weight float64
+	}{
+		{"desiredProfession", w.DesiredProfession},
+		{"professionExperienced", w.ProfessionExperienced},
+		{"education", w.Education},
+		{"driversLicense", w.DriversLicense},
+		{"language", w.Language},
+		{"skill", w.Skill},
+		{"zipDistance", w.ZipDistance},
+		{"recency", w.Recency},
+	}
+	for _, entry := range weights {
+		if entry.weight < 0 {
+			return fmt.Errorf("scoreWeights.%s: cannot be negative", entry.name)
+		}
+	}
+	return nil
 }
 
 // ProfileOnMatch defines what should happen when a profile is matched to a CV
@@ -237,62 +633,60 @@ type PdfOptions struct {
 	CompanyAddress *string `json:"companyAddress" bson:"companyAddress"`
 }
 
-// ProfileSendEmailData only contains an email address atm
+// ProfileSendEmailData defines an email address that should receive the matches
 type ProfileSendEmailData struct {
-	Email string `json:"email"`
+	Email    string               `json:"email"`
+	Delivery ProfileEmailDelivery `json:"delivery" bson:"delivery,omitempty" description:"when the matches are sent, immediate (default) sends an email per match, hourly and daily send a single digest email with all the matches of that period"`
 }
 
-// SendEmail sends an email
-func (d *ProfileSendEmailData) SendEmail(profile Profile, htmlBody []byte, pdfFile *os.File) error {
-	e := email.NewEmail()
+// ProfileEmailDelivery defines when the matches are sent to an email address
+type ProfileEmailDelivery string
 
-	e.To = []string{d.Email}
-	e.Subject = "Nieuwe match voor " + profile.Name
-	e.HTML = htmlBody
-	text, _ := html2text.FromString(string(htmlBody), html2text.Options{})
-	e.Text = []byte(text)
+const (
+	// ProfileEmailDeliveryImmediate sends an email per match as soon as the match is made, this is the default
+	ProfileEmailDeliveryImmediate = ProfileEmailDelivery("immediate")
+	// ProfileEmailDeliveryHourly sends a digest email with the matches of the last hour
+	ProfileEmailDeliveryHourly = ProfileEmailDelivery("hourly")
+	// ProfileEmailDeliveryDaily sends a digest email with the matches of the last day
+	ProfileEmailDeliveryDaily = ProfileEmailDelivery("daily")
+)
 
-	if pdfFile != nil {
-		pdfFile.Seek(0, 0)
-		_, err := e.Attach(pdfFile, "match.pdf", "application/pdf")
-		if err != nil {
-			return err
-		}
+// Valid returns true if the delivery is known, an empty delivery defaults to immediate
+func (d ProfileEmailDelivery) Valid() bool {
+	switch d {
+	case "", ProfileEmailDeliveryImmediate, ProfileEmailDeliveryHourly, ProfileEmailDeliveryDaily:
+		return true
+	default:
+		return false
 	}
-
-	emailservice.SendMail(e)
-	return nil
 }
 
-// ProfileHTTPCallData defines a http address that should be called when a match was made
-type ProfileHTTPCallData struct {
-	URI    string `json:"uri"`
-	Method string `json:"method"`
+// IsDigest returns true if the matches are collected and sent as a digest email
+func (d ProfileEmailDelivery) IsDigest() bool {
+	return d == ProfileEmailDeliveryHourly || d == ProfileEmailDeliveryDaily
 }
 
-// MakeRequest creates a http request
-func (d *ProfileHTTPCallData) MakeRequest(profile Profile, match Match) {
-	req := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(req)
-	req.SetRequestURI(d.URI)
-	req.Header.SetMethod(d.Method)
+// NewEmailMessage creates the email with content to d, if pdfFile is set it's attached to the email
+func (d *ProfileSendEmailData) NewEmailMessage(content EmailContent, pdfFile *os.File) (EmailMessage, error) {
+	message := content.Message(d.Email)
+	if pdfFile == nil {
+		return message, nil
+	}
 
-	// FIXME set request timeout
-	// FIXME url data in case of get request
-	value, err := json.Marshal(map[string]interface{}{
-		"profileId": profile.ID.Hex(),
-		"match":     match,
-	})
+	_, err := pdfFile.Seek(0, 0)
 	if err != nil {
-		req.ResetBody()
-		req.AppendBody(value)
+		return message, err
 	}
-
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(resp)
-
-	// We don't care about the error returned here as it's not our task to keep the endpoint running
-	var _ = fasthttp.Do(req, resp)
+	pdf, err := io.ReadAll(pdfFile)
+	if err != nil {
+		return message, err
+	}
+	message.Attachments = append(message.Attachments, EmailAttachment{
+		Filename:    "match.pdf",
+		ContentType: "application/pdf",
+		Content:     pdf,
+	})
+	return message, nil
 }
 
 // CheckAPIKeysExists checks if apiKeys are valid IDs of existing keys
@@ -317,6 +711,83 @@ outer:
 	return nil
 }
 
+// ValidateProfileLanguages validates the languages of a profile
+func ValidateProfileLanguages(languages []ProfileLanguage) error {
+	for idx, language := range languages {
+		if len(language.Name) == 0 {
+			return fmt.Errorf("languages[%d].name: cannot be empty", idx)
+		}
+		if !language.LevelSpoken.Valid() {
+			return fmt.Errorf("languages[%d].levelSpoken: invalid language level", idx)
+		}
+		if !language.LevelWritten.Valid() {
+			return fmt.Errorf("languages[%d].levelWritten: invalid language level", idx)
+		}
+	}
+	return nil
+}
+
+// WeeklyHoursMetBy returns true if the weekly hours of a work experience are within the min and max weekly hours of the profile
+// If the profile has a min or max weekly hours, work experiences with unknown (0) weekly hours never meet it
+func (p *Profile) WeeklyHoursMetBy(hours int) bool {
+	if p.MinWeeklyHours == 0 && p.MaxWeeklyHours == 0 {
+		return true
+	}
+	if hours <= 0 {
+		return false
+	}
+	return hours >= p.MinWeeklyHours && (p.MaxWeeklyHours == 0 || hours <= p.MaxWeeklyHours)
+}
+
+// ValidateExperience validates the years of experience and weekly hours of a profile
+func (p *Profile) ValidateExperience() error {
+	if p.MinYearsExperience < 0 {
+		return errors.New("minYearsExperience: cannot be negative")
+	}
+	if p.MinWeeklyHours < 0 {
+		return errors.New("minWeeklyHours: cannot be negative")
+	}
+	if p.MaxWeeklyHours < 0 {
+		return errors.New("maxWeeklyHours: cannot be negative")
+	}
+	if p.MaxWeeklyHours > 0 && p.MaxWeeklyHours < p.MinWeeklyHours {
+		return errors.New("maxWeeklyHours: cannot be less than minWeeklyHours")
+	}
+	return nil
+}
+
+// ValidateAgeAndAvailability validates the age range and availability of a profile
+func (p *Profile) ValidateAgeAndAvailability() error {
+	if p.MinAge < 0 {
+		return errors.New("minAge: cannot be negative")
+	}
+	if p.MaxAge < 0 {
+		return errors.New("maxAge: cannot be negative")
+	}
+	if p.MaxAge > 0 && p.MaxAge < p.MinAge {
+		return errors.New("maxAge: cannot be less than minAge")
+	}
+	if p.AvailableWithinDays != nil && *p.AvailableWithinDays < 0 {
+		return errors.New("availableWithinDays: cannot be negative")
+	}
+	return nil
+}
+
+// HasAgeCriteria returns true if the profile has a minimal or maximal age
+func (p *Profile) HasAgeCriteria() bool {
+	return p.MinAge > 0 || p.MaxAge > 0
+}
+
+// ValidateProfileSkills validates the skills of a profile
+func ValidateProfileSkills(skills []ProfileSkill) error {
+	for idx, skill := range skills {
+		if len(strings.TrimSpace(skill.Name)) == 0 {
+			return fmt.Errorf("skills[%d].name: cannot be empty", idx)
+		}
+	}
+	return nil
+}
+
 // ValidateCreateNewProfile validates a new profile to create
 func (p *Profile) ValidateCreateNewProfile(conn db.Connection) error {
 	// TODO this needs more validation
@@ -332,43 +803,124 @@ func (p *Profile) ValidateCreateNewProfile(conn db.Connection) error {
 		}
 	}
 
+	if p.ScoreWeights != nil {
+		err := p.ScoreWeights.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if p.MinimumScore < 0 {
+		return errors.New("minimumScore: cannot be negative")
+	}
+
+	err := p.ValidateExperience()
+	if err != nil {
+		return err
+	}
+
+	err = p.ValidateAgeAndAvailability()
+	if err != nil {
+		return err
+	}
+
+	err = p.ValidateScheduleAndQuota()
+	if err != nil {
+		return err
+	}
+
+	err = ValidateProfileLanguages(p.Languages)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateProfileSkills(p.Skills)
+	if err != nil {
+		return err
+	}
+
+	if p.Criteria != nil {
+		err = p.Criteria.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.Exclusions.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = ValidateProfileZipcodes(p.Zipcodes)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateProfileZipRadiuses(p.ZipRadiuses)
+	if err != nil {
+		return err
+	}
+
 	if len(p.OnMatch.SendMail) == 0 && len(p.OnMatch.HTTPCall) == 0 {
 		return errors.New("at least on of the profile onMatch options be set")
 	}
-	emailRegex := regexp.MustCompile(
-		"^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@" +
-			"[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?" +
-			"(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$",
-	)
-	for idx, mail := range p.OnMatch.SendMail {
-		if len(mail.Email) < 3 || len(mail.Email) > 254 || !emailRegex.MatchString(mail.Email) {
-			return fmt.Errorf("onMatch.sendMail[%d].email: invalid email address", idx)
-		}
+
+	err = p.OnMatch.ValidateSendMail()
+	if err != nil {
+		return err
 	}
-	for idx, call := range p.OnMatch.HTTPCall {
-		uri, err := url.Parse(call.URI)
-		if err != nil {
-			return fmt.Errorf("onMatch.httpCall[%d].uri: %s", idx, err.Error())
+
+	err = p.OnMatch.ValidateHTTPCalls()
+	if err != nil {
+		return err
+	}
+
+	return p.ValidateEmailSettings(conn)
+}
+
+// ValidateEmailSettings validates the locale and the email templates of the profile
+func (p *Profile) ValidateEmailSettings(conn db.Connection) error {
+	if !p.Locale.Valid() {
+		return fmt.Errorf("locale: unknown locale %s", p.Locale)
+	}
+
+	templates := []struct {
+		field string
+		id    *primitive.ObjectID
+		kind  EmailTemplateKind
+	}{
+		{"matchEmailTemplateId", p.MatchEmailTemplateID, EmailTemplateKindMatch},
+		{"digestEmailTemplateId", p.DigestEmailTemplateID, EmailTemplateKindDigest},
+	}
+	for _, entry := range templates {
+		if entry.id == nil {
+			continue
 		}
-		if uri.Scheme != "http" && uri.Scheme != "https" {
-			return fmt.Errorf("onMatch.httpCall[%d].uri: url schema must be set to http or https", idx)
+		emailTemplate, err := GetEmailTemplate(conn, *entry.id)
+		if err != nil {
+			return fmt.Errorf("%s: unknown email template %s", entry.field, entry.id.Hex())
 		}
-		if uri.User != nil {
-			return fmt.Errorf("onMatch.httpCall[%d].uri: user information is not allowed", idx)
+		if emailTemplate.Kind != entry.kind {
+			return fmt.Errorf("%s: must be a %s template", entry.field, entry.kind)
 		}
-		if uri.Host == "" && uri.Opaque == "" {
-			return fmt.Errorf("onMatch.httpCall[%d].uri: host must be set", idx)
+	}
+	return nil
+}
+
+var emailRegex = regexp.MustCompile(
+	"^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@" +
+		"[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?" +
+		"(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$",
+)
+
+// ValidateSendMail validates the email addresses of onMatch
+func (onMatch *ProfileOnMatch) ValidateSendMail() error {
+	for idx, mail := range onMatch.SendMail {
+		if len(mail.Email) < 3 || len(mail.Email) > 254 || !emailRegex.MatchString(mail.Email) {
+			return fmt.Errorf("onMatch.sendMail[%d].email: invalid email address", idx)
 		}
-		switch call.Method {
-		case "", "GET", "POST", "PATCH", "PUT", "DELETE":
-		default:
-			return fmt.Errorf(
-				"onMatch.httpCall[%d].method: not a valid method, must be one of "+
-					`"GET", "POST", "PATCH", "PUT", "DELETE" or empty to default to GET`,
-				idx,
-			)
+		if !mail.Delivery.Valid() {
+			return fmt.Errorf(`onMatch.sendMail[%d].delivery: must be "immediate", "hourly", "daily" or empty to default to immediate`, idx)
 		}
 	}
-
 	return nil
 }
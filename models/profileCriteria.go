@@ -0,0 +1,192 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/mjarkk/jsonschema"
+)
+
+// ProfileCriterion is the name of a profile criterion that can be used in a criteria expression
+// The names are equal to the json field names of the profile field that defines the criterion
+type ProfileCriterion string
+
+// The profile criteria that can be used in a criteria expression
+const (
+	ProfileCriterionEducations            ProfileCriterion = "educations"
+	ProfileCriterionDesiredProfessions    ProfileCriterion = "desiredProfessions"
+	ProfileCriterionProfessionExperienced ProfileCriterion = "professionExperienced"
+	ProfileCriterionDriversLicenses       ProfileCriterion = "driversLicenses"
+	ProfileCriterionLanguages             ProfileCriterion = "languages"
+	ProfileCriterionSkills                ProfileCriterion = "skills"
+)
+
+// ProfileCriteria contains all the criteria that can be used in a criteria expression
+var ProfileCriteria = []ProfileCriterion{
+	ProfileCriterionEducations,
+	ProfileCriterionDesiredProfessions,
+	ProfileCriterionProfessionExperienced,
+	ProfileCriterionDriversLicenses,
+	ProfileCriterionLanguages,
+	ProfileCriterionSkills,
+}
+
+// Valid returns true if the criterion is known
+func (c ProfileCriterion) Valid() bool {
+	for _, criterion := range ProfileCriteria {
+		if c == criterion {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONSchemaDescribe implements schema.Describe
+func (ProfileCriterion) JSONSchemaDescribe() jsonschema.Property {
+	enum := make([]json.RawMessage, len(ProfileCriteria))
+	for idx, criterion := range ProfileCriteria {
+		enum[idx] = json.RawMessage(`"` + criterion + `"`)
+	}
+
+	return jsonschema.Property{
+		Title:       "Profile criterion",
+		Description: "A criterion is met if one of the values of the profile field with the same name matched the CV, a criterion without values is never met",
+		Type:        jsonschema.PropertyTypeString,
+		Enum:        enum,
+	}
+}
+
+// maxProfileCriteriaExpressionDepth limits how deeply nested a criteria expression can be
+const maxProfileCriteriaExpressionDepth = 10
+
+// ProfileCriteriaExpression is a boolean expression over the profile criteria
+// Exactly one of the fields must be set
+//
+// Example of (desiredProfessions AND driversLicenses) OR (professionExperienced AND educations):
+//
+//	{"or": [
+//	  {"and": [{"criterion": "desiredProfessions"}, {"criterion": "driversLicenses"}]},
+//	  {"and": [{"criterion": "professionExperienced"}, {"criterion": "educations"}]}
+//	]}
+type ProfileCriteriaExpression struct {
+	Criterion ProfileCriterion            `json:"criterion,omitempty" bson:"criterion,omitempty" jsonSchema:"notRequired" description:"Met if one of the values of the profile field with this name matched the CV, a criterion without values is never met"`
+	And       []ProfileCriteriaExpression `json:"and,omitempty" bson:"and,omitempty" description:"Met if all of the expressions are met"`
+	Or        []ProfileCriteriaExpression `json:"or,omitempty" bson:"or,omitempty" description:"Met if at least one of the expressions is met"`
+	Not       *ProfileCriteriaExpression  `json:"not,omitempty" bson:"not,omitempty" description:"Met if the expression is not met"`
+}
+
+// Validate checks if the expression is usable
+func (e ProfileCriteriaExpression) Validate() error {
+	return e.validate("criteria", 0)
+}
+
+func (e ProfileCriteriaExpression) validate(path string, depth int) error {
+	if depth > maxProfileCriteriaExpressionDepth {
+		return errors.New(path + ": expression nested too deep")
+	}
+
+	setFields := 0
+	if e.Criterion != "" {
+		setFields++
+	}
+	if e.And != nil {
+		setFields++
+	}
+	if e.Or != nil {
+		setFields++
+	}
+	if e.Not != nil {
+		setFields++
+	}
+	if setFields != 1 {
+		return errors.New(path + ": exactly one of criterion, and, or and not must be set")
+	}
+
+	switch {
+	case e.Criterion != "":
+		if !e.Criterion.Valid() {
+			return errors.New(path + ".criterion: unknown criterion " + string(e.Criterion))
+		}
+	case e.And != nil:
+		return validateProfileCriteriaExpressions(path+".and", e.And, depth)
+	case e.Or != nil:
+		return validateProfileCriteriaExpressions(path+".or", e.Or, depth)
+	case e.Not != nil:
+		return e.Not.validate(path+".not", depth+1)
+	}
+	return nil
+}
+
+func validateProfileCriteriaExpressions(path string, expressions []ProfileCriteriaExpression, depth int) error {
+	if len(expressions) == 0 {
+		return errors.New(path + ": must contain at least one expression")
+	}
+	for idx, expression := range expressions {
+		err := expression.validate(path+"["+strconv.Itoa(idx)+"]", depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate evaluates the expression, met is called to check if a single criterion is met
+func (e ProfileCriteriaExpression) Evaluate(met func(ProfileCriterion) bool) bool {
+	switch {
+	case e.Criterion != "":
+		return met(e.Criterion)
+	case e.And != nil:
+		for _, expression := range e.And {
+			if !expression.Evaluate(met) {
+				return false
+			}
+		}
+		return true
+	case e.Or != nil:
+		for _, expression := range e.Or {
+			if expression.Evaluate(met) {
+				return true
+			}
+		}
+		return false
+	case e.Not != nil:
+		return !e.Not.Evaluate(met)
+	default:
+		return false
+	}
+}
+
+// String formats the expression in a human readable way
+// For example: (desiredProfessions AND driversLicenses) OR NOT languages
+func (e ProfileCriteriaExpression) String() string {
+	join := func(expressions []ProfileCriteriaExpression, operator string) string {
+		parts := make([]string, len(expressions))
+		for idx, expression := range expressions {
+			part := expression.String()
+			if len(expression.And) > 1 || len(expression.Or) > 1 {
+				part = "(" + part + ")"
+			}
+			parts[idx] = part
+		}
+		return strings.Join(parts, " "+operator+" ")
+	}
+
+	switch {
+	case e.Criterion != "":
+		return string(e.Criterion)
+	case e.And != nil:
+		return join(e.And, "AND")
+	case e.Or != nil:
+		return join(e.Or, "OR")
+	case e.Not != nil:
+		inner := e.Not.String()
+		if len(e.Not.And) > 1 || len(e.Not.Or) > 1 {
+			inner = "(" + inner + ")"
+		}
+		return "NOT " + inner
+	default:
+		return ""
+	}
+}
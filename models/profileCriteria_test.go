@@ -0,0 +1,86 @@
+package models
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+func criterionExpr(criterion ProfileCriterion) ProfileCriteriaExpression {
+	return ProfileCriteriaExpression{Criterion: criterion}
+}
+
+func TestProfileCriteriaExpressionValidate(t *testing.T) {
+	validExpressions := []ProfileCriteriaExpression{
+		criterionExpr(ProfileCriterionEducations),
+		{And: []ProfileCriteriaExpression{
+			criterionExpr(ProfileCriterionDesiredProfessions),
+			criterionExpr(ProfileCriterionDriversLicenses),
+		}},
+		{Not: &ProfileCriteriaExpression{Or: []ProfileCriteriaExpression{criterionExpr(ProfileCriterionLanguages)}}},
+	}
+	for _, expression := range validExpressions {
+		NoError(t, expression.Validate(), expression.String())
+	}
+
+	tooDeep := criterionExpr(ProfileCriterionEducations)
+	for i := 0; i <= maxProfileCriteriaExpressionDepth; i++ {
+		inner := tooDeep
+		tooDeep = ProfileCriteriaExpression{Not: &inner}
+	}
+
+	invalidExpressions := []ProfileCriteriaExpression{
+		{},
+		criterionExpr("foo"),
+		{And: []ProfileCriteriaExpression{}},
+		{Or: []ProfileCriteriaExpression{{}}},
+		{
+			Criterion: ProfileCriterionEducations,
+			And:       []ProfileCriteriaExpression{criterionExpr(ProfileCriterionLanguages)},
+		},
+		tooDeep,
+	}
+	for _, expression := range invalidExpressions {
+		Error(t, expression.Validate(), expression.String())
+	}
+}
+
+func TestProfileCriteriaExpressionEvaluate(t *testing.T) {
+	// (desiredProfessions AND driversLicenses) OR (professionExperienced AND educations)
+	expression := ProfileCriteriaExpression{Or: []ProfileCriteriaExpression{
+		{And: []ProfileCriteriaExpression{
+			criterionExpr(ProfileCriterionDesiredProfessions),
+			criterionExpr(ProfileCriterionDriversLicenses),
+		}},
+		{And: []ProfileCriteriaExpression{
+			criterionExpr(ProfileCriterionProfessionExperienced),
+			criterionExpr(ProfileCriterionEducations),
+		}},
+	}}
+	Equal(t, "(desiredProfessions AND driversLicenses) OR (professionExperienced AND educations)", expression.String())
+
+	testCases := []struct {
+		met      []ProfileCriterion
+		expected bool
+	}{
+		{[]ProfileCriterion{}, false},
+		{[]ProfileCriterion{ProfileCriterionDesiredProfessions}, false},
+		{[]ProfileCriterion{ProfileCriterionDesiredProfessions, ProfileCriterionDriversLicenses}, true},
+		{[]ProfileCriterion{ProfileCriterionProfessionExperienced, ProfileCriterionEducations}, true},
+		{[]ProfileCriterion{ProfileCriterionDesiredProfessions, ProfileCriterionEducations}, false},
+	}
+	for _, testCase := range testCases {
+		met := map[ProfileCriterion]bool{}
+		for _, criterion := range testCase.met {
+			met[criterion] = true
+		}
+		Equal(t, testCase.expected, expression.Evaluate(func(criterion ProfileCriterion) bool {
+			return met[criterion]
+		}), testCase.met)
+	}
+
+	not := ProfileCriteriaExpression{Not: &ProfileCriteriaExpression{Criterion: ProfileCriterionLanguages}}
+	Equal(t, "NOT languages", not.String())
+	True(t, not.Evaluate(func(ProfileCriterion) bool { return false }))
+	False(t, not.Evaluate(func(ProfileCriterion) bool { return true }))
+}
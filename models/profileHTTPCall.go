@@ -0,0 +1,406 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/script-development/RT-CV/helpers/crypto"
+	"github.com/valyala/fasthttp"
+)
+
+// ProfileHTTPCallPayloadMode defines how the payload of a http call is sent
+type ProfileHTTPCallPayloadMode string
+
+const (
+	// ProfileHTTPCallPayloadModeBody sends the payload as request body, this is the default
+	ProfileHTTPCallPayloadModeBody = ProfileHTTPCallPayloadMode("body")
+	// ProfileHTTPCallPayloadModeQuery adds the fields of the payload as query parameters to the uri
+	ProfileHTTPCallPayloadModeQuery = ProfileHTTPCallPayloadMode("query")
+)
+
+// ProfileHTTPCallData defines a http address that should be called when a match was made
+type ProfileHTTPCallData struct {
+	URI    string `json:"uri"`
+	Method string `json:"method"`
+
+	PayloadMode  ProfileHTTPCallPayloadMode `json:"payloadMode" bson:"payloadMode,omitempty" description:"how the payload is sent, body (default) or query. In query mode the payload must be a JSON object of which the fields are added as query parameters to the uri, this mode is only allowed for GET requests"`
+	BodyTemplate string                     `json:"bodyTemplate" bson:"bodyTemplate,omitempty" description:"a go text/template used to create the payload instead of the default JSON payload. The template has access to .Profile, .CV and .Match, the json function can be used to JSON encode a value"`
+	Headers      []ProfileHTTPCallHeader    `json:"headers" bson:"headers,omitempty" description:"static headers added to every request"`
+
+	// SigningSecret is only used to set the secret through the api, it's never stored or returned
+	SigningSecret *string `json:"signingSecret,omitempty" bson:"-" description:"the secret used to sign the requests, once set it cannot be read back. Leave out to keep the current secret of the call with the same uri, set to an empty string to stop signing"`
+	// EncryptedSigningSecret is the SigningSecret encrypted with the WEBHOOK_SECRETS_KEY of the server
+	EncryptedSigningSecret string `json:"-" bson:"encryptedSigningSecret,omitempty"`
+	Signed                 bool   `json:"signed" description:"true if the requests contain a signature, this value is ignored when creating or updating a profile"`
+}
+
+// ProfileHTTPCallHeader is a static header added to the requests of a http call
+type ProfileHTTPCallHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value" bson:"value,omitempty" description:"the value of the header, always empty for headers with a secret value"`
+
+	// SecretValue is only used to set the secret value through the api, it's never stored or returned
+	SecretValue *string `json:"secretValue,omitempty" bson:"-" description:"set instead of value to store the value encrypted, for example for authorization headers. Once set it cannot be read back. Leave out to keep the current secret value of the header with the same name"`
+	// EncryptedValue is the SecretValue encrypted with the WEBHOOK_SECRETS_KEY of the server
+	EncryptedValue string `json:"-" bson:"encryptedValue,omitempty"`
+	Secret         bool   `json:"secret" description:"true if the value of this header is secret, this value is ignored when creating or updating a profile"`
+}
+
+// ProfileHTTPCallTemplateData is the data available in the body template of a http call
+type ProfileHTTPCallTemplateData struct {
+	Profile Profile
+	CV      *CV
+	Match   Match
+}
+
+// MinSigningSecretLength is the minimal length of the signing secret of a ProfileHTTPCallData
+const MinSigningSecretLength = 16
+
+// ValidateHTTPCalls validates the http calls of onMatch
+func (onMatch *ProfileOnMatch) ValidateHTTPCalls() error {
+	for idx, call := range onMatch.HTTPCall {
+		err := call.Validate()
+		if err != nil {
+			return fmt.Errorf("onMatch.httpCall[%d].%s", idx, err.Error())
+		}
+	}
+	return nil
+}
+
+// Validate checks if the http call is usable
+func (d *ProfileHTTPCallData) Validate() error {
+	uri, err := url.Parse(d.URI)
+	if err != nil {
+		return fmt.Errorf("uri: %s", err.Error())
+	}
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return errors.New("uri: url schema must be set to http or https")
+	}
+	if uri.User != nil {
+		return errors.New("uri: user information is not allowed")
+	}
+	if uri.Host == "" && uri.Opaque == "" {
+		return errors.New("uri: host must be set")
+	}
+
+	switch d.Method {
+	case "", "GET", "POST", "PATCH", "PUT", "DELETE":
+	default:
+		return errors.New(`method: not a valid method, must be one of "GET", "POST", "PATCH", "PUT", "DELETE" or empty to default to GET`)
+	}
+
+	switch d.PayloadMode {
+	case "", ProfileHTTPCallPayloadModeBody:
+	case ProfileHTTPCallPayloadModeQuery:
+		if d.GetMethod() != "GET" {
+			return errors.New("payloadMode: query mode is only allowed for GET requests")
+		}
+	default:
+		return errors.New(`payloadMode: must be "body", "query" or empty to default to body`)
+	}
+
+	for idx, header := range d.Headers {
+		if header.Name == "" || strings.ContainsAny(header.Name, " :\t\r\n") {
+			return fmt.Errorf("headers[%d].name: not a valid header name", idx)
+		}
+		if strings.ContainsAny(header.Value, "\r\n") {
+			return fmt.Errorf("headers[%d].value: cannot contain newlines", idx)
+		}
+		if header.SecretValue != nil {
+			if header.Value != "" {
+				return fmt.Errorf("headers[%d]: value and secretValue cannot both be set", idx)
+			}
+			if strings.ContainsAny(*header.SecretValue, "\r\n") {
+				return fmt.Errorf("headers[%d].secretValue: cannot contain newlines", idx)
+			}
+		}
+	}
+
+	if d.BodyTemplate != "" {
+		// Render the template with example data to catch errors that only show up when executing the template
+		exampleCV := ExampleCV()
+		payload, err := d.RenderPayload(WebhookPayload{
+			Profile: Profile{Name: "Example profile"},
+			CV:      *exampleCV,
+			Match:   Match{ReferenceNr: exampleCV.ReferenceNumber},
+		})
+		if err != nil {
+			return fmt.Errorf("bodyTemplate: %s", err.Error())
+		}
+		if d.PayloadMode == ProfileHTTPCallPayloadModeQuery {
+			err = json.Unmarshal(payload, &map[string]json.RawMessage{})
+			if err != nil {
+				return errors.New("bodyTemplate: must render a JSON object in query mode")
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetMethod returns the http method of the call, defaults to GET
+func (d *ProfileHTTPCallData) GetMethod() string {
+	if d.Method == "" {
+		return "GET"
+	}
+	return d.Method
+}
+
+var profileHTTPCallTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// RenderPayload returns the payload of a request, the default JSON payload or the result of the body template
+func (d *ProfileHTTPCallData) RenderPayload(payload WebhookPayload) ([]byte, error) {
+	if d.BodyTemplate == "" {
+		return json.Marshal(payload)
+	}
+
+	tmpl, err := template.New("bodyTemplate").Funcs(profileHTTPCallTemplateFuncs).Option("missingkey=error").Parse(d.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	buff := bytes.NewBuffer(nil)
+	err = tmpl.Execute(buff, ProfileHTTPCallTemplateData{
+		Profile: payload.Profile,
+		CV:      &payload.CV,
+		Match:   payload.Match,
+	})
+	return buff.Bytes(), err
+}
+
+// EncryptSecrets encrypts the signing secrets and secret header values set through the api with encryptionKey
+// Calls and headers without a new secret keep the secret of the call in previous with the same uri
+func (onMatch *ProfileOnMatch) EncryptSecrets(encryptionKey string, previous []ProfileHTTPCallData) error {
+	for idx := range onMatch.HTTPCall {
+		call := &onMatch.HTTPCall[idx]
+
+		var previousCall *ProfileHTTPCallData
+		for previousIdx := range previous {
+			if previous[previousIdx].URI == call.URI {
+				previousCall = &previous[previousIdx]
+				break
+			}
+		}
+
+		call.EncryptedSigningSecret = ""
+		call.Signed = false
+		if call.SigningSecret == nil {
+			if previousCall != nil && previousCall.EncryptedSigningSecret != "" {
+				call.EncryptedSigningSecret = previousCall.EncryptedSigningSecret
+				call.Signed = true
+			}
+		} else {
+			secret := *call.SigningSecret
+			call.SigningSecret = nil
+			if secret != "" {
+				if len(secret) < MinSigningSecretLength {
+					return fmt.Errorf("onMatch.httpCall[%d].signingSecret: must have a minimal length of %d chars", idx, MinSigningSecretLength)
+				}
+				encrypted, err := encryptHTTPCallSecret(secret, encryptionKey)
+				if err != nil {
+					return fmt.Errorf("onMatch.httpCall[%d].signingSecret: %s", idx, err.Error())
+				}
+				call.EncryptedSigningSecret = encrypted
+				call.Signed = true
+			}
+		}
+
+		for headerIdx := range call.Headers {
+			header := &call.Headers[headerIdx]
+			header.EncryptedValue = ""
+			header.Secret = false
+
+			if header.SecretValue == nil {
+				if header.Value == "" && previousCall != nil {
+					for _, previousHeader := range previousCall.Headers {
+						if previousHeader.Name == header.Name && previousHeader.EncryptedValue != "" {
+							header.EncryptedValue = previousHeader.EncryptedValue
+							header.Secret = true
+							break
+						}
+					}
+				}
+				continue
+			}
+
+			secret := *header.SecretValue
+			header.SecretValue = nil
+			if secret == "" {
+				continue
+			}
+			encrypted, err := encryptHTTPCallSecret(secret, encryptionKey)
+			if err != nil {
+				return fmt.Errorf("onMatch.httpCall[%d].headers[%d].secretValue: %s", idx, headerIdx, err.Error())
+			}
+			header.Value = ""
+			header.EncryptedValue = encrypted
+			header.Secret = true
+		}
+	}
+	return nil
+}
+
+func encryptHTTPCallSecret(secret, encryptionKey string) (string, error) {
+	if len(encryptionKey) < 16 {
+		return "", errors.New("secrets are not enabled on this server, WEBHOOK_SECRETS_KEY is not set")
+	}
+
+	data, err := crypto.Encrypt([]byte(secret), []byte(encryptionKey))
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+func decryptHTTPCallSecret(encrypted, encryptionKey string) ([]byte, error) {
+	if len(encryptionKey) < 16 {
+		return nil, errors.New("unable to decrypt secret, WEBHOOK_SECRETS_KEY is not set")
+	}
+
+	data, err := base64.URLEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Decrypt(data, []byte(encryptionKey))
+}
+
+// DecryptSigningSecret returns the signing secret of the call, returns nil if the requests should not be signed
+func (d *ProfileHTTPCallData) DecryptSigningSecret(encryptionKey string) ([]byte, error) {
+	if d.EncryptedSigningSecret == "" {
+		return nil, nil
+	}
+	return decryptHTTPCallSecret(d.EncryptedSigningSecret, encryptionKey)
+}
+
+// ProfileHTTPCallRequest is a request to the http address of a profile
+type ProfileHTTPCallRequest struct {
+	Method  string
+	URI     string
+	Body    []byte
+	Headers map[string]string
+}
+
+// NewRequest creates the request that sends payload to the http address
+// encryptionKey is used to decrypt the secret header values
+func (d *ProfileHTTPCallData) NewRequest(payload WebhookPayload, encryptionKey string) (*ProfileHTTPCallRequest, error) {
+	renderedPayload, err := d.RenderPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	return d.NewRequestWithPayload(renderedPayload, encryptionKey)
+}
+
+// NewRequestWithPayload creates the request that sends a payload rendered by RenderPayload to the http address
+// encryptionKey is used to decrypt the secret header values
+func (d *ProfileHTTPCallData) NewRequestWithPayload(renderedPayload []byte, encryptionKey string) (*ProfileHTTPCallRequest, error) {
+	var err error
+	req := &ProfileHTTPCallRequest{
+		Method:  d.GetMethod(),
+		URI:     d.URI,
+		Headers: map[string]string{},
+	}
+
+	if d.PayloadMode == ProfileHTTPCallPayloadModeQuery {
+		req.URI, err = addPayloadToQuery(d.URI, renderedPayload)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		req.Body = renderedPayload
+		req.Headers["Content-Type"] = "application/json"
+	}
+
+	for _, header := range d.Headers {
+		value := header.Value
+		if header.EncryptedValue != "" {
+			decrypted, err := decryptHTTPCallSecret(header.EncryptedValue, encryptionKey)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decrypt the value of header %s: %s", header.Name, err.Error())
+			}
+			value = string(decrypted)
+		}
+		req.Headers[header.Name] = value
+	}
+
+	return req, nil
+}
+
+// addPayloadToQuery adds the fields of the JSON object payload as query parameters to uri
+// String values are added as is, other values are added JSON encoded
+func addPayloadToQuery(uri string, payload []byte) (string, error) {
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(payload, &fields)
+	if err != nil {
+		return "", errors.New("the payload must be a JSON object in query mode")
+	}
+
+	parsedURI, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	query := parsedURI.Query()
+	for key, value := range fields {
+		var str string
+		if json.Unmarshal(value, &str) == nil {
+			query.Set(key, str)
+		} else {
+			query.Set(key, string(value))
+		}
+	}
+	parsedURI.RawQuery = query.Encode()
+	return parsedURI.String(), nil
+}
+
+// SignedContent returns the part of the request covered by the signature, the body or the query string if the request has no body
+func (r *ProfileHTTPCallRequest) SignedContent() []byte {
+	if r.Body != nil {
+		return r.Body
+	}
+
+	parsedURI, err := url.Parse(r.URI)
+	if err != nil {
+		return nil
+	}
+	return []byte(parsedURI.RawQuery)
+}
+
+// Do makes the request with the extra headers added
+// Returns the status code of the response, err is only set if no response was received
+func (r *ProfileHTTPCallRequest) Do(extraHeaders map[string]string, timeout time.Duration) (statusCode int, err error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(r.URI)
+	req.Header.SetMethod(r.Method)
+
+	for key, value := range r.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range extraHeaders {
+		req.Header.Set(key, value)
+	}
+	if r.Body != nil {
+		req.SetBody(r.Body)
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	err = fasthttp.DoTimeout(req, resp, timeout)
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode(), nil
+}
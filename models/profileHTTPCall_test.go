@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	. "github.com/stretchr/testify/assert"
+)
+
+const testingSecretsKey = "testing-webhook-secrets-key"
+
+func TestProfileHTTPCallDataValidate(t *testing.T) {
+	valid := []ProfileHTTPCallData{
+		{URI: "https://example.com"},
+		{URI: "https://example.com", Method: "POST", BodyTemplate: `{"name": {{json .CV.FullName}}, "profile": {{json .Profile.Name}}}`},
+		{URI: "https://example.com", PayloadMode: ProfileHTTPCallPayloadModeQuery},
+		{URI: "https://example.com", PayloadMode: ProfileHTTPCallPayloadModeQuery, BodyTemplate: `{"ref": {{json .Match.ReferenceNr}}}`},
+		{URI: "https://example.com", Headers: []ProfileHTTPCallHeader{{Name: "X-Api-Key", Value: "abc"}}},
+	}
+	for _, call := range valid {
+		NoError(t, call.Validate(), call)
+	}
+
+	secret := "abc"
+	invalid := map[string]ProfileHTTPCallData{
+		"uri":          {URI: "ftp://example.com"},
+		"method":       {URI: "https://example.com", Method: "CONNECT"},
+		"payloadMode":  {URI: "https://example.com", Method: "POST", PayloadMode: ProfileHTTPCallPayloadModeQuery},
+		"unknown mode": {URI: "https://example.com", PayloadMode: "form"},
+		"header name":  {URI: "https://example.com", Headers: []ProfileHTTPCallHeader{{Name: "X Api Key", Value: "abc"}}},
+		"header value": {URI: "https://example.com", Headers: []ProfileHTTPCallHeader{{Name: "X-Api-Key", Value: "abc\r\nHost: evil"}}},
+		"both values":  {URI: "https://example.com", Headers: []ProfileHTTPCallHeader{{Name: "X-Api-Key", Value: "abc", SecretValue: &secret}}},
+		"syntax error": {URI: "https://example.com", BodyTemplate: `{{.CV.Title`},
+		"unknown key":  {URI: "https://example.com", BodyTemplate: `{{.CV.DoesNotExist}}`},
+		"query object": {URI: "https://example.com", PayloadMode: ProfileHTTPCallPayloadModeQuery, BodyTemplate: `not json`},
+	}
+	for name, call := range invalid {
+		Error(t, call.Validate(), name)
+	}
+}
+
+func TestProfileHTTPCallDataNewRequest(t *testing.T) {
+	payload := WebhookPayload{
+		Profile: Profile{Name: "profile name"},
+		CV:      CV{ReferenceNumber: "123"},
+		Match:   Match{Score: 2},
+	}
+
+	// The default payload is the JSON encoded WebhookPayload
+	call := ProfileHTTPCallData{URI: "https://example.com/hook", Method: "POST"}
+	req, err := call.NewRequest(payload, "")
+	NoError(t, err)
+	Equal(t, "POST", req.Method)
+	Equal(t, "https://example.com/hook", req.URI)
+	Equal(t, "application/json", req.Headers["Content-Type"])
+	expectedBody, err := json.Marshal(payload)
+	NoError(t, err)
+	Equal(t, expectedBody, req.Body)
+	Equal(t, req.Body, req.SignedContent())
+
+	// Body templates and headers
+	call.BodyTemplate = `<match profile="{{.Profile.Name}}" ref="{{.CV.ReferenceNumber}}" score="{{.Match.Score}}"/>`
+	call.Headers = []ProfileHTTPCallHeader{{Name: "Content-Type", Value: "application/xml"}}
+	req, err = call.NewRequest(payload, "")
+	NoError(t, err)
+	Equal(t, `<match profile="profile name" ref="123" score="2"/>`, string(req.Body))
+	Equal(t, "application/xml", req.Headers["Content-Type"])
+
+	// Query mode
+	call = ProfileHTTPCallData{
+		URI:          "https://example.com/hook?token=abc",
+		PayloadMode:  ProfileHTTPCallPayloadModeQuery,
+		BodyTemplate: `{"ref": {{json .CV.ReferenceNumber}}, "score": {{.Match.Score}}}`,
+	}
+	req, err = call.NewRequest(payload, "")
+	NoError(t, err)
+	Nil(t, req.Body)
+	parsedURI, err := url.Parse(req.URI)
+	NoError(t, err)
+	Equal(t, url.Values{"token": {"abc"}, "ref": {"123"}, "score": {"2"}}, parsedURI.Query())
+	Equal(t, []byte(parsedURI.RawQuery), req.SignedContent())
+}
+
+func TestProfileOnMatchEncryptSecrets(t *testing.T) {
+	token := "Bearer secret-token"
+	newOnMatch := func() ProfileOnMatch {
+		return ProfileOnMatch{HTTPCall: []ProfileHTTPCallData{{
+			URI: "https://example.com",
+			Headers: []ProfileHTTPCallHeader{
+				{Name: "Authorization", SecretValue: &token},
+				{Name: "X-Source", Value: "rtcv"},
+			},
+		}}}
+	}
+
+	// Secrets cannot be set without a secrets key
+	onMatch := newOnMatch()
+	Error(t, onMatch.EncryptSecrets("", nil))
+
+	onMatch = newOnMatch()
+	NoError(t, onMatch.EncryptSecrets(testingSecretsKey, nil))
+	authHeader := onMatch.HTTPCall[0].Headers[0]
+	True(t, authHeader.Secret)
+	Nil(t, authHeader.SecretValue)
+	Empty(t, authHeader.Value)
+	NotEmpty(t, authHeader.EncryptedValue)
+	False(t, onMatch.HTTPCall[0].Headers[1].Secret)
+
+	req, err := onMatch.HTTPCall[0].NewRequest(WebhookPayload{}, testingSecretsKey)
+	NoError(t, err)
+	Equal(t, token, req.Headers["Authorization"])
+	Equal(t, "rtcv", req.Headers["X-Source"])
+
+	_, err = onMatch.HTTPCall[0].NewRequest(WebhookPayload{}, "another-webhook-secrets-key")
+	Error(t, err)
+
+	// Updating the call without a new secret value keeps the current secret
+	updated := ProfileOnMatch{HTTPCall: []ProfileHTTPCallData{{
+		URI:     "https://example.com",
+		Headers: []ProfileHTTPCallHeader{{Name: "Authorization"}},
+	}}}
+	NoError(t, updated.EncryptSecrets(testingSecretsKey, onMatch.HTTPCall))
+	True(t, updated.HTTPCall[0].Headers[0].Secret)
+	Equal(t, authHeader.EncryptedValue, updated.HTTPCall[0].Headers[0].EncryptedValue)
+
+	// Setting a plain value replaces the secret
+	updated.HTTPCall[0].Headers[0].Value = "Bearer public"
+	NoError(t, updated.EncryptSecrets(testingSecretsKey, onMatch.HTTPCall))
+	False(t, updated.HTTPCall[0].Headers[0].Secret)
+	Empty(t, updated.HTTPCall[0].Headers[0].EncryptedValue)
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/script-development/RT-CV/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ProfileSchedule is a part of a weekday in which a profile matches
+// The hours are in the timezone of the server
+type ProfileSchedule struct {
+	Weekday  time.Weekday `json:"weekday" description:"The day of the week, 0 (sunday) to 6 (saturday)"`
+	FromHour int          `json:"fromHour" bson:"fromHour" description:"The hour from which the profile matches, 0 to 23"`
+	ToHour   int          `json:"toHour" bson:"toHour" description:"The hour until which the profile matches, 1 to 24. Must be after fromHour"`
+}
+
+// Contains returns true if t is within the schedule
+func (s ProfileSchedule) Contains(t time.Time) bool {
+	return t.Weekday() == s.Weekday && t.Hour() >= s.FromHour && t.Hour() < s.ToHour
+}
+
+// String formats the schedule for usage in a reason or error
+func (s ProfileSchedule) String() string {
+	return fmt.Sprintf("%s %02d:00-%02d:00", s.Weekday, s.FromHour, s.ToHour)
+}
+
+// ActivePeriodContains returns true if t is within the activeFrom and activeUntil of the profile
+func (p *Profile) ActivePeriodContains(t time.Time) bool {
+	if p.ActiveFrom != nil && t.Before(p.ActiveFrom.Time()) {
+		return false
+	}
+	if p.ActiveUntil != nil && !t.Before(p.ActiveUntil.Time()) {
+		return false
+	}
+	return true
+}
+
+// ScheduleContains returns true if the profile has no schedule or t is within one of the schedules of the profile
+func (p *Profile) ScheduleContains(t time.Time) bool {
+	if len(p.Schedule) == 0 {
+		return true
+	}
+	for _, schedule := range p.Schedule {
+		if schedule.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateScheduleAndQuota validates the active period, schedule and match quota of a profile
+func (p *Profile) ValidateScheduleAndQuota() error {
+	if p.ActiveFrom != nil && p.ActiveUntil != nil && !p.ActiveUntil.Time().After(p.ActiveFrom.Time()) {
+		return errors.New("activeUntil: must be after activeFrom")
+	}
+	for idx, schedule := range p.Schedule {
+		if schedule.Weekday < time.Sunday || schedule.Weekday > time.Saturday {
+			return fmt.Errorf("schedule[%d].weekday: must be between 0 and 6", idx)
+		}
+		if schedule.FromHour < 0 || schedule.FromHour > 23 {
+			return fmt.Errorf("schedule[%d].fromHour: must be between 0 and 23", idx)
+		}
+		if schedule.ToHour <= schedule.FromHour || schedule.ToHour > 24 {
+			return fmt.Errorf("schedule[%d].toHour: must be after fromHour and at most 24", idx)
+		}
+	}
+	if p.MaxMatchesPerDay < 0 {
+		return errors.New("maxMatchesPerDay: cannot be negative")
+	}
+	if p.MaxMatchesPerWeek < 0 {
+		return errors.New("maxMatchesPerWeek: cannot be negative")
+	}
+	return nil
+}
+
+// HasMatchQuota returns true if the amount of matches of the profile is limited
+func (p *Profile) HasMatchQuota() bool {
+	return p.MaxMatchesPerDay > 0 || p.MaxMatchesPerWeek > 0
+}
+
+// startOfDay returns the start of the day of t
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the start of the monday of the week of t
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -daysSinceMonday)
+}
+
+// MatchQuotaReached returns true if the profile already has the maximum amount of matches of the day or week of now
+// Debug matches are not counted
+func (p *Profile) MatchQuotaReached(conn db.Connection, now time.Time) (bool, error) {
+	quotas := []struct {
+		max   int
+		since time.Time
+	}{
+		{p.MaxMatchesPerDay, startOfDay(now)},
+		{p.MaxMatchesPerWeek, startOfWeek(now)},
+	}
+	for _, quota := range quotas {
+		if quota.max <= 0 {
+			continue
+		}
+		count, err := CountMatchesOfProfileSince(conn, p.ID, quota.since)
+		if err != nil {
+			return false, err
+		}
+		if count >= uint64(quota.max) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ProfilesCacheInvalidator is implemented by the cache of the profiles used for matching
+// Invalidate is called after profiles are changed outside of the api
+type ProfilesCacheInvalidator interface {
+	Invalidate()
+}
+
+// DeactivateExpiredProfiles deactivates the active profiles of which the activeUntil has passed
+// If profiles are deactivated the profiles cache is invalidated
+// Returns the amount of deactivated profiles
+func DeactivateExpiredProfiles(conn db.Connection, profilesCache ProfilesCacheInvalidator, now time.Time) (int, error) {
+	profiles := []Profile{}
+	err := conn.Find(&Profile{}, &profiles, bson.M{
+		"active":      true,
+		"activeUntil": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deactivated := 0
+	defer func() {
+		if deactivated > 0 {
+			profilesCache.Invalidate()
+		}
+	}()
+
+	for idx := range profiles {
+		profiles[idx].Active = false
+		err = conn.UpdateByID(&profiles[idx])
+		if err != nil {
+			return deactivated, err
+		}
+		deactivated++
+	}
+	return deactivated, nil
+}
+
+// StartProfilesDeactivationSchedule periodically deactivates profiles of which the activeUntil has passed
+// The matcher itself also never matches these profiles, this makes sure they are also shown as inactive
+func StartProfilesDeactivationSchedule(conn db.Connection, profilesCache ProfilesCacheInvalidator) {
+	deactivate := func() {
+		count, err := DeactivateExpiredProfiles(conn, profilesCache, time.Now())
+		if err != nil {
+			log.WithError(err).Error("Failed to deactivate expired profiles")
+		} else if count > 0 {
+			log.WithField("count", count).Info("Deactivated expired profiles")
+		}
+	}
+
+	ticker := time.NewTicker(10 * time.Minute)
+	go func() {
+		deactivate()
+		for range ticker.C {
+			deactivate()
+		}
+	}()
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/db/testingdb"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	. "github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProfileScheduleContains(t *testing.T) {
+	// 2022-03-16 is a wednesday
+	wednesday := func(hour int) time.Time {
+		return time.Date(2022, time.March, 16, hour, 30, 0, 0, time.UTC)
+	}
+
+	profile := Profile{Schedule: []ProfileSchedule{
+		{Weekday: time.Wednesday, FromHour: 9, ToHour: 17},
+		{Weekday: time.Saturday, FromHour: 0, ToHour: 24},
+	}}
+	True(t, profile.ScheduleContains(wednesday(9)))
+	True(t, profile.ScheduleContains(wednesday(16)))
+	False(t, profile.ScheduleContains(wednesday(17)))
+	False(t, profile.ScheduleContains(wednesday(8)))
+	True(t, profile.ScheduleContains(wednesday(23).AddDate(0, 0, 3)))
+	False(t, profile.ScheduleContains(wednesday(12).AddDate(0, 0, 1)))
+
+	// No schedule means always
+	True(t, (&Profile{}).ScheduleContains(wednesday(3)))
+}
+
+func TestProfileActivePeriodContains(t *testing.T) {
+	now := time.Now()
+	profile := Profile{
+		ActiveFrom:  jsonHelpers.RFC3339Nano(now.Add(-time.Hour)).ToPtr(),
+		ActiveUntil: jsonHelpers.RFC3339Nano(now.Add(time.Hour)).ToPtr(),
+	}
+	True(t, profile.ActivePeriodContains(now))
+	False(t, profile.ActivePeriodContains(now.Add(-time.Hour*2)))
+	False(t, profile.ActivePeriodContains(now.Add(time.Hour)))
+}
+
+func TestValidateScheduleAndQuota(t *testing.T) {
+	NoError(t, (&Profile{Schedule: []ProfileSchedule{{Weekday: time.Monday, FromHour: 0, ToHour: 24}}}).ValidateScheduleAndQuota())
+	Error(t, (&Profile{Schedule: []ProfileSchedule{{Weekday: 7, FromHour: 9, ToHour: 17}}}).ValidateScheduleAndQuota())
+	Error(t, (&Profile{Schedule: []ProfileSchedule{{Weekday: time.Monday, FromHour: 17, ToHour: 9}}}).ValidateScheduleAndQuota())
+	Error(t, (&Profile{MaxMatchesPerDay: -1}).ValidateScheduleAndQuota())
+
+	now := time.Now()
+	Error(t, (&Profile{
+		ActiveFrom:  jsonHelpers.RFC3339Nano(now).ToPtr(),
+		ActiveUntil: jsonHelpers.RFC3339Nano(now.Add(-time.Hour)).ToPtr(),
+	}).ValidateScheduleAndQuota())
+}
+
+func TestStartOfWeek(t *testing.T) {
+	monday := time.Date(2022, time.March, 14, 0, 0, 0, 0, time.UTC)
+	Equal(t, monday, startOfWeek(time.Date(2022, time.March, 14, 12, 0, 0, 0, time.UTC)))
+	Equal(t, monday, startOfWeek(time.Date(2022, time.March, 20, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestMatchQuotaReached(t *testing.T) {
+	conn := testingdb.NewDB()
+	now := time.Now()
+	profile := Profile{M: db.NewM(), MaxMatchesPerDay: 2, MaxMatchesPerWeek: 3}
+
+	reached, err := profile.MatchQuotaReached(conn, now)
+	NoError(t, err)
+	False(t, reached)
+
+	// Debug matches and matches of other profiles are not counted
+	NoError(t, conn.Insert(
+		&Match{M: db.NewM(), ProfileID: profile.ID, When: jsonHelpers.RFC3339Nano(now), Debug: true},
+		&Match{M: db.NewM(), ProfileID: db.NewM().ID, When: jsonHelpers.RFC3339Nano(now)},
+		&Match{M: db.NewM(), ProfileID: profile.ID, When: jsonHelpers.RFC3339Nano(now)},
+	))
+	reached, err = profile.MatchQuotaReached(conn, now)
+	NoError(t, err)
+	False(t, reached)
+
+	NoError(t, conn.Insert(&Match{M: db.NewM(), ProfileID: profile.ID, When: jsonHelpers.RFC3339Nano(now)}))
+	reached, err = profile.MatchQuotaReached(conn, now)
+	NoError(t, err)
+	True(t, reached)
+
+	// The day quota is not reached tomorrow but the week quota might be
+	profile.MaxMatchesPerWeek = 0
+	reached, err = profile.MatchQuotaReached(conn, now.AddDate(0, 0, 1))
+	NoError(t, err)
+	False(t, reached)
+}
+
+func TestDeactivateExpiredProfiles(t *testing.T) {
+	conn := testingdb.NewDB()
+	now := time.Now()
+
+	expired := Profile{M: db.NewM(), Active: true, ActiveUntil: jsonHelpers.RFC3339Nano(now.Add(-time.Minute)).ToPtr()}
+	notExpired := Profile{M: db.NewM(), Active: true, ActiveUntil: jsonHelpers.RFC3339Nano(now.Add(time.Hour)).ToPtr()}
+	noEnd := Profile{M: db.NewM(), Active: true}
+	NoError(t, conn.Insert(&expired, &notExpired, &noEnd))
+
+	cache := &testProfilesCache{}
+	count, err := DeactivateExpiredProfiles(conn, cache, now)
+	NoError(t, err)
+	Equal(t, 1, count)
+	Equal(t, 1, cache.invalidated)
+
+	for _, profile := range []Profile{expired, notExpired, noEnd} {
+		profileFromDB, err := GetProfile(conn, profile.ID)
+		NoError(t, err)
+		Equal(t, profile.ID != expired.ID, profileFromDB.Active)
+	}
+
+	// Nothing changed so the cache should not be invalidated again
+	count, err = DeactivateExpiredProfiles(conn, cache, now)
+	NoError(t, err)
+	Equal(t, 0, count)
+	Equal(t, 1, cache.invalidated)
+}
+
+type testProfilesCache struct {
+	invalidated int
+}
+
+func (c *testProfilesCache) Invalidate() {
+	c.invalidated++
+}
+
+func TestProfileActivePeriodBSON(t *testing.T) {
+	// A profile without an active period should not get one after it's stored in the database
+	data, err := bson.Marshal(Profile{M: db.NewM()})
+	NoError(t, err)
+	profile := Profile{}
+	NoError(t, bson.Unmarshal(data, &profile))
+	Nil(t, profile.ActiveFrom)
+	Nil(t, profile.ActiveUntil)
+	True(t, profile.ActivePeriodContains(time.Now()))
+
+	activeUntil := jsonHelpers.RFC3339Nano(time.Date(2022, time.March, 16, 0, 0, 0, 0, time.UTC))
+	data, err = bson.Marshal(Profile{M: db.NewM(), ActiveUntil: &activeUntil})
+	NoError(t, err)
+	profile = Profile{}
+	NoError(t, bson.Unmarshal(data, &profile))
+	Nil(t, profile.ActiveFrom)
+	NotNil(t, profile.ActiveUntil)
+	True(t, activeUntil.Time().Equal(profile.ActiveUntil.Time()))
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/script-development/RT-CV/helpers/geo"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestValidateProfileZipRadiuses(t *testing.T) {
+	validZipRadiuses := [][]ProfileZipRadius{
+		{{Zipcode: 3511, RadiusKm: 10}},
+		{{Center: &geo.Coordinates{Lat: 52.1, Lng: 5.1}, RadiusKm: 10}},
+	}
+	for _, zipRadiuses := range validZipRadiuses {
+		NoError(t, ValidateProfileZipRadiuses(zipRadiuses))
+	}
+
+	invalidZipRadiuses := [][]ProfileZipRadius{
+		{{Zipcode: 3511}},
+		{{RadiusKm: 10}},
+		{{Zipcode: 999, RadiusKm: 10}},
+		// A dutch zipcode of which the coordinates are not known
+		{{Zipcode: 3584, RadiusKm: 10}},
+		{{Zipcode: 10000, RadiusKm: 10}},
+		{{Center: &geo.Coordinates{Lat: 91, Lng: 5.1}, RadiusKm: 10}},
+	}
+	for _, zipRadiuses := range invalidZipRadiuses {
+		Error(t, ValidateProfileZipRadiuses(zipRadiuses))
+	}
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/script-development/RT-CV/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SynonymKind tells to what kind of profile terms a synonym set applies
+type SynonymKind string
+
+const (
+	// SynonymKindProfession applies to the desiredProfessions and professionExperienced of a profile
+	SynonymKindProfession = SynonymKind("profession")
+	// SynonymKindEducation applies to the educations of a profile
+	SynonymKindEducation = SynonymKind("education")
+)
+
+// Valid returns whether k is a known synonym kind
+func (k SynonymKind) Valid() bool {
+	switch k {
+	case SynonymKindProfession, SynonymKindEducation:
+		return true
+	default:
+		return false
+	}
+}
+
+// SynonymSet contains terms that mean the same thing, for example "chauffeur" and "driver"
+//
+// A set can have a parent set to form a taxonomy where the parent is the broader term,
+// for example "vrachtwagenchauffeur" can have "chauffeur" as parent.
+// A profile term found in a set is expanded with all the terms of that set and all the terms of its child sets,
+// so a profile asking for a "chauffeur" also matches a "vrachtwagenchauffeur" but not the other way around
+type SynonymSet struct {
+	db.M     `bson:",inline"`
+	Kind     SynonymKind         `json:"kind" description:"To what kind of profile terms this set applies, profession or education"`
+	Terms    []string            `json:"terms" description:"The terms that mean the same thing"`
+	ParentID *primitive.ObjectID `json:"parentId" bson:"parentId" description:"The set with the broader term, must be of the same kind"`
+}
+
+// CollectionName returns the collection name of a synonym set
+func (*SynonymSet) CollectionName() string {
+	return "synonymSets"
+}
+
+// Indexes implements db.Entry
+func (*SynonymSet) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.M{"kind": 1}},
+		{Keys: bson.M{"parentId": 1}},
+	}
+}
+
+// GetSynonymSets returns all synonym sets
+func GetSynonymSets(conn db.Connection) ([]SynonymSet, error) {
+	sets := []SynonymSet{}
+	err := conn.Find(&SynonymSet{}, &sets, nil)
+	return sets, err
+}
+
+// GetSynonymSet returns a synonym set by id
+func GetSynonymSet(conn db.Connection, id primitive.ObjectID) (SynonymSet, error) {
+	set := SynonymSet{}
+	err := conn.FindOne(&set, bson.M{"_id": id})
+	return set, err
+}
+
+// GetSynonymIndex returns a synonym index of all synonym sets in the database
+func GetSynonymIndex(conn db.Connection) (*SynonymIndex, error) {
+	sets, err := GetSynonymSets(conn)
+	if err != nil {
+		return nil, err
+	}
+	return NewSynonymIndex(sets), nil
+}
+
+// Validate validates the synonym set
+// The other sets are used to validate the parent, they may include the set itself
+func (s SynonymSet) Validate(otherSets []SynonymSet) error {
+	if !s.Kind.Valid() {
+		return errors.New("kind: must be profession or education")
+	}
+	if len(s.Terms) == 0 {
+		return errors.New("terms: must contain at least one term")
+	}
+	for idx, term := range s.Terms {
+		if len(strings.TrimSpace(term)) == 0 {
+			return fmt.Errorf("terms[%d]: cannot be empty", idx)
+		}
+	}
+
+	if s.ParentID == nil {
+		return nil
+	}
+
+	setsByID := map[primitive.ObjectID]SynonymSet{}
+	for _, set := range otherSets {
+		setsByID[set.ID] = set
+	}
+	setsByID[s.ID] = s
+
+	parent, ok := setsByID[*s.ParentID]
+	if !ok {
+		return errors.New("parentId: set does not exist")
+	}
+	if parent.Kind != s.Kind {
+		return errors.New("parentId: parent must be of the same kind")
+	}
+
+	// Make sure the set is not its own ancestor
+	seen := map[primitive.ObjectID]bool{s.ID: true}
+	for current := parent; ; {
+		if seen[current.ID] {
+			return errors.New("parentId: set cannot be its own parent")
+		}
+		seen[current.ID] = true
+
+		if current.ParentID == nil {
+			return nil
+		}
+		current, ok = setsByID[*current.ParentID]
+		if !ok {
+			return nil
+		}
+	}
+}
+
+// normalizeSynonymTerm normalizes a term so terms that only differ in casing or surrounding spaces are equal
+func normalizeSynonymTerm(term string) string {
+	return strings.ToLower(strings.TrimSpace(term))
+}
+
+// SynonymIndex can be used to quickly find the aliases of a profile term
+type SynonymIndex struct {
+	// aliases contains for every kind and normalized term the aliases of that term
+	aliases map[SynonymKind]map[string][]string
+}
+
+// NewSynonymIndex creates a synonym index from the synonym sets
+func NewSynonymIndex(sets []SynonymSet) *SynonymIndex {
+	children := map[primitive.ObjectID][]SynonymSet{}
+	for _, set := range sets {
+		if set.ParentID != nil {
+			children[*set.ParentID] = append(children[*set.ParentID], set)
+		}
+	}
+
+	index := &SynonymIndex{aliases: map[SynonymKind]map[string][]string{}}
+	for _, set := range sets {
+		// Collect the terms of this set and all its child sets
+		terms := []string{}
+		seenSets := map[primitive.ObjectID]bool{}
+		toCheck := []SynonymSet{set}
+		for len(toCheck) > 0 {
+			current := toCheck[0]
+			toCheck = toCheck[1:]
+			if seenSets[current.ID] {
+				continue
+			}
+			seenSets[current.ID] = true
+			terms = append(terms, current.Terms...)
+			toCheck = append(toCheck, children[current.ID]...)
+		}
+
+		kindAliases, ok := index.aliases[set.Kind]
+		if !ok {
+			kindAliases = map[string][]string{}
+			index.aliases[set.Kind] = kindAliases
+		}
+		for _, term := range set.Terms {
+			normalizedTerm := normalizeSynonymTerm(term)
+			kindAliases[normalizedTerm] = appendUniqueSynonymTerms(kindAliases[normalizedTerm], normalizedTerm, terms)
+		}
+	}
+
+	return index
+}
+
+// appendUniqueSynonymTerms adds the terms to list if they are not yet in the list and are not equal to exclude
+func appendUniqueSynonymTerms(list []string, exclude string, terms []string) []string {
+	for _, term := range terms {
+		normalizedTerm := normalizeSynonymTerm(term)
+		if normalizedTerm == exclude {
+			continue
+		}
+		found := false
+		for _, entry := range list {
+			if normalizeSynonymTerm(entry) == normalizedTerm {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, term)
+		}
+	}
+	return list
+}
+
+// Aliases returns the aliases of a term, the term itself is not included
+func (i *SynonymIndex) Aliases(kind SynonymKind, term string) []string {
+	if i == nil {
+		return nil
+	}
+	return i.aliases[kind][normalizeSynonymTerm(term)]
+}
+
+// ExpandProfile sets the aliases of the professions and educations of the profile
+// The fuzzy matchers of the profile are reset, (*Profile).PrepareForMatching rebuilds them with the aliases
+func (i *SynonymIndex) ExpandProfile(p *Profile) {
+	for idx, profession := range p.DesiredProfessions {
+		p.DesiredProfessions[idx].Aliases = i.Aliases(SynonymKindProfession, profession.Name)
+	}
+	for idx, profession := range p.ProfessionExperienced {
+		p.ProfessionExperienced[idx].Aliases = i.Aliases(SynonymKindProfession, profession.Name)
+	}
+	for idx, education := range p.Educations {
+		p.Educations[idx].Aliases = i.Aliases(SynonymKindEducation, education.Name)
+	}
+
+	p.DesiredProfessionsFuzzyMatcher = nil
+	p.ProfessionExperiencedFuzzyMatcher = nil
+	p.EducationFuzzyMatcher = nil
+	p.preparedForMatching = false
+}
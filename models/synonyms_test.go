@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/script-development/RT-CV/db"
+	. "github.com/stretchr/testify/assert"
+)
+
+func TestSynonymIndex(t *testing.T) {
+	chauffeur := SynonymSet{M: db.NewM(), Kind: SynonymKindProfession, Terms: []string{"Chauffeur", "driver"}}
+	truckDriver := SynonymSet{
+		M:        db.NewM(),
+		Kind:     SynonymKindProfession,
+		Terms:    []string{"vrachtwagenchauffeur", "truck driver"},
+		ParentID: &chauffeur.ID,
+	}
+	nurse := SynonymSet{M: db.NewM(), Kind: SynonymKindEducation, Terms: []string{"Verpleegkunde", "nursing"}}
+
+	index := NewSynonymIndex([]SynonymSet{chauffeur, truckDriver, nurse})
+
+	// The broader term also gets the terms of the narrower terms
+	Equal(t, []string{"driver", "vrachtwagenchauffeur", "truck driver"}, index.Aliases(SynonymKindProfession, " chauffeur "))
+	// The narrower term does not get the broader terms
+	Equal(t, []string{"vrachtwagenchauffeur"}, index.Aliases(SynonymKindProfession, "truck driver"))
+
+	// The kind should match
+	Equal(t, []string{"nursing"}, index.Aliases(SynonymKindEducation, "verpleegkunde"))
+	Empty(t, index.Aliases(SynonymKindProfession, "verpleegkunde"))
+	Empty(t, index.Aliases(SynonymKindProfession, "bakker"))
+
+	profile := Profile{
+		DesiredProfessions: []ProfileProfession{{Name: "chauffeur"}},
+		Educations:         []ProfileEducation{{Name: "nursing"}},
+	}
+	clone, err := profile.Clone()
+	NoError(t, err)
+	index.ExpandProfile(&clone)
+	Equal(t, []string{"driver", "vrachtwagenchauffeur", "truck driver"}, clone.DesiredProfessions[0].Aliases)
+	Equal(t, []string{"Verpleegkunde"}, clone.Educations[0].Aliases)
+
+	// Expanding a clone should not change the original profile
+	Nil(t, profile.DesiredProfessions[0].Aliases)
+	Nil(t, profile.Educations[0].Aliases)
+}
+
+func TestSynonymSetValidate(t *testing.T) {
+	a := SynonymSet{M: db.NewM(), Kind: SynonymKindProfession, Terms: []string{"a"}}
+	b := SynonymSet{M: db.NewM(), Kind: SynonymKindProfession, Terms: []string{"b"}, ParentID: &a.ID}
+	NoError(t, a.Validate(nil))
+	NoError(t, b.Validate([]SynonymSet{a}))
+
+	// a cannot become the child of b as b is already the child of a
+	a.ParentID = &b.ID
+	Error(t, a.Validate([]SynonymSet{a, b}))
+}
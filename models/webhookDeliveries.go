@@ -0,0 +1,107 @@
+package models
+
+import (
+	"github.com/script-development/RT-CV/db"
+	"github.com/script-development/RT-CV/helpers/jsonHelpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WebhookPayload is the JSON body sent to the httpCall addresses of a profile when a match was made
+// The body template of a httpCall can be used to send a different body
+type WebhookPayload struct {
+	ProfileID primitive.ObjectID `json:"profileId"`
+	Match     Match              `json:"match"`
+	CV        CV                 `json:"cv"`
+	// Profile is only available in the body template
+	Profile Profile `json:"-"`
+}
+
+// WebhookDeliveryStatus is the status of a webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryStatusPending means the webhook is being delivered or waiting for a retry
+	WebhookDeliveryStatusPending WebhookDeliveryStatus = "pending"
+	// WebhookDeliveryStatusDelivered means the receiver responded with a non error status code
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryStatusFailed means the webhook could not be delivered
+	WebhookDeliveryStatusFailed WebhookDeliveryStatus = "failed"
+)
+
+// Valid returns true if the status is known
+func (s WebhookDeliveryStatus) Valid() bool {
+	switch s {
+	case WebhookDeliveryStatusPending, WebhookDeliveryStatusDelivered, WebhookDeliveryStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// WebhookDelivery is the log entry of a call to the httpCall address of a profile
+type WebhookDelivery struct {
+	db.M       `bson:",inline"`
+	ProfileID  primitive.ObjectID      `json:"profileId" bson:"profileId"`
+	MatchID    primitive.ObjectID      `json:"matchId" bson:"matchId"`
+	URI        string                  `json:"uri"`
+	Method     string                  `json:"method"`
+	Status     WebhookDeliveryStatus   `json:"status"`
+	Attempts   int                     `json:"attempts"`
+	StatusCode int                     `json:"statusCode" bson:"statusCode,omitempty" description:"the status code of the last response, 0 if no response was received"`
+	LastError  string                  `json:"lastError" bson:"lastError,omitempty"`
+	CreatedAt  jsonHelpers.RFC3339Nano `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  jsonHelpers.RFC3339Nano `json:"updatedAt" bson:"updatedAt"`
+
+	// Call and Payload are kept while the delivery is pending so it can be resumed after a restart of the server
+	// The payload contains the full CV so both are removed once the webhook is delivered or failed
+	//
+	// Call is the http call the webhook is sent to, its signing secret and secret header values stay encrypted
+	Call *ProfileHTTPCallData `json:"-" bson:"call,omitempty"`
+	// Payload is the payload of the request as rendered by (*ProfileHTTPCallData).RenderPayload
+	Payload []byte `json:"-" bson:"payload,omitempty"`
+}
+
+// CollectionName returns the collection name of the WebhookDelivery
+func (*WebhookDelivery) CollectionName() string {
+	return "webhookDeliveries"
+}
+
+// Indexes implements db.Entry
+func (*WebhookDelivery) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.M{"profileId": 1}},
+		{Keys: bson.M{"status": 1}},
+		{Keys: bson.M{"createdAt": -1}},
+	}
+}
+
+// GetWebhookDeliveries returns a page of the webhook deliveries, the newest first
+// If profileID is set only the deliveries of that profile are returned
+// If status is set only the deliveries with that status are returned
+func GetWebhookDeliveries(conn db.Connection, profileID *primitive.ObjectID, status *WebhookDeliveryStatus, page Page) ([]WebhookDelivery, error) {
+	filter := bson.M{}
+	if profileID != nil {
+		filter["profileId"] = *profileID
+	}
+	if status != nil {
+		filter["status"] = *status
+	}
+
+	deliveries := []WebhookDelivery{}
+	err := conn.Find(&WebhookDelivery{}, &deliveries, filter, page.findOptions(true))
+	return deliveries, err
+}
+
+// GetPendingWebhookDeliveries returns the webhook deliveries that are not yet delivered or failed, the oldest first
+func GetPendingWebhookDeliveries(conn db.Connection) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	err := conn.Find(
+		&WebhookDelivery{},
+		&deliveries,
+		bson.M{"status": WebhookDeliveryStatusPending},
+		Page{}.findOptions(false),
+	)
+	return deliveries, err
+}
@@ -83,6 +83,18 @@ class CV {
           LanguageLevel.reasonable,
         ),
       ],
+      competences: [
+        Competence(
+          "Klantvriendelijk",
+          description: "Altijd vriendelijk tegen klanten, ook als ze boos zijn",
+        ),
+        Competence("Stressbestendig"),
+      ],
+      interests: [
+        Interest("Muziek", description: "Speelt gitaar in een band"),
+      ],
+      personalPresentation:
+          "Ik ben een gedreven en enthousiaste kandidaat die graag nieuwe dingen leert",
     );
   }
 
@@ -111,6 +123,15 @@ class CV {
         ?.map((entry) => Language.fromJson(entry))
         ?.toList()
         ?.cast<Language>();
+    competences = json['competences']
+        ?.map((entry) => Competence.fromJson(entry))
+        ?.toList()
+        ?.cast<Competence>();
+    interests = json['interests']
+        ?.map((entry) => Interest.fromJson(entry))
+        ?.toList()
+        ?.cast<Interest>();
+    personalPresentation = json['personalPresentation'];
     personalDetails = PersonalDetails.fromJson(json['personalDetails']);
     driversLicenses = json['driversLicenses']?.cast<String>();
   }
@@ -124,6 +145,9 @@ class CV {
     this.workExperiences,
     this.preferredJobs,
     this.languages,
+    this.competences,
+    this.interests,
+    this.personalPresentation,
     required this.personalDetails,
     this.driversLicenses,
   });
@@ -136,6 +160,9 @@ class CV {
   late final List<WorkExperience>? workExperiences;
   late final List<String>? preferredJobs;
   late final List<Language>? languages;
+  late final List<Competence>? competences;
+  late final List<Interest>? interests;
+  late final String? personalPresentation;
   late final PersonalDetails personalDetails;
   late final List<String>? driversLicenses;
 }
@@ -262,17 +289,27 @@ class Language {
 }
 
 class Competence {
+  Competence.fromJson(Map<String, dynamic> json) {
+    name = json['name'];
+    description = json['description'];
+  }
+
   Competence(this.name, {this.description});
 
-  String name;
-  String? description;
+  late final String name;
+  late final String? description;
 }
 
 class Interest {
+  Interest.fromJson(Map<String, dynamic> json) {
+    name = json['name'];
+    description = json['description'];
+  }
+
   Interest(this.name, {this.description});
 
-  String name;
-  String? description;
+  late final String name;
+  late final String? description;
 }
 
 class PersonalDetails {
@@ -1,7 +1,9 @@
 import 'package:pdf/pdf.dart';
 import 'package:pdf/widgets.dart';
 
+import 'args.dart';
 import 'cv.dart';
+import 'layout.dart';
 import 'utils.dart';
 
 class ClientInfo extends StatelessWidget {
@@ -168,6 +170,72 @@ class EducationWidget extends StatelessWidget {
   }
 }
 
+class CompetenceWidget extends StatelessWidget {
+  CompetenceWidget(Competence this.competence);
+
+  final Competence competence;
+
+  @override
+  Widget build(Context context) {
+    return Padding(
+      padding: EdgeInsets.only(bottom: 10),
+      child: ListEntry(
+        competence.name,
+        description: competence.description,
+      ),
+    );
+  }
+}
+
+class InterestWidget extends StatelessWidget {
+  InterestWidget(Interest this.interest);
+
+  final Interest interest;
+
+  @override
+  Widget build(Context context) {
+    return Padding(
+      padding: EdgeInsets.only(bottom: 10),
+      child: ListEntry(
+        interest.name,
+        description: interest.description,
+      ),
+    );
+  }
+}
+
+class PersonalPresentationWidget extends StatelessWidget {
+  PersonalPresentationWidget(this.presentation, this.style);
+
+  final String presentation;
+  final Style style;
+
+  @override
+  Widget build(Context context) {
+    return Column(
+      crossAxisAlignment: CrossAxisAlignment.start,
+      children: [
+        ListTitle(
+          IconData(0xe7fd), // Person
+          "Persoonlijke presentatie",
+          style,
+        ),
+        Padding(
+          padding: const EdgeInsets.only(top: 5),
+          child: Text(
+            presentation,
+            style: TextStyle(
+              fontSize: 10,
+              color: PdfColors.grey800,
+              lineSpacing: 2,
+            ),
+          ),
+        ),
+      ],
+    );
+  }
+}
+
 class ListEntry extends StatelessWidget {
   ListEntry(
     this.title, {
@@ -80,6 +80,22 @@ Future<void> main(List<String> programArgs) async {
       cv.courses!.map((course) => EducationWidget(course)).toList(),
     ));
   }
+  if (cv.competences != null && cv.competences!.isNotEmpty) {
+    lists.add(ListWithHeader(
+      IconData(0xe838), // Star
+      "Competenties",
+      cv.competences!
+          .map((competence) => CompetenceWidget(competence))
+          .toList(),
+    ));
+  }
+  if (cv.interests != null && cv.interests!.isNotEmpty) {
+    lists.add(ListWithHeader(
+      IconData(0xe87d), // Favorite
+      "Interesses",
+      cv.interests!.map((interest) => InterestWidget(interest)).toList(),
+    ));
+  }
 
   // Determain the layout depending on the amound of items in the lists.
   List<WrapLayoutBlock> wrapLayoutBlocks = [];
@@ -124,6 +140,11 @@ Future<void> main(List<String> programArgs) async {
             driversLicenses: cv.driversLicenses,
           ),
         ),
+        if (cv.personalPresentation != null &&
+            cv.personalPresentation!.isNotEmpty)
+          LayoutBlockBase(
+            child: PersonalPresentationWidget(cv.personalPresentation!, style),
+          ),
         ColumnsLayoutBlock(remainingLists, style),
         ...wrapLayoutBlocks,
       ],